@@ -48,6 +48,20 @@ func (s *Ad) IsNotExit(err error) bool {
 	return false
 }
 
+// IsNotMember returns true if the member to be removed is not a member of the group
+func (s *Ad) IsNotMember(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	v, ok := err.(*AdError)
+	if !ok {
+		return false
+	}
+
+	return v.Code == AdErrorNotMember
+}
+
 func (s *Ad) GetEntry(filter *AdEntryFilter, objectClass string) (*AdEntry, error) {
 	conn, err := s.open(true)
 	if err != nil {
@@ -81,6 +95,36 @@ func (s *Ad) GetDnParent(v string) string {
 	return v[index+1:]
 }
 
+// MoveEntry moves the entry to the parent and returns the new distinguished name
+func (s *Ad) MoveEntry(dn, parentDN string) (string, error) {
+	if len(dn) < 1 {
+		return "", fmt.Errorf("dn is empty")
+	}
+	if len(parentDN) < 1 {
+		return "", fmt.Errorf("parent distinguished name is empty")
+	}
+
+	parent := s.GetDnParent(dn)
+	if len(parent) < 1 {
+		return "", fmt.Errorf("dn (%s) is invalid", dn)
+	}
+	rdn := strings.TrimSuffix(dn, ","+parent)
+
+	conn, err := s.open(true)
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+
+	modifyRequest := ldap.NewModifyDNRequest(dn, rdn, true, parentDN)
+	err = conn.ModifyDN(modifyRequest)
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("%s,%s", rdn, parentDN), nil
+}
+
 func (s *Ad) fmtExistError(format string, a ...interface{}) *AdError {
 	return &AdError{
 		Code:    AdErrorExist,
@@ -240,6 +284,7 @@ func (s *Ad) copyGroup(target *AdEntryGroup, source *ldap.Entry) {
 	target.Account = source.GetAttributeValue("sAMAccountName")
 	target.Description = source.GetAttributeValue("description")
 	target.Info = source.GetAttributeValue("info")
+	target.ManagedBy = source.GetAttributeValue("managedBy")
 }
 
 func (s *Ad) copyUser(target *AdEntryUser, source *ldap.Entry) {
@@ -253,4 +298,7 @@ func (s *Ad) copyUser(target *AdEntryUser, source *ldap.Entry) {
 	target.SID = s.decodeSID(source.GetRawAttributeValue("objectSid"))
 	target.Account = source.GetAttributeValue("sAMAccountName")
 	target.Dialing = source.GetAttributeValue("msNPAllowDialin")
+	target.Manager = source.GetAttributeValue("manager")
+	target.Mail = source.GetAttributeValue("mail")
+	target.PwdLastSet = source.GetAttributeValue("pwdLastSet")
 }
@@ -20,6 +20,9 @@ type AdEntryFilter struct {
 	ParentDN string   // msDS-parentdistname
 	Manager  string   // manager
 	Dialing  string   // msNPAllowDialin
+	Member   string   // member
+	MemberOf string   // memberOf
+	InChain  bool     // match member and memberOf in the nested chain (LDAP_MATCHING_RULE_IN_CHAIN)
 }
 
 func (s *AdEntryFilter) GetFilter(objectClass string) string {
@@ -33,6 +36,12 @@ func (s *AdEntryFilter) GetFilter(objectClass string) string {
 	if len(s.Manager) > 0 {
 		sb.WriteString(fmt.Sprintf("(manager=%s)", s.toFilterValue(s.Manager)))
 	}
+	if len(s.Member) > 0 {
+		sb.WriteString(fmt.Sprintf("(member%s=%s)", s.matchingRule(), s.toFilterValue(s.Member)))
+	}
+	if len(s.MemberOf) > 0 {
+		sb.WriteString(fmt.Sprintf("(memberOf%s=%s)", s.matchingRule(), s.toFilterValue(s.MemberOf)))
+	}
 	if len(s.Dialing) > 0 {
 		sb.WriteString(fmt.Sprintf("(msNPAllowDialin=%s)", s.toFilterValue(s.Dialing)))
 	}
@@ -65,6 +74,14 @@ func (s *AdEntryFilter) GetFilter(objectClass string) string {
 	return fmt.Sprintf("(&%s)", sb.String())
 }
 
+func (s *AdEntryFilter) matchingRule() string {
+	if s.InChain {
+		return ":1.2.840.113556.1.4.1941:"
+	}
+
+	return ""
+}
+
 func (s *AdEntryFilter) toFilterValue(v string) string {
 	/*
 		*   -> 2a
@@ -132,9 +149,12 @@ func (s *AdEntryUserControl) FromValue(value string) error {
 type AdEntryUser struct {
 	AdEntry
 
-	SID     string // objectSid
-	Account string // sAMAccountName
-	Dialing string // msNPAllowDialin
+	SID        string // objectSid
+	Account    string // sAMAccountName
+	Dialing    string // msNPAllowDialin
+	Manager    string // manager
+	Mail       string // mail
+	PwdLastSet string // pwdLastSet
 }
 
 // AdEntryUserDict map[sid]*AdEntryUser
@@ -162,4 +182,5 @@ type AdEntryGroup struct {
 	Account     string // sAMAccountName
 	Description string // description
 	Info        string // info
+	ManagedBy   string // managedBy
 }
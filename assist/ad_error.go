@@ -1,13 +1,15 @@
 package assist
 
 const (
-	AdErrorExist    = 1
-	AdErrorNotExist = 2
+	AdErrorExist     = 1
+	AdErrorNotExist  = 2
+	AdErrorNotMember = 3
 )
 
 var (
-	ErrExist    = &AdError{Code: AdErrorExist, Message: "has been exist"}
-	ErrNotExist = &AdError{Code: AdErrorNotExist, Message: "not exist"}
+	ErrExist     = &AdError{Code: AdErrorExist, Message: "has been exist"}
+	ErrNotExist  = &AdError{Code: AdErrorNotExist, Message: "not exist"}
+	ErrNotMember = &AdError{Code: AdErrorNotMember, Message: "not a member"}
 )
 
 type AdError struct {
@@ -37,6 +37,36 @@ func (s *Ad) GetGroup(dn string) (*AdEntryGroup, error) {
 	return s.getGroup(conn, &AdEntryFilter{DNs: []string{dn}})
 }
 
+func (s *Ad) GetGroupByAccount(account string) (*AdEntryGroup, error) {
+	if len(account) < 1 {
+		return nil, fmt.Errorf("account is empty")
+	}
+
+	conn, err := s.open(true)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	return s.getGroup(conn, &AdEntryFilter{Account: account})
+}
+
+// GetMemberGroups returns the groups which the user or group is member of,
+// the groups are resolved through the nested membership if nested is true
+func (s *Ad) GetMemberGroups(memberDN string, nested bool) ([]*AdEntryGroup, error) {
+	if len(memberDN) < 1 {
+		return nil, fmt.Errorf("member distinguished name is empty")
+	}
+
+	conn, err := s.open(true)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	return s.getGroups(conn, &AdEntryFilter{Member: memberDN, InChain: nested})
+}
+
 func (s *Ad) GetGroupsFromOrganizationUnit(ouDN string) ([]*AdEntryGroup, error) {
 	if len(ouDN) < 1 {
 		return nil, fmt.Errorf("ouDN is empty")
@@ -51,7 +81,7 @@ func (s *Ad) GetGroupsFromOrganizationUnit(ouDN string) ([]*AdEntryGroup, error)
 	filter := &AdEntryFilter{}
 	filter.ParentDN = ouDN
 	searchFilter := filter.GetFilter(AdClassGroup)
-	searchAttrs := []string{"name", "objectGUID", "objectSid", "sAMAccountName", "description", "info"}
+	searchAttrs := []string{"name", "objectGUID", "objectSid", "sAMAccountName", "description", "info", "managedBy"}
 	searchRequest := ldap.NewSearchRequest(
 		s.Base,
 		ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 0, 0, false,
@@ -164,7 +194,7 @@ func (s *Ad) getGroup(conn *ldap.Conn, filter *AdEntryFilter) (*AdEntryGroup, er
 	}
 
 	searchFilter := filter.GetFilter(AdClassGroup)
-	searchAttrs := []string{"name", "objectGUID", "objectSid", "sAMAccountName", "description", "info"}
+	searchAttrs := []string{"name", "objectGUID", "objectSid", "sAMAccountName", "description", "info", "managedBy"}
 	searchRequest := ldap.NewSearchRequest(
 		s.Base,
 		ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 0, 0, false,
@@ -187,6 +217,36 @@ func (s *Ad) getGroup(conn *ldap.Conn, filter *AdEntryFilter) (*AdEntryGroup, er
 	return result, nil
 }
 
+func (s *Ad) getGroups(conn *ldap.Conn, filter *AdEntryFilter) ([]*AdEntryGroup, error) {
+	if filter == nil {
+		return nil, fmt.Errorf("filter is nil")
+	}
+
+	searchFilter := filter.GetFilter(AdClassGroup)
+	searchAttrs := []string{"name", "objectGUID", "objectSid", "sAMAccountName", "description", "info", "managedBy"}
+	searchRequest := ldap.NewSearchRequest(
+		s.Base,
+		ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 0, 0, false,
+		searchFilter,
+		searchAttrs,
+		nil,
+	)
+	searchResult, err := conn.Search(searchRequest)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]*AdEntryGroup, 0)
+	for _, searchEntry := range searchResult.Entries {
+		result := &AdEntryGroup{}
+		s.copyGroup(result, searchEntry)
+
+		results = append(results, result)
+	}
+
+	return results, nil
+}
+
 func (s *Ad) addGroupMember(conn *ldap.Conn, groupDN, memberDN string) error {
 	if len(groupDN) < 1 {
 		return fmt.Errorf("group distinguished name is empty")
@@ -255,7 +315,7 @@ func (s *Ad) removeGroupMember(conn *ldap.Conn, groupDN, memberDN string) error
 		return err
 	}
 	if len(searchResult.Entries) < 1 {
-		return fmt.Errorf("group distinguished name (%s) not exist", groupDN)
+		return s.fmtError(AdErrorNotExist, "group distinguished name (%s) not exist", groupDN)
 	}
 
 	groupDn := ""
@@ -274,13 +334,19 @@ func (s *Ad) removeGroupMember(conn *ldap.Conn, groupDN, memberDN string) error
 
 		newMembers = append(newMembers, item)
 	}
+	if len(newMembers) == len(members) {
+		return s.fmtError(AdErrorNotMember, "(%s) is not a member of group (%s)", memberDN, groupDn)
+	}
 
-	members = append(members, memberDN)
 	modifyRequest := ldap.NewModifyRequest(groupDn, nil)
 	modifyRequest.Replace("member", newMembers)
 
 	err = conn.Modify(modifyRequest)
 	if err != nil {
+		le, ok := err.(*ldap.Error)
+		if ok && le.ResultCode == ldap.LDAPResultNoSuchObject {
+			return s.fmtError(AdErrorNotExist, "group distinguished name (%s) not exist", groupDn)
+		}
 		return err
 	}
 
@@ -333,3 +399,17 @@ func (s *Ad) isGroupMember(conn *ldap.Conn, groupAccount, memberAccount string)
 
 	return false, nil
 }
+
+func (s *Ad) DeleteGroup(dn string) error {
+	if len(dn) < 1 {
+		return fmt.Errorf("dn is empty")
+	}
+
+	conn, err := s.open(true)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	return s.deleteEntry(conn, dn)
+}
@@ -43,6 +43,21 @@ func (s *Ad) GetOrganizationUnit(dn string) (*AdEntryOrganizationUnit, error) {
 	return s.getOrganizationUnit(conn, &AdEntryFilter{DNs: []string{dn}})
 }
 
+// DeleteOrganizationUnit deletes the organization unit, it fails if the unit is not empty
+func (s *Ad) DeleteOrganizationUnit(dn string) error {
+	if len(dn) < 1 {
+		return fmt.Errorf("dn is empty")
+	}
+
+	conn, err := s.open(true)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	return s.deleteEntry(conn, dn)
+}
+
 func (s *Ad) getOrganizationUnits(conn *ldap.Conn, parentDN string) ([]*AdEntryOrganizationUnit, error) {
 	if len(parentDN) < 1 {
 		return nil, fmt.Errorf("parent distinguished name is empty")
@@ -32,7 +32,7 @@ func (s *Ad) GetAllUsers() (AdEntryUserDict, error) {
 	defer conn.Close()
 
 	searchFilter := fmt.Sprintf("(&(&(objectCategory=%s)(objectClass=%s)))", AdCategoryPerson, AdClassUser)
-	searchAttrs := []string{"name", "objectGUID", "objectSid", "sAMAccountName"}
+	searchAttrs := []string{"name", "objectGUID", "objectSid", "sAMAccountName", "mail"}
 	searchRequest := ldap.NewSearchRequest(
 		s.Base,
 		ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 0, 0, false,
@@ -114,6 +114,65 @@ func (s *Ad) GetUserSubordinates(account string) ([]*AdEntryUser, error) {
 	return s.getUsers(conn, &AdEntryFilter{Manager: user.DN})
 }
 
+func (s *Ad) GetUser(account string) (*AdEntryUser, error) {
+	if len(account) < 1 {
+		return nil, fmt.Errorf("帐号为空")
+	}
+	samAccount := s.toSamAccount(account)
+	if len(samAccount) < 1 {
+		return nil, fmt.Errorf("帐号(%s)无效", account)
+	}
+
+	conn, err := s.open(true)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	return s.getUser(conn, &AdEntryFilter{Account: samAccount})
+}
+
+func (s *Ad) GetUserByDN(dn string) (*AdEntryUser, error) {
+	if len(dn) < 1 {
+		return nil, fmt.Errorf("dn is empty")
+	}
+
+	conn, err := s.open(true)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	return s.getUser(conn, &AdEntryFilter{DNs: []string{dn}})
+}
+
+// GetUserManager returns the direct manager of the account, or ErrNotExist if no manager is set
+func (s *Ad) GetUserManager(account string) (*AdEntryUser, error) {
+	if len(account) < 1 {
+		return nil, fmt.Errorf("帐号为空")
+	}
+	samAccount := s.toSamAccount(account)
+	if len(samAccount) < 1 {
+		return nil, fmt.Errorf("帐号(%s)无效", account)
+	}
+
+	conn, err := s.open(true)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	user, err := s.getUser(conn, &AdEntryFilter{Account: samAccount})
+	if err != nil {
+		return nil, err
+	}
+	if len(user.Manager) < 1 {
+		return nil, ErrNotExist
+	}
+
+	return s.getUser(conn, &AdEntryFilter{DNs: []string{user.Manager}})
+}
+
 func (s *Ad) GetUsersFromGroup(groupDN string) ([]*AdEntryUser, error) {
 	if len(groupDN) < 1 {
 		return nil, fmt.Errorf("group name is empty")
@@ -128,6 +187,21 @@ func (s *Ad) GetUsersFromGroup(groupDN string) ([]*AdEntryUser, error) {
 	return s.getUsersFromGroup(conn, groupDN)
 }
 
+// GetNestedUsersFromGroup returns the users which are member of the group directly or through the nested groups
+func (s *Ad) GetNestedUsersFromGroup(groupDN string) ([]*AdEntryUser, error) {
+	if len(groupDN) < 1 {
+		return nil, fmt.Errorf("group name is empty")
+	}
+
+	conn, err := s.open(true)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	return s.getUsers(conn, &AdEntryFilter{MemberOf: groupDN, InChain: true})
+}
+
 func (s *Ad) NewUser(v *AdEntryUserCreate) (*AdEntryUser, error) {
 	if v == nil {
 		return nil, fmt.Errorf("parameter is nil")
@@ -219,15 +293,32 @@ func (s *Ad) NewUser(v *AdEntryUserCreate) (*AdEntryUser, error) {
 
 	_, err = s.setUserControl(conn, s.Base, &AdEntryFilter{DNs: []string{userDn}}, &AdEntryUserControl{DontExpirePassword: true})
 
+	// remove the new entry if it can not be read back, so that the caller never gets an orphan user without its entry
 	users, err = s.getUsers(conn, &AdEntryFilter{DNs: []string{userDn}})
 	if err != nil {
+		s.deleteEntry(conn, userDn)
 		return nil, err
 	}
-	if len(users) > 0 {
-		return users[0], nil
+	if len(users) < 1 {
+		s.deleteEntry(conn, userDn)
+		return nil, fmt.Errorf("新建用户(%s)后未找到该用户", v.Account)
 	}
 
-	return nil, nil
+	return users[0], nil
+}
+
+func (s *Ad) DeleteUser(dn string) error {
+	if len(dn) < 1 {
+		return fmt.Errorf("dn is empty")
+	}
+
+	conn, err := s.open(true)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	return s.deleteEntry(conn, dn)
 }
 
 func (s *Ad) SetUserPassword(account, password string) error {
@@ -316,6 +407,56 @@ func (s *Ad) SetUserVpnEnable(account string, enable bool) error {
 	return s.setUserVpnEnable(conn, user.DN, user.Dialing, enable)
 }
 
+func (s *Ad) SetUserEnable(account string, enable bool) error {
+	if len(account) < 1 {
+		return fmt.Errorf("帐号为空")
+	}
+	samAccount := s.toSamAccount(account)
+	if len(samAccount) < 1 {
+		return fmt.Errorf("帐号(%s)无效", account)
+	}
+
+	conn, err := s.open(true)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	filter := &AdEntryFilter{Account: samAccount}
+	control, err := s.getUserControl(conn, s.Base, filter)
+	if err != nil {
+		return err
+	}
+	control.Disable = !enable
+
+	_, err = s.setUserControl(conn, s.Base, filter, control)
+	return err
+}
+
+// GetUserEnable returns false if the account is disabled
+func (s *Ad) GetUserEnable(account string) (bool, error) {
+	if len(account) < 1 {
+		return false, fmt.Errorf("帐号为空")
+	}
+	samAccount := s.toSamAccount(account)
+	if len(samAccount) < 1 {
+		return false, fmt.Errorf("帐号(%s)无效", account)
+	}
+
+	conn, err := s.open(true)
+	if err != nil {
+		return false, err
+	}
+	defer conn.Close()
+
+	control, err := s.getUserControl(conn, s.Base, &AdEntryFilter{Account: samAccount})
+	if err != nil {
+		return false, err
+	}
+
+	return !control.Disable, nil
+}
+
 func (s *Ad) GetUserVpnEnable(account string) (bool, error) {
 	if len(account) < 1 {
 		return false, fmt.Errorf("帐号为空")
@@ -362,7 +503,7 @@ func (s *Ad) login(conn *ldap.Conn, account, password string) (*AdEntryUser, err
 	filter := &AdEntryFilter{}
 	filter.Account = samAccount
 	searchFilter := filter.GetFilter(AdClassUser)
-	searchAttrs := []string{"name", "objectGUID", "objectSid", "sAMAccountName"}
+	searchAttrs := []string{"name", "objectGUID", "objectSid", "sAMAccountName", "mail"}
 	searchRequest := ldap.NewSearchRequest(
 		s.Base,
 		ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 0, 0, false,
@@ -385,6 +526,7 @@ func (s *Ad) login(conn *ldap.Conn, account, password string) (*AdEntryUser, err
 	entry.DN = searchEntry.DN
 	entry.SID = s.decodeSID(searchEntry.GetRawAttributeValue("objectSid"))
 	entry.Account = searchEntry.GetAttributeValue("sAMAccountName")
+	entry.Mail = searchEntry.GetAttributeValue("mail")
 
 	ctrl, ce := s.getUserControl(conn, entry.DN, &AdEntryFilter{DNs: []string{entry.DN}})
 	if ce != nil {
@@ -413,7 +555,7 @@ func (s *Ad) getUsers(conn *ldap.Conn, filter *AdEntryFilter) ([]*AdEntryUser, e
 	}
 
 	searchFilter := filter.GetFilter(AdClassUser)
-	searchAttrs := []string{"name", "objectGUID", "objectSid", "sAMAccountName", "msNPAllowDialin"}
+	searchAttrs := []string{"name", "objectGUID", "objectSid", "sAMAccountName", "msNPAllowDialin", "manager", "mail", "pwdLastSet"}
 	base := filter.ParentDN
 	if len(base) < 1 {
 		base = s.Base
@@ -441,6 +583,22 @@ func (s *Ad) getUsers(conn *ldap.Conn, filter *AdEntryFilter) ([]*AdEntryUser, e
 	return results, nil
 }
 
+func (s *Ad) getUser(conn *ldap.Conn, filter *AdEntryFilter) (*AdEntryUser, error) {
+	users, err := s.getUsers(conn, filter)
+	if err != nil {
+		return nil, err
+	}
+	if len(users) < 1 {
+		return nil, ErrNotExist
+	}
+	user := users[0]
+	if user == nil {
+		return nil, ErrNotExist
+	}
+
+	return user, nil
+}
+
 func (s *Ad) getUsersFromGroup(conn *ldap.Conn, groupDN string) ([]*AdEntryUser, error) {
 	if len(groupDN) < 1 {
 		return nil, fmt.Errorf("group distinguished name is empty")
@@ -0,0 +1,370 @@
+package assist
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/md5"
+	"encoding/binary"
+	"fmt"
+)
+
+// RADIUS (RFC 2865, RFC 2866) packet codes
+const (
+	RadiusCodeAccessRequest      = 1
+	RadiusCodeAccessAccept       = 2
+	RadiusCodeAccessReject       = 3
+	RadiusCodeAccountingRequest  = 4
+	RadiusCodeAccountingResponse = 5
+)
+
+// RADIUS attribute types
+const (
+	RadiusAttrUserName             = 1
+	RadiusAttrUserPassword         = 2
+	RadiusAttrNasIpAddress         = 4
+	RadiusAttrNasPort              = 5
+	RadiusAttrFramedIpAddress      = 8
+	RadiusAttrReplyMessage         = 18
+	RadiusAttrVendorSpecific       = 26
+	RadiusAttrCallingStationId     = 31
+	RadiusAttrNasIdentifier        = 32
+	RadiusAttrAcctStatusType       = 40
+	RadiusAttrAcctInputOctets      = 42
+	RadiusAttrAcctOutputOctets     = 43
+	RadiusAttrAcctSessionId        = 44
+	RadiusAttrAcctSessionTime      = 46
+	RadiusAttrMessageAuthenticator = 80
+)
+
+// Microsoft vendor specific attributes (RFC 2548)
+const (
+	RadiusVendorMicrosoft = 311
+
+	RadiusMsChapError     = 2
+	RadiusMsChapChallenge = 11
+	RadiusMsChap2Response = 25
+)
+
+const (
+	radiusHeaderLength = 20
+	radiusMaxLength    = 4096
+)
+
+type RadiusAttribute struct {
+	Type  byte
+	Value []byte
+}
+
+type RadiusPacket struct {
+	Code          byte
+	Identifier    byte
+	Authenticator [16]byte
+	Attributes    []*RadiusAttribute
+}
+
+func ParseRadiusPacket(data []byte) (*RadiusPacket, error) {
+	if len(data) < radiusHeaderLength {
+		return nil, fmt.Errorf("packet too short")
+	}
+	length := int(binary.BigEndian.Uint16(data[2:4]))
+	if length < radiusHeaderLength || length > radiusMaxLength || length > len(data) {
+		return nil, fmt.Errorf("invalid packet length %d", length)
+	}
+
+	packet := &RadiusPacket{
+		Code:       data[0],
+		Identifier: data[1],
+		Attributes: make([]*RadiusAttribute, 0),
+	}
+	copy(packet.Authenticator[:], data[4:20])
+
+	attrs := data[radiusHeaderLength:length]
+	for len(attrs) > 0 {
+		if len(attrs) < 2 {
+			return nil, fmt.Errorf("invalid attribute")
+		}
+		size := int(attrs[1])
+		if size < 2 || size > len(attrs) {
+			return nil, fmt.Errorf("invalid attribute length %d", size)
+		}
+		value := make([]byte, size-2)
+		copy(value, attrs[2:size])
+		packet.Attributes = append(packet.Attributes, &RadiusAttribute{Type: attrs[0], Value: value})
+		attrs = attrs[size:]
+	}
+
+	return packet, nil
+}
+
+// Encode returns the wire format of the packet with the current authenticator
+func (s *RadiusPacket) Encode() ([]byte, error) {
+	buf := &bytes.Buffer{}
+	buf.Write([]byte{s.Code, s.Identifier, 0, 0})
+	buf.Write(s.Authenticator[:])
+	for _, attr := range s.Attributes {
+		if len(attr.Value) > 253 {
+			return nil, fmt.Errorf("value of attribute %d too long", attr.Type)
+		}
+		buf.WriteByte(attr.Type)
+		buf.WriteByte(byte(len(attr.Value) + 2))
+		buf.Write(attr.Value)
+	}
+
+	data := buf.Bytes()
+	if len(data) > radiusMaxLength {
+		return nil, fmt.Errorf("packet too long")
+	}
+	binary.BigEndian.PutUint16(data[2:4], uint16(len(data)))
+
+	return data, nil
+}
+
+func (s *RadiusPacket) GetAttribute(t byte) []byte {
+	for _, attr := range s.Attributes {
+		if attr.Type == t {
+			return attr.Value
+		}
+	}
+
+	return nil
+}
+
+func (s *RadiusPacket) GetString(t byte) string {
+	return string(s.GetAttribute(t))
+}
+
+// GetInteger returns the value of a 32-bit integer attribute, 0 if not present
+func (s *RadiusPacket) GetInteger(t byte) uint32 {
+	v := s.GetAttribute(t)
+	if len(v) != 4 {
+		return 0
+	}
+
+	return binary.BigEndian.Uint32(v)
+}
+
+func (s *RadiusPacket) GetVendorAttribute(vendor uint32, t byte) []byte {
+	for _, attr := range s.Attributes {
+		if attr.Type != RadiusAttrVendorSpecific || len(attr.Value) < 6 {
+			continue
+		}
+		if binary.BigEndian.Uint32(attr.Value[0:4]) != vendor {
+			continue
+		}
+
+		sub := attr.Value[4:]
+		for len(sub) >= 2 {
+			size := int(sub[1])
+			if size < 2 || size > len(sub) {
+				break
+			}
+			if sub[0] == t {
+				return sub[2:size]
+			}
+			sub = sub[size:]
+		}
+	}
+
+	return nil
+}
+
+func (s *RadiusPacket) AddAttribute(t byte, value []byte) {
+	s.Attributes = append(s.Attributes, &RadiusAttribute{Type: t, Value: value})
+}
+
+func (s *RadiusPacket) AddString(t byte, value string) {
+	s.AddAttribute(t, []byte(value))
+}
+
+func (s *RadiusPacket) AddVendorAttribute(vendor uint32, t byte, value []byte) {
+	v := make([]byte, 6, 6+len(value))
+	binary.BigEndian.PutUint32(v[0:4], vendor)
+	v[4] = t
+	v[5] = byte(len(value) + 2)
+	v = append(v, value...)
+	s.AddAttribute(RadiusAttrVendorSpecific, v)
+}
+
+// NewResponse creates the reply of the request which has the same identifier
+func (s *RadiusPacket) NewResponse(code byte) *RadiusPacket {
+	return &RadiusPacket{
+		Code:       code,
+		Identifier: s.Identifier,
+		Attributes: make([]*RadiusAttribute, 0),
+	}
+}
+
+// EncodeResponse signs the response with the authenticator of the request,
+// the Message-Authenticator (RFC 3579, 3.2) is computed too if the attribute is added
+func (s *RadiusPacket) EncodeResponse(request *RadiusPacket, secret string) ([]byte, error) {
+	s.Authenticator = request.Authenticator
+	err := s.signMessageAuthenticator(secret)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := s.Encode()
+	if err != nil {
+		return nil, err
+	}
+
+	hash := md5.New()
+	hash.Write(data)
+	hash.Write([]byte(secret))
+	copy(data[4:20], hash.Sum(nil))
+	copy(s.Authenticator[:], data[4:20])
+
+	return data, nil
+}
+
+// EncodeRequest computes the authenticator of an Accounting-Request (RFC 2866, 3) or the Message-Authenticator
+// of an Access-Request if the attribute is added, the random authenticator of an Access-Request must be set before
+func (s *RadiusPacket) EncodeRequest(secret string) ([]byte, error) {
+	if s.Code == RadiusCodeAccountingRequest {
+		s.Authenticator = [16]byte{}
+		data, err := s.Encode()
+		if err != nil {
+			return nil, err
+		}
+		hash := md5.New()
+		hash.Write(data)
+		hash.Write([]byte(secret))
+		copy(data[4:20], hash.Sum(nil))
+		copy(s.Authenticator[:], data[4:20])
+		return data, nil
+	}
+
+	err := s.signMessageAuthenticator(secret)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.Encode()
+}
+
+// VerifyAccounting checks the authenticator of an Accounting-Request (RFC 2866, 3)
+func (s *RadiusPacket) VerifyAccounting(secret string) bool {
+	authenticator := s.Authenticator
+	s.Authenticator = [16]byte{}
+	data, err := s.Encode()
+	s.Authenticator = authenticator
+	if err != nil {
+		return false
+	}
+
+	hash := md5.New()
+	hash.Write(data)
+	hash.Write([]byte(secret))
+
+	return hmac.Equal(hash.Sum(nil), authenticator[:])
+}
+
+// VerifyMessageAuthenticator checks the Message-Authenticator of an Access-Request,
+// it returns false if the attribute is not present
+func (s *RadiusPacket) VerifyMessageAuthenticator(secret string) bool {
+	index := -1
+	for i, attr := range s.Attributes {
+		if attr.Type == RadiusAttrMessageAuthenticator {
+			index = i
+			break
+		}
+	}
+	if index < 0 || len(s.Attributes[index].Value) != md5.Size {
+		return false
+	}
+
+	value := s.Attributes[index].Value
+	s.Attributes[index].Value = make([]byte, md5.Size)
+	data, err := s.Encode()
+	s.Attributes[index].Value = value
+	if err != nil {
+		return false
+	}
+
+	mac := hmac.New(md5.New, []byte(secret))
+	mac.Write(data)
+
+	return hmac.Equal(mac.Sum(nil), value)
+}
+
+func (s *RadiusPacket) signMessageAuthenticator(secret string) error {
+	var attr *RadiusAttribute
+	for _, item := range s.Attributes {
+		if item.Type == RadiusAttrMessageAuthenticator {
+			attr = item
+			break
+		}
+	}
+	if attr == nil {
+		return nil
+	}
+	attr.Value = make([]byte, md5.Size)
+
+	data, err := s.Encode()
+	if err != nil {
+		return err
+	}
+	mac := hmac.New(md5.New, []byte(secret))
+	mac.Write(data)
+	attr.Value = mac.Sum(nil)
+
+	return nil
+}
+
+// AddMessageAuthenticator adds the attribute which is computed when the packet is encoded
+func (s *RadiusPacket) AddMessageAuthenticator() {
+	s.AddAttribute(RadiusAttrMessageAuthenticator, make([]byte, md5.Size))
+}
+
+// DecodeUserPassword decrypts the User-Password attribute (RFC 2865, 5.2)
+func (s *RadiusPacket) DecodeUserPassword(secret string) (string, error) {
+	value := s.GetAttribute(RadiusAttrUserPassword)
+	if len(value) < 16 || len(value) > 128 || len(value)%16 != 0 {
+		return "", fmt.Errorf("invalid User-Password")
+	}
+
+	result := make([]byte, len(value))
+	last := s.Authenticator[:]
+	for i := 0; i < len(value); i += 16 {
+		hash := md5.New()
+		hash.Write([]byte(secret))
+		hash.Write(last)
+		b := hash.Sum(nil)
+		for j := 0; j < 16; j++ {
+			result[i+j] = value[i+j] ^ b[j]
+		}
+		last = value[i : i+16]
+	}
+
+	return string(bytes.TrimRight(result, "\x00")), nil
+}
+
+// EncodeUserPassword encrypts the password and sets it as the User-Password attribute,
+// the authenticator must be set before
+func (s *RadiusPacket) EncodeUserPassword(password, secret string) error {
+	if len(password) > 128 {
+		return fmt.Errorf("password too long")
+	}
+	size := (len(password) + 15) / 16 * 16
+	if size == 0 {
+		size = 16
+	}
+	plain := make([]byte, size)
+	copy(plain, password)
+
+	result := make([]byte, size)
+	last := s.Authenticator[:]
+	for i := 0; i < size; i += 16 {
+		hash := md5.New()
+		hash.Write([]byte(secret))
+		hash.Write(last)
+		b := hash.Sum(nil)
+		for j := 0; j < 16; j++ {
+			result[i+j] = plain[i+j] ^ b[j]
+		}
+		last = result[i : i+16]
+	}
+	s.AddAttribute(RadiusAttrUserPassword, result)
+
+	return nil
+}
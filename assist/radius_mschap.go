@@ -0,0 +1,209 @@
+package assist
+
+import (
+	"bytes"
+	"crypto/des"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/binary"
+	"fmt"
+	"golang.org/x/crypto/md4"
+	"strings"
+	"unicode/utf16"
+)
+
+// Microsoft vendor specific attributes of MS-CHAPv2 and MPPE (RFC 2548)
+const (
+	RadiusMsMppeEncryptionPolicy = 7
+	RadiusMsMppeEncryptionTypes  = 8
+	RadiusMsMppeSendKey          = 16
+	RadiusMsMppeRecvKey          = 17
+	RadiusMsChap2Success         = 26
+)
+
+// MS-CHAP2-Response (RFC 2548, 2.3.2): ident(1) + flags(1) + peer challenge(16) + reserved(8) + response(24)
+const (
+	msChap2ResponseLength = 50
+	msChap2ChallengeSize  = 16
+)
+
+var (
+	msChap2Magic1 = []byte("Magic server to client signing constant")
+	msChap2Magic2 = []byte("Pad to make it do more than one iteration")
+
+	mppeMagic1 = []byte("This is the MPPE Master Key")
+	mppeMagic2 = []byte("On the client side, this is the send key; on the server side, it is the receive key.")
+	mppeMagic3 = []byte("On the client side, this is the receive key; on the server side, it is the send key.")
+)
+
+// MsChap2Response is the MS-CHAP2-Response attribute of an Access-Request
+type MsChap2Response struct {
+	Ident         byte
+	PeerChallenge []byte
+	NtResponse    []byte
+}
+
+// GetMsChap2 returns the MS-CHAP-Challenge and MS-CHAP2-Response of the request
+func (s *RadiusPacket) GetMsChap2() ([]byte, *MsChap2Response, error) {
+	challenge := s.GetVendorAttribute(RadiusVendorMicrosoft, RadiusMsChapChallenge)
+	if len(challenge) != msChap2ChallengeSize {
+		return nil, nil, fmt.Errorf("invalid MS-CHAP-Challenge")
+	}
+	value := s.GetVendorAttribute(RadiusVendorMicrosoft, RadiusMsChap2Response)
+	if len(value) != msChap2ResponseLength {
+		return nil, nil, fmt.Errorf("invalid MS-CHAP2-Response")
+	}
+
+	response := &MsChap2Response{
+		Ident:         value[0],
+		PeerChallenge: value[2:18],
+		NtResponse:    value[26:50],
+	}
+
+	return challenge, response, nil
+}
+
+// AddMppeKey encrypts the MS-MPPE-Send-Key or MS-MPPE-Recv-Key (RFC 2548, 2.4.2) with the secret
+// and the authenticator of the request
+func (s *RadiusPacket) AddMppeKey(t byte, key []byte, secret string, request *RadiusPacket) error {
+	salt := make([]byte, 2)
+	_, err := rand.Read(salt)
+	if err != nil {
+		return err
+	}
+	salt[0] |= 0x80
+
+	size := (len(key) + 1 + 15) / 16 * 16
+	plain := make([]byte, size)
+	plain[0] = byte(len(key))
+	copy(plain[1:], key)
+
+	result := make([]byte, 0, 2+size)
+	result = append(result, salt...)
+	last := append(request.Authenticator[:], salt...)
+	for i := 0; i < size; i += 16 {
+		hash := md5.New()
+		hash.Write([]byte(secret))
+		hash.Write(last)
+		b := hash.Sum(nil)
+		for j := 0; j < 16; j++ {
+			b[j] ^= plain[i+j]
+		}
+		result = append(result, b...)
+		last = b
+	}
+	s.AddVendorAttribute(RadiusVendorMicrosoft, t, result)
+
+	return nil
+}
+
+// MsChap2NtPasswordHash returns the MD4 of the UTF-16LE password (RFC 2759, 8.3)
+func MsChap2NtPasswordHash(password string) []byte {
+	codes := utf16.Encode([]rune(password))
+	data := make([]byte, 2*len(codes))
+	for i, code := range codes {
+		binary.LittleEndian.PutUint16(data[2*i:], code)
+	}
+
+	hash := md4.New()
+	hash.Write(data)
+
+	return hash.Sum(nil)
+}
+
+// MsChap2NtResponse returns the expected NT-Response of the peer (RFC 2759, 8.1)
+func MsChap2NtResponse(authChallenge, peerChallenge []byte, userName string, ntHash []byte) []byte {
+	challenge := msChap2ChallengeHash(peerChallenge, authChallenge, userName)
+
+	zHash := make([]byte, 21)
+	copy(zHash, ntHash)
+	response := make([]byte, 0, 24)
+	for i := 0; i < 3; i++ {
+		response = append(response, msChap2DesEncrypt(challenge, zHash[7*i:7*i+7])...)
+	}
+
+	return response
+}
+
+// MsChap2AuthenticatorResponse returns the "S=" string of MS-CHAP2-Success which proves
+// the server knows the password (RFC 2759, 8.7)
+func MsChap2AuthenticatorResponse(authChallenge, peerChallenge, ntResponse []byte, userName string, ntHash []byte) string {
+	hashHash := md4.New()
+	hashHash.Write(ntHash)
+
+	digest := sha1.New()
+	digest.Write(hashHash.Sum(nil))
+	digest.Write(ntResponse)
+	digest.Write(msChap2Magic1)
+	value := digest.Sum(nil)
+
+	digest = sha1.New()
+	digest.Write(value)
+	digest.Write(msChap2ChallengeHash(peerChallenge, authChallenge, userName))
+	digest.Write(msChap2Magic2)
+
+	return fmt.Sprintf("S=%X", digest.Sum(nil))
+}
+
+// MsChap2MppeKeys returns the 128-bit MPPE send and receive keys of the server (RFC 3079, 3.3)
+func MsChap2MppeKeys(ntHash, ntResponse []byte) ([]byte, []byte) {
+	hashHash := md4.New()
+	hashHash.Write(ntHash)
+
+	digest := sha1.New()
+	digest.Write(hashHash.Sum(nil))
+	digest.Write(ntResponse)
+	digest.Write(mppeMagic1)
+	masterKey := digest.Sum(nil)[:16]
+
+	return mppeStartKey(masterKey, mppeMagic3), mppeStartKey(masterKey, mppeMagic2)
+}
+
+// MsChap2UserName returns the user name used in the challenge hash, the domain (DOMAIN\user) is removed
+func MsChap2UserName(userName string) string {
+	index := strings.LastIndex(userName, "\\")
+	if index >= 0 {
+		return userName[index+1:]
+	}
+
+	return userName
+}
+
+func msChap2ChallengeHash(peerChallenge, authChallenge []byte, userName string) []byte {
+	digest := sha1.New()
+	digest.Write(peerChallenge)
+	digest.Write(authChallenge)
+	digest.Write([]byte(MsChap2UserName(userName)))
+
+	return digest.Sum(nil)[:8]
+}
+
+// msChap2DesEncrypt encrypts the 8 bytes clear text with the 7 bytes key, a parity bit is inserted after every 7 bits
+func msChap2DesEncrypt(clear, key []byte) []byte {
+	k := make([]byte, 8)
+	k[0] = key[0]
+	k[1] = key[0]<<7 | key[1]>>1
+	k[2] = key[1]<<6 | key[2]>>2
+	k[3] = key[2]<<5 | key[3]>>3
+	k[4] = key[3]<<4 | key[4]>>4
+	k[5] = key[4]<<3 | key[5]>>5
+	k[6] = key[5]<<2 | key[6]>>6
+	k[7] = key[6] << 1
+
+	block, _ := des.NewCipher(k)
+	result := make([]byte, 8)
+	block.Encrypt(result, clear[:8])
+
+	return result
+}
+
+func mppeStartKey(masterKey, magic []byte) []byte {
+	digest := sha1.New()
+	digest.Write(masterKey)
+	digest.Write(bytes.Repeat([]byte{0x00}, 40))
+	digest.Write(magic)
+	digest.Write(bytes.Repeat([]byte{0xf2}, 40))
+
+	return digest.Sum(nil)[:16]
+}
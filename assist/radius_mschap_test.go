@@ -0,0 +1,120 @@
+package assist
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/hex"
+	"testing"
+)
+
+// test vectors of RFC 2759, 9.2 and RFC 3079, 3.5.3
+const (
+	msChap2TestUserName      = "User"
+	msChap2TestPassword      = "clientPass"
+	msChap2TestAuthChallenge = "5B5D7C7D7B3F2F3E3C2C602132262628"
+	msChap2TestPeerChallenge = "21402324255E262A28295F2B3A337C7E"
+	msChap2TestNtHash        = "44EBBA8D5312B8D611474411F56989AE"
+	msChap2TestNtResponse    = "82309ECD8D708B5EA08FAA3981CD83544233114A3D85D6DF"
+	msChap2TestSuccess       = "S=407A5589115FD0D6209F510FE9C04566932CDA56"
+	msChap2TestSendKey       = "8B7CDC149B993A1BA118CB153F56DCCB"
+)
+
+func msChap2TestBytes(t *testing.T, value string) []byte {
+	data, err := hex.DecodeString(value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestMsChap2_RFC2759(t *testing.T) {
+	authChallenge := msChap2TestBytes(t, msChap2TestAuthChallenge)
+	peerChallenge := msChap2TestBytes(t, msChap2TestPeerChallenge)
+
+	ntHash := MsChap2NtPasswordHash(msChap2TestPassword)
+	if expect := msChap2TestBytes(t, msChap2TestNtHash); !bytes.Equal(ntHash, expect) {
+		t.Fatalf("NtPasswordHash: expect %x, actual %x", expect, ntHash)
+	}
+
+	ntResponse := MsChap2NtResponse(authChallenge, peerChallenge, msChap2TestUserName, ntHash)
+	if expect := msChap2TestBytes(t, msChap2TestNtResponse); !bytes.Equal(ntResponse, expect) {
+		t.Fatalf("NT-Response: expect %x, actual %x", expect, ntResponse)
+	}
+	domainResponse := MsChap2NtResponse(authChallenge, peerChallenge, "CORP\\"+msChap2TestUserName, ntHash)
+	if !bytes.Equal(domainResponse, ntResponse) {
+		t.Fatal("the domain should be removed from the user name")
+	}
+
+	success := MsChap2AuthenticatorResponse(authChallenge, peerChallenge, ntResponse, msChap2TestUserName, ntHash)
+	if success != msChap2TestSuccess {
+		t.Fatalf("AuthenticatorResponse: expect %s, actual %s", msChap2TestSuccess, success)
+	}
+
+	sendKey, recvKey := MsChap2MppeKeys(ntHash, ntResponse)
+	if expect := msChap2TestBytes(t, msChap2TestSendKey); !bytes.Equal(sendKey, expect) {
+		t.Fatalf("SendStartKey128: expect %x, actual %x", expect, sendKey)
+	}
+	if bytes.Equal(sendKey, recvKey) {
+		t.Fatal("send and receive keys should differ")
+	}
+}
+
+func TestRadiusPacket_MsChap2(t *testing.T) {
+	request := &RadiusPacket{Code: RadiusCodeAccessRequest, Identifier: 4}
+	copy(request.Authenticator[:], "0123456789abcdef")
+	request.AddString(RadiusAttrUserName, msChap2TestUserName)
+	request.AddVendorAttribute(RadiusVendorMicrosoft, RadiusMsChapChallenge, msChap2TestBytes(t, msChap2TestAuthChallenge))
+	value := []byte{7, 0}
+	value = append(value, msChap2TestBytes(t, msChap2TestPeerChallenge)...)
+	value = append(value, make([]byte, 8)...)
+	value = append(value, msChap2TestBytes(t, msChap2TestNtResponse)...)
+	request.AddVendorAttribute(RadiusVendorMicrosoft, RadiusMsChap2Response, value)
+
+	challenge, response, err := request.GetMsChap2()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response.Ident != 7 || !bytes.Equal(challenge, msChap2TestBytes(t, msChap2TestAuthChallenge)) ||
+		!bytes.Equal(response.PeerChallenge, msChap2TestBytes(t, msChap2TestPeerChallenge)) ||
+		!bytes.Equal(response.NtResponse, msChap2TestBytes(t, msChap2TestNtResponse)) {
+		t.Fatalf("unexpected MS-CHAPv2 attributes: %x %+v", challenge, response)
+	}
+
+	empty := &RadiusPacket{Code: RadiusCodeAccessRequest}
+	if _, _, err = empty.GetMsChap2(); err == nil {
+		t.Fatal("MS-CHAPv2 attributes should be required")
+	}
+}
+
+func TestRadiusPacket_MppeKey(t *testing.T) {
+	request := &RadiusPacket{Code: RadiusCodeAccessRequest, Identifier: 5}
+	copy(request.Authenticator[:], "fedcba9876543210")
+	key := msChap2TestBytes(t, msChap2TestSendKey)
+
+	response := request.NewResponse(RadiusCodeAccessAccept)
+	err := response.AddMppeKey(RadiusMsMppeSendKey, key, radiusTestSecret, request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	value := response.GetVendorAttribute(RadiusVendorMicrosoft, RadiusMsMppeSendKey)
+	if len(value) != 2+32 || value[0]&0x80 == 0 {
+		t.Fatalf("unexpected MS-MPPE-Send-Key: %x", value)
+	}
+
+	// decrypt as the NAS does (RFC 2548, 2.4.2)
+	plain := make([]byte, 0, 32)
+	last := append(request.Authenticator[:], value[:2]...)
+	for i := 2; i < len(value); i += 16 {
+		hash := md5.New()
+		hash.Write([]byte(radiusTestSecret))
+		hash.Write(last)
+		b := hash.Sum(nil)
+		for j := 0; j < 16; j++ {
+			plain = append(plain, value[i+j]^b[j])
+		}
+		last = value[i : i+16]
+	}
+	if int(plain[0]) != len(key) || !bytes.Equal(plain[1:1+len(key)], key) {
+		t.Fatalf("decrypted key: expect %x, actual %x", key, plain)
+	}
+}
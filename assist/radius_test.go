@@ -0,0 +1,175 @@
+package assist
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+)
+
+// Access-Request and Access-Accept of the example in RFC 2865, 7.1
+const (
+	radiusTestSecret   = "xyzzy5461"
+	radiusTestRequest  = "010000380f403f9473978057bd83d5cb98f4227a01066e656d6f02120dbe708d93d413ce3196e43f782a0aee0406c0a801100506" + "00000003"
+	radiusTestResponse = "0200002686fe220e7624ba2a1005f6bf9b55e0b2" + "0606000000010f06000000000e06c0a80103"
+)
+
+func TestRadiusPacket_RFC2865(t *testing.T) {
+	data, _ := hex.DecodeString(radiusTestRequest)
+	request, err := ParseRadiusPacket(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if request.Code != RadiusCodeAccessRequest {
+		t.Fatalf("code: expect %d, actual %d", RadiusCodeAccessRequest, request.Code)
+	}
+	if v := request.GetString(RadiusAttrUserName); v != "nemo" {
+		t.Fatalf("User-Name: expect nemo, actual %s", v)
+	}
+	if v := request.GetInteger(RadiusAttrNasPort); v != 3 {
+		t.Fatalf("NAS-Port: expect 3, actual %d", v)
+	}
+	password, err := request.DecodeUserPassword(radiusTestSecret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if password != "arctangent" {
+		t.Fatalf("User-Password: expect arctangent, actual %s", password)
+	}
+
+	encoded, err := request.Encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(encoded, data) {
+		t.Fatalf("encode: expect %x, actual %x", data, encoded)
+	}
+
+	response := request.NewResponse(RadiusCodeAccessAccept)
+	response.AddAttribute(6, []byte{0, 0, 0, 1})
+	response.AddAttribute(15, []byte{0, 0, 0, 0})
+	response.AddAttribute(14, []byte{192, 168, 1, 3})
+	encoded, err = response.EncodeResponse(request, radiusTestSecret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect, _ := hex.DecodeString(radiusTestResponse)
+	if !bytes.Equal(encoded, expect) {
+		t.Fatalf("response: expect %x, actual %x", expect, encoded)
+	}
+}
+
+func TestRadiusPacket_UserPassword(t *testing.T) {
+	passwords := []string{"a", "arctangent", "0123456789abcdef", "0123456789abcdef0123456789abcdef!"}
+	for _, password := range passwords {
+		request := &RadiusPacket{Code: RadiusCodeAccessRequest, Identifier: 1}
+		copy(request.Authenticator[:], "0123456789abcdef")
+		err := request.EncodeUserPassword(password, radiusTestSecret)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(request.GetAttribute(RadiusAttrUserPassword))%16 != 0 {
+			t.Fatalf("length of User-Password should be multiple of 16")
+		}
+
+		actual, err := request.DecodeUserPassword(radiusTestSecret)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if actual != password {
+			t.Fatalf("expect %s, actual %s", password, actual)
+		}
+	}
+}
+
+func TestRadiusPacket_MessageAuthenticator(t *testing.T) {
+	request := &RadiusPacket{Code: RadiusCodeAccessRequest, Identifier: 2}
+	copy(request.Authenticator[:], "fedcba9876543210")
+	request.AddString(RadiusAttrUserName, "nemo")
+	request.AddMessageAuthenticator()
+	data, err := request.EncodeRequest(radiusTestSecret)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	parsed, err := ParseRadiusPacket(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !parsed.VerifyMessageAuthenticator(radiusTestSecret) {
+		t.Fatal("message authenticator should be valid")
+	}
+	if parsed.VerifyMessageAuthenticator("wrong") {
+		t.Fatal("message authenticator should be invalid with wrong secret")
+	}
+
+	parsed.Attributes[0].Value = []byte("oman")
+	if parsed.VerifyMessageAuthenticator(radiusTestSecret) {
+		t.Fatal("message authenticator should be invalid after modified")
+	}
+
+	noAttr := &RadiusPacket{Code: RadiusCodeAccessRequest}
+	if noAttr.VerifyMessageAuthenticator(radiusTestSecret) {
+		t.Fatal("message authenticator should be invalid if not present")
+	}
+}
+
+func TestRadiusPacket_Accounting(t *testing.T) {
+	request := &RadiusPacket{Code: RadiusCodeAccountingRequest, Identifier: 3}
+	request.AddString(RadiusAttrUserName, "nemo")
+	request.AddAttribute(RadiusAttrAcctStatusType, []byte{0, 0, 0, 1})
+	request.AddString(RadiusAttrAcctSessionId, "session-1")
+	data, err := request.EncodeRequest(radiusTestSecret)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	parsed, err := ParseRadiusPacket(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !parsed.VerifyAccounting(radiusTestSecret) {
+		t.Fatal("accounting authenticator should be valid")
+	}
+	if parsed.VerifyAccounting("wrong") {
+		t.Fatal("accounting authenticator should be invalid with wrong secret")
+	}
+	if v := parsed.GetInteger(RadiusAttrAcctStatusType); v != 1 {
+		t.Fatalf("Acct-Status-Type: expect 1, actual %d", v)
+	}
+}
+
+func TestRadiusPacket_VendorAttribute(t *testing.T) {
+	packet := &RadiusPacket{Code: RadiusCodeAccessReject}
+	packet.AddVendorAttribute(RadiusVendorMicrosoft, RadiusMsChapError, []byte("\x01E=691 R=0 V=3"))
+	data, err := packet.Encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	parsed, err := ParseRadiusPacket(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	v := parsed.GetVendorAttribute(RadiusVendorMicrosoft, RadiusMsChapError)
+	if string(v) != "\x01E=691 R=0 V=3" {
+		t.Fatalf("unexpected vendor attribute: %q", v)
+	}
+	if parsed.GetVendorAttribute(RadiusVendorMicrosoft, RadiusMsChap2Response) != nil {
+		t.Fatal("vendor attribute should not be found")
+	}
+}
+
+func TestParseRadiusPacket_Invalid(t *testing.T) {
+	items := []string{
+		"0100",
+		"01000015" + "00000000000000000000000000000000" + "01",
+		"01000017" + "00000000000000000000000000000000" + "010a61",
+	}
+	for _, item := range items {
+		data, _ := hex.DecodeString(item)
+		_, err := ParseRadiusPacket(data)
+		if err == nil {
+			t.Fatalf("packet %s should be invalid", item)
+		}
+	}
+}
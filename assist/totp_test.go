@@ -0,0 +1,91 @@
+package assist
+
+import (
+	"encoding/base32"
+	"strings"
+	"testing"
+	"time"
+)
+
+// RFC 6238 Appendix B, SHA1 with the ASCII secret "12345678901234567890"
+var testTotpSecret = base32.StdEncoding.EncodeToString([]byte("12345678901234567890"))
+
+func TestHotp(t *testing.T) {
+	key := []byte("12345678901234567890")
+	items := map[int64]string{
+		59:          "94287082",
+		1111111109:  "07081804",
+		1111111111:  "14050471",
+		1234567890:  "89005924",
+		2000000000:  "69279037",
+		20000000000: "65353130",
+	}
+	for unix, code := range items {
+		value := hotp(key, uint64(TotpStep(time.Unix(unix, 0))), 8)
+		if value != code {
+			t.Errorf("time %d: expect %s, got %s", unix, code, value)
+		}
+	}
+}
+
+func TestTotpCode(t *testing.T) {
+	code, err := TotpCode(testTotpSecret, TotpStep(time.Unix(59, 0)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if code != "287082" {
+		t.Errorf("expect 287082, got %s", code)
+	}
+
+	_, err = TotpCode("not base32!", 1)
+	if err == nil {
+		t.Error("invalid secret should fail")
+	}
+}
+
+func TestVerifyTotp(t *testing.T) {
+	now := time.Unix(1111111109, 0)
+	code, err := TotpCode(testTotpSecret, TotpStep(now)-1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	step, ok := VerifyTotp(testTotpSecret, code, now, 1)
+	if !ok {
+		t.Fatal("code of previous step should be accepted")
+	}
+	if step != TotpStep(now)-1 {
+		t.Errorf("unexpected step: %d", step)
+	}
+
+	_, ok = VerifyTotp(testTotpSecret, code, now.Add(2*TotpPeriod*time.Second), 1)
+	if ok {
+		t.Error("code out of window should be refused")
+	}
+	_, ok = VerifyTotp(testTotpSecret, "12345", now, 1)
+	if ok {
+		t.Error("code of invalid length should be refused")
+	}
+}
+
+func TestNewTotpSecret(t *testing.T) {
+	secret, err := NewTotpSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(secret) != 32 || strings.Contains(secret, "=") {
+		t.Errorf("unexpected secret: %s", secret)
+	}
+	_, err = TotpCode(secret, 1)
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+func TestTotpUri(t *testing.T) {
+	uri := TotpUri("goa", "zhang san", "JBSWY3DPEHPK3PXP")
+	expect := "otpauth://totp/goa:zhang%20san?algorithm=SHA1&digits=6&issuer=goa&period=30&secret=JBSWY3DPEHPK3PXP"
+	if uri != expect {
+		t.Errorf("expect %s, got %s", expect, uri)
+	}
+}
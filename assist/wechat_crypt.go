@@ -0,0 +1,123 @@
+package assist
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+const (
+	wechatAesKeyLength = 43
+	wechatBlockSize    = 32
+)
+
+// WechatCrypt encrypts and decrypts the callback messages of WeChat official account (AES-256-CBC),
+// the plaintext is: random(16) + length(4, big endian) + message + appId, padded with PKCS#7 in 32 bytes block
+type WechatCrypt struct {
+	token string
+	appId string
+	key   []byte
+}
+
+// NewWechatCrypt creates the crypt with the 43 characters EncodingAESKey configured in the WeChat platform
+func NewWechatCrypt(token, encodingAesKey, appId string) (*WechatCrypt, error) {
+	if len(encodingAesKey) != wechatAesKeyLength {
+		return nil, fmt.Errorf("EncodingAESKey长度须为%d位", wechatAesKeyLength)
+	}
+	key, err := base64.StdEncoding.DecodeString(encodingAesKey + "=")
+	if err != nil {
+		return nil, fmt.Errorf("EncodingAESKey无效: %v", err)
+	}
+
+	return &WechatCrypt{
+		token: token,
+		appId: appId,
+		key:   key,
+	}, nil
+}
+
+// Sign returns the msg_signature of the encrypted message
+func (s *WechatCrypt) Sign(timestamp, nonce, encrypt string) string {
+	return WechatSign(s.token, timestamp, nonce, encrypt)
+}
+
+func (s *WechatCrypt) Encrypt(message []byte) (string, error) {
+	buf := &bytes.Buffer{}
+	random := make([]byte, 16)
+	_, err := rand.Read(random)
+	if err != nil {
+		return "", err
+	}
+	buf.Write(random)
+	binary.Write(buf, binary.BigEndian, uint32(len(message)))
+	buf.Write(message)
+	buf.WriteString(s.appId)
+
+	pad := wechatBlockSize - buf.Len()%wechatBlockSize
+	buf.Write(bytes.Repeat([]byte{byte(pad)}, pad))
+	plain := buf.Bytes()
+
+	block, err := aes.NewCipher(s.key)
+	if err != nil {
+		return "", err
+	}
+	data := make([]byte, len(plain))
+	cipher.NewCBCEncrypter(block, s.key[:aes.BlockSize]).CryptBlocks(data, plain)
+
+	return base64.StdEncoding.EncodeToString(data), nil
+}
+
+// Decrypt returns the message, an error is returned if the appId of the message is not the same
+func (s *WechatCrypt) Decrypt(encrypt string) ([]byte, error) {
+	data, err := base64.StdEncoding.DecodeString(encrypt)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < aes.BlockSize || len(data)%aes.BlockSize != 0 {
+		return nil, fmt.Errorf("密文长度无效")
+	}
+
+	block, err := aes.NewCipher(s.key)
+	if err != nil {
+		return nil, err
+	}
+	plain := make([]byte, len(data))
+	cipher.NewCBCDecrypter(block, s.key[:aes.BlockSize]).CryptBlocks(plain, data)
+
+	pad := int(plain[len(plain)-1])
+	if pad < 1 || pad > wechatBlockSize || pad > len(plain) {
+		return nil, fmt.Errorf("填充无效")
+	}
+	plain = plain[:len(plain)-pad]
+	if len(plain) < 20 {
+		return nil, fmt.Errorf("明文长度无效")
+	}
+
+	length := int(binary.BigEndian.Uint32(plain[16:20]))
+	if length > len(plain)-20 {
+		return nil, fmt.Errorf("消息长度无效")
+	}
+	message := plain[20 : 20+length]
+	appId := string(plain[20+length:])
+	if appId != s.appId {
+		return nil, fmt.Errorf("AppID不匹配: %s", appId)
+	}
+
+	return message, nil
+}
+
+// WechatSign returns the hex of SHA1 of the sorted and joined values, it is used for the signature of url and message
+func WechatSign(values ...string) string {
+	items := make([]string, len(values))
+	copy(items, values)
+	sort.Strings(items)
+
+	return fmt.Sprintf("%x", sha1.Sum([]byte(strings.Join(items, ""))))
+}
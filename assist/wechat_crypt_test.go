@@ -0,0 +1,85 @@
+package assist
+
+import (
+	"encoding/base64"
+	"testing"
+)
+
+const (
+	testWechatToken  = "spamtest"
+	testWechatAesKey = "jWmYm7qr5nMoAUwZRjGtBxmz3KA1tkAj3ykkR6q2B2C"
+	testWechatAppId  = "wx5823bf96d3bd56c7"
+)
+
+func TestWechatCrypt_EncryptDecrypt(t *testing.T) {
+	crypt, err := NewWechatCrypt(testWechatToken, testWechatAesKey, testWechatAppId)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, message := range []string{"", "a", "<xml><Content><![CDATA[你好]]></Content></xml>", string(make([]byte, 100))} {
+		encrypt, err := crypt.Encrypt([]byte(message))
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, _ := base64.StdEncoding.DecodeString(encrypt)
+		if len(data)%32 != 0 {
+			t.Errorf("cipher length %d is not multiple of 32", len(data))
+		}
+
+		plain, err := crypt.Decrypt(encrypt)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(plain) != message {
+			t.Errorf("expect %q, got %q", message, plain)
+		}
+	}
+}
+
+func TestWechatCrypt_Decrypt(t *testing.T) {
+	crypt, err := NewWechatCrypt(testWechatToken, testWechatAesKey, testWechatAppId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := NewWechatCrypt(testWechatToken, testWechatAesKey, "wx0000000000000000")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	encrypt, err := other.Encrypt([]byte("hello"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = crypt.Decrypt(encrypt)
+	if err == nil {
+		t.Error("message of another app should not be decrypted")
+	}
+
+	_, err = crypt.Decrypt("not base64!")
+	if err == nil {
+		t.Error("invalid base64 should fail")
+	}
+	_, err = crypt.Decrypt(base64.StdEncoding.EncodeToString(make([]byte, 15)))
+	if err == nil {
+		t.Error("invalid length should fail")
+	}
+}
+
+func TestNewWechatCrypt(t *testing.T) {
+	_, err := NewWechatCrypt(testWechatToken, testWechatAesKey[:42], testWechatAppId)
+	if err == nil {
+		t.Error("short key should fail")
+	}
+}
+
+func TestWechatSign(t *testing.T) {
+	// sha1("1409304348" + "xxxxxx" + "yyyyyy"), values are sorted before joined
+	sign := WechatSign("yyyyyy", "1409304348", "xxxxxx")
+	if sign != "71e4644a28c2e380b9944214f0e52b74acdc6ae3" {
+		t.Errorf("unexpected sign: %s", sign)
+	}
+	if sign != WechatSign("xxxxxx", "yyyyyy", "1409304348") {
+		t.Error("sign should not depend on the order of values")
+	}
+}
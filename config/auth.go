@@ -1,6 +1,13 @@
 package config
 
 type Auth struct {
-	Token  AuthToken  `json:"token"`
-	Wechat AuthWechat `json:"wechat"`
+	Token         AuthToken         `json:"token"`
+	Limit         AuthLimit         `json:"limit" note:"登录失败限制"`
+	Session       AuthSession       `json:"session" note:"会话"`
+	Impersonation AuthImpersonation `json:"impersonation" note:"管理员代理登录"`
+	Rsa           AuthRsa           `json:"rsa" note:"登录密码加密密钥"`
+	Wechat        AuthWechat        `json:"wechat"`
+	Oidc          AuthOidc          `json:"oidc" note:"OpenID Connect单点登录"`
+	Saml          AuthSaml          `json:"saml" note:"SAML 2.0单点登录"`
+	Totp          AuthTotp          `json:"totp" note:"两步验证"`
 }
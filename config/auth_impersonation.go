@@ -0,0 +1,5 @@
+package config
+
+type AuthImpersonation struct {
+	Expiration int64 `json:"expiration" note:"代理登录凭证有效期(分钟), 到期后不能延长, 默认30"`
+}
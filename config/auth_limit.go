@@ -0,0 +1,8 @@
+package config
+
+type AuthLimit struct {
+	Window   int64 `json:"window" note:"统计登录失败次数的滑动窗口(分钟), 默认15"`
+	Captcha  int   `json:"captcha" note:"同一IP在窗口内失败达到该次数后须输入验证码, 默认3"`
+	Lockout  int   `json:"lockout" note:"同一IP或同一帐号在窗口内失败达到该次数后暂时锁定, 默认10, 0表示不锁定"`
+	LockTime int64 `json:"lockTime" note:"锁定时长(分钟), 默认15"`
+}
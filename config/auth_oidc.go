@@ -0,0 +1,45 @@
+package config
+
+type AuthOidc struct {
+	Enabled bool              `json:"enabled" note:"是否启用OpenID Connect单点登录"`
+	Issuer  string            `json:"issuer" note:"签发者, 为授权服务的外部访问地址, 如: https://oa.example.com/auth, 启用时必填, 为空时不启用"`
+	Clients []*AuthOidcClient `json:"clients" note:"客户端(接入单点登录的系统)"`
+}
+
+type AuthOidcClient struct {
+	ID           string   `json:"id" note:"客户端标识(client_id)"`
+	Name         string   `json:"name" note:"名称, 显示在登录页面"`
+	Secret       string   `json:"secret" note:"客户端密钥(client_secret), 为空时为公开客户端(如单页应用), 仅凭PKCE验证"`
+	RedirectUris []string `json:"redirectUris" note:"允许的回调地址, 须完全匹配"`
+}
+
+func (s *AuthOidc) GetClient(id string) *AuthOidcClient {
+	if len(id) < 1 {
+		return nil
+	}
+
+	for _, item := range s.Clients {
+		if item == nil {
+			continue
+		}
+		if item.ID == id {
+			return item
+		}
+	}
+
+	return nil
+}
+
+func (s *AuthOidcClient) HasRedirectUri(uri string) bool {
+	if len(uri) < 1 {
+		return false
+	}
+
+	for _, item := range s.RedirectUris {
+		if item == uri {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,9 @@
+package config
+
+type AuthRsa struct {
+	Bits     int    `json:"bits" note:"密钥长度(位), 不小于2048, 默认2048"`
+	File     string `json:"file" note:"密钥文件路径, 为空时默认为程序根目录下的crt/login.key, 不存在时自动生成"`
+	Key      string `json:"key" note:"加密密钥文件中私钥的密钥(AES-256, 16进制), 为空时自动生成"`
+	Rotation int64  `json:"rotation" note:"轮换周期(小时), 默认720(30天), 0表示不轮换"`
+	Grace    int64  `json:"grace" note:"轮换后旧密钥仍可解密的宽限期(分钟), 默认60"`
+}
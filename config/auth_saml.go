@@ -0,0 +1,51 @@
+package config
+
+const (
+	AuthSamlNameIDAccount = "account"
+	AuthSamlNameIDMail    = "mail"
+)
+
+type AuthSaml struct {
+	Enabled    bool          `json:"enabled" note:"是否启用SAML 2.0单点登录"`
+	Url        string        `json:"url" note:"授权服务的外部访问地址, 如: https://oa.example.com/auth, 启用时必填, 为空时不启用"`
+	EntityID   string        `json:"entityId" note:"身份提供者标识(entityID), 一般为元数据地址, 如: https://oa.example.com/auth/saml/metadata, 启用时必填, 为空时不启用"`
+	Key        AuthSamlKey   `json:"key" note:"断言签名密钥"`
+	Expiration int64         `json:"expiration" note:"断言有效期(分钟), 默认5"`
+	Sps        []*AuthSamlSp `json:"sps" note:"服务提供者(接入单点登录的系统)"`
+}
+
+type AuthSamlKey struct {
+	File string `json:"file" note:"RSA私钥文件路径(PEM), 为空时默认为程序根目录下的crt/saml.pem, 不存在时自动生成"`
+	Cert string `json:"cert" note:"证书文件路径(PEM), 为空时默认为程序根目录下的crt/saml.crt, 不存在时根据私钥自动生成自签名证书, 有效期10年"`
+}
+
+type AuthSamlSp struct {
+	EntityID   string             `json:"entityId" note:"服务提供者标识(entityID), 即认证请求的Issuer及断言的Audience"`
+	Name       string             `json:"name" note:"名称, 显示在登录页面"`
+	AcsUrl     string             `json:"acsUrl" note:"断言消费地址(AssertionConsumerService), HTTP-POST绑定, 响应只发送至该地址"`
+	NameID     string             `json:"nameId" note:"用户标识(NameID): account-帐号(默认); mail-电子邮箱"`
+	Attributes AuthSamlAttributes `json:"attributes" note:"属性名称, 为空表示不发送该属性"`
+}
+
+type AuthSamlAttributes struct {
+	Mail   string `json:"mail" note:"电子邮箱的属性名称, 如: email"`
+	Name   string `json:"name" note:"姓名的属性名称, 如: displayName"`
+	Groups string `json:"groups" note:"所属组(包括嵌套)帐号的属性名称, 每个组一个值, 如: groups"`
+}
+
+func (s *AuthSaml) GetSp(entityId string) *AuthSamlSp {
+	if len(entityId) < 1 {
+		return nil
+	}
+
+	for _, item := range s.Sps {
+		if item == nil {
+			continue
+		}
+		if item.EntityID == entityId {
+			return item
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,5 @@
+package config
+
+type AuthSession struct {
+	Limit int `json:"limit" note:"每个用户同时有效的会话数上限, 超出时最早登录的会话被强制下线, 0表示不限制"`
+}
@@ -5,7 +5,16 @@ import (
 )
 
 type AuthToken struct {
-	Code    gcfg.Token `json:"code"`
-	Access  gcfg.Token `json:"access"`
-	Refresh gcfg.Token `json:"refresh"`
+	Code    gcfg.Token `json:"code" note:"授权码(OIDC), 有效期(分钟)默认1"`
+	Access  gcfg.Token `json:"access" note:"访问凭证, 有效期(分钟)默认10"`
+	Refresh gcfg.Token `json:"refresh" note:"刷新凭证, 有效期(分钟)默认10080(7天)"`
+
+	Jwt    bool         `json:"jwt" note:"是否签发JWT访问凭证及刷新凭证, 否则登录时仅签发不透明凭证"`
+	Issuer string       `json:"issuer" note:"签发者(iss), 如: https://oa.example.com"`
+	Key    AuthTokenKey `json:"key" note:"签名密钥"`
+}
+
+type AuthTokenKey struct {
+	ID   string `json:"id" note:"密钥ID(kid), 为空时根据公钥生成"`
+	File string `json:"file" note:"RSA私钥文件路径(PEM), 为空时默认为程序根目录下的crt/token.pem, 不存在时自动生成"`
 }
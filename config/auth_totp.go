@@ -0,0 +1,8 @@
+package config
+
+type AuthTotp struct {
+	Enabled bool     `json:"enabled" note:"是否启用两步验证(TOTP), 启用后用户可自愿开启"`
+	Issuer  string   `json:"issuer" note:"发行方, 显示在验证器应用中"`
+	Groups  []string `json:"groups" note:"强制两步验证的组(帐号名称, 包括嵌套成员), 如: oa.admins"`
+	Key     string   `json:"key" note:"加密验证密钥的密钥(AES-256, 16进制), 为空时自动生成"`
+}
@@ -3,4 +3,5 @@ package config
 type AuthWechat struct {
 	Url AuthWechatUrl `json:"url" note:"回调地址"`
 	App AuthWechatApp `json:"app" note:"开发帐号"`
+	Mp  AuthWechatApp `json:"mp" note:"公众号开发帐号, 用于根据公众号消息的OpenID查询UnionID, 标识ID为空时使用开发帐号"`
 }
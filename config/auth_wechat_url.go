@@ -3,4 +3,5 @@ package config
 type AuthWechatUrl struct {
 	Api      AuthWechatUrlApi      `json:"api" note:"接口(服务器)配置"`
 	Callback AuthWechatUrlCallback `json:"callback" note:"回调地址"`
+	Oauth    string                `json:"oauth" note:"网页授权接口地址, 为空时默认为https://api.weixin.qq.com, 测试时可指向本地模拟服务"`
 }
@@ -1,5 +1,11 @@
 package config
 
+const (
+	WechatMsgPlain      = 0 // 明文模式
+	WechatMsgCompatible = 1 // 兼容模式
+	WechatMsgSecure     = 2 // 安全模式
+)
+
 type AuthWechatUrlApi struct {
 	Token   string `json:"token" note:"令牌"`
 	AESKey  string `json:"aesKey" note:"消息加解密密钥"`
@@ -8,6 +8,7 @@ import (
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"strings"
 	"sync"
 )
 
@@ -20,6 +21,9 @@ type Config struct {
 	Svn  Svn  `json:"svn" note:"SVN服务"`
 	Ad   MsAd `json:"ad" note:"AD服务"`
 	Mail Mail `json:"mail" note:"邮件服务"`
+	Db   Db   `json:"db" note:"本地存储"`
+
+	Radius Radius `json:"radius" note:"RADIUS服务"`
 }
 
 func NewConfig() *Config {
@@ -102,6 +106,72 @@ func NewConfig() *Config {
 				},
 			},
 		},
+		Auth: Auth{
+			Token: AuthToken{
+				Code: gcfg.Token{
+					Expiration: 1,
+				},
+				Access: gcfg.Token{
+					Expiration: 10,
+				},
+				Refresh: gcfg.Token{
+					Expiration: 10080,
+				},
+				Jwt:    false,
+				Issuer: "goa",
+			},
+			Limit: AuthLimit{
+				Window:   15,
+				Captcha:  3,
+				Lockout:  10,
+				LockTime: 15,
+			},
+			Impersonation: AuthImpersonation{
+				Expiration: 30,
+			},
+			Rsa: AuthRsa{
+				Bits:     2048,
+				Rotation: 720,
+				Grace:    60,
+			},
+			Totp: AuthTotp{
+				Enabled: false,
+				Issuer:  "goa",
+				Groups: []string{
+					"oa.admins",
+				},
+			},
+			Oidc: AuthOidc{
+				Enabled: false,
+				Clients: []*AuthOidcClient{
+					{
+						ID:     "wiki",
+						Name:   "Wiki",
+						Secret: "",
+						RedirectUris: []string{
+							"https://wiki.example.com/oidc/callback",
+						},
+					},
+				},
+			},
+			Saml: AuthSaml{
+				Enabled:    false,
+				Expiration: 5,
+				Sps: []*AuthSamlSp{
+					{
+						EntityID: "https://crm.example.com/saml/metadata",
+						Name:     "CRM",
+						AcsUrl:   "https://crm.example.com/saml/acs",
+						NameID:   AuthSamlNameIDAccount,
+						Attributes: AuthSamlAttributes{
+							Mail:   "email",
+							Name:   "displayName",
+							Groups: "groups",
+						},
+					},
+				},
+			},
+		},
 		Dhcp: Dhcp{
 			Api: DhcpApi{
 				Url: "http://192.168.123.101:8085",
@@ -130,6 +200,67 @@ func NewConfig() *Config {
 				Share:  "OU=共享目录,DC=example,DC=com",
 				User:   "OU=用户账号,DC=example,DC=com",
 				Svn:    "OU=SVN,DC=example,DC=com",
+				Leaver: "OU=离职人员,DC=example,DC=com",
+			},
+			Expiration: MsAdExpiration{
+				Interval: 60,
+				Reminder: 60,
+			},
+			VpnGrant: MsAdVpnGrant{
+				Interval: 60,
+			},
+			History: MsAdHistory{
+				Enabled:   true,
+				Retention: 400,
+			},
+			Cache: MsAdCache{
+				Expiration: 60,
+			},
+			Onboarding: []*MsAdOnboarding{
+				{
+					Department: "研发部",
+					Parent:     "OU=研发部,OU=用户账号,DC=example,DC=com",
+					Groups:     []string{},
+					Vpn:        true,
+					Dhcp:       "笔记本",
+					Svn:        []*MsAdOnboardingSvn{},
+				},
+			},
+			Template: MsAdTemplate{
+				Server: []*MsAdGroupTemplate{
+					{
+						Name:        "Server.Authorization.Managers.%s",
+						Description: "授权管理员",
+						Info:        "具备添加、删除成员及编辑成员访问权限的权限",
+					},
+					{
+						Name:        "Server.Remote.Desktop.Users.%s",
+						Description: "远程桌面用户",
+						Info:        "允许通过远程桌面服务登陆",
+					},
+				},
+				Share: []*MsAdGroupTemplate{
+					{
+						Name:        "Share.Authorization.Managers.%s",
+						Description: "授权管理员",
+						Info:        "具备添加、删除成员及编辑成员访问权限的权限",
+					},
+					{
+						Name:        "Share.Read.%s",
+						Description: "只读用户",
+						Info:        "对共享目录具有只读权限",
+					},
+					{
+						Name:        "Share.Read.Write.%s",
+						Description: "读写用户",
+						Info:        "对共享目录具有读写权限，但没有删改权限",
+					},
+					{
+						Name:        "Share.Read.Write.Modify.%s",
+						Description: "读写删改用户",
+						Info:        "对共享目录具有读写及删改权限",
+					},
+				},
 			},
 		},
 		Mail: Mail{
@@ -137,6 +268,23 @@ func NewConfig() *Config {
 				Url: "http://172.16.100.3:11034",
 			},
 		},
+		Radius: Radius{
+			Enabled:    false,
+			Address:    ":1812",
+			Accounting: ":1813",
+			MsChap2: RadiusMsChap2{
+				Enabled: false,
+			},
+			Clients: []*RadiusClient{
+				{
+					Name:    "vpn",
+					Address: "192.168.1.1",
+					Secret:  "",
+
+					RequireMessageAuthenticator: true,
+				},
+			},
+		},
 	}
 }
 
@@ -212,6 +360,26 @@ func (s *Config) String() string {
 	return string(bytes[:])
 }
 
+// MaskedString returns the configuration for logging, the passwords, secrets and keys which are not empty are masked
+func (s *Config) MaskedString() string {
+	data, err := json.Marshal(s)
+	if err != nil {
+		return ""
+	}
+	var value interface{}
+	err = json.Unmarshal(data, &value)
+	if err != nil {
+		return ""
+	}
+
+	data, err = json.Marshal(maskSecrets(value))
+	if err != nil {
+		return ""
+	}
+
+	return string(data)
+}
+
 func (s *Config) FormatString() string {
 	bytes, err := json.MarshalIndent(s, "", "    ")
 	if err != nil {
@@ -220,3 +388,34 @@ func (s *Config) FormatString() string {
 
 	return string(bytes[:])
 }
+
+// secretNames are the json names of the sensitive values, e.g. db.token.key, auth.totp.key, radius.clients[].secret
+var secretNames = map[string]bool{
+	"password": true,
+	"secret":   true,
+	"key":      true,
+	"aeskey":   true,
+	"token":    true,
+}
+
+func maskSecrets(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for name, item := range v {
+			text, ok := item.(string)
+			if ok {
+				if len(text) > 0 && secretNames[strings.ToLower(name)] {
+					v[name] = "******"
+				}
+				continue
+			}
+			v[name] = maskSecrets(item)
+		}
+	case []interface{}:
+		for i, item := range v {
+			v[i] = maskSecrets(item)
+		}
+	}
+
+	return value
+}
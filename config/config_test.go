@@ -0,0 +1,32 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestConfig_MaskedString(t *testing.T) {
+	cfg := NewConfig()
+	cfg.Db.Token.Key = "db-token-key-0123"
+	cfg.Auth.Totp.Key = "auth-totp-key-0123"
+	cfg.Auth.Rsa.Key = "auth-rsa-key-0123"
+	cfg.Ad.Account.Password = "ad-password-0123"
+	cfg.Radius.Clients[0].Secret = "radius-secret-0123"
+	cfg.Radius.MsChap2.Key = "radius-nt-key-0123"
+
+	value := cfg.MaskedString()
+	if len(value) < 1 {
+		t.Fatal("masked string should not be empty")
+	}
+	for _, secret := range []string{"db-token-key", "auth-totp-key", "auth-rsa-key", "ad-password", "radius-secret", "radius-nt-key"} {
+		if strings.Contains(value, secret) {
+			t.Errorf("%s should be masked", secret)
+		}
+	}
+	if !strings.Contains(value, `"address":":1812"`) {
+		t.Error("the other values should be kept")
+	}
+	if cfg.Db.Token.Key != "db-token-key-0123" {
+		t.Error("the configuration should not be changed")
+	}
+}
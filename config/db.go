@@ -0,0 +1,6 @@
+package config
+
+type Db struct {
+	Path  string  `json:"path" note:"本地数据库文件路径, 为空时默认为程序根目录下的data/goa.db"`
+	Token DbToken `json:"token" note:"登录凭证"`
+}
@@ -0,0 +1,6 @@
+package config
+
+type DbToken struct {
+	Persistent bool   `json:"persistent" note:"是否将登录凭证保存到本地数据库, 保存后重启服务无需重新登录"`
+	Key        string `json:"key" note:"加密凭证扩展信息的密钥(AES-256, 16进制), 为空时自动生成"`
+}
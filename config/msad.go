@@ -1,10 +1,16 @@
 package config
 
 type MsAd struct {
-	Host       string      `json:"host" note:"主机地址"`
-	Port       int         `json:"port" note:"端口, 389或636"`
-	Base       string      `json:"base" note:"根路径，如: DC=example,DC=com"`
-	Account    MsAdAccount `json:"account" note:"访问帐号帐号"`
-	Root       MsAdRoot    `json:"root" note:"根节点"`
-	AdminGroup string      `json:"adminGroup" note:"系统管理员组(帐号名称)"`
+	Host       string            `json:"host" note:"主机地址"`
+	Port       int               `json:"port" note:"端口, 389或636"`
+	Base       string            `json:"base" note:"根路径，如: DC=example,DC=com"`
+	Account    MsAdAccount       `json:"account" note:"访问帐号帐号"`
+	Root       MsAdRoot          `json:"root" note:"根节点"`
+	AdminGroup string            `json:"adminGroup" note:"系统管理员组(帐号名称)"`
+	Expiration MsAdExpiration    `json:"expiration" note:"限时组成员"`
+	VpnGrant   MsAdVpnGrant      `json:"vpnGrant" note:"VPN限时授权"`
+	Template   MsAdTemplate      `json:"template" note:"角色组模板"`
+	History    MsAdHistory       `json:"history" note:"组成员历史"`
+	Cache      MsAdCache         `json:"cache" note:"组成员及角色缓存"`
+	Onboarding []*MsAdOnboarding `json:"onboarding" note:"入职模板, 每个部门一个"`
 }
@@ -0,0 +1,5 @@
+package config
+
+type MsAdCache struct {
+	Expiration int64 `json:"expiration" note:"管理员组成员、资源授权组成员及组角色查询结果的缓存有效期(秒), 默认60, 小于0表示不缓存"`
+}
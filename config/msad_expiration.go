@@ -0,0 +1,6 @@
+package config
+
+type MsAdExpiration struct {
+	Interval int64 `json:"interval" note:"检查组成员是否到期的间隔时间(秒), 默认60"`
+	Reminder int64 `json:"reminder" note:"组成员到期前提醒的提前时间(分钟), 默认60"`
+}
@@ -0,0 +1,6 @@
+package config
+
+type MsAdHistory struct {
+	Enabled   bool  `json:"enabled" note:"是否每天保存角色组成员快照"`
+	Retention int64 `json:"retention" note:"快照及变更记录的保留天数, 0表示永久保留"`
+}
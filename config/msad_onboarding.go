@@ -0,0 +1,16 @@
+package config
+
+type MsAdOnboarding struct {
+	Department string               `json:"department" note:"部门名称, 入职时按此名称选择模板"`
+	Parent     string               `json:"parent" note:"用户所在组织单位DN, 如: OU=研发部,OU=用户账号,DC=example,DC=com"`
+	Groups     []string             `json:"groups" note:"加入的组DN"`
+	Vpn        bool                 `json:"vpn" note:"是否启用VPN"`
+	Dhcp       string               `json:"dhcp" note:"添加DHCP筛选器时的设备类型, 如: 笔记本"`
+	Svn        []*MsAdOnboardingSvn `json:"svn" note:"SVN访问权限"`
+}
+
+type MsAdOnboardingSvn struct {
+	Repository  string `json:"repository" note:"存储库名称"`
+	Path        string `json:"path" note:"路径"`
+	AccessLevel int    `json:"accessLevel" note:"访问权限: 1-只读; 2-读写"`
+}
@@ -5,4 +5,5 @@ type MsAdRoot struct {
 	Share  string `json:"share" note:"共享目录, 如: OU=共享目录,DC=example,DC=com"`
 	User   string `json:"user" note:"用户帐号, 如: OU=用户账号,DC=example,DC=com"`
 	Svn    string `json:"svn" note:"SVN帐号, 如: OU=SVN,DC=example,DC=com"`
+	Leaver string `json:"leaver" note:"离职用户, 如: OU=离职人员,DC=example,DC=com"`
 }
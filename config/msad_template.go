@@ -0,0 +1,12 @@
+package config
+
+type MsAdTemplate struct {
+	Server []*MsAdGroupTemplate `json:"server" note:"添加服务器时创建的角色组"`
+	Share  []*MsAdGroupTemplate `json:"share" note:"添加共享目录时创建的角色组"`
+}
+
+type MsAdGroupTemplate struct {
+	Name        string `json:"name" note:"组名称格式, 其中%s替换为组后缀, 如: Share.Read.%s"`
+	Description string `json:"description" note:"描述"`
+	Info        string `json:"info" note:"注释"`
+}
@@ -0,0 +1,5 @@
+package config
+
+type MsAdVpnGrant struct {
+	Interval int64 `json:"interval" note:"检查VPN限时授权是否开始或结束的间隔时间(秒), 默认60"`
+}
@@ -0,0 +1,22 @@
+package config
+
+type Radius struct {
+	Enabled    bool            `json:"enabled" note:"是否启用RADIUS服务, 支持PAP及MS-CHAPv2(需单独启用)认证"`
+	Address    string          `json:"address" note:"认证监听地址, 如: :1812"`
+	Accounting string          `json:"accounting" note:"计费监听地址, 如: :1813, 为空时不监听"`
+	MsChap2    RadiusMsChap2   `json:"msChap2" note:"MS-CHAPv2认证"`
+	Clients    []*RadiusClient `json:"clients" note:"客户端(如VPN设备), 未配置的客户端发送的请求将被忽略"`
+}
+
+type RadiusMsChap2 struct {
+	Enabled bool   `json:"enabled" note:"是否启用MS-CHAPv2认证, NT哈希无法通过LDAP从AD读取, 启用后在用户登录、PAP认证或在本系统修改密码时加密保存NT哈希; 在其他系统修改密码后, 需登录本系统一次才能使用MS-CHAPv2"`
+	Key     string `json:"key" note:"加密NT哈希的密钥(AES-256, 16进制), 为空时自动生成"`
+}
+
+type RadiusClient struct {
+	Name    string `json:"name" note:"名称"`
+	Address string `json:"address" note:"IP地址或网段, 如: 192.168.1.1或192.168.1.0/24"`
+	Secret  string `json:"secret" note:"共享密钥"`
+
+	RequireMessageAuthenticator bool `json:"requireMessageAuthenticator" note:"是否要求认证请求包含Message-Authenticator(RFC 3579), 用于防范BlastRADIUS攻击, 客户端支持时应启用"`
+}
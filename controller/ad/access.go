@@ -0,0 +1,506 @@
+package ad
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/csby/goa/controller"
+	"github.com/csby/goa/data/model"
+	"github.com/csby/goa/data/socket"
+	"github.com/csby/gwsf/gtype"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	accessRequestBucket = "access.request"
+)
+
+func NewAccess(log gtype.Log, param *controller.Parameter) *Access {
+	instance := &Access{}
+	instance.SetLog(log)
+	instance.SetParameter(param)
+
+	return instance
+}
+
+type Access struct {
+	base
+}
+
+func (s *Access) CreateRequest(ctx gtype.Context, ps gtype.Params) {
+	token := s.GetToken(ctx.Token())
+	if token == nil {
+		ctx.Error(gtype.ErrInternal, "凭证无效")
+		return
+	}
+	if s.Dbs == nil {
+		ctx.Error(gtype.ErrInternal, "本地存储不可用")
+		return
+	}
+
+	argument := &model.AccessRequestCreate{}
+	err := ctx.GetJson(argument)
+	if err != nil {
+		ctx.Error(gtype.ErrInput, err)
+		return
+	}
+	if len(argument.GroupDn) < 1 {
+		ctx.Error(gtype.ErrInput.SetDetail("groupDn为空"))
+		return
+	}
+	groupDn, err := s.FromBase64(argument.GroupDn)
+	if err != nil {
+		ctx.Error(gtype.ErrInput, "groupDn不是有效base64字符: ", err)
+		return
+	}
+	reason := strings.TrimSpace(argument.Reason)
+	if len(reason) < 1 {
+		ctx.Error(gtype.ErrInput.SetDetail("申请理由(reason)为空"))
+		return
+	}
+
+	ad := s.Ad()
+	group, err := ad.GetGroup(groupDn)
+	if err != nil {
+		ctx.Error(gtype.ErrInput, fmt.Sprintf("角色组(%s)无效: %v", ad.GetDnName(groupDn), err))
+		return
+	}
+	resource := s.GetAdResource(group.DN)
+	role := s.GetAdGroupRole(group.Account)
+	if !s.isRequestable(group.Account, resource.Type, role) {
+		ctx.Error(gtype.ErrNoPermission, fmt.Sprintf("角色组(%s)不允许申请", group.Account))
+		return
+	}
+	user, err := ad.GetUser(token.UserAccount)
+	if err != nil {
+		ctx.Error(gtype.ErrInternal, err)
+		return
+	}
+	isMember, err := ad.IsGroupMember(group.Account, user.Account)
+	if err != nil {
+		ctx.Error(gtype.ErrInternal, err)
+		return
+	}
+	if isMember {
+		ctx.Error(gtype.ErrInput, fmt.Sprintf("已经是角色组(%s)的成员", group.Account))
+		return
+	}
+	if s.hasPendingRequest(user.Account, group.DN) {
+		ctx.Error(gtype.ErrInput, fmt.Sprintf("角色组(%s)的申请正在审批中", group.Account))
+		return
+	}
+
+	resourceDn, _ := s.FromBase64(resource.Dn)
+	approvers, err := s.GetAdAuthorizationAccounts(resourceDn)
+	if err != nil {
+		ctx.Error(gtype.ErrInternal, err)
+		return
+	}
+	approvers = excludeAccount(approvers, user.Account)
+	if len(approvers) < 1 && !isPrivilegedRole(role) {
+		manager, me := ad.GetUserManager(user.Account)
+		if me == nil && strings.ToLower(manager.Account) != strings.ToLower(user.Account) {
+			approvers = append(approvers, manager.Account)
+		} else if !ad.IsNotExit(me) {
+			ctx.Error(gtype.ErrInternal, me)
+			return
+		}
+	}
+	if len(approvers) < 1 {
+		if isPrivilegedRole(role) {
+			ctx.Error(gtype.ErrInput, "未找到审批人: 资源未设置授权管理员")
+			return
+		}
+		ctx.Error(gtype.ErrInput, "未找到审批人: 资源未设置授权管理员, 且申请人未设置直接主管")
+		return
+	}
+
+	item := &model.AccessRequest{
+		ID:         ctx.NewGuid(),
+		Account:    user.Account,
+		Name:       user.Name,
+		MemberDn:   s.ToBase64(user.DN),
+		Resource:   *resource,
+		Reason:     reason,
+		Approvers:  approvers,
+		Status:     model.AccessRequestPending,
+		CreateTime: gtype.DateTime(time.Now()),
+	}
+	item.Group.Dn = s.ToBase64(group.DN)
+	item.Group.Account = group.Account
+	item.Group.Description = group.Description
+	item.Group.Info = group.Info
+	item.Group.Role = role
+
+	err = s.Dbs.Put(accessRequestBucket, item.ID, item)
+	if err != nil {
+		ctx.Error(gtype.ErrInternal, err)
+		return
+	}
+
+	s.WriteWebSocketMessageToAccounts(socket.WSAccessRequest, item, approvers...)
+	ctx.Success(item)
+}
+
+func (s *Access) CreateRequestDoc(doc gtype.Doc, method string, uri gtype.Uri) {
+	catalog := s.createCatalog(doc, adCatalogAccess)
+	function := catalog.AddFunction(method, uri, "提交权限申请")
+	function.SetNote("申请加入服务器、共享目录或SVN存储库的角色组, 申请将推送给该资源的授权管理员审批; 资源未设置授权管理员时推送给申请人的直接主管")
+	function.SetRemark("系统管理员组及不属于服务器、共享目录或SVN存储库的组不允许申请; 授权管理员组及数据库系统管理员组只能由资源的授权管理员审批")
+	function.SetInputJsonExample(&model.AccessRequestCreate{
+		Reason: "参与项目开发",
+	})
+	function.SetOutputDataExample(&model.AccessRequest{
+		ID:         gtype.NewGuid(),
+		Account:    "zhangsan",
+		Name:       "张三",
+		Reason:     "参与项目开发",
+		Approvers:  []string{"lisi"},
+		CreateTime: gtype.DateTime(time.Now()),
+	})
+	function.AddOutputError(gtype.ErrTokenEmpty)
+	function.AddOutputError(gtype.ErrTokenInvalid)
+	function.AddOutputError(gtype.ErrNoPermission)
+	function.AddOutputError(gtype.ErrInput)
+	function.AddOutputError(gtype.ErrInternal)
+}
+
+func (s *Access) GetRequests(ctx gtype.Context, ps gtype.Params) {
+	token := s.GetToken(ctx.Token())
+	if token == nil {
+		ctx.Error(gtype.ErrInternal, "凭证无效")
+		return
+	}
+	if s.Dbs == nil {
+		ctx.Error(gtype.ErrInternal, "本地存储不可用")
+		return
+	}
+
+	argument := &model.AccessRequestFilter{
+		Status: -1,
+	}
+	err := ctx.GetJson(argument)
+	if err != nil {
+		ctx.Error(gtype.ErrInput, err)
+		return
+	}
+
+	isAdmin := false
+	if !argument.Mine {
+		isAdmin = s.IsAdmin(token.UserAccount)
+	}
+	results := make(model.AccessRequestCollection, 0)
+	err = s.Dbs.ForEach(accessRequestBucket, func(key string, value []byte) error {
+		item := &model.AccessRequest{}
+		if json.Unmarshal(value, item) != nil {
+			return nil
+		}
+		if argument.Status >= 0 && argument.Status != item.Status {
+			return nil
+		}
+
+		if argument.Mine {
+			if strings.ToLower(item.Account) != strings.ToLower(token.UserAccount) {
+				return nil
+			}
+		} else if !isAdmin && !s.isApprover(item, token.UserAccount) {
+			return nil
+		}
+
+		results = append(results, item)
+		return nil
+	})
+	if err != nil {
+		ctx.Error(gtype.ErrInternal, err)
+		return
+	}
+
+	sort.Sort(results)
+	ctx.Success(results)
+}
+
+func (s *Access) GetRequestsDoc(doc gtype.Doc, method string, uri gtype.Uri) {
+	catalog := s.createCatalog(doc, adCatalogAccess)
+	function := catalog.AddFunction(method, uri, "获取权限申请列表")
+	function.SetNote("获取当前登录用户提交的申请, 或需要当前登录用户审批的申请(管理员可查看全部申请)")
+	function.SetInputJsonExample(&model.AccessRequestFilter{
+		Status: -1,
+	})
+	function.SetOutputDataExample([]*model.AccessRequest{
+		{
+			ID:         gtype.NewGuid(),
+			Account:    "zhangsan",
+			Name:       "张三",
+			CreateTime: gtype.DateTime(time.Now()),
+		},
+	})
+	function.AddOutputError(gtype.ErrTokenEmpty)
+	function.AddOutputError(gtype.ErrTokenInvalid)
+	function.AddOutputError(gtype.ErrInternal)
+}
+
+func (s *Access) Approve(ctx gtype.Context, ps gtype.Params) {
+	s.approve(ctx, true)
+}
+
+func (s *Access) ApproveDoc(doc gtype.Doc, method string, uri gtype.Uri) {
+	catalog := s.createCatalog(doc, adCatalogAccess)
+	function := catalog.AddFunction(method, uri, "批准权限申请")
+	function.SetNote("批准后自动将申请人添加到角色组, 并将结果推送给申请人及其他审批人")
+	function.SetRemark("申请人不能审批本人的申请, 即使同时为审批人或组的管理员; 批准时重新校验审批人对角色组的管理权限")
+	function.SetInputJsonExample(&model.AccessRequestApprove{
+		ID: gtype.NewGuid(),
+	})
+	function.SetOutputDataExample(&model.AccessRequest{
+		ID:     gtype.NewGuid(),
+		Status: model.AccessRequestApproved,
+	})
+	function.AddOutputError(gtype.ErrTokenEmpty)
+	function.AddOutputError(gtype.ErrTokenInvalid)
+	function.AddOutputError(gtype.ErrNoPermission)
+	function.AddOutputError(gtype.ErrInput)
+	function.AddOutputError(gtype.ErrInternal)
+}
+
+func (s *Access) Reject(ctx gtype.Context, ps gtype.Params) {
+	s.approve(ctx, false)
+}
+
+func (s *Access) RejectDoc(doc gtype.Doc, method string, uri gtype.Uri) {
+	catalog := s.createCatalog(doc, adCatalogAccess)
+	function := catalog.AddFunction(method, uri, "拒绝权限申请")
+	function.SetRemark("申请人不能审批本人的申请, 即使同时为审批人或组的管理员")
+	function.SetInputJsonExample(&model.AccessRequestApprove{
+		ID:      gtype.NewGuid(),
+		Comment: "无需该权限",
+	})
+	function.SetOutputDataExample(&model.AccessRequest{
+		ID:     gtype.NewGuid(),
+		Status: model.AccessRequestRejected,
+	})
+	function.AddOutputError(gtype.ErrTokenEmpty)
+	function.AddOutputError(gtype.ErrTokenInvalid)
+	function.AddOutputError(gtype.ErrNoPermission)
+	function.AddOutputError(gtype.ErrInput)
+	function.AddOutputError(gtype.ErrInternal)
+}
+
+func (s *Access) approve(ctx gtype.Context, approved bool) {
+	token := s.GetToken(ctx.Token())
+	if token == nil {
+		ctx.Error(gtype.ErrInternal, "凭证无效")
+		return
+	}
+	if s.Dbs == nil {
+		ctx.Error(gtype.ErrInternal, "本地存储不可用")
+		return
+	}
+
+	argument := &model.AccessRequestApprove{}
+	err := ctx.GetJson(argument)
+	if err != nil {
+		ctx.Error(gtype.ErrInput, err)
+		return
+	}
+	if len(argument.ID) < 1 {
+		ctx.Error(gtype.ErrInput.SetDetail("申请标识ID(id)为空"))
+		return
+	}
+
+	item := &model.AccessRequest{}
+	ok, err := s.Dbs.Get(accessRequestBucket, argument.ID, item)
+	if err != nil {
+		ctx.Error(gtype.ErrInternal, err)
+		return
+	}
+	if !ok {
+		ctx.Error(gtype.ErrInput, fmt.Sprintf("申请(%s)不存在", argument.ID))
+		return
+	}
+	if strings.ToLower(item.Account) == strings.ToLower(token.UserAccount) {
+		ctx.Error(gtype.ErrNoPermission, "不能审批本人的申请")
+		return
+	}
+	canApprove, err := s.canApprove(item, token.UserAccount, approved)
+	if err != nil {
+		ctx.Error(gtype.ErrInternal, err)
+		return
+	}
+	if !canApprove {
+		ctx.Error(gtype.ErrNoPermission, "不是该申请的审批人, 或已没有管理该角色组的权限")
+		return
+	}
+
+	// mark the request as handled first, so that two approvers can not handle it at the same time
+	now := gtype.DateTime(time.Now())
+	err = s.Dbs.Modify(accessRequestBucket, item.ID, item, func(existed bool) error {
+		if !existed {
+			return fmt.Errorf("申请(%s)不存在", argument.ID)
+		}
+		if item.Status != model.AccessRequestPending {
+			return fmt.Errorf("申请(%s)已被审批", argument.ID)
+		}
+
+		if approved {
+			item.Status = model.AccessRequestApproved
+		} else {
+			item.Status = model.AccessRequestRejected
+		}
+		item.ApproveBy = token.UserAccount
+		item.ApproveTime = &now
+		item.Comment = argument.Comment
+		return nil
+	})
+	if err != nil {
+		ctx.Error(gtype.ErrInput, err)
+		return
+	}
+
+	if approved {
+		err = s.addMember(item)
+		if err != nil {
+			item.Status = model.AccessRequestFailed
+			item.Error = err.Error()
+			s.LogError(fmt.Sprintf("add member (%s) to group (%s) fail: ", item.Account, item.Group.Account), err)
+		}
+		err = s.Dbs.Put(accessRequestBucket, item.ID, item)
+		if err != nil {
+			s.LogError("save access request fail: ", err)
+		}
+	}
+
+	receivers := make([]string, 0)
+	receivers = append(receivers, item.Account)
+	for _, approver := range item.Approvers {
+		if strings.ToLower(approver) != strings.ToLower(token.UserAccount) {
+			receivers = append(receivers, approver)
+		}
+	}
+	s.WriteWebSocketMessageToAccounts(socket.WSAccessRequestResult, item, receivers...)
+
+	ctx.Success(item)
+}
+
+func (s *Access) addMember(item *model.AccessRequest) error {
+	groupDn, err := s.FromBase64(item.Group.Dn)
+	if err != nil {
+		return err
+	}
+	memberDn, err := s.FromBase64(item.MemberDn)
+	if err != nil {
+		return err
+	}
+
+	return s.AddGroupMember(groupDn, memberDn, model.GroupMemberSourceAccess, item.ApproveBy)
+}
+
+// canApprove checks the approver against the directory again, the approvers are fixed when the request is created
+// and may have lost the authorization since then; a listed approver may always reject the request,
+// but approving it requires the right to manage the group, or being the direct manager of the requester
+// for a non-privileged group
+func (s *Access) canApprove(item *model.AccessRequest, account string, approved bool) (bool, error) {
+	if strings.ToLower(item.Account) == strings.ToLower(account) {
+		return false, nil
+	}
+	groupDn, err := s.FromBase64(item.Group.Dn)
+	if err != nil {
+		return false, err
+	}
+	canManage, err := s.CanManageGroup(account, groupDn)
+	if err != nil {
+		return false, err
+	}
+	if canManage {
+		return true, nil
+	}
+	if !s.isApprover(item, account) {
+		return false, nil
+	}
+	if !approved {
+		return true, nil
+	}
+	if isPrivilegedRole(item.Group.Role) {
+		return false, nil
+	}
+
+	ad := s.Ad()
+	manager, err := ad.GetUserManager(item.Account)
+	if err != nil {
+		if ad.IsNotExit(err) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	return strings.ToLower(manager.Account) == strings.ToLower(account), nil
+}
+
+// isRequestable returns true if the group is a role group of a managed server, share or svn repository,
+// the system administrator group is never requestable
+func (s *Access) isRequestable(account string, resourceType, role int) bool {
+	if resourceType == model.AdResourceOther {
+		return false
+	}
+	if s.Cfg != nil && len(s.Cfg.Ad.AdminGroup) > 0 {
+		if strings.ToLower(account) == strings.ToLower(s.Cfg.Ad.AdminGroup) {
+			return false
+		}
+	}
+
+	switch role {
+	case model.GroupRoleAuthorization,
+		model.GroupRoleRemoteDesktop,
+		model.GroupRoleDatabaseAdmin,
+		model.GroupRoleReadOnly,
+		model.GroupRoleReadWrite,
+		model.GroupRoleReadWriteModify:
+		return true
+	default:
+		return false
+	}
+}
+
+// isPrivilegedRole returns true if the membership of the role grants administrative rights,
+// such requests are only approved by the authorization administrators of the resource
+func isPrivilegedRole(role int) bool {
+	return role == model.GroupRoleAuthorization || role == model.GroupRoleDatabaseAdmin
+}
+
+// isApprover returns true if the account is one of the approvers of the request, the requester is never an approver
+func (s *Access) isApprover(item *model.AccessRequest, account string) bool {
+	if item == nil {
+		return false
+	}
+	if strings.ToLower(item.Account) == strings.ToLower(account) {
+		return false
+	}
+
+	for _, approver := range item.Approvers {
+		if strings.ToLower(approver) == strings.ToLower(account) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (s *Access) hasPendingRequest(account, groupDn string) bool {
+	dn := s.ToBase64(groupDn)
+	exist := false
+	s.Dbs.ForEach(accessRequestBucket, func(key string, value []byte) error {
+		item := &model.AccessRequest{}
+		if json.Unmarshal(value, item) != nil {
+			return nil
+		}
+		if item.Status != model.AccessRequestPending {
+			return nil
+		}
+		if item.Group.Dn == dn && strings.ToLower(item.Account) == strings.ToLower(account) {
+			exist = true
+		}
+		return nil
+	})
+
+	return exist
+}
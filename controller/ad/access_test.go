@@ -0,0 +1,75 @@
+package ad
+
+import (
+	"github.com/csby/goa/config"
+	"github.com/csby/goa/controller"
+	"github.com/csby/goa/data/model"
+	"testing"
+)
+
+func TestAccess_IsApprover(t *testing.T) {
+	s := &Access{}
+	item := &model.AccessRequest{
+		Account:   "zhangsan",
+		Approvers: []string{"Admin", "ZhangSan"},
+	}
+
+	if !s.isApprover(item, "admin") {
+		t.Error("admin should be an approver")
+	}
+	if s.isApprover(item, "zhangsan") {
+		t.Error("the requester should not approve his own request")
+	}
+	if s.isApprover(item, "lisi") {
+		t.Error("lisi should not be an approver")
+	}
+	if s.isApprover(nil, "admin") {
+		t.Error("nil request has no approver")
+	}
+}
+
+func TestExcludeAccount(t *testing.T) {
+	results := excludeAccount([]string{"admin", "ZhangSan", "lisi"}, "zhangsan")
+	if len(results) != 2 || results[0] != "admin" || results[1] != "lisi" {
+		t.Errorf("unexpected accounts: %v", results)
+	}
+	results = excludeAccount(nil, "zhangsan")
+	if len(results) != 0 {
+		t.Errorf("unexpected accounts: %v", results)
+	}
+}
+
+func TestAccess_IsRequestable(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Ad.AdminGroup = "oa.admins"
+	s := NewAccess(nil, &controller.Parameter{Cfg: cfg})
+
+	cases := []struct {
+		account  string
+		resource int
+		role     int
+		expected bool
+	}{
+		{"srv01.read.write.", model.AdResourceServer, model.GroupRoleReadWrite, true},
+		{"srv01.authorization.", model.AdResourceServer, model.GroupRoleAuthorization, true},
+		{"svn01.read.", model.AdResourceSvn, model.GroupRoleReadOnly, true},
+		{"Domain Admins", model.AdResourceOther, model.GroupRoleOther, false},
+		{"srv01.read.", model.AdResourceOther, model.GroupRoleReadOnly, false},
+		{"srv01.users", model.AdResourceServer, model.GroupRoleOther, false},
+		{"OA.Admins", model.AdResourceServer, model.GroupRoleReadOnly, false},
+	}
+	for _, c := range cases {
+		if actual := s.isRequestable(c.account, c.resource, c.role); actual != c.expected {
+			t.Errorf("%s: expected %v, actual %v", c.account, c.expected, actual)
+		}
+	}
+}
+
+func TestIsPrivilegedRole(t *testing.T) {
+	if !isPrivilegedRole(model.GroupRoleAuthorization) || !isPrivilegedRole(model.GroupRoleDatabaseAdmin) {
+		t.Error("authorization and database administrator groups should be privileged")
+	}
+	if isPrivilegedRole(model.GroupRoleReadWrite) || isPrivilegedRole(model.GroupRoleRemoteDesktop) {
+		t.Error("read write and remote desktop groups should not be privileged")
+	}
+}
@@ -6,11 +6,16 @@ import (
 )
 
 const (
-	adCatalogRoot   = "域控"
-	adCatalogUser   = "用户"
-	adCatalogGroup  = "组"
-	adCatalogServer = "服务器"
-	adCatalogShare  = "共享目录"
+	adCatalogRoot    = "域控"
+	adCatalogUser    = "用户"
+	adCatalogGroup   = "组"
+	adCatalogServer  = "服务器"
+	adCatalogShare   = "共享目录"
+	adCatalogAccess  = "权限申请"
+	adCatalogReview  = "权限审核"
+	adCatalogMatrix  = "访问权限"
+	adCatalogHistory = "成员历史"
+	adCatalogVpn     = "VPN授权"
 )
 
 type base struct {
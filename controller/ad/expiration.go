@@ -0,0 +1,239 @@
+package ad
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/csby/goa/controller"
+	"github.com/csby/goa/data/model"
+	"github.com/csby/goa/data/socket"
+	"github.com/csby/gwsf/gtype"
+	"sort"
+	"strings"
+	"time"
+)
+
+func NewExpiration(log gtype.Log, param *controller.Parameter) *Expiration {
+	instance := &Expiration{}
+	instance.SetLog(log)
+	instance.SetParameter(param)
+
+	return instance
+}
+
+// Expiration removes the time-bound group members when they expire
+type Expiration struct {
+	base
+}
+
+// Start checks the expirations periodically in background, the expirations are persisted,
+// so those expired while the service was stopped are removed at the first check
+func (s *Expiration) Start() {
+	if s.Dbs == nil {
+		return
+	}
+
+	go s.run()
+}
+
+func (s *Expiration) GetList(ctx gtype.Context, ps gtype.Params) {
+	token := s.GetToken(ctx.Token())
+	if token == nil {
+		ctx.Error(gtype.ErrInternal, "凭证无效")
+		return
+	}
+	if s.Dbs == nil {
+		ctx.Error(gtype.ErrInternal, "本地存储不可用")
+		return
+	}
+
+	isAdmin := s.IsAdmin(token.UserAccount)
+	account := strings.ToLower(token.UserAccount)
+	results := make(model.AdGroupMemberExpirationCollection, 0)
+	err := s.Dbs.ForEach(controller.GroupMemberExpirationBucket, func(key string, value []byte) error {
+		item := &model.AdGroupMemberExpiration{}
+		if json.Unmarshal(value, item) != nil {
+			return nil
+		}
+		if !isAdmin {
+			if strings.ToLower(item.Member.Account) != account && strings.ToLower(item.CreateBy) != account {
+				return nil
+			}
+		}
+
+		results = append(results, item)
+		return nil
+	})
+	if err != nil {
+		ctx.Error(gtype.ErrInternal, err)
+		return
+	}
+
+	sort.Sort(results)
+	ctx.Success(results)
+}
+
+func (s *Expiration) GetListDoc(doc gtype.Doc, method string, uri gtype.Uri) {
+	catalog := s.createCatalog(doc, adCatalogGroup)
+	function := catalog.AddFunction(method, uri, "获取限时组成员列表")
+	function.SetNote("获取尚未到期的限时组成员, 管理员可查看全部, 其他用户仅可查看自己或由自己添加的成员")
+	function.SetOutputDataExample([]*model.AdGroupMemberExpiration{
+		{
+			Member: model.AdUser{
+				Account: "zhangsan",
+				Name:    "张三",
+			},
+			ExpireTime: gtype.DateTime(time.Now().Add(time.Hour)),
+			CreateBy:   "admin",
+			CreateTime: gtype.DateTime(time.Now()),
+		},
+	})
+	function.AddOutputError(gtype.ErrTokenEmpty)
+	function.AddOutputError(gtype.ErrTokenInvalid)
+	function.AddOutputError(gtype.ErrInternal)
+}
+
+func (s *Expiration) run() {
+	interval := int64(60)
+	if s.Cfg != nil && s.Cfg.Ad.Expiration.Interval > 0 {
+		interval = s.Cfg.Ad.Expiration.Interval
+	}
+	ticker := time.NewTicker(time.Duration(interval) * time.Second)
+	defer ticker.Stop()
+
+	s.check()
+	for range ticker.C {
+		s.check()
+	}
+}
+
+func (s *Expiration) check() {
+	defer func() {
+		if err := recover(); err != nil {
+			s.LogError("check group member expiration error:", err)
+		}
+	}()
+
+	items := make([]*model.AdGroupMemberExpiration, 0)
+	err := s.Dbs.ForEach(controller.GroupMemberExpirationBucket, func(key string, value []byte) error {
+		item := &model.AdGroupMemberExpiration{}
+		if json.Unmarshal(value, item) == nil {
+			items = append(items, item)
+		}
+		return nil
+	})
+	if err != nil {
+		s.LogError("load group member expiration fail:", err)
+		return
+	}
+
+	reminder := int64(60)
+	if s.Cfg != nil && s.Cfg.Ad.Expiration.Reminder > 0 {
+		reminder = s.Cfg.Ad.Expiration.Reminder
+	}
+	expired, reminding := classifyExpirations(items, time.Now(), time.Duration(reminder)*time.Minute)
+	for _, item := range expired {
+		s.expire(item)
+	}
+	for _, item := range reminding {
+		s.remind(item)
+	}
+}
+
+// expire removes the member from the group and closes the record, the record is closed too if the group or
+// the membership does not exist anymore, otherwise it is retried at the next check
+func (s *Expiration) expire(item *model.AdGroupMemberExpiration) {
+	groupDn, err := s.FromBase64(item.Group.Dn)
+	if err != nil {
+		s.LogError(fmt.Sprintf("invalid expiration (%s) is removed:", item.ID), err)
+		s.Dbs.Delete(controller.GroupMemberExpirationBucket, item.ID)
+		return
+	}
+	memberDn, err := s.FromBase64(item.Member.Dn)
+	if err != nil {
+		s.LogError(fmt.Sprintf("invalid expiration (%s) is removed:", item.ID), err)
+		s.Dbs.Delete(controller.GroupMemberExpirationBucket, item.ID)
+		return
+	}
+
+	err = s.RemoveGroupMember(groupDn, memberDn, model.GroupMemberSourceExpired, "")
+	if err != nil {
+		if !s.Ad().IsNotExit(err) {
+			s.LogError(fmt.Sprintf("remove expired member (%s) from group (%s) fail:", item.Member.Account, item.Group.Account), err)
+			return
+		}
+		s.LogInfo(fmt.Sprintf("expiration of member (%s) is closed: group (%s) not exist", item.Member.Account, item.Group.Account))
+	} else {
+		s.LogInfo(fmt.Sprintf("expired member (%s) has been removed from group (%s)", item.Member.Account, item.Group.Account))
+	}
+	s.Dbs.Delete(controller.GroupMemberExpirationBucket, item.ID)
+
+	s.WriteWebSocketMessageToAccounts(socket.WSGroupMemberExpired, item, item.Member.Account, item.CreateBy)
+}
+
+func (s *Expiration) remind(item *model.AdGroupMemberExpiration) {
+	err := s.Dbs.Modify(controller.GroupMemberExpirationBucket, item.ID, item, func(existed bool) error {
+		if !existed {
+			return fmt.Errorf("not exist")
+		}
+		item.Reminded = true
+		return nil
+	})
+	if err != nil {
+		return
+	}
+
+	s.WriteWebSocketMessageToAccounts(socket.WSGroupMemberExpiring, item, item.Member.Account)
+}
+
+func (s *base) setMemberExpiration(groupDn, memberDn string, expireTime gtype.DateTime, operator string) error {
+	if s.Dbs == nil {
+		return fmt.Errorf("本地存储不可用")
+	}
+
+	ad := s.Ad()
+	group, err := ad.GetGroup(groupDn)
+	if err != nil {
+		return err
+	}
+
+	item := &model.AdGroupMemberExpiration{
+		ID:         s.GroupMemberExpirationKey(groupDn, memberDn),
+		ExpireTime: expireTime,
+		CreateBy:   operator,
+		CreateTime: gtype.DateTime(time.Now()),
+	}
+	item.Group.Dn = s.ToBase64(group.DN)
+	item.Group.Account = group.Account
+	item.Group.Description = group.Description
+	item.Group.Info = group.Info
+	item.Group.Role = s.GetAdGroupRole(group.Account)
+	item.Member.Dn = s.ToBase64(memberDn)
+	item.Member.Name = ad.GetDnName(memberDn)
+	member, err := ad.GetUserByDN(memberDn)
+	if err == nil {
+		item.Member.SID = member.SID
+		item.Member.Account = member.Account
+		item.Member.Name = member.Name
+	}
+
+	return s.Dbs.Put(controller.GroupMemberExpirationBucket, item.ID, item)
+}
+
+// classifyExpirations returns the items which are expired at now, and the items to be reminded within the reminder
+func classifyExpirations(items []*model.AdGroupMemberExpiration, now time.Time, reminder time.Duration) ([]*model.AdGroupMemberExpiration, []*model.AdGroupMemberExpiration) {
+	expired := make([]*model.AdGroupMemberExpiration, 0)
+	reminding := make([]*model.AdGroupMemberExpiration, 0)
+	for _, item := range items {
+		if item == nil {
+			continue
+		}
+		expireTime := time.Time(item.ExpireTime)
+		if !expireTime.After(now) {
+			expired = append(expired, item)
+		} else if !item.Reminded && expireTime.Sub(now) <= reminder {
+			reminding = append(reminding, item)
+		}
+	}
+
+	return expired, reminding
+}
@@ -0,0 +1,33 @@
+package ad
+
+import (
+	"github.com/csby/goa/data/model"
+	"github.com/csby/gwsf/gtype"
+	"testing"
+	"time"
+)
+
+func TestClassifyExpirations(t *testing.T) {
+	now := time.Now()
+	items := []*model.AdGroupMemberExpiration{
+		{ID: "expired", ExpireTime: gtype.DateTime(now.Add(-time.Minute))},
+		{ID: "now", ExpireTime: gtype.DateTime(now)},
+		{ID: "soon", ExpireTime: gtype.DateTime(now.Add(30 * time.Minute))},
+		{ID: "reminded", ExpireTime: gtype.DateTime(now.Add(30 * time.Minute)), Reminded: true},
+		{ID: "later", ExpireTime: gtype.DateTime(now.Add(2 * time.Hour))},
+		nil,
+	}
+
+	expired, reminding := classifyExpirations(items, now, time.Hour)
+	if len(expired) != 2 || expired[0].ID != "expired" || expired[1].ID != "now" {
+		t.Errorf("unexpected expired items: %v", expired)
+	}
+	if len(reminding) != 1 || reminding[0].ID != "soon" {
+		t.Errorf("unexpected reminding items: %v", reminding)
+	}
+
+	expired, reminding = classifyExpirations(items, now.Add(3*time.Hour), time.Hour)
+	if len(expired) != 5 || len(reminding) != 0 {
+		t.Errorf("all items should be expired: %d, %d", len(expired), len(reminding))
+	}
+}
@@ -1,10 +1,12 @@
 package ad
 
 import (
+	"fmt"
 	"github.com/csby/goa/controller"
 	"github.com/csby/goa/data/model"
 	"github.com/csby/gwsf/gtype"
 	"sort"
+	"time"
 )
 
 func NewGroup(log gtype.Log, param *controller.Parameter) *Group {
@@ -137,6 +139,12 @@ func (s *Group) GetGrantGroupsDoc(doc gtype.Doc, method string, uri gtype.Uri) {
 }
 
 func (s *Group) AddMember(ctx gtype.Context, ps gtype.Params) {
+	token := s.GetToken(ctx.Token())
+	if token == nil {
+		ctx.Error(gtype.ErrInternal, "凭证无效")
+		return
+	}
+
 	argument := &model.AdGroupMemberArgument{}
 	err := ctx.GetJson(argument)
 	if err != nil {
@@ -163,8 +171,28 @@ func (s *Group) AddMember(ctx gtype.Context, ps gtype.Params) {
 		return
 	}
 
-	ad := s.Ad()
-	err = ad.AddGroupMember(groupDn, memberDn)
+	canManage, err := s.CanManageGroup(token.UserAccount, groupDn)
+	if err != nil {
+		ctx.Error(gtype.ErrInternal, err)
+		return
+	}
+	if !canManage {
+		ctx.Error(gtype.ErrNoPermission, "需要管理员或该组的授权管理员权限才能修改组成员")
+		return
+	}
+
+	if argument.ExpireTime != nil {
+		if !time.Time(*argument.ExpireTime).After(time.Now()) {
+			ctx.Error(gtype.ErrInput, "过期时间(expireTime)必须晚于当前时间")
+			return
+		}
+		if s.Dbs == nil {
+			ctx.Error(gtype.ErrInternal, "本地存储不可用, 无法添加限时成员")
+			return
+		}
+	}
+
+	err = s.addMember(groupDn, memberDn, argument.ExpireTime, token.UserAccount)
 	if err != nil {
 		ctx.Error(gtype.ErrInternal, err)
 		return
@@ -173,15 +201,66 @@ func (s *Group) AddMember(ctx gtype.Context, ps gtype.Params) {
 	ctx.Success(nil)
 }
 
+// addMember saves (or deletes if no expire time) the expiration before adding the member, so that a timed member
+// is never left in the group without it; the previous expiration is restored if the member can not be added
+func (s *Group) addMember(groupDn, memberDn string, expireTime *gtype.DateTime, operator string) error {
+	key := s.GroupMemberExpirationKey(groupDn, memberDn)
+	var previous *model.AdGroupMemberExpiration
+	if s.Dbs != nil {
+		item := &model.AdGroupMemberExpiration{}
+		ok, err := s.Dbs.Get(controller.GroupMemberExpirationBucket, key, item)
+		if err != nil {
+			return err
+		}
+		if ok {
+			previous = item
+		}
+	}
+
+	var err error
+	if expireTime != nil {
+		err = s.setMemberExpiration(groupDn, memberDn, *expireTime, operator)
+	} else {
+		err = s.DeleteGroupMemberExpiration(groupDn, memberDn)
+	}
+	if err != nil {
+		return fmt.Errorf("保存过期时间失败: %v", err)
+	}
+
+	err = s.AddGroupMember(groupDn, memberDn, model.GroupMemberSourceApi, operator)
+	if err != nil {
+		var re error
+		if previous != nil {
+			re = s.Dbs.Put(controller.GroupMemberExpirationBucket, key, previous)
+		} else {
+			re = s.DeleteGroupMemberExpiration(groupDn, memberDn)
+		}
+		if re != nil {
+			s.LogError(fmt.Sprintf("restore expiration of member (%s) in group (%s) fail: ", memberDn, groupDn), re)
+		}
+		return err
+	}
+
+	return nil
+}
+
 func (s *Group) AddMemberDoc(doc gtype.Doc, method string, uri gtype.Uri) {
 	catalog := s.createCatalog(doc, adCatalogGroup)
 	function := catalog.AddFunction(method, uri, "添加组成员")
+	function.SetNote("仅管理员、组所在组织单位的授权管理员及组的管理者(managedBy)可以修改组成员; 指定过期时间(expireTime)时, 到期后自动移除该成员")
 	function.SetInputJsonExample(&model.AdGroupMemberArgument{})
 	function.AddOutputError(gtype.ErrInternal)
 	function.AddOutputError(gtype.ErrInput)
+	function.AddOutputError(gtype.ErrNoPermission)
 }
 
 func (s *Group) RemoveMember(ctx gtype.Context, ps gtype.Params) {
+	token := s.GetToken(ctx.Token())
+	if token == nil {
+		ctx.Error(gtype.ErrInternal, "凭证无效")
+		return
+	}
+
 	argument := &model.AdGroupMemberArgument{}
 	err := ctx.GetJson(argument)
 	if err != nil {
@@ -208,8 +287,17 @@ func (s *Group) RemoveMember(ctx gtype.Context, ps gtype.Params) {
 		return
 	}
 
-	ad := s.Ad()
-	err = ad.RemoveGroupMember(groupDn, memberDn)
+	canManage, err := s.CanManageGroup(token.UserAccount, groupDn)
+	if err != nil {
+		ctx.Error(gtype.ErrInternal, err)
+		return
+	}
+	if !canManage {
+		ctx.Error(gtype.ErrNoPermission, "需要管理员或该组的授权管理员权限才能修改组成员")
+		return
+	}
+
+	err = s.RemoveGroupMember(groupDn, memberDn, model.GroupMemberSourceApi, token.UserAccount)
 	if err != nil {
 		ctx.Error(gtype.ErrInternal, err)
 		return
@@ -221,7 +309,9 @@ func (s *Group) RemoveMember(ctx gtype.Context, ps gtype.Params) {
 func (s *Group) RemoveMemberDoc(doc gtype.Doc, method string, uri gtype.Uri) {
 	catalog := s.createCatalog(doc, adCatalogGroup)
 	function := catalog.AddFunction(method, uri, "移除组成员")
+	function.SetNote("仅管理员、组所在组织单位的授权管理员及组的管理者(managedBy)可以修改组成员")
 	function.SetInputJsonExample(&model.AdGroupMemberArgument{})
 	function.AddOutputError(gtype.ErrInternal)
 	function.AddOutputError(gtype.ErrInput)
+	function.AddOutputError(gtype.ErrNoPermission)
 }
@@ -0,0 +1,605 @@
+package ad
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/csby/goa/controller"
+	"github.com/csby/goa/data/model"
+	"github.com/csby/gwsf/gtype"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	memberSnapshotBucket = "group.member.snapshot"
+	memberSnapshotLayout = "2006-01-02"
+)
+
+func NewHistory(log gtype.Log, param *controller.Parameter) *History {
+	instance := &History{}
+	instance.SetLog(log)
+	instance.SetParameter(param)
+
+	return instance
+}
+
+// History keeps a daily snapshot of the members of the managed role groups,
+// together with the member changes made through goa
+type History struct {
+	base
+}
+
+// Start takes the snapshot of today in background if it has not been taken yet, and checks again every hour
+func (s *History) Start() {
+	if s.Dbs == nil || s.Cfg == nil {
+		return
+	}
+	if !s.Cfg.Ad.History.Enabled {
+		return
+	}
+
+	go s.run()
+}
+
+func (s *History) CreateSnapshot(ctx gtype.Context, ps gtype.Params) {
+	token := s.GetToken(ctx.Token())
+	if token == nil {
+		ctx.Error(gtype.ErrInternal, "凭证无效")
+		return
+	}
+	if s.Dbs == nil {
+		ctx.Error(gtype.ErrInternal, "本地存储不可用")
+		return
+	}
+	if !s.IsAdmin(token.UserAccount) {
+		ctx.Error(gtype.ErrNoPermission, "仅管理员可保存快照")
+		return
+	}
+
+	snapshot, err := s.takeSnapshot()
+	if err != nil {
+		ctx.Error(gtype.ErrInternal, err)
+		return
+	}
+	err = s.Dbs.Put(memberSnapshotBucket, snapshot.Date, snapshot)
+	if err != nil {
+		ctx.Error(gtype.ErrInternal, err)
+		return
+	}
+
+	ctx.Success(snapshot.Date)
+}
+
+func (s *History) CreateSnapshotDoc(doc gtype.Doc, method string, uri gtype.Uri) {
+	catalog := s.createCatalog(doc, adCatalogGroup, adCatalogHistory)
+	function := catalog.AddFunction(method, uri, "保存成员快照")
+	function.SetNote("仅管理员可操作, 立即保存角色组成员快照并覆盖当天已有的快照, 成功时返回快照日期")
+	function.SetOutputDataExample(time.Now().Format(memberSnapshotLayout))
+	function.AddOutputError(gtype.ErrTokenEmpty)
+	function.AddOutputError(gtype.ErrTokenInvalid)
+	function.AddOutputError(gtype.ErrNoPermission)
+	function.AddOutputError(gtype.ErrInternal)
+}
+
+func (s *History) GetSnapshots(ctx gtype.Context, ps gtype.Params) {
+	if s.Dbs == nil {
+		ctx.Error(gtype.ErrInternal, "本地存储不可用")
+		return
+	}
+
+	dates := make([]string, 0)
+	err := s.Dbs.ForEach(memberSnapshotBucket, func(key string, value []byte) error {
+		dates = append(dates, key)
+		return nil
+	})
+	if err != nil {
+		ctx.Error(gtype.ErrInternal, err)
+		return
+	}
+
+	sort.Strings(dates)
+	ctx.Success(dates)
+}
+
+func (s *History) GetSnapshotsDoc(doc gtype.Doc, method string, uri gtype.Uri) {
+	catalog := s.createCatalog(doc, adCatalogGroup, adCatalogHistory)
+	function := catalog.AddFunction(method, uri, "获取快照日期列表")
+	function.SetOutputDataExample([]string{time.Now().Format(memberSnapshotLayout)})
+	function.AddOutputError(gtype.ErrInternal)
+}
+
+func (s *History) GetDiff(ctx gtype.Context, ps gtype.Params) {
+	token := s.GetToken(ctx.Token())
+	if token == nil {
+		ctx.Error(gtype.ErrInternal, "凭证无效")
+		return
+	}
+	if s.Dbs == nil {
+		ctx.Error(gtype.ErrInternal, "本地存储不可用")
+		return
+	}
+
+	argument := &model.GroupMemberDiffFilter{}
+	err := ctx.GetJson(argument)
+	if err != nil {
+		ctx.Error(gtype.ErrInput, err)
+		return
+	}
+	if len(argument.From) < 1 {
+		ctx.Error(gtype.ErrInput.SetDetail("开始日期(from)为空"))
+		return
+	}
+	groupKey := ""
+	if len(argument.GroupDn) > 0 {
+		groupDn, ge := s.FromBase64(argument.GroupDn)
+		if ge != nil {
+			ctx.Error(gtype.ErrInput, "groupDn不是有效base64字符: ", ge)
+			return
+		}
+		groupKey = strings.ToLower(groupDn)
+		canManage, ce := s.CanManageGroup(token.UserAccount, groupDn)
+		if ce != nil {
+			ctx.Error(gtype.ErrInternal, ce)
+			return
+		}
+		if !canManage {
+			ctx.Error(gtype.ErrNoPermission, "需要管理员或该组的授权管理员权限")
+			return
+		}
+	} else if !s.IsAdmin(token.UserAccount) {
+		ctx.Error(gtype.ErrNoPermission, "仅管理员可对比全部角色组")
+		return
+	}
+
+	from, err := s.findSnapshot(argument.From)
+	if err != nil {
+		ctx.Error(gtype.ErrInput, err)
+		return
+	}
+	var to *model.GroupMemberSnapshot
+	if len(argument.To) > 0 {
+		to, err = s.findSnapshot(argument.To)
+		if err != nil {
+			ctx.Error(gtype.ErrInput, err)
+			return
+		}
+	} else {
+		to, err = s.takeSnapshot()
+		if err != nil {
+			ctx.Error(gtype.ErrInternal, err)
+			return
+		}
+		to.Date = ""
+	}
+
+	result := &model.GroupMemberDiff{
+		From: from.Date,
+		To:   to.Date,
+	}
+	groups := make(model.GroupMemberDiffItemCollection, 0)
+	for _, item := range s.diff(from, to) {
+		if len(groupKey) > 0 && s.groupKey(&item.Group) != groupKey {
+			continue
+		}
+		groups = append(groups, item)
+	}
+	sort.Sort(groups)
+	result.Groups = groups
+
+	ctx.Success(result)
+}
+
+func (s *History) GetDiffDoc(doc gtype.Doc, method string, uri gtype.Uri) {
+	catalog := s.createCatalog(doc, adCatalogGroup, adCatalogHistory)
+	function := catalog.AddFunction(method, uri, "对比两个日期的组成员")
+	function.SetNote("分别取不晚于开始日期及结束日期的最近快照进行对比, 结束日期为空时与当前成员对比; " +
+		"仅管理员可对比全部角色组, 组的授权管理员可对比指定的组")
+	function.SetInputJsonExample(&model.GroupMemberDiffFilter{
+		From: time.Now().AddDate(0, -1, 0).Format(memberSnapshotLayout),
+		To:   time.Now().Format(memberSnapshotLayout),
+	})
+	function.SetOutputDataExample(&model.GroupMemberDiff{
+		From: time.Now().AddDate(0, -1, 0).Format(memberSnapshotLayout),
+		To:   time.Now().Format(memberSnapshotLayout),
+		Groups: []*model.GroupMemberDiffItem{
+			{
+				Group: model.AdGroup{
+					Account: "oa.admins",
+				},
+				Added: []*model.AdUser{
+					{
+						Account: "zhangsan",
+						Name:    "张三",
+					},
+				},
+				Removed: []*model.AdUser{},
+			},
+		},
+	})
+	function.AddOutputError(gtype.ErrTokenEmpty)
+	function.AddOutputError(gtype.ErrTokenInvalid)
+	function.AddOutputError(gtype.ErrNoPermission)
+	function.AddOutputError(gtype.ErrInput)
+	function.AddOutputError(gtype.ErrInternal)
+}
+
+func (s *History) GetTimeline(ctx gtype.Context, ps gtype.Params) {
+	token := s.GetToken(ctx.Token())
+	if token == nil {
+		ctx.Error(gtype.ErrInternal, "凭证无效")
+		return
+	}
+	if s.Dbs == nil {
+		ctx.Error(gtype.ErrInternal, "本地存储不可用")
+		return
+	}
+
+	argument := &model.GroupMemberTimelineFilter{}
+	err := ctx.GetJson(argument)
+	if err != nil {
+		ctx.Error(gtype.ErrInput, err)
+		return
+	}
+	if len(argument.GroupDn) < 1 {
+		ctx.Error(gtype.ErrInput.SetDetail("groupDn为空"))
+		return
+	}
+	groupDn, err := s.FromBase64(argument.GroupDn)
+	if err != nil {
+		ctx.Error(gtype.ErrInput, "groupDn不是有效base64字符: ", err)
+		return
+	}
+	canManage, err := s.CanManageGroup(token.UserAccount, groupDn)
+	if err != nil {
+		ctx.Error(gtype.ErrInternal, err)
+		return
+	}
+	if !canManage {
+		ctx.Error(gtype.ErrNoPermission, "需要管理员或该组的授权管理员权限")
+		return
+	}
+	groupKey := strings.ToLower(groupDn)
+
+	events := make(model.GroupMemberEventCollection, 0)
+	err = s.Dbs.ForEach(controller.GroupMemberEventBucket, func(key string, value []byte) error {
+		item := &model.GroupMemberEvent{}
+		if json.Unmarshal(value, item) != nil {
+			return nil
+		}
+		if s.groupKey(&item.Group) == groupKey {
+			events = append(events, item)
+		}
+		return nil
+	})
+	if err != nil {
+		ctx.Error(gtype.ErrInternal, err)
+		return
+	}
+
+	// the changes found by comparing the snapshots are added if they were not made through goa
+	snapshots, err := s.getSnapshots()
+	if err != nil {
+		ctx.Error(gtype.ErrInternal, err)
+		return
+	}
+	detected := make(model.GroupMemberEventCollection, 0)
+	for i := 1; i < len(snapshots); i++ {
+		prev := snapshots[i-1]
+		cur := snapshots[i]
+		for _, item := range s.diff(prev, cur) {
+			if s.groupKey(&item.Group) != groupKey {
+				continue
+			}
+			changes := map[int][]*model.AdUser{
+				model.GroupMemberAdded:   item.Added,
+				model.GroupMemberRemoved: item.Removed,
+			}
+			for action, members := range changes {
+				for _, member := range members {
+					if s.hasEvent(events, member, action, prev.CreateTime, cur.CreateTime) {
+						continue
+					}
+					detected = append(detected, &model.GroupMemberEvent{
+						ID:     fmt.Sprintf("%s.%s.%d", cur.Date, member.Dn, action),
+						Group:  item.Group,
+						Member: *member,
+						Action: action,
+						Source: model.GroupMemberSourceSnapshot,
+						Time:   cur.CreateTime,
+					})
+				}
+			}
+		}
+	}
+	events = append(events, detected...)
+
+	sort.Sort(events)
+	ctx.Success(events)
+}
+
+func (s *History) GetTimelineDoc(doc gtype.Doc, method string, uri gtype.Uri) {
+	catalog := s.createCatalog(doc, adCatalogGroup, adCatalogHistory)
+	function := catalog.AddFunction(method, uri, "获取组成员变更记录")
+	function.SetNote("包含通过本系统添加或移除成员的记录(含操作人), 以及对比相邻快照发现的其他变更(操作人未知); 仅管理员及组的授权管理员可查看")
+	function.SetInputJsonExample(&model.GroupMemberTimelineFilter{})
+	function.SetOutputDataExample([]*model.GroupMemberEvent{
+		{
+			ID: gtype.NewGuid(),
+			Group: model.AdGroup{
+				Account: "oa.admins",
+			},
+			Member: model.AdUser{
+				Account: "zhangsan",
+				Name:    "张三",
+			},
+			Action:   model.GroupMemberAdded,
+			Source:   model.GroupMemberSourceApi,
+			Operator: "admin",
+			Time:     gtype.DateTime(time.Now()),
+		},
+	})
+	function.AddOutputError(gtype.ErrTokenEmpty)
+	function.AddOutputError(gtype.ErrTokenInvalid)
+	function.AddOutputError(gtype.ErrNoPermission)
+	function.AddOutputError(gtype.ErrInput)
+	function.AddOutputError(gtype.ErrInternal)
+}
+
+func (s *History) run() {
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+
+	s.check()
+	for range ticker.C {
+		s.check()
+	}
+}
+
+func (s *History) check() {
+	defer func() {
+		if err := recover(); err != nil {
+			s.LogError("group member snapshot error:", err)
+		}
+	}()
+
+	date := time.Now().Format(memberSnapshotLayout)
+	ok, err := s.Dbs.Get(memberSnapshotBucket, date, &model.GroupMemberSnapshot{})
+	if err != nil || ok {
+		return
+	}
+
+	snapshot, err := s.takeSnapshot()
+	if err != nil {
+		s.LogError("take group member snapshot fail:", err)
+		return
+	}
+	err = s.Dbs.Put(memberSnapshotBucket, snapshot.Date, snapshot)
+	if err != nil {
+		s.LogError("save group member snapshot fail:", err)
+		return
+	}
+
+	s.purge()
+}
+
+func (s *History) purge() {
+	days := s.Cfg.Ad.History.Retention
+	if days <= 0 {
+		return
+	}
+	expired := time.Now().AddDate(0, 0, -int(days))
+
+	dates := make([]string, 0)
+	s.Dbs.ForEach(memberSnapshotBucket, func(key string, value []byte) error {
+		if key < expired.Format(memberSnapshotLayout) {
+			dates = append(dates, key)
+		}
+		return nil
+	})
+	for _, date := range dates {
+		s.Dbs.Delete(memberSnapshotBucket, date)
+	}
+
+	keys := make([]string, 0)
+	s.Dbs.ForEach(controller.GroupMemberEventBucket, func(key string, value []byte) error {
+		if key < s.GroupMemberEventKeyPrefix(expired) {
+			keys = append(keys, key)
+		}
+		return nil
+	})
+	for _, key := range keys {
+		s.Dbs.Delete(controller.GroupMemberEventBucket, key)
+	}
+}
+
+// takeSnapshot reads the direct members of the role groups of the servers, shares, svn repositories
+// and the administrator group
+func (s *History) takeSnapshot() (*model.GroupMemberSnapshot, error) {
+	now := time.Now()
+	snapshot := &model.GroupMemberSnapshot{
+		Date:       now.Format(memberSnapshotLayout),
+		CreateTime: gtype.DateTime(now),
+		Groups:     make([]*model.GroupMemberSnapshotGroup, 0),
+	}
+
+	groups := make([]model.AdGroup, 0)
+	ad := s.Ad()
+	if len(s.Cfg.Ad.AdminGroup) > 0 {
+		admin, err := ad.GetGroupByAccount(s.Cfg.Ad.AdminGroup)
+		if err == nil {
+			group := model.AdGroup{}
+			group.Dn = s.ToBase64(admin.DN)
+			group.Account = admin.Account
+			group.Description = admin.Description
+			group.Info = admin.Info
+			groups = append(groups, group)
+		} else if !ad.IsNotExit(err) {
+			return nil, err
+		}
+	}
+	resourceGroups, err := s.GetAdResourceGroups()
+	if err != nil {
+		return nil, err
+	}
+	for _, item := range resourceGroups {
+		groups = append(groups, item.Group.AdGroup)
+	}
+
+	for _, group := range groups {
+		groupDn, _ := s.FromBase64(group.Dn)
+		users, ue := ad.GetUsersFromGroup(groupDn)
+		if ue != nil {
+			return nil, ue
+		}
+
+		item := &model.GroupMemberSnapshotGroup{
+			Group:   group,
+			Members: make([]*model.AdUser, 0),
+		}
+		for _, user := range users {
+			if user == nil {
+				continue
+			}
+			member := &model.AdUser{}
+			member.Dn = s.ToBase64(user.DN)
+			member.SID = user.SID
+			member.Account = user.Account
+			member.Name = user.Name
+			item.Members = append(item.Members, member)
+		}
+		snapshot.Groups = append(snapshot.Groups, item)
+	}
+
+	return snapshot, nil
+}
+
+func (s *History) getSnapshots() ([]*model.GroupMemberSnapshot, error) {
+	results := make([]*model.GroupMemberSnapshot, 0)
+	err := s.Dbs.ForEach(memberSnapshotBucket, func(key string, value []byte) error {
+		item := &model.GroupMemberSnapshot{}
+		if json.Unmarshal(value, item) == nil {
+			results = append(results, item)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].Date < results[j].Date
+	})
+	return results, nil
+}
+
+// findSnapshot returns the latest snapshot which is not later than the date
+func (s *History) findSnapshot(date string) (*model.GroupMemberSnapshot, error) {
+	t, err := time.ParseInLocation(memberSnapshotLayout, date, time.Local)
+	if err != nil {
+		return nil, fmt.Errorf("日期(%s)无效, 格式应为: %s", date, memberSnapshotLayout)
+	}
+	date = t.Format(memberSnapshotLayout)
+
+	found := ""
+	err = s.Dbs.ForEach(memberSnapshotBucket, func(key string, value []byte) error {
+		if key <= date && key > found {
+			found = key
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(found) < 1 {
+		return nil, fmt.Errorf("日期(%s)及之前没有快照", date)
+	}
+
+	snapshot := &model.GroupMemberSnapshot{}
+	_, err = s.Dbs.Get(memberSnapshotBucket, found, snapshot)
+	if err != nil {
+		return nil, err
+	}
+
+	return snapshot, nil
+}
+
+// diff returns the groups whose members are changed from the snapshot to another one,
+// the groups which exist in only one of the snapshots are ignored
+func (s *History) diff(from, to *model.GroupMemberSnapshot) []*model.GroupMemberDiffItem {
+	results := make([]*model.GroupMemberDiffItem, 0)
+	olds := make(map[string]*model.GroupMemberSnapshotGroup)
+	for _, group := range from.Groups {
+		olds[s.groupKey(&group.Group)] = group
+	}
+
+	for _, group := range to.Groups {
+		old, ok := olds[s.groupKey(&group.Group)]
+		if !ok {
+			continue
+		}
+
+		oldMembers := make(map[string]bool)
+		for _, member := range old.Members {
+			oldMembers[s.memberKey(member)] = true
+		}
+		newMembers := make(map[string]bool)
+		for _, member := range group.Members {
+			newMembers[s.memberKey(member)] = true
+		}
+
+		item := &model.GroupMemberDiffItem{
+			Group:   group.Group,
+			Added:   make([]*model.AdUser, 0),
+			Removed: make([]*model.AdUser, 0),
+		}
+		for _, member := range group.Members {
+			if !oldMembers[s.memberKey(member)] {
+				item.Added = append(item.Added, member)
+			}
+		}
+		for _, member := range old.Members {
+			if !newMembers[s.memberKey(member)] {
+				item.Removed = append(item.Removed, member)
+			}
+		}
+		if len(item.Added) > 0 || len(item.Removed) > 0 {
+			results = append(results, item)
+		}
+	}
+
+	return results
+}
+
+func (s *History) hasEvent(events []*model.GroupMemberEvent, member *model.AdUser, action int, from, to gtype.DateTime) bool {
+	for _, event := range events {
+		if event.Action != action {
+			continue
+		}
+		if s.memberKey(&event.Member) != s.memberKey(member) {
+			continue
+		}
+		t := time.Time(event.Time)
+		if t.After(time.Time(from)) && !t.After(time.Time(to)) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (s *base) groupKey(group *model.AdGroup) string {
+	dn, _ := s.FromBase64(group.Dn)
+	return strings.ToLower(dn)
+}
+
+// memberKey returns the lower case of the decoded DN, DNs are compared case-insensitively but base64 is not;
+// the encoded value is used as is if it can not be decoded
+func (s *base) memberKey(member *model.AdUser) string {
+	dn, err := s.FromBase64(member.Dn)
+	if err != nil {
+		return member.Dn
+	}
+
+	return strings.ToLower(dn)
+}
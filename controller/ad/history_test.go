@@ -0,0 +1,87 @@
+package ad
+
+import (
+	"github.com/csby/goa/data/model"
+	"github.com/csby/gwsf/gtype"
+	"testing"
+	"time"
+)
+
+func testHistoryGroup(s *History, groupDn string, memberDns ...string) *model.GroupMemberSnapshotGroup {
+	group := &model.GroupMemberSnapshotGroup{
+		Members: make([]*model.AdUser, 0),
+	}
+	group.Group.Dn = s.ToBase64(groupDn)
+	for _, dn := range memberDns {
+		member := testHistoryMember(s, dn)
+		member.Account = dn
+		group.Members = append(group.Members, member)
+	}
+
+	return group
+}
+
+func testHistoryMember(s *History, dn string) *model.AdUser {
+	member := &model.AdUser{}
+	member.Dn = s.ToBase64(dn)
+
+	return member
+}
+
+func TestHistory_Diff(t *testing.T) {
+	s := &History{}
+	// the base64 of the two DNs differ only in case: Q049YWFh and Q049YWFH
+	from := &model.GroupMemberSnapshot{
+		Groups: []*model.GroupMemberSnapshotGroup{
+			testHistoryGroup(s, "CN=g1,DC=example,DC=com", "CN=aaa", "CN=Zhang San,OU=Users"),
+			testHistoryGroup(s, "CN=g2,DC=example,DC=com", "CN=lisi"),
+			testHistoryGroup(s, "CN=g3,DC=example,DC=com", "CN=wangwu"),
+		},
+	}
+	to := &model.GroupMemberSnapshot{
+		Groups: []*model.GroupMemberSnapshotGroup{
+			testHistoryGroup(s, "cn=G1,dc=example,dc=com", "CN=aaG", "cn=zhang san,ou=users"),
+			testHistoryGroup(s, "CN=g2,DC=example,DC=com", "CN=lisi"),
+			testHistoryGroup(s, "CN=g4,DC=example,DC=com", "CN=zhaoliu"),
+		},
+	}
+
+	items := s.diff(from, to)
+	if len(items) != 1 {
+		t.Fatalf("only g1 should be changed: %d", len(items))
+	}
+	item := items[0]
+	if len(item.Added) != 1 || item.Added[0].Account != "CN=aaG" {
+		t.Errorf("unexpected added members: %v", item.Added)
+	}
+	if len(item.Removed) != 1 || item.Removed[0].Account != "CN=aaa" {
+		t.Errorf("unexpected removed members: %v", item.Removed)
+	}
+}
+
+func TestHistory_HasEvent(t *testing.T) {
+	s := &History{}
+	now := time.Now()
+	events := []*model.GroupMemberEvent{
+		{
+			Member: *testHistoryMember(s, "CN=aaa"),
+			Action: model.GroupMemberAdded,
+			Time:   gtype.DateTime(now),
+		},
+	}
+	from := gtype.DateTime(now.Add(-time.Hour))
+	to := gtype.DateTime(now.Add(time.Hour))
+
+	if !s.hasEvent(events, testHistoryMember(s, "cn=AAA"), model.GroupMemberAdded, from, to) {
+		t.Error("the DN should be compared case-insensitively")
+	}
+	if s.hasEvent(events, testHistoryMember(s, "CN=aaG"), model.GroupMemberAdded, from, to) {
+		t.Error("different DN should not match")
+	}
+	if s.hasEvent(events, testHistoryMember(s, "CN=aaa"), model.GroupMemberRemoved, from, to) {
+		t.Error("different action should not match")
+	}
+	if s.hasEvent(events, testHistoryMember(s, "CN=aaa"), model.GroupMemberAdded, to, to) {
+		t.Error("event out of range should not match")
+	}
+}
@@ -0,0 +1,379 @@
+package ad
+
+import (
+	"fmt"
+	"github.com/csby/goa/controller"
+	"github.com/csby/goa/data/model"
+	"github.com/csby/gwsf/gtype"
+	"github.com/xuri/excelize/v2"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+func NewMatrix(log gtype.Log, param *controller.Parameter) *Matrix {
+	instance := &Matrix{}
+	instance.SetLog(log)
+	instance.SetParameter(param)
+
+	return instance
+}
+
+// Matrix is the effective access of the users and groups to the servers, shares and svn repositories,
+// nested group membership is resolved
+type Matrix struct {
+	base
+}
+
+func (s *Matrix) GetPrincipalAccess(ctx gtype.Context, ps gtype.Params) {
+	argument := &model.AccessMatrixPrincipalFilter{}
+	err := ctx.GetJson(argument)
+	if err != nil {
+		ctx.Error(gtype.ErrInput, err)
+		return
+	}
+
+	results, ge := s.getPrincipalAccess(ctx, argument.Account)
+	if ge != nil {
+		ctx.Error(ge)
+		return
+	}
+
+	ctx.Success(results)
+}
+
+func (s *Matrix) GetPrincipalAccessDoc(doc gtype.Doc, method string, uri gtype.Uri) {
+	catalog := s.createCatalog(doc, adCatalogMatrix)
+	function := catalog.AddFunction(method, uri, "获取用户或组可访问的资源")
+	function.SetNote("解析嵌套组成员关系, 列出用户或组在服务器、共享目录及SVN存储库中的全部角色; 管理员可查询任意用户或组, 其他用户仅可查询自己")
+	function.SetInputJsonExample(&model.AccessMatrixPrincipalFilter{
+		Account: "zhangsan",
+	})
+	function.SetOutputDataExample(s.entriesExample())
+	function.AddOutputError(gtype.ErrTokenEmpty)
+	function.AddOutputError(gtype.ErrTokenInvalid)
+	function.AddOutputError(gtype.ErrNoPermission)
+	function.AddOutputError(gtype.ErrInput)
+	function.AddOutputError(gtype.ErrInternal)
+}
+
+func (s *Matrix) GetResourceAccess(ctx gtype.Context, ps gtype.Params) {
+	argument := &model.AccessMatrixResourceFilter{}
+	err := ctx.GetJson(argument)
+	if err != nil {
+		ctx.Error(gtype.ErrInput, err)
+		return
+	}
+
+	results, ge := s.getResourceAccess(ctx, argument.Dn)
+	if ge != nil {
+		ctx.Error(ge)
+		return
+	}
+
+	ctx.Success(results)
+}
+
+func (s *Matrix) GetResourceAccessDoc(doc gtype.Doc, method string, uri gtype.Uri) {
+	catalog := s.createCatalog(doc, adCatalogMatrix)
+	function := catalog.AddFunction(method, uri, "获取可访问资源的用户")
+	function.SetNote("解析嵌套组成员关系, 列出可访问服务器、共享目录或SVN存储库的全部用户及其角色; 仅管理员及该资源的授权管理员可查询")
+	function.SetInputJsonExample(&model.AccessMatrixResourceFilter{
+		Dn: "T1U9UHVibGljIFNoYXJlLE9VPeWFseS6q+ebruW9lSxEQz1leGFtcGxlLERDPWNvbQ==",
+	})
+	function.SetOutputDataExample(s.entriesExample())
+	function.AddOutputError(gtype.ErrTokenEmpty)
+	function.AddOutputError(gtype.ErrTokenInvalid)
+	function.AddOutputError(gtype.ErrNoPermission)
+	function.AddOutputError(gtype.ErrInput)
+	function.AddOutputError(gtype.ErrInternal)
+}
+
+func (s *Matrix) Export(ctx gtype.Context, ps gtype.Params) {
+	argument := &model.AccessMatrixExportFilter{}
+	err := ctx.GetJson(argument)
+	if err != nil {
+		ctx.Error(gtype.ErrInput, err)
+		return
+	}
+
+	var results model.AccessMatrixEntryCollection
+	var ge gtype.Error
+	name := ""
+	if len(argument.Account) > 0 {
+		name = argument.Account
+		results, ge = s.getPrincipalAccess(ctx, argument.Account)
+	} else if len(argument.Dn) > 0 {
+		dn, _ := s.FromBase64(argument.Dn)
+		name = s.Ad().GetDnName(dn)
+		results, ge = s.getResourceAccess(ctx, argument.Dn)
+	} else {
+		ge = gtype.ErrInput.SetDetail("帐号名称(account)及资源唯一名称(dn)均为空")
+	}
+	if ge != nil {
+		ctx.Error(ge)
+		return
+	}
+
+	file := excelize.NewFile()
+	defer file.Close()
+	sheet := "访问权限"
+	file.SetSheetName(file.GetSheetName(0), sheet)
+	file.SetSheetRow(sheet, "A1", &[]interface{}{"资源类型", "资源名称", "角色组", "角色", "帐号", "名称", "成员关系"})
+	for i, item := range results {
+		direct := "嵌套组"
+		if item.Direct {
+			direct = "直接成员"
+		}
+		cell, _ := excelize.CoordinatesToCellName(1, i+2)
+		file.SetSheetRow(sheet, cell, &[]interface{}{
+			s.resourceTypeName(item.Resource.Type),
+			item.Resource.Name,
+			item.Group.Account,
+			s.groupRoleName(item.Group.Role),
+			item.Principal.Account,
+			item.Principal.Name,
+			direct,
+		})
+	}
+
+	fileName := fmt.Sprintf("访问权限-%s-%s.xlsx", name, time.Now().Format("20060102150405"))
+	w := ctx.Response()
+	w.Header().Set("Content-Type", "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename*=UTF-8''%s", url.PathEscape(fileName)))
+	err = file.Write(w)
+	if err != nil {
+		s.LogError("write access matrix xlsx fail:", err)
+	}
+}
+
+func (s *Matrix) ExportDoc(doc gtype.Doc, method string, uri gtype.Uri) {
+	catalog := s.createCatalog(doc, adCatalogMatrix)
+	function := catalog.AddFunction(method, uri, "导出访问权限")
+	function.SetNote("以XLSX文件导出用户或组可访问的资源(account不为空), 或可访问资源的用户(dn不为空), 权限要求与对应的查询接口相同")
+	function.SetInputJsonExample(&model.AccessMatrixExportFilter{
+		Account: "zhangsan",
+	})
+	function.AddOutputHeader("Content-Type", "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet")
+	function.AddOutputError(gtype.ErrTokenEmpty)
+	function.AddOutputError(gtype.ErrTokenInvalid)
+	function.AddOutputError(gtype.ErrNoPermission)
+	function.AddOutputError(gtype.ErrInput)
+	function.AddOutputError(gtype.ErrInternal)
+}
+
+func (s *Matrix) getPrincipalAccess(ctx gtype.Context, account string) (model.AccessMatrixEntryCollection, gtype.Error) {
+	token := s.GetToken(ctx.Token())
+	if token == nil {
+		return nil, gtype.ErrInternal.SetDetail("凭证无效")
+	}
+	if len(account) < 1 {
+		return nil, gtype.ErrInput.SetDetail("帐号名称(account)为空")
+	}
+	if strings.ToLower(account) != strings.ToLower(token.UserAccount) && !s.IsAdmin(token.UserAccount) {
+		return nil, gtype.ErrNoPermission.SetDetail("仅管理员可查询其他用户或组")
+	}
+
+	ad := s.Ad()
+	principal := model.AccessPrincipal{}
+	principalDn := ""
+	user, err := ad.GetUser(account)
+	if err == nil {
+		principalDn = user.DN
+		principal.Type = model.AccessPrincipalUser
+		principal.SID = user.SID
+		principal.Account = user.Account
+		principal.Name = user.Name
+	} else if ad.IsNotExit(err) {
+		group, ge := ad.GetGroupByAccount(account)
+		if ge != nil {
+			if ad.IsNotExit(ge) {
+				return nil, gtype.ErrInput.SetDetail(fmt.Sprintf("用户或组(%s)不存在", account))
+			}
+			return nil, gtype.ErrInternal.SetDetail(ge)
+		}
+		principalDn = group.DN
+		principal.Type = model.AccessPrincipalGroup
+		principal.SID = group.SID
+		principal.Account = group.Account
+		principal.Name = group.Description
+	} else {
+		return nil, gtype.ErrInternal.SetDetail(err)
+	}
+	principal.Dn = s.ToBase64(principalDn)
+
+	nested, err := ad.GetMemberGroups(principalDn, true)
+	if err != nil {
+		return nil, gtype.ErrInternal.SetDetail(err)
+	}
+	direct, err := ad.GetMemberGroups(principalDn, false)
+	if err != nil {
+		return nil, gtype.ErrInternal.SetDetail(err)
+	}
+	memberships := make(map[string]bool)
+	for _, group := range nested {
+		memberships[strings.ToLower(group.DN)] = false
+	}
+	for _, group := range direct {
+		memberships[strings.ToLower(group.DN)] = true
+	}
+
+	groups, err := s.GetAdResourceGroups()
+	if err != nil {
+		return nil, gtype.ErrInternal.SetDetail(err)
+	}
+	results := make(model.AccessMatrixEntryCollection, 0)
+	for _, group := range groups {
+		groupDn, _ := s.FromBase64(group.Group.Dn)
+		isDirect, ok := memberships[strings.ToLower(groupDn)]
+		if !ok {
+			continue
+		}
+
+		results = append(results, &model.AccessMatrixEntry{
+			Principal: principal,
+			Resource:  group.Resource,
+			Group:     group.Group,
+			Direct:    isDirect,
+		})
+	}
+
+	sort.Sort(results)
+	return results, nil
+}
+
+func (s *Matrix) getResourceAccess(ctx gtype.Context, dn string) (model.AccessMatrixEntryCollection, gtype.Error) {
+	token := s.GetToken(ctx.Token())
+	if token == nil {
+		return nil, gtype.ErrInternal.SetDetail("凭证无效")
+	}
+	if len(dn) < 1 {
+		return nil, gtype.ErrInput.SetDetail("资源唯一名称(dn)为空")
+	}
+	ouDn, err := s.FromBase64(dn)
+	if err != nil {
+		return nil, gtype.ErrInput.SetDetail(fmt.Sprintf("资源唯一名称(dn)不是有效base64字符: %v", err))
+	}
+	resource := s.GetAdResourceByDn(ouDn)
+	if resource.Type == model.AdResourceOther {
+		return nil, gtype.ErrInput.SetDetail(fmt.Sprintf("组织单位(%s)不是服务器、共享目录或SVN存储库", resource.Name))
+	}
+	if !s.IsAdmin(token.UserAccount) {
+		managers, me := s.GetAdAuthorizationAccounts(ouDn)
+		if me != nil {
+			return nil, gtype.ErrInternal.SetDetail(me)
+		}
+		isManager := false
+		for _, manager := range managers {
+			if strings.ToLower(manager) == strings.ToLower(token.UserAccount) {
+				isManager = true
+				break
+			}
+		}
+		if !isManager {
+			return nil, gtype.ErrNoPermission.SetDetail("仅管理员及资源的授权管理员可查询")
+		}
+	}
+
+	ad := s.Ad()
+	groups, err := ad.GetGroupsFromOrganizationUnit(ouDn)
+	if err != nil {
+		return nil, gtype.ErrInternal.SetDetail(err)
+	}
+	results := make(model.AccessMatrixEntryCollection, 0)
+	for _, group := range groups {
+		if group == nil {
+			continue
+		}
+		roleGroup := model.AdRoleGroup{}
+		roleGroup.Dn = s.ToBase64(group.DN)
+		roleGroup.Account = group.Account
+		roleGroup.Description = group.Description
+		roleGroup.Info = group.Info
+		roleGroup.Role = s.GetAdGroupRole(group.Account)
+
+		direct, ue := ad.GetUsersFromGroup(group.DN)
+		if ue != nil {
+			return nil, gtype.ErrInternal.SetDetail(ue)
+		}
+		directs := make(map[string]bool)
+		for _, user := range direct {
+			directs[strings.ToLower(user.DN)] = true
+		}
+		users, ue := ad.GetNestedUsersFromGroup(group.DN)
+		if ue != nil {
+			return nil, gtype.ErrInternal.SetDetail(ue)
+		}
+		for _, user := range users {
+			if user == nil {
+				continue
+			}
+			entry := &model.AccessMatrixEntry{
+				Resource: *resource,
+				Group:    roleGroup,
+				Direct:   directs[strings.ToLower(user.DN)],
+			}
+			entry.Principal.Dn = s.ToBase64(user.DN)
+			entry.Principal.Type = model.AccessPrincipalUser
+			entry.Principal.SID = user.SID
+			entry.Principal.Account = user.Account
+			entry.Principal.Name = user.Name
+			results = append(results, entry)
+		}
+	}
+
+	sort.Sort(results)
+	return results, nil
+}
+
+func (s *Matrix) entriesExample() []*model.AccessMatrixEntry {
+	entry := &model.AccessMatrixEntry{
+		Principal: model.AccessPrincipal{
+			Type:    model.AccessPrincipalUser,
+			Account: "zhangsan",
+			Name:    "张三",
+		},
+		Resource: model.AdResource{
+			Type: model.AdResourceShare,
+			Name: "Public Share",
+		},
+		Direct: true,
+	}
+	entry.Group.Account = "Share.Read.Public.Share"
+	entry.Group.Role = model.GroupRoleReadOnly
+
+	return []*model.AccessMatrixEntry{entry}
+}
+
+func (s *Matrix) resourceTypeName(v int) string {
+	switch v {
+	case model.AdResourceServer:
+		return "服务器"
+	case model.AdResourceShare:
+		return "共享目录"
+	case model.AdResourceSvn:
+		return "SVN存储库"
+	default:
+		return "其他"
+	}
+}
+
+func (s *Matrix) groupRoleName(v int) string {
+	switch v {
+	case model.GroupRoleAuthorization:
+		return "授权管理员"
+	case model.GroupRoleRemoteDesktop:
+		return "远程桌面用户"
+	case model.GroupRoleDatabaseAdmin:
+		return "数据库实例管理员"
+	case model.GroupRoleReadOnly:
+		return "只读"
+	case model.GroupRoleReadWrite:
+		return "读写"
+	case model.GroupRoleReadWriteModify:
+		return "读写改"
+	default:
+		return "其他"
+	}
+}
@@ -0,0 +1,95 @@
+package ad
+
+import (
+	"fmt"
+	"github.com/csby/goa/assist"
+	"github.com/csby/goa/config"
+	"github.com/csby/goa/data/model"
+	"strings"
+)
+
+// provision creates the organization unit under root together with the role groups of the templates,
+// everything created in this call is deleted if any step fails
+func (s *base) provision(root string, argument *model.AdOrganizationUnitAdd, groupSuffix string, templates []*config.MsAdGroupTemplate) (model.AdRoleGroupCollection, error) {
+	ad := s.Ad()
+	entry, err := ad.GetOrganizationUnit(root)
+	if err != nil {
+		if ad.IsNotExit(err) {
+			entry, err = ad.AddOrganizationUnit(root, "", "")
+			if err != nil {
+				return nil, err
+			}
+		} else {
+			return nil, err
+		}
+	}
+
+	ou := fmt.Sprintf("OU=%s,%s", argument.Name, entry.DN)
+	_, err = ad.GetOrganizationUnit(ou)
+	if err != nil {
+		if !ad.IsNotExit(err) {
+			return nil, err
+		}
+	} else {
+		return nil, fmt.Errorf("名称(%s)已存在", argument.Name)
+	}
+
+	entry, err = ad.AddOrganizationUnit(ou, argument.Description, argument.Street)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make(model.AdRoleGroupCollection, 0)
+	if argument.SkipGroups || len(groupSuffix) < 1 {
+		return results, nil
+	}
+
+	groups := make([]*assist.AdEntryGroup, 0)
+	for _, template := range templates {
+		if template == nil || len(template.Name) < 1 {
+			continue
+		}
+
+		groupName := template.Name
+		if strings.Contains(groupName, "%s") {
+			groupName = fmt.Sprintf(groupName, groupSuffix)
+		} else {
+			groupName = fmt.Sprintf("%s.%s", groupName, groupSuffix)
+		}
+		group, ge := ad.NewGroup(entry.DN, groupName, template.Description, template.Info)
+		if ge != nil {
+			s.rollback(ad, entry.DN, groups)
+			return nil, fmt.Errorf("创建角色组(%s)失败: %v", groupName, ge)
+		}
+		if group == nil {
+			group = &assist.AdEntryGroup{}
+			group.DN = fmt.Sprintf("CN=%s,%s", groupName, entry.DN)
+			group.Account = groupName
+		}
+		groups = append(groups, group)
+
+		result := &model.AdRoleGroup{}
+		result.Dn = s.ToBase64(group.DN)
+		result.Account = group.Account
+		result.Description = group.Description
+		result.Info = group.Info
+		result.Role = s.GetAdGroupRole(group.Account)
+		results = append(results, result)
+	}
+
+	return results, nil
+}
+
+func (s *base) rollback(ad *assist.Ad, ouDn string, groups []*assist.AdEntryGroup) {
+	for i := len(groups) - 1; i >= 0; i-- {
+		err := ad.DeleteGroup(groups[i].DN)
+		if err != nil {
+			s.LogError(fmt.Sprintf("rollback: delete group '%s' fail:", groups[i].DN), err)
+		}
+	}
+
+	err := ad.DeleteOrganizationUnit(ouDn)
+	if err != nil {
+		s.LogError(fmt.Sprintf("rollback: delete organization unit '%s' fail:", ouDn), err)
+	}
+}
@@ -0,0 +1,761 @@
+package ad
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/csby/goa/controller"
+	"github.com/csby/goa/data/model"
+	"github.com/csby/goa/data/socket"
+	"github.com/csby/gwsf/gtype"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	reviewCampaignBucket = "access.review.campaign"
+	reviewItemBucket     = "access.review.item"
+)
+
+func NewReview(log gtype.Log, param *controller.Parameter) *Review {
+	instance := &Review{}
+	instance.SetLog(log)
+	instance.SetParameter(param)
+
+	return instance
+}
+
+// Review is the periodic access review, the members of the role groups are confirmed to be kept or revoked
+type Review struct {
+	base
+}
+
+func (s *Review) StartCampaign(ctx gtype.Context, ps gtype.Params) {
+	token := s.GetToken(ctx.Token())
+	if token == nil {
+		ctx.Error(gtype.ErrInternal, "凭证无效")
+		return
+	}
+	if s.Dbs == nil {
+		ctx.Error(gtype.ErrInternal, "本地存储不可用")
+		return
+	}
+	if !s.IsAdmin(token.UserAccount) {
+		ctx.Error(gtype.ErrNoPermission, "仅管理员可发起审核活动")
+		return
+	}
+
+	argument := &model.AccessReviewCampaignCreate{}
+	err := ctx.GetJson(argument)
+	if err != nil {
+		ctx.Error(gtype.ErrInput, err)
+		return
+	}
+	name := strings.TrimSpace(argument.Name)
+	if len(name) < 1 {
+		ctx.Error(gtype.ErrInput.SetDetail("名称(name)为空"))
+		return
+	}
+	if argument.Reviewer == 0 {
+		argument.Reviewer = model.AccessReviewByAuthorization
+	}
+	if argument.Reviewer != model.AccessReviewByAuthorization && argument.Reviewer != model.AccessReviewByManager {
+		ctx.Error(gtype.ErrInput, fmt.Sprintf("审核人(reviewer)无效: %d", argument.Reviewer))
+		return
+	}
+
+	campaign := &model.AccessReviewCampaign{
+		ID:         ctx.NewGuid(),
+		Name:       name,
+		Reviewer:   argument.Reviewer,
+		Resources:  argument.Resources,
+		Status:     model.AccessReviewCampaignActive,
+		CreateBy:   token.UserAccount,
+		CreateTime: gtype.DateTime(time.Now()),
+	}
+	items, err := s.createItems(campaign)
+	if err != nil {
+		ctx.Error(gtype.ErrInternal, err)
+		return
+	}
+	campaign.Total = len(items)
+	campaign.Pending = len(items)
+
+	err = s.Dbs.Put(reviewCampaignBucket, campaign.ID, campaign)
+	if err != nil {
+		ctx.Error(gtype.ErrInternal, err)
+		return
+	}
+	reviewers := make([]string, 0)
+	exists := make(map[string]bool)
+	for _, item := range items {
+		err = s.Dbs.Put(reviewItemBucket, s.itemKey(item), item)
+		if err != nil {
+			ctx.Error(gtype.ErrInternal, err)
+			return
+		}
+		for _, reviewer := range item.Reviewers {
+			key := strings.ToLower(reviewer)
+			if !exists[key] {
+				exists[key] = true
+				reviewers = append(reviewers, reviewer)
+			}
+		}
+	}
+
+	s.WriteWebSocketMessageToAccounts(socket.WSAccessReview, campaign, reviewers...)
+	ctx.Success(campaign)
+}
+
+func (s *Review) StartCampaignDoc(doc gtype.Doc, method string, uri gtype.Uri) {
+	catalog := s.createCatalog(doc, adCatalogReview)
+	function := catalog.AddFunction(method, uri, "发起审核活动")
+	function.SetNote("仅管理员可发起, 对服务器、共享目录及SVN存储库角色组的每个成员生成审核项, 并推送给审核人; " +
+		"审核人为资源的授权管理员(授权管理员组的成员由其直接主管审核)或成员的直接主管, 未找到审核人时由管理员审核")
+	function.SetInputJsonExample(&model.AccessReviewCampaignCreate{
+		Name:      "2024年第一季度权限审核",
+		Reviewer:  model.AccessReviewByAuthorization,
+		Resources: []int{model.AdResourceServer, model.AdResourceShare, model.AdResourceSvn},
+	})
+	function.SetOutputDataExample(&model.AccessReviewCampaign{
+		ID:         gtype.NewGuid(),
+		Name:       "2024年第一季度权限审核",
+		Reviewer:   model.AccessReviewByAuthorization,
+		Total:      120,
+		Pending:    120,
+		CreateBy:   "admin",
+		CreateTime: gtype.DateTime(time.Now()),
+	})
+	function.AddOutputError(gtype.ErrTokenEmpty)
+	function.AddOutputError(gtype.ErrTokenInvalid)
+	function.AddOutputError(gtype.ErrNoPermission)
+	function.AddOutputError(gtype.ErrInput)
+	function.AddOutputError(gtype.ErrInternal)
+}
+
+func (s *Review) GetCampaigns(ctx gtype.Context, ps gtype.Params) {
+	token := s.GetToken(ctx.Token())
+	if token == nil {
+		ctx.Error(gtype.ErrInternal, "凭证无效")
+		return
+	}
+	if s.Dbs == nil {
+		ctx.Error(gtype.ErrInternal, "本地存储不可用")
+		return
+	}
+
+	isAdmin := s.IsAdmin(token.UserAccount)
+	totals := make(map[string]int)
+	pendings := make(map[string]int)
+	err := s.Dbs.ForEach(reviewItemBucket, func(key string, value []byte) error {
+		item := &model.AccessReviewItem{}
+		if json.Unmarshal(value, item) != nil {
+			return nil
+		}
+		if !isAdmin && !s.isReviewer(item, token.UserAccount) {
+			return nil
+		}
+
+		totals[item.CampaignID]++
+		if item.Decision == model.AccessReviewPending {
+			pendings[item.CampaignID]++
+		}
+		return nil
+	})
+	if err != nil {
+		ctx.Error(gtype.ErrInternal, err)
+		return
+	}
+
+	results := make(model.AccessReviewCampaignCollection, 0)
+	err = s.Dbs.ForEach(reviewCampaignBucket, func(key string, value []byte) error {
+		item := &model.AccessReviewCampaign{}
+		if json.Unmarshal(value, item) != nil {
+			return nil
+		}
+		total, ok := totals[item.ID]
+		if !isAdmin && !ok {
+			return nil
+		}
+
+		item.Total = total
+		item.Pending = pendings[item.ID]
+		results = append(results, item)
+		return nil
+	})
+	if err != nil {
+		ctx.Error(gtype.ErrInternal, err)
+		return
+	}
+
+	sort.Sort(results)
+	ctx.Success(results)
+}
+
+func (s *Review) GetCampaignsDoc(doc gtype.Doc, method string, uri gtype.Uri) {
+	catalog := s.createCatalog(doc, adCatalogReview)
+	function := catalog.AddFunction(method, uri, "获取审核活动列表")
+	function.SetNote("管理员可查看全部审核活动, 其他用户仅可查看包含需要自己审核的审核项的活动, 数量仅统计自己可审核的审核项")
+	function.SetOutputDataExample([]*model.AccessReviewCampaign{
+		{
+			ID:         gtype.NewGuid(),
+			Name:       "2024年第一季度权限审核",
+			Total:      12,
+			Pending:    3,
+			CreateBy:   "admin",
+			CreateTime: gtype.DateTime(time.Now()),
+		},
+	})
+	function.AddOutputError(gtype.ErrTokenEmpty)
+	function.AddOutputError(gtype.ErrTokenInvalid)
+	function.AddOutputError(gtype.ErrInternal)
+}
+
+func (s *Review) GetItems(ctx gtype.Context, ps gtype.Params) {
+	token := s.GetToken(ctx.Token())
+	if token == nil {
+		ctx.Error(gtype.ErrInternal, "凭证无效")
+		return
+	}
+	if s.Dbs == nil {
+		ctx.Error(gtype.ErrInternal, "本地存储不可用")
+		return
+	}
+
+	argument := &model.AccessReviewItemFilter{
+		Decision: -1,
+	}
+	err := ctx.GetJson(argument)
+	if err != nil {
+		ctx.Error(gtype.ErrInput, err)
+		return
+	}
+	if len(argument.CampaignID) < 1 {
+		ctx.Error(gtype.ErrInput.SetDetail("审核活动标识ID(campaignId)为空"))
+		return
+	}
+
+	isAdmin := s.IsAdmin(token.UserAccount)
+	results, err := s.getItems(argument.CampaignID, func(item *model.AccessReviewItem) bool {
+		if argument.Decision >= 0 && argument.Decision != item.Decision {
+			return false
+		}
+		return isAdmin || s.isReviewer(item, token.UserAccount)
+	})
+	if err != nil {
+		ctx.Error(gtype.ErrInternal, err)
+		return
+	}
+
+	ctx.Success(results)
+}
+
+func (s *Review) GetItemsDoc(doc gtype.Doc, method string, uri gtype.Uri) {
+	catalog := s.createCatalog(doc, adCatalogReview)
+	function := catalog.AddFunction(method, uri, "获取审核项列表")
+	function.SetNote("管理员可查看全部审核项, 其他用户仅可查看需要自己审核的审核项")
+	function.SetInputJsonExample(&model.AccessReviewItemFilter{
+		CampaignID: gtype.NewGuid(),
+		Decision:   -1,
+	})
+	function.SetOutputDataExample([]*model.AccessReviewItem{
+		{
+			ID: gtype.NewGuid(),
+			Resource: model.AdResource{
+				Type: model.AdResourceShare,
+				Name: "Public Share",
+			},
+			Member: model.AdUser{
+				Account: "zhangsan",
+				Name:    "张三",
+			},
+			Reviewers: []string{"lisi"},
+			Decision:  model.AccessReviewPending,
+		},
+	})
+	function.AddOutputError(gtype.ErrTokenEmpty)
+	function.AddOutputError(gtype.ErrTokenInvalid)
+	function.AddOutputError(gtype.ErrInput)
+	function.AddOutputError(gtype.ErrInternal)
+}
+
+func (s *Review) Decide(ctx gtype.Context, ps gtype.Params) {
+	token := s.GetToken(ctx.Token())
+	if token == nil {
+		ctx.Error(gtype.ErrInternal, "凭证无效")
+		return
+	}
+	if s.Dbs == nil {
+		ctx.Error(gtype.ErrInternal, "本地存储不可用")
+		return
+	}
+
+	argument := &model.AccessReviewDecide{}
+	err := ctx.GetJson(argument)
+	if err != nil {
+		ctx.Error(gtype.ErrInput, err)
+		return
+	}
+	if len(argument.CampaignID) < 1 {
+		ctx.Error(gtype.ErrInput.SetDetail("审核活动标识ID(campaignId)为空"))
+		return
+	}
+	if len(argument.ItemIDs) < 1 {
+		ctx.Error(gtype.ErrInput.SetDetail("审核项标识ID(itemIds)为空"))
+		return
+	}
+	if argument.Decision != model.AccessReviewKeep && argument.Decision != model.AccessReviewRevoke {
+		ctx.Error(gtype.ErrInput, fmt.Sprintf("审核结果(decision)无效: %d", argument.Decision))
+		return
+	}
+
+	campaign := &model.AccessReviewCampaign{}
+	ok, err := s.Dbs.Get(reviewCampaignBucket, argument.CampaignID, campaign)
+	if err != nil {
+		ctx.Error(gtype.ErrInternal, err)
+		return
+	}
+	if !ok {
+		ctx.Error(gtype.ErrInput, fmt.Sprintf("审核活动(%s)不存在", argument.CampaignID))
+		return
+	}
+	if campaign.Status != model.AccessReviewCampaignActive {
+		ctx.Error(gtype.ErrInput, fmt.Sprintf("审核活动(%s)已完成", campaign.Name))
+		return
+	}
+
+	isAdmin := s.IsAdmin(token.UserAccount)
+	results := make(model.AccessReviewItemCollection, 0)
+	for _, id := range argument.ItemIDs {
+		item := &model.AccessReviewItem{}
+		key := fmt.Sprintf("%s.%s", argument.CampaignID, id)
+		ok, err = s.Dbs.Get(reviewItemBucket, key, item)
+		if err != nil {
+			ctx.Error(gtype.ErrInternal, err)
+			return
+		}
+		if !ok {
+			ctx.Error(gtype.ErrInput, fmt.Sprintf("审核项(%s)不存在", id))
+			return
+		}
+		if !s.canDecide(item, token.UserAccount, isAdmin) {
+			ctx.Error(gtype.ErrNoPermission, fmt.Sprintf("不是审核项(%s)的审核人", id))
+			return
+		}
+	}
+
+	now := gtype.DateTime(time.Now())
+	for _, id := range argument.ItemIDs {
+		item := &model.AccessReviewItem{}
+		key := fmt.Sprintf("%s.%s", argument.CampaignID, id)
+		err = s.Dbs.Modify(reviewItemBucket, key, item, func(existed bool) error {
+			if !existed {
+				return fmt.Errorf("审核项(%s)不存在", id)
+			}
+			if item.Decision == model.AccessReviewRevoke {
+				return fmt.Errorf("审核项(%s)已撤销", id)
+			}
+
+			item.Decision = argument.Decision
+			item.ReviewBy = token.UserAccount
+			item.ReviewTime = &now
+			item.Comment = argument.Comment
+			item.Error = ""
+			return nil
+		})
+		if err != nil {
+			ctx.Error(gtype.ErrInput, err)
+			return
+		}
+
+		if item.Decision == model.AccessReviewRevoke {
+			err = s.revoke(item)
+			if err != nil {
+				item.Decision = model.AccessReviewRevokeFailed
+				item.Error = err.Error()
+				s.LogError(fmt.Sprintf("revoke member (%s) from group (%s) fail: ", item.Member.Account, item.Group.Account), err)
+			}
+			err = s.Dbs.Put(reviewItemBucket, key, item)
+			if err != nil {
+				s.LogError("save access review item fail: ", err)
+			}
+		}
+
+		results = append(results, item)
+	}
+
+	ctx.Success(results)
+}
+
+func (s *Review) DecideDoc(doc gtype.Doc, method string, uri gtype.Uri) {
+	catalog := s.createCatalog(doc, adCatalogReview)
+	function := catalog.AddFunction(method, uri, "提交审核结果")
+	function.SetNote("审核结果为撤销时立即将成员从角色组中移除; 已撤销的审核项不可再修改, 其他审核项在活动完成前可重新审核")
+	function.SetRemark("不能审核本人的成员资格, 系统管理员也不例外")
+	function.SetInputJsonExample(&model.AccessReviewDecide{
+		CampaignID: gtype.NewGuid(),
+		ItemIDs:    []string{gtype.NewGuid()},
+		Decision:   model.AccessReviewRevoke,
+		Comment:    "已调岗",
+	})
+	function.SetOutputDataExample([]*model.AccessReviewItem{
+		{
+			ID:       gtype.NewGuid(),
+			Decision: model.AccessReviewRevoke,
+			ReviewBy: "lisi",
+		},
+	})
+	function.AddOutputError(gtype.ErrTokenEmpty)
+	function.AddOutputError(gtype.ErrTokenInvalid)
+	function.AddOutputError(gtype.ErrNoPermission)
+	function.AddOutputError(gtype.ErrInput)
+	function.AddOutputError(gtype.ErrInternal)
+}
+
+func (s *Review) CompleteCampaign(ctx gtype.Context, ps gtype.Params) {
+	token := s.GetToken(ctx.Token())
+	if token == nil {
+		ctx.Error(gtype.ErrInternal, "凭证无效")
+		return
+	}
+	if s.Dbs == nil {
+		ctx.Error(gtype.ErrInternal, "本地存储不可用")
+		return
+	}
+	if !s.IsAdmin(token.UserAccount) {
+		ctx.Error(gtype.ErrNoPermission, "仅管理员可完成审核活动")
+		return
+	}
+
+	argument := &model.AccessReviewCampaignID{}
+	err := ctx.GetJson(argument)
+	if err != nil {
+		ctx.Error(gtype.ErrInput, err)
+		return
+	}
+	if len(argument.ID) < 1 {
+		ctx.Error(gtype.ErrInput.SetDetail("审核活动标识ID(id)为空"))
+		return
+	}
+
+	now := gtype.DateTime(time.Now())
+	campaign := &model.AccessReviewCampaign{}
+	err = s.Dbs.Modify(reviewCampaignBucket, argument.ID, campaign, func(existed bool) error {
+		if !existed {
+			return fmt.Errorf("审核活动(%s)不存在", argument.ID)
+		}
+		if campaign.Status != model.AccessReviewCampaignActive {
+			return fmt.Errorf("审核活动(%s)已完成", campaign.Name)
+		}
+
+		campaign.Status = model.AccessReviewCampaignCompleted
+		campaign.CompleteBy = token.UserAccount
+		campaign.CompleteTime = &now
+		return nil
+	})
+	if err != nil {
+		ctx.Error(gtype.ErrInput, err)
+		return
+	}
+
+	report, err := s.getReport(campaign)
+	if err != nil {
+		ctx.Error(gtype.ErrInternal, err)
+		return
+	}
+
+	s.WriteWebSocketMessageToAccounts(socket.WSAccessReviewComplete, campaign, campaign.CreateBy)
+	ctx.Success(report)
+}
+
+func (s *Review) CompleteCampaignDoc(doc gtype.Doc, method string, uri gtype.Uri) {
+	catalog := s.createCatalog(doc, adCatalogReview)
+	function := catalog.AddFunction(method, uri, "完成审核活动")
+	function.SetNote("仅管理员可操作, 完成后不可再提交审核结果, 尚未审核的审核项保持为待审核; 成功时返回审核报告")
+	function.SetInputJsonExample(&model.AccessReviewCampaignID{
+		ID: gtype.NewGuid(),
+	})
+	function.SetOutputDataExample(s.reportExample())
+	function.AddOutputError(gtype.ErrTokenEmpty)
+	function.AddOutputError(gtype.ErrTokenInvalid)
+	function.AddOutputError(gtype.ErrNoPermission)
+	function.AddOutputError(gtype.ErrInput)
+	function.AddOutputError(gtype.ErrInternal)
+}
+
+func (s *Review) GetReport(ctx gtype.Context, ps gtype.Params) {
+	token := s.GetToken(ctx.Token())
+	if token == nil {
+		ctx.Error(gtype.ErrInternal, "凭证无效")
+		return
+	}
+	if s.Dbs == nil {
+		ctx.Error(gtype.ErrInternal, "本地存储不可用")
+		return
+	}
+	if !s.IsAdmin(token.UserAccount) {
+		ctx.Error(gtype.ErrNoPermission, "仅管理员可查看审核报告")
+		return
+	}
+
+	argument := &model.AccessReviewCampaignID{}
+	err := ctx.GetJson(argument)
+	if err != nil {
+		ctx.Error(gtype.ErrInput, err)
+		return
+	}
+	if len(argument.ID) < 1 {
+		ctx.Error(gtype.ErrInput.SetDetail("审核活动标识ID(id)为空"))
+		return
+	}
+
+	campaign := &model.AccessReviewCampaign{}
+	ok, err := s.Dbs.Get(reviewCampaignBucket, argument.ID, campaign)
+	if err != nil {
+		ctx.Error(gtype.ErrInternal, err)
+		return
+	}
+	if !ok {
+		ctx.Error(gtype.ErrInput, fmt.Sprintf("审核活动(%s)不存在", argument.ID))
+		return
+	}
+
+	report, err := s.getReport(campaign)
+	if err != nil {
+		ctx.Error(gtype.ErrInternal, err)
+		return
+	}
+
+	ctx.Success(report)
+}
+
+func (s *Review) GetReportDoc(doc gtype.Doc, method string, uri gtype.Uri) {
+	catalog := s.createCatalog(doc, adCatalogReview)
+	function := catalog.AddFunction(method, uri, "获取审核报告")
+	function.SetNote("仅管理员可查看, 包含每个审核项的审核结果、审核人及审核时间")
+	function.SetInputJsonExample(&model.AccessReviewCampaignID{
+		ID: gtype.NewGuid(),
+	})
+	function.SetOutputDataExample(s.reportExample())
+	function.AddOutputError(gtype.ErrTokenEmpty)
+	function.AddOutputError(gtype.ErrTokenInvalid)
+	function.AddOutputError(gtype.ErrNoPermission)
+	function.AddOutputError(gtype.ErrInput)
+	function.AddOutputError(gtype.ErrInternal)
+}
+
+func (s *Review) reportExample() *model.AccessReviewReport {
+	now := gtype.DateTime(time.Now())
+	return &model.AccessReviewReport{
+		Campaign: model.AccessReviewCampaign{
+			ID:           gtype.NewGuid(),
+			Name:         "2024年第一季度权限审核",
+			Status:       model.AccessReviewCampaignCompleted,
+			Total:        2,
+			CreateBy:     "admin",
+			CreateTime:   now,
+			CompleteBy:   "admin",
+			CompleteTime: &now,
+		},
+		Kept:    1,
+		Revoked: 1,
+		Items: []*model.AccessReviewItem{
+			{
+				ID: gtype.NewGuid(),
+				Member: model.AdUser{
+					Account: "zhangsan",
+					Name:    "张三",
+				},
+				Decision:   model.AccessReviewRevoke,
+				ReviewBy:   "lisi",
+				ReviewTime: &now,
+			},
+		},
+	}
+}
+
+func (s *Review) createItems(campaign *model.AccessReviewCampaign) ([]*model.AccessReviewItem, error) {
+	groups, err := s.GetAdResourceGroups(campaign.Resources...)
+	if err != nil {
+		return nil, err
+	}
+
+	ad := s.Ad()
+	authorizations := make(map[string][]string)
+	managers := make(map[string][]string)
+	getManager := func(account string) ([]string, error) {
+		key := strings.ToLower(account)
+		accounts, ok := managers[key]
+		if ok {
+			return accounts, nil
+		}
+		accounts = make([]string, 0)
+		manager, me := ad.GetUserManager(account)
+		if me == nil {
+			accounts = append(accounts, manager.Account)
+		} else if !ad.IsNotExit(me) {
+			return nil, me
+		}
+		managers[key] = accounts
+		return accounts, nil
+	}
+
+	items := make([]*model.AccessReviewItem, 0)
+	for _, group := range groups {
+		groupDn, _ := s.FromBase64(group.Group.Dn)
+		users, ue := ad.GetUsersFromGroup(groupDn)
+		if ue != nil {
+			return nil, ue
+		}
+		for _, user := range users {
+			if user == nil {
+				continue
+			}
+
+			var reviewers []string
+			if campaign.Reviewer == model.AccessReviewByAuthorization && group.Group.Role != model.GroupRoleAuthorization {
+				accounts, ok := authorizations[group.Resource.Dn]
+				if !ok {
+					resourceDn, _ := s.FromBase64(group.Resource.Dn)
+					accounts, err = s.GetAdAuthorizationAccounts(resourceDn)
+					if err != nil {
+						return nil, err
+					}
+					authorizations[group.Resource.Dn] = accounts
+				}
+				reviewers = excludeAccount(accounts, user.Account)
+			}
+			if len(reviewers) < 1 {
+				accounts, me := getManager(user.Account)
+				if me != nil {
+					return nil, me
+				}
+				reviewers = excludeAccount(accounts, user.Account)
+			}
+
+			item := &model.AccessReviewItem{
+				ID:         gtype.NewGuid(),
+				CampaignID: campaign.ID,
+				Resource:   group.Resource,
+				Group:      group.Group,
+				Reviewers:  reviewers,
+				Decision:   model.AccessReviewPending,
+			}
+			item.Member.Dn = s.ToBase64(user.DN)
+			item.Member.SID = user.SID
+			item.Member.Account = user.Account
+			item.Member.Name = user.Name
+			items = append(items, item)
+		}
+	}
+
+	return items, nil
+}
+
+func (s *Review) getItems(campaignId string, filter func(item *model.AccessReviewItem) bool) (model.AccessReviewItemCollection, error) {
+	results := make(model.AccessReviewItemCollection, 0)
+	err := s.Dbs.ForEach(reviewItemBucket, func(key string, value []byte) error {
+		item := &model.AccessReviewItem{}
+		if json.Unmarshal(value, item) != nil {
+			return nil
+		}
+		if item.CampaignID != campaignId {
+			return nil
+		}
+		if filter != nil && !filter(item) {
+			return nil
+		}
+
+		results = append(results, item)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Sort(results)
+	return results, nil
+}
+
+func (s *Review) getReport(campaign *model.AccessReviewCampaign) (*model.AccessReviewReport, error) {
+	items, err := s.getItems(campaign.ID, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &model.AccessReviewReport{
+		Campaign: *campaign,
+		Items:    items,
+	}
+	for _, item := range items {
+		switch item.Decision {
+		case model.AccessReviewKeep:
+			report.Kept++
+		case model.AccessReviewRevoke:
+			report.Revoked++
+		case model.AccessReviewRevokeFailed:
+			report.Failed++
+		default:
+			report.Pending++
+		}
+	}
+	report.Campaign.Total = len(items)
+	report.Campaign.Pending = report.Pending
+
+	return report, nil
+}
+
+func (s *Review) revoke(item *model.AccessReviewItem) error {
+	groupDn, err := s.FromBase64(item.Group.Dn)
+	if err != nil {
+		return err
+	}
+	memberDn, err := s.FromBase64(item.Member.Dn)
+	if err != nil {
+		return err
+	}
+
+	return s.RemoveGroupMember(groupDn, memberDn, model.GroupMemberSourceReview, item.ReviewBy)
+}
+
+func (s *Review) itemKey(item *model.AccessReviewItem) string {
+	return fmt.Sprintf("%s.%s", item.CampaignID, item.ID)
+}
+
+// canDecide returns true if the account may review the item, nobody reviews his own membership, administrators included
+func (s *Review) canDecide(item *model.AccessReviewItem, account string, isAdmin bool) bool {
+	if item == nil {
+		return false
+	}
+	if strings.ToLower(item.Member.Account) == strings.ToLower(account) {
+		return false
+	}
+
+	return isAdmin || s.isReviewer(item, account)
+}
+
+func (s *Review) isReviewer(item *model.AccessReviewItem, account string) bool {
+	if item == nil {
+		return false
+	}
+
+	for _, reviewer := range item.Reviewers {
+		if strings.ToLower(reviewer) == strings.ToLower(account) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// excludeAccount removes the account from the accounts, so that nobody reviews or approves his own access
+func excludeAccount(accounts []string, account string) []string {
+	results := make([]string, 0)
+	for _, item := range accounts {
+		if strings.ToLower(item) != strings.ToLower(account) {
+			results = append(results, item)
+		}
+	}
+
+	return results
+}
@@ -0,0 +1,30 @@
+package ad
+
+import (
+	"github.com/csby/goa/data/model"
+	"testing"
+)
+
+func TestReview_CanDecide(t *testing.T) {
+	s := &Review{}
+	item := &model.AccessReviewItem{
+		Reviewers: []string{"lisi"},
+	}
+	item.Member.Account = "ZhangSan"
+
+	if !s.canDecide(item, "LiSi", false) {
+		t.Error("lisi should review the item")
+	}
+	if !s.canDecide(item, "admin", true) {
+		t.Error("administrator should review the item")
+	}
+	if s.canDecide(item, "wangwu", false) {
+		t.Error("wangwu is not a reviewer of the item")
+	}
+	if s.canDecide(item, "zhangsan", true) {
+		t.Error("administrator should not review his own membership")
+	}
+	if s.canDecide(nil, "admin", true) {
+		t.Error("nil item can not be reviewed")
+	}
+}
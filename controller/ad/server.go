@@ -1,7 +1,6 @@
 package ad
 
 import (
-	"fmt"
 	"github.com/csby/goa/controller"
 	"github.com/csby/goa/data/model"
 	"github.com/csby/gwsf/gtype"
@@ -80,63 +79,39 @@ func (s *Server) Add(ctx gtype.Context, ps gtype.Params) {
 		ctx.Error(gtype.ErrInternal.SetDetail("配置错误: 根组织单位为空"))
 		return
 	}
-	ad := s.Ad()
-	entry, err := ad.GetOrganizationUnit(root)
-	if err != nil {
-		if ad.IsNotExit(err) {
-			entry, err = ad.AddOrganizationUnit(root, "", "")
-			if err != nil {
-				ctx.Error(gtype.ErrInternal.SetDetail(err))
-				return
-			}
-		} else {
-			ctx.Error(gtype.ErrInternal.SetDetail(err))
-			return
-		}
-	}
-
-	ou := fmt.Sprintf("OU=%s,%s", argument.Name, entry.DN)
-	entry, err = ad.GetOrganizationUnit(ou)
-	if err != nil {
-		if !ad.IsNotExit(err) {
-			ctx.Error(gtype.ErrInternal.SetDetail(err))
-			return
-		}
-	} else {
-		ctx.Error(gtype.ErrInternal.SetDetail(fmt.Sprintf("名称(%s)已存在", argument.Name)))
-		return
-	}
-
-	entry, err = ad.AddOrganizationUnit(ou, argument.Description, argument.Street)
-	if err != nil {
-		ctx.Error(gtype.ErrInternal.SetDetail(err))
-		return
-	}
-
 	groupSuffix := argument.GroupSuffix
 	if len(groupSuffix) < 1 {
 		groupSuffix = s.CreateAdler32String(argument.Name)
 	}
 
-	if len(groupSuffix) > 0 {
-		groupName := fmt.Sprintf("Server.Authorization.Managers.%s", groupSuffix)
-		ad.NewGroup(entry.DN, groupName, "授权管理员", "具备添加、删除成员及编辑成员访问权限的权限")
-
-		groupName = fmt.Sprintf("Server.Remote.Desktop.Users.%s", groupSuffix)
-		ad.NewGroup(entry.DN, groupName, "远程桌面用户", "允许通过远程桌面服务登陆")
+	groups, err := s.provision(root, argument, groupSuffix, s.Cfg.Ad.Template.Server)
+	if err != nil {
+		ctx.Error(gtype.ErrInternal.SetDetail(err))
+		return
 	}
 
-	ctx.Success(nil)
+	ctx.Success(groups)
 }
 
 func (s *Server) AddDoc(doc gtype.Doc, method string, uri gtype.Uri) {
 	catalog := s.createCatalog(doc, adCatalogServer)
 	function := catalog.AddFunction(method, uri, "添加服务器")
+	function.SetRemark("需要管理员权限")
+	function.SetNote("按配置的角色组模板(ad.template)同时创建角色组, 任一步骤失败时将删除本次已创建的组织单位及角色组; 成功时返回已创建的角色组")
 	function.SetInputJsonExample(&model.AdOrganizationUnitAdd{
 		Name:        "即时通讯服务器",
 		GroupSuffix: "IM",
 	})
-	function.SetOutputDataExample(nil)
+	function.SetOutputDataExample([]*model.AdRoleGroup{
+		{
+			AdGroup: model.AdGroup{
+				Account:     "Server.Remote.Desktop.Users.IM",
+				Description: "远程桌面用户",
+			},
+			Role: model.GroupRoleRemoteDesktop,
+		},
+	})
 	function.AddOutputError(gtype.ErrInternal)
 	function.AddOutputError(gtype.ErrInput)
+	function.AddOutputError(gtype.ErrNoPermission)
 }
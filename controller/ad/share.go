@@ -1,7 +1,6 @@
 package ad
 
 import (
-	"fmt"
 	"github.com/csby/goa/controller"
 	"github.com/csby/goa/data/model"
 	"github.com/csby/gwsf/gtype"
@@ -80,39 +79,6 @@ func (s *Share) Add(ctx gtype.Context, ps gtype.Params) {
 		ctx.Error(gtype.ErrInternal.SetDetail("配置错误: 根组织单位为空"))
 		return
 	}
-	ad := s.Ad()
-	entry, err := ad.GetOrganizationUnit(root)
-	if err != nil {
-		if ad.IsNotExit(err) {
-			entry, err = ad.AddOrganizationUnit(root, "", "")
-			if err != nil {
-				ctx.Error(gtype.ErrInternal.SetDetail(err))
-				return
-			}
-		} else {
-			ctx.Error(gtype.ErrInternal.SetDetail(err))
-			return
-		}
-	}
-
-	ou := fmt.Sprintf("OU=%s,%s", argument.Name, entry.DN)
-	entry, err = ad.GetOrganizationUnit(ou)
-	if err != nil {
-		if !ad.IsNotExit(err) {
-			ctx.Error(gtype.ErrInternal.SetDetail(err))
-			return
-		}
-	} else {
-		ctx.Error(gtype.ErrInternal.SetDetail(fmt.Sprintf("名称(%s)已存在", argument.Name)))
-		return
-	}
-
-	entry, err = ad.AddOrganizationUnit(ou, argument.Description, argument.Street)
-	if err != nil {
-		ctx.Error(gtype.ErrInternal.SetDetail(err))
-		return
-	}
-
 	groupSuffix := argument.GroupSuffix
 	if len(groupSuffix) < 1 {
 		items := make([]string, 0)
@@ -129,32 +95,35 @@ func (s *Share) Add(ctx gtype.Context, ps gtype.Params) {
 		}
 	}
 
-	if len(groupSuffix) > 0 {
-		groupName := fmt.Sprintf("Share.Authorization.Managers.%s", groupSuffix)
-		ad.NewGroup(entry.DN, groupName, "授权管理员", "具备添加、删除成员及编辑成员访问权限的权限")
-
-		groupName = fmt.Sprintf("Share.Read.%s", groupSuffix)
-		ad.NewGroup(entry.DN, groupName, "只读用户", "对共享目录具有只读权限")
-
-		groupName = fmt.Sprintf("Share.Read.Write.%s", groupSuffix)
-		ad.NewGroup(entry.DN, groupName, "读写用户", "对共享目录具有读写权限，但没有删改权限")
-
-		groupName = fmt.Sprintf("Share.Read.Write.Modify.%s", groupSuffix)
-		ad.NewGroup(entry.DN, groupName, "读写删改用户", "对共享目录具有读写及删改权限")
+	groups, err := s.provision(root, argument, groupSuffix, s.Cfg.Ad.Template.Share)
+	if err != nil {
+		ctx.Error(gtype.ErrInternal.SetDetail(err))
+		return
 	}
 
-	ctx.Success(nil)
+	ctx.Success(groups)
 }
 
 func (s *Share) AddDoc(doc gtype.Doc, method string, uri gtype.Uri) {
 	catalog := s.createCatalog(doc, adCatalogShare)
 	function := catalog.AddFunction(method, uri, "添加共享目录")
+	function.SetRemark("需要管理员权限")
+	function.SetNote("按配置的角色组模板(ad.template)同时创建角色组, 任一步骤失败时将删除本次已创建的组织单位及角色组; 成功时返回已创建的角色组")
 	function.SetInputJsonExample(&model.AdOrganizationUnitAdd{
 		Name:        "Public Share",
 		GroupSuffix: "Public.Share",
 		Description: "总共容量：20.00GB",
 	})
-	function.SetOutputDataExample(nil)
+	function.SetOutputDataExample([]*model.AdRoleGroup{
+		{
+			AdGroup: model.AdGroup{
+				Account:     "Share.Read.Public.Share",
+				Description: "只读用户",
+			},
+			Role: model.GroupRoleReadOnly,
+		},
+	})
 	function.AddOutputError(gtype.ErrInternal)
 	function.AddOutputError(gtype.ErrInput)
+	function.AddOutputError(gtype.ErrNoPermission)
 }
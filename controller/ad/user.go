@@ -124,6 +124,10 @@ func (s *User) ResetPassword(ctx gtype.Context, ps gtype.Params) {
 		ctx.Error(gtype.ErrInternal, err)
 		return
 	}
+	err = s.SaveNtHash(account, argument.Password)
+	if err != nil {
+		s.LogError(fmt.Sprintf("save nt hash of %s fail: ", account), err)
+	}
 
 	ctx.Success(nil)
 }
@@ -131,11 +135,13 @@ func (s *User) ResetPassword(ctx gtype.Context, ps gtype.Params) {
 func (s *User) ResetPasswordDoc(doc gtype.Doc, method string, uri gtype.Uri) {
 	catalog := s.createCatalog(doc, adCatalogUser)
 	function := catalog.AddFunction(method, uri, "重置密码")
+	function.SetRemark("需要管理员权限")
 	function.SetInputJsonExample(&model.AdSetPassword{})
 	function.SetOutputDataExample(nil)
 	function.AddOutputError(gtype.ErrTokenEmpty)
 	function.AddOutputError(gtype.ErrTokenInvalid)
 	function.AddOutputError(gtype.ErrInput)
+	function.AddOutputError(gtype.ErrNoPermission)
 }
 
 func (s *User) ChangePassword(ctx gtype.Context, ps gtype.Params) {
@@ -167,6 +173,10 @@ func (s *User) ChangePassword(ctx gtype.Context, ps gtype.Params) {
 		ctx.Error(gtype.ErrInternal, err)
 		return
 	}
+	err = s.SaveNtHash(account, argument.NewPassword)
+	if err != nil {
+		s.LogError(fmt.Sprintf("save nt hash of %s fail: ", account), err)
+	}
 
 	ctx.Success(nil)
 }
@@ -409,11 +419,13 @@ func (s *User) GetVpnEnable(ctx gtype.Context, ps gtype.Params) {
 func (s *User) GetVpnEnableDoc(doc gtype.Doc, method string, uri gtype.Uri) {
 	catalog := s.createCatalog(doc, adCatalogUser)
 	function := catalog.AddFunction(method, uri, "获取VPN启用状态")
+	function.SetRemark("查看其他用户需要管理员权限")
 	function.SetNote("如果未指定帐号，默认为当前登录用户")
 	function.SetInputJsonExample(&model.AdAccount{})
 	function.SetOutputDataExample(true)
 	function.AddOutputError(gtype.ErrTokenEmpty)
 	function.AddOutputError(gtype.ErrTokenInvalid)
+	function.AddOutputError(gtype.ErrNoPermission)
 }
 
 func (s *User) SetVpnEnable(ctx gtype.Context, ps gtype.Params) {
@@ -429,8 +441,7 @@ func (s *User) SetVpnEnable(ctx gtype.Context, ps gtype.Params) {
 		argument.Account = token.UserAccount
 	}
 
-	ad := s.Ad()
-	err := ad.SetUserVpnEnable(argument.Account, argument.Enable)
+	err := s.SetUserVpnEnable(argument.Account, argument.Enable, model.VpnSourceApi, token.UserAccount, ctx.RIP(), "")
 	if err != nil {
 		ctx.Error(gtype.ErrInternal, err)
 		return
@@ -442,11 +453,13 @@ func (s *User) SetVpnEnable(ctx gtype.Context, ps gtype.Params) {
 func (s *User) SetVpnEnableDoc(doc gtype.Doc, method string, uri gtype.Uri) {
 	catalog := s.createCatalog(doc, adCatalogUser)
 	function := catalog.AddFunction(method, uri, "设置VPN启用状态")
-	function.SetNote("如果未指定帐号，默认为当前登录用户")
+	function.SetRemark("需要管理员权限")
+	function.SetNote("如果未指定帐号，默认为当前登录用户; 每次设置均记录到VPN变更记录")
 	function.SetInputJsonExample(&model.AdVpn{})
 	function.SetOutputDataExample(nil)
 	function.AddOutputError(gtype.ErrTokenEmpty)
 	function.AddOutputError(gtype.ErrTokenInvalid)
+	function.AddOutputError(gtype.ErrNoPermission)
 }
 
 func (s *User) GetVpnEnableList(ctx gtype.Context, ps gtype.Params) {
@@ -0,0 +1,475 @@
+package ad
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/csby/goa/controller"
+	"github.com/csby/goa/data/model"
+	"github.com/csby/gwsf/gtype"
+	"sort"
+	"strings"
+	"time"
+)
+
+func NewVpn(log gtype.Log, param *controller.Parameter) *Vpn {
+	instance := &Vpn{}
+	instance.SetLog(log)
+	instance.SetParameter(param)
+
+	return instance
+}
+
+// Vpn enables the dial-in permission in the time window of a grant and records every change
+type Vpn struct {
+	base
+}
+
+// Start checks the grants periodically in background, the grants are persisted,
+// so those started or ended while the service was stopped are applied at the first check
+func (s *Vpn) Start() {
+	if s.Dbs == nil {
+		return
+	}
+
+	go s.run()
+}
+
+func (s *Vpn) CreateGrant(ctx gtype.Context, ps gtype.Params) {
+	token := s.GetToken(ctx.Token())
+	if token == nil {
+		ctx.Error(gtype.ErrInternal, "凭证无效")
+		return
+	}
+	if s.Dbs == nil {
+		ctx.Error(gtype.ErrInternal, "本地存储不可用")
+		return
+	}
+	if !s.IsAdmin(token.UserAccount) {
+		ctx.Error(gtype.ErrNoPermission, "仅管理员可授权VPN")
+		return
+	}
+
+	argument := &model.VpnGrantCreate{}
+	err := ctx.GetJson(argument)
+	if err != nil {
+		ctx.Error(gtype.ErrInput, err)
+		return
+	}
+	if len(argument.Account) < 1 {
+		ctx.Error(gtype.ErrInput.SetDetail("用户帐号(account)为空"))
+		return
+	}
+	reason := strings.TrimSpace(argument.Reason)
+	if len(reason) < 1 {
+		ctx.Error(gtype.ErrInput.SetDetail("原因(reason)为空"))
+		return
+	}
+	now := time.Now()
+	startTime := time.Time(argument.StartTime)
+	if startTime.Before(now) {
+		startTime = now
+	}
+	endTime := time.Time(argument.EndTime)
+	if !endTime.After(startTime) {
+		ctx.Error(gtype.ErrInput.SetDetail("结束时间(endTime)必须晚于开始时间及当前时间"))
+		return
+	}
+
+	ad := s.Ad()
+	user, err := ad.GetUser(argument.Account)
+	if err != nil {
+		ctx.Error(gtype.ErrInput, err)
+		return
+	}
+
+	grant := &model.VpnGrant{
+		ID:         gtype.NewGuid(),
+		Account:    user.Account,
+		Name:       user.Name,
+		StartTime:  gtype.DateTime(startTime),
+		EndTime:    gtype.DateTime(endTime),
+		Reason:     reason,
+		Status:     model.VpnGrantScheduled,
+		CreateBy:   token.UserAccount,
+		CreateIP:   ctx.RIP(),
+		CreateTime: gtype.DateTime(now),
+	}
+	err = s.Dbs.Put(controller.VpnGrantBucket, grant.ID, grant)
+	if err != nil {
+		ctx.Error(gtype.ErrInternal, err)
+		return
+	}
+
+	if !startTime.After(now) {
+		s.apply(grant.ID)
+		s.Dbs.Get(controller.VpnGrantBucket, grant.ID, grant)
+	}
+
+	ctx.Success(grant)
+}
+
+func (s *Vpn) CreateGrantDoc(doc gtype.Doc, method string, uri gtype.Uri) {
+	catalog := s.createCatalog(doc, adCatalogVpn)
+	function := catalog.AddFunction(method, uri, "添加VPN限时授权")
+	function.SetNote("仅管理员可授权, 在开始时间启用VPN, 在结束时间禁用VPN; 开始时VPN已启用的, 结束时保持启用; " +
+		"开始时间为空或早于当前时间时立即启用; 每次启用或禁用均记录到VPN变更记录")
+	function.SetInputJsonExample(&model.VpnGrantCreate{
+		Account:   "zhangsan",
+		StartTime: gtype.DateTime(time.Now()),
+		EndTime:   gtype.DateTime(time.Now().Add(7 * 24 * time.Hour)),
+		Reason:    "出差",
+	})
+	function.SetOutputDataExample(s.grantExample())
+	function.AddOutputError(gtype.ErrTokenEmpty)
+	function.AddOutputError(gtype.ErrTokenInvalid)
+	function.AddOutputError(gtype.ErrNoPermission)
+	function.AddOutputError(gtype.ErrInput)
+	function.AddOutputError(gtype.ErrInternal)
+}
+
+func (s *Vpn) CancelGrant(ctx gtype.Context, ps gtype.Params) {
+	token := s.GetToken(ctx.Token())
+	if token == nil {
+		ctx.Error(gtype.ErrInternal, "凭证无效")
+		return
+	}
+	if s.Dbs == nil {
+		ctx.Error(gtype.ErrInternal, "本地存储不可用")
+		return
+	}
+	if !s.IsAdmin(token.UserAccount) {
+		ctx.Error(gtype.ErrNoPermission, "仅管理员可取消VPN授权")
+		return
+	}
+
+	argument := &model.VpnGrantID{}
+	err := ctx.GetJson(argument)
+	if err != nil {
+		ctx.Error(gtype.ErrInput, err)
+		return
+	}
+	if len(argument.ID) < 1 {
+		ctx.Error(gtype.ErrInput.SetDetail("授权标识ID(id)为空"))
+		return
+	}
+
+	grant := &model.VpnGrant{}
+	ok, err := s.Dbs.Get(controller.VpnGrantBucket, argument.ID, grant)
+	if err != nil {
+		ctx.Error(gtype.ErrInternal, err)
+		return
+	}
+	if !ok {
+		ctx.Error(gtype.ErrInput, fmt.Sprintf("授权(%s)不存在", argument.ID))
+		return
+	}
+	if grant.Status != model.VpnGrantScheduled && grant.Status != model.VpnGrantActive {
+		ctx.Error(gtype.ErrInput, "授权已结束或已取消")
+		return
+	}
+
+	if grant.Status == model.VpnGrantActive && !grant.Enabled && s.getOtherActive(grant) == nil {
+		err = s.SetUserVpnEnable(grant.Account, false, model.VpnSourceGrant, token.UserAccount, ctx.RIP(),
+			fmt.Sprintf("取消授权: %s", grant.Reason))
+		if err != nil {
+			ctx.Error(gtype.ErrInternal, err)
+			return
+		}
+	}
+
+	grant.Status = model.VpnGrantCanceled
+	err = s.Dbs.Put(controller.VpnGrantBucket, grant.ID, grant)
+	if err != nil {
+		ctx.Error(gtype.ErrInternal, err)
+		return
+	}
+
+	ctx.Success(grant)
+}
+
+func (s *Vpn) CancelGrantDoc(doc gtype.Doc, method string, uri gtype.Uri) {
+	catalog := s.createCatalog(doc, adCatalogVpn)
+	function := catalog.AddFunction(method, uri, "取消VPN限时授权")
+	function.SetNote("仅管理员可取消, 生效中的授权取消时立即禁用VPN(开始时VPN已启用或有其它生效中的授权时除外)")
+	function.SetInputJsonExample(&model.VpnGrantID{
+		ID: gtype.NewGuid(),
+	})
+	function.SetOutputDataExample(s.grantExample())
+	function.AddOutputError(gtype.ErrTokenEmpty)
+	function.AddOutputError(gtype.ErrTokenInvalid)
+	function.AddOutputError(gtype.ErrNoPermission)
+	function.AddOutputError(gtype.ErrInput)
+	function.AddOutputError(gtype.ErrInternal)
+}
+
+func (s *Vpn) GetGrants(ctx gtype.Context, ps gtype.Params) {
+	token := s.GetToken(ctx.Token())
+	if token == nil {
+		ctx.Error(gtype.ErrInternal, "凭证无效")
+		return
+	}
+	if s.Dbs == nil {
+		ctx.Error(gtype.ErrInternal, "本地存储不可用")
+		return
+	}
+
+	argument := &model.VpnGrantFilter{}
+	ctx.GetJson(argument)
+	account := strings.ToLower(argument.Account)
+	if !s.IsAdmin(token.UserAccount) {
+		account = strings.ToLower(token.UserAccount)
+	}
+
+	results := make(model.VpnGrantCollection, 0)
+	err := s.Dbs.ForEach(controller.VpnGrantBucket, func(key string, value []byte) error {
+		item := &model.VpnGrant{}
+		if json.Unmarshal(value, item) != nil {
+			return nil
+		}
+		if item.Status != model.VpnGrantScheduled && item.Status != model.VpnGrantActive {
+			return nil
+		}
+		if len(account) > 0 && strings.ToLower(item.Account) != account {
+			return nil
+		}
+
+		results = append(results, item)
+		return nil
+	})
+	if err != nil {
+		ctx.Error(gtype.ErrInternal, err)
+		return
+	}
+
+	sort.Sort(results)
+	ctx.Success(results)
+}
+
+func (s *Vpn) GetGrantsDoc(doc gtype.Doc, method string, uri gtype.Uri) {
+	catalog := s.createCatalog(doc, adCatalogVpn)
+	function := catalog.AddFunction(method, uri, "获取VPN限时授权列表")
+	function.SetNote("获取生效中及未开始的授权, 按开始时间排序; 管理员可查看全部, 其他用户仅可查看自己的授权")
+	function.SetInputJsonExample(&model.VpnGrantFilter{})
+	function.SetOutputDataExample([]*model.VpnGrant{s.grantExample()})
+	function.AddOutputError(gtype.ErrTokenEmpty)
+	function.AddOutputError(gtype.ErrTokenInvalid)
+	function.AddOutputError(gtype.ErrInternal)
+}
+
+func (s *Vpn) GetEvents(ctx gtype.Context, ps gtype.Params) {
+	token := s.GetToken(ctx.Token())
+	if token == nil {
+		ctx.Error(gtype.ErrInternal, "凭证无效")
+		return
+	}
+	if s.Dbs == nil {
+		ctx.Error(gtype.ErrInternal, "本地存储不可用")
+		return
+	}
+	if !s.IsAdmin(token.UserAccount) {
+		ctx.Error(gtype.ErrNoPermission, "仅管理员可查看VPN变更记录")
+		return
+	}
+
+	argument := &model.VpnEventFilter{}
+	ctx.GetJson(argument)
+	account := strings.ToLower(argument.Account)
+
+	results := make(model.VpnEventCollection, 0)
+	err := s.Dbs.ForEach(controller.VpnEventBucket, func(key string, value []byte) error {
+		item := &model.VpnEvent{}
+		if json.Unmarshal(value, item) != nil {
+			return nil
+		}
+		if len(account) > 0 && strings.ToLower(item.Account) != account {
+			return nil
+		}
+		if argument.StartTime != nil && time.Time(item.Time).Before(time.Time(*argument.StartTime)) {
+			return nil
+		}
+		if argument.EndTime != nil && time.Time(item.Time).After(time.Time(*argument.EndTime)) {
+			return nil
+		}
+
+		results = append(results, item)
+		return nil
+	})
+	if err != nil {
+		ctx.Error(gtype.ErrInternal, err)
+		return
+	}
+
+	sort.Sort(results)
+	ctx.Success(results)
+}
+
+func (s *Vpn) GetEventsDoc(doc gtype.Doc, method string, uri gtype.Uri) {
+	catalog := s.createCatalog(doc, adCatalogVpn)
+	function := catalog.AddFunction(method, uri, "获取VPN变更记录")
+	function.SetNote("仅管理员可查看, 包括通过接口设置、限时授权及入职离职作业引起的变更, 按时间倒序排列")
+	function.SetInputJsonExample(&model.VpnEventFilter{})
+	function.SetOutputDataExample([]*model.VpnEvent{
+		{
+			ID:       gtype.NewGuid(),
+			Account:  "zhangsan",
+			Enable:   true,
+			Source:   model.VpnSourceApi,
+			Operator: "admin",
+			IP:       "192.168.1.10",
+			Time:     gtype.DateTime(time.Now()),
+		},
+	})
+	function.AddOutputError(gtype.ErrTokenEmpty)
+	function.AddOutputError(gtype.ErrTokenInvalid)
+	function.AddOutputError(gtype.ErrNoPermission)
+	function.AddOutputError(gtype.ErrInternal)
+}
+
+func (s *Vpn) grantExample() *model.VpnGrant {
+	now := time.Now()
+	return &model.VpnGrant{
+		ID:         gtype.NewGuid(),
+		Account:    "zhangsan",
+		Name:       "张三",
+		StartTime:  gtype.DateTime(now),
+		EndTime:    gtype.DateTime(now.Add(7 * 24 * time.Hour)),
+		Reason:     "出差",
+		Status:     model.VpnGrantActive,
+		CreateBy:   "admin",
+		CreateIP:   "192.168.1.10",
+		CreateTime: gtype.DateTime(now),
+	}
+}
+
+func (s *Vpn) run() {
+	interval := int64(60)
+	if s.Cfg != nil && s.Cfg.Ad.VpnGrant.Interval > 0 {
+		interval = s.Cfg.Ad.VpnGrant.Interval
+	}
+	ticker := time.NewTicker(time.Duration(interval) * time.Second)
+	defer ticker.Stop()
+
+	s.check()
+	for range ticker.C {
+		s.check()
+	}
+}
+
+func (s *Vpn) check() {
+	defer func() {
+		if err := recover(); err != nil {
+			s.LogError("check vpn grant error:", err)
+		}
+	}()
+
+	ids := make([]string, 0)
+	err := s.Dbs.ForEach(controller.VpnGrantBucket, func(key string, value []byte) error {
+		item := &model.VpnGrant{}
+		if json.Unmarshal(value, item) != nil {
+			return nil
+		}
+		if item.Status == model.VpnGrantScheduled || item.Status == model.VpnGrantActive {
+			ids = append(ids, key)
+		}
+		return nil
+	})
+	if err != nil {
+		s.LogError("load vpn grant fail:", err)
+		return
+	}
+
+	for _, id := range ids {
+		s.apply(id)
+	}
+}
+
+// apply starts or ends the grant according to the current time
+func (s *Vpn) apply(id string) {
+	grant := &model.VpnGrant{}
+	ok, err := s.Dbs.Get(controller.VpnGrantBucket, id, grant)
+	if err != nil || !ok {
+		return
+	}
+
+	now := time.Now()
+	startTime := time.Time(grant.StartTime)
+	endTime := time.Time(grant.EndTime)
+	if grant.Status == model.VpnGrantScheduled {
+		if startTime.After(now) {
+			return
+		}
+		if !endTime.After(now) {
+			// the whole window passed while the service was stopped
+			grant.Status = model.VpnGrantEnded
+			s.saveGrant(grant)
+			return
+		}
+
+		enabled, err := s.Ad().GetUserVpnEnable(grant.Account)
+		if err != nil {
+			s.LogError(fmt.Sprintf("get vpn of %s fail:", grant.Account), err)
+			return
+		}
+		// the vpn is enabled by the other grant, so keep the state before that grant
+		other := s.getOtherActive(grant)
+		if other != nil {
+			grant.Enabled = other.Enabled
+		} else {
+			grant.Enabled = enabled
+		}
+		if !enabled {
+			err = s.SetUserVpnEnable(grant.Account, true, model.VpnSourceGrant, grant.CreateBy, "", grant.Reason)
+			if err != nil {
+				s.LogError(fmt.Sprintf("enable vpn of %s fail:", grant.Account), err)
+				return
+			}
+		}
+		grant.Status = model.VpnGrantActive
+		s.saveGrant(grant)
+	} else if grant.Status == model.VpnGrantActive {
+		if endTime.After(now) {
+			return
+		}
+
+		if !grant.Enabled && s.getOtherActive(grant) == nil {
+			err = s.SetUserVpnEnable(grant.Account, false, model.VpnSourceGrant, grant.CreateBy, "", grant.Reason)
+			if err != nil {
+				s.LogError(fmt.Sprintf("disable vpn of %s fail:", grant.Account), err)
+				return
+			}
+		}
+		grant.Status = model.VpnGrantEnded
+		s.saveGrant(grant)
+	}
+}
+
+// getOtherActive returns another active grant of the account which is not ended yet, or nil if not found
+func (s *Vpn) getOtherActive(grant *model.VpnGrant) *model.VpnGrant {
+	now := time.Now()
+	var result *model.VpnGrant
+	s.Dbs.ForEach(controller.VpnGrantBucket, func(key string, value []byte) error {
+		if result != nil || key == grant.ID {
+			return nil
+		}
+		item := &model.VpnGrant{}
+		if json.Unmarshal(value, item) != nil {
+			return nil
+		}
+		if item.Status != model.VpnGrantActive || !time.Time(item.EndTime).After(now) {
+			return nil
+		}
+		if strings.ToLower(item.Account) == strings.ToLower(grant.Account) {
+			result = item
+		}
+		return nil
+	})
+
+	return result
+}
+
+func (s *Vpn) saveGrant(grant *model.VpnGrant) {
+	err := s.Dbs.Put(controller.VpnGrantBucket, grant.ID, grant)
+	if err != nil {
+		s.LogError(fmt.Sprintf("save vpn grant (%s) fail:", grant.ID), err)
+	}
+}
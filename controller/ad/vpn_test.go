@@ -0,0 +1,87 @@
+package ad
+
+import (
+	"github.com/csby/goa/controller"
+	"github.com/csby/goa/data/model"
+	"github.com/csby/goa/data/storage/storagetest"
+	"github.com/csby/gwsf/gtype"
+	"testing"
+	"time"
+)
+
+func newTestVpn(t *testing.T) *Vpn {
+	dbs := storagetest.Open(t)
+
+	return NewVpn(nil, &controller.Parameter{Dbs: dbs})
+}
+
+func newTestVpnGrant(id string, status int, start, end time.Duration, enabled bool) *model.VpnGrant {
+	now := time.Now()
+	return &model.VpnGrant{
+		ID:        id,
+		Account:   "zhangsan",
+		StartTime: gtype.DateTime(now.Add(start)),
+		EndTime:   gtype.DateTime(now.Add(end)),
+		Status:    status,
+		Enabled:   enabled,
+		CreateBy:  "admin",
+	}
+}
+
+func TestVpn_Check(t *testing.T) {
+	s := newTestVpn(t)
+	grants := []*model.VpnGrant{
+		// not started yet
+		newTestVpnGrant("future", model.VpnGrantScheduled, time.Hour, 2*time.Hour, false),
+		// the whole window passed while the service was stopped
+		newTestVpnGrant("missed", model.VpnGrantScheduled, -2*time.Hour, -time.Hour, false),
+		// not ended yet
+		newTestVpnGrant("active", model.VpnGrantActive, -time.Hour, time.Hour, false),
+		// ended, the vpn was enabled before the grant so it is kept
+		newTestVpnGrant("ended", model.VpnGrantActive, -2*time.Hour, -time.Hour, true),
+		// ended, the vpn is still needed by the active grant
+		newTestVpnGrant("overlapped", model.VpnGrantActive, -2*time.Hour, -time.Minute, false),
+		newTestVpnGrant("cancelled", model.VpnGrantCanceled, -2*time.Hour, time.Hour, false),
+	}
+	for _, grant := range grants {
+		s.saveGrant(grant)
+	}
+
+	s.check()
+
+	expected := map[string]int{
+		"future":     model.VpnGrantScheduled,
+		"missed":     model.VpnGrantEnded,
+		"active":     model.VpnGrantActive,
+		"ended":      model.VpnGrantEnded,
+		"overlapped": model.VpnGrantEnded,
+		"cancelled":  model.VpnGrantCanceled,
+	}
+	for id, status := range expected {
+		grant := &model.VpnGrant{}
+		ok, err := s.Dbs.Get(controller.VpnGrantBucket, id, grant)
+		if err != nil || !ok {
+			t.Fatalf("grant %s not found: %v", id, err)
+		}
+		if grant.Status != status {
+			t.Errorf("grant %s: expected status %d, got %d", id, status, grant.Status)
+		}
+	}
+}
+
+func TestVpn_GetOtherActive(t *testing.T) {
+	s := newTestVpn(t)
+	grant := newTestVpnGrant("g1", model.VpnGrantActive, -time.Hour, time.Hour, false)
+	s.saveGrant(grant)
+	s.saveGrant(newTestVpnGrant("ended", model.VpnGrantActive, -2*time.Hour, -time.Hour, false))
+
+	if other := s.getOtherActive(grant); other != nil {
+		t.Errorf("the ended grant should not be active, got %s", other.ID)
+	}
+
+	s.saveGrant(newTestVpnGrant("g2", model.VpnGrantActive, -time.Hour, 2*time.Hour, true))
+	other := s.getOtherActive(grant)
+	if other == nil || other.ID != "g2" {
+		t.Errorf("expected the other active grant g2, got %v", other)
+	}
+}
@@ -0,0 +1,120 @@
+package controller
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"github.com/csby/goa/data/model"
+	"github.com/csby/gwsf/gtype"
+	"net"
+	"strings"
+	"time"
+)
+
+const (
+	ApiKeyBucket = "apikey"
+
+	// the api key is "goak_<id>_<secret>", it is presented as the token so that the handlers get the token as usual
+	apiKeyPrefix   = "goak_"
+	apiKeyIdLength = 16
+
+	// the token id of the api key is "apikey:<id>", which is never saved in Tdb
+	apiKeyTokenPrefix = "apikey:"
+)
+
+func IsApiKey(value string) bool {
+	return strings.HasPrefix(value, apiKeyPrefix)
+}
+
+// NewApiKey returns the id, the key and the hash of the key, only the hash should be saved
+func NewApiKey() (string, string, string, error) {
+	buf := make([]byte, apiKeyIdLength/2+32)
+	_, err := rand.Read(buf)
+	if err != nil {
+		return "", "", "", err
+	}
+	id := hex.EncodeToString(buf[:apiKeyIdLength/2])
+	key := fmt.Sprintf("%s%s_%s", apiKeyPrefix, id, base64.RawURLEncoding.EncodeToString(buf[apiKeyIdLength/2:]))
+
+	return id, key, HashApiKey(key), nil
+}
+
+func HashApiKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// GetApiKey returns the api key of the value, error is returned if it is invalid or expired
+func (s *Controller) GetApiKey(value string) (*model.ApiKey, error) {
+	if !IsApiKey(value) || len(value) < len(apiKeyPrefix)+apiKeyIdLength+2 {
+		return nil, fmt.Errorf("API密钥格式无效")
+	}
+	if s.Dbs == nil {
+		return nil, fmt.Errorf("本地数据库不可用")
+	}
+
+	id := value[len(apiKeyPrefix) : len(apiKeyPrefix)+apiKeyIdLength]
+	item := &model.ApiKey{}
+	ok, err := s.Dbs.Get(ApiKeyBucket, id, item)
+	if err != nil {
+		return nil, err
+	}
+	if !ok || subtle.ConstantTimeCompare([]byte(item.Hash), []byte(HashApiKey(value))) != 1 {
+		return nil, fmt.Errorf("API密钥无效")
+	}
+	if !time.Time(item.ExpireTime).After(time.Now()) {
+		return nil, fmt.Errorf("API密钥已于%s过期", item.ExpireTime.String())
+	}
+
+	return item, nil
+}
+
+// ApiKeyToken returns the token of the api key, the handlers check the permissions of the account as usual
+func (s *Controller) ApiKeyToken(item *model.ApiKey) *gtype.Token {
+	return &gtype.Token{
+		ID:          apiKeyTokenPrefix + item.ID,
+		UserAccount: item.Account,
+		UserName:    item.Name,
+		LoginTime:   time.Time(item.CreateTime),
+		ActiveTime:  time.Now(),
+	}
+}
+
+// ApiKeyAllowIP returns true if the ip is in one of the cidrs of the api key
+func ApiKeyAllowIP(item *model.ApiKey, ip string) bool {
+	addr := net.ParseIP(ip)
+	if addr == nil {
+		return false
+	}
+	for _, cidr := range item.Cidrs {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			continue
+		}
+		if network.Contains(addr) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ApiKeyAllowRoute returns true if the path matches one of the routes of the api key, a route ends with * matches the prefix
+func ApiKeyAllowRoute(item *model.ApiKey, path string) bool {
+	path = strings.ToLower(path)
+	for _, route := range item.Routes {
+		route = strings.ToLower(route)
+		if strings.HasSuffix(route, "*") {
+			if strings.HasPrefix(path, strings.TrimSuffix(route, "*")) {
+				return true
+			}
+		} else if path == route {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,95 @@
+package controller
+
+import (
+	"github.com/csby/goa/data/model"
+	"github.com/csby/goa/data/storage/storagetest"
+	"github.com/csby/gwsf/gtype"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestController_GetApiKey(t *testing.T) {
+	dbs := storagetest.Open(t)
+	s := &Controller{Dbs: dbs}
+
+	id, key, hash, err := NewApiKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !IsApiKey(key) || !strings.Contains(key, id) || strings.Contains(hash, id) {
+		t.Fatalf("unexpected key: %s", key)
+	}
+	item := &model.ApiKey{
+		ID:         id,
+		Name:       "dhcp-kiosk",
+		Account:    "svc.dhcp",
+		ExpireTime: gtype.DateTime(time.Now().Add(time.Hour)),
+		Hash:       hash,
+	}
+	err = dbs.Put(ApiKeyBucket, id, item)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := s.GetApiKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Account != "svc.dhcp" {
+		t.Errorf("unexpected api key: %+v", got)
+	}
+	token := s.GetToken(key)
+	if token == nil || token.UserAccount != "svc.dhcp" || token.ID == key {
+		t.Errorf("unexpected token: %+v", token)
+	}
+
+	if _, err = s.GetApiKey(key[:len(key)-1] + "x"); err == nil {
+		t.Error("key with the wrong secret should be refused")
+	}
+	if _, err = s.GetApiKey("goak_short"); err == nil {
+		t.Error("malformed key should be refused")
+	}
+
+	item.ExpireTime = gtype.DateTime(time.Now().Add(-time.Second))
+	dbs.Put(ApiKeyBucket, id, item)
+	if _, err = s.GetApiKey(key); err == nil {
+		t.Error("expired key should be refused")
+	}
+	if s.GetToken(key) != nil {
+		t.Error("expired key should not have a token")
+	}
+}
+
+func TestApiKeyAllow(t *testing.T) {
+	item := &model.ApiKey{
+		Routes: []string{"/staff.api/dhcp/filter/add", "/staff.api/svn/*"},
+		Cidrs:  []string{"192.168.1.0/24", "10.0.0.8/32"},
+	}
+
+	ips := map[string]bool{
+		"192.168.1.20": true,
+		"10.0.0.8":     true,
+		"10.0.0.9":     false,
+		"192.168.2.1":  false,
+		"":             false,
+	}
+	for ip, expected := range ips {
+		if ApiKeyAllowIP(item, ip) != expected {
+			t.Errorf("ip %s: expected %v", ip, expected)
+		}
+	}
+
+	routes := map[string]bool{
+		"/staff.api/dhcp/filter/add":      true,
+		"/staff.api/DHCP/filter/add":      true,
+		"/staff.api/dhcp/filter/del":      false,
+		"/staff.api/svn/repository/list":  true,
+		"/staff.api/ad/user/account/list": false,
+	}
+	for route, expected := range routes {
+		if ApiKeyAllowRoute(item, route) != expected {
+			t.Errorf("route %s: expected %v", route, expected)
+		}
+	}
+}
@@ -0,0 +1,28 @@
+package controller
+
+import (
+	"fmt"
+	"github.com/csby/goa/data/model"
+	"github.com/csby/gwsf/gtype"
+	"time"
+)
+
+const (
+	AuditBucket = "audit"
+)
+
+// RecordAudit saves the audit event, the key starts with the time so that the events are stored in order
+func (s *Controller) RecordAudit(event *model.AuditEvent) {
+	if s.Dbs == nil || event == nil {
+		return
+	}
+
+	now := time.Now()
+	event.ID = fmt.Sprintf("%019d.%s", now.UnixNano(), gtype.NewGuid())
+	event.Time = gtype.DateTime(now)
+
+	err := s.Dbs.Put(AuditBucket, event.ID, event)
+	if err != nil {
+		s.LogError("save audit event fail:", err)
+	}
+}
@@ -1,14 +1,18 @@
 package auth
 
 import (
+	"crypto/cipher"
 	"encoding/base64"
 	"fmt"
+	"github.com/csby/goa/assist"
+	"github.com/csby/goa/config"
 	"github.com/csby/goa/controller"
+	"github.com/csby/goa/data/model"
 	"github.com/csby/goa/data/socket"
-	"github.com/csby/gsecurity/grsa"
 	"github.com/csby/gwsf/gtype"
 	"github.com/mojocn/base64Captcha"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -23,9 +27,33 @@ func NewAd(log gtype.Log, param *controller.Parameter) *Ad {
 	instance.SetLog(log)
 	instance.SetParameter(param)
 
-	instance.errorCount = make(map[string]int)
+	if instance.Cfg != nil {
+		instance.limiter = newLoginLimiter(instance.Cfg.Auth.Limit)
+	} else {
+		instance.limiter = newLoginLimiter(config.AuthLimit{})
+	}
 	instance.captchaStore = base64Captcha.DefaultMemStore
-	instance.rsaPrivate.Create(1024)
+	if instance.Cfg != nil {
+		keys, err := newLoginKeyRing(instance.Cfg.Auth.Rsa, time.Now())
+		if err != nil {
+			instance.LogError("load login rsa key fail, a temporary key is used: ", err)
+		} else {
+			instance.loginKeys = keys
+		}
+	}
+	if instance.loginKeys == nil {
+		instance.loginKeys, _ = newLoginKeyRing(config.AuthRsa{}, time.Now())
+	}
+
+	instance.totpTickets = make(map[string]*totpTicket)
+	if instance.Cfg != nil && instance.Cfg.Auth.Totp.Enabled {
+		aead, err := newTotpAead(instance.Cfg.Auth.Totp.Key)
+		if err != nil {
+			instance.LogError("totp key is invalid: ", err)
+		} else {
+			instance.totpAead = aead
+		}
+	}
 
 	return instance
 }
@@ -33,13 +61,26 @@ func NewAd(log gtype.Log, param *controller.Parameter) *Ad {
 type Ad struct {
 	base
 
-	errorCount   map[string]int
+	limiter      *loginLimiter
 	captchaStore base64Captcha.Store
-	rsaPrivate   grsa.Private
+	loginKeys    *loginKeyRing
+
+	totpMutex   sync.Mutex
+	totpTickets map[string]*totpTicket // key: ticket
+	totpAead    cipher.AEAD
 
 	AccountVerification func(account, password string) gtype.Error
 }
 
+// Start rotates the login rsa key in background if the rotation is configured
+func (s *Ad) Start() {
+	if s.Cfg == nil || s.Cfg.Auth.Rsa.Rotation <= 0 {
+		return
+	}
+
+	go s.runKeyRotation()
+}
+
 func (s *Ad) GetCaptcha(ctx gtype.Context, ps gtype.Params) {
 	filter := &gtype.CaptchaFilter{
 		Mode:   3,
@@ -72,18 +113,14 @@ func (s *Ad) GetCaptcha(ctx gtype.Context, ps gtype.Params) {
 		return
 	}
 
-	data := &gtype.Captcha{
-		ID:       captchaId,
-		Value:    captchaValue,
-		Required: s.captchaRequired(ctx.RIP()),
-	}
-	rsaPublic, err := s.rsaPrivate.Public()
-	if err == nil {
-		keyVal, err := rsaPublic.ToMemory()
-		if err == nil {
-			data.RsaPublicKey = string(keyVal)
-		}
+	data := &model.AuthCaptcha{
+		Captcha: gtype.Captcha{
+			ID:       captchaId,
+			Value:    captchaValue,
+			Required: s.captchaRequired(ctx.RIP()),
+		},
 	}
+	data.RsaKeyID, data.RsaPublicKey = s.loginKeys.public()
 
 	ctx.Success(data)
 }
@@ -91,7 +128,8 @@ func (s *Ad) GetCaptcha(ctx gtype.Context, ps gtype.Params) {
 func (s *Ad) GetCaptchaDoc(doc gtype.Doc, method string, uri gtype.Uri) {
 	catalog := s.createCatalog(doc, authCatalogAd)
 	function := catalog.AddFunction(method, uri, "获取验证码")
-	function.SetNote("获取用户登陆需要的验证码信息")
+	function.SetNote("获取用户登陆需要的验证码信息, 以及加密登录密码的RSA公钥(PKCS#1 v1.5)及其ID; " +
+		"公钥按配置(config: auth.rsa.rotation)定期轮换, 轮换后旧公钥加密的密码在宽限期内仍可登录")
 	function.SetRemark("该接口不需要凭证")
 	function.SetInputJsonExample(&gtype.CaptchaFilter{
 		Mode:   3,
@@ -100,11 +138,14 @@ func (s *Ad) GetCaptchaDoc(doc gtype.Doc, method string, uri gtype.Uri) {
 		Height: 30,
 	})
 
-	function.SetOutputDataExample(&gtype.Captcha{
-		ID:           "GKSVhVMRAHsyVuXSrMYs",
-		Value:        "data:image/png;base64,iVBOR...",
-		RsaPublicKey: "-----BEGIN PUBLIC KEY-----...-----END PUBLIC KEY-----",
-		Required:     false,
+	function.SetOutputDataExample(&model.AuthCaptcha{
+		Captcha: gtype.Captcha{
+			ID:           "GKSVhVMRAHsyVuXSrMYs",
+			Value:        "data:image/png;base64,iVBOR...",
+			RsaPublicKey: "-----BEGIN PUBLIC KEY-----...-----END PUBLIC KEY-----",
+			Required:     false,
+		},
+		RsaKeyID: "3f9a1c0d5e7b2468",
 	})
 	function.AddOutputError(gtype.ErrInput)
 	function.AddOutputError(gtype.ErrInternal)
@@ -118,55 +159,33 @@ func (s *Ad) Login(ctx gtype.Context, ps gtype.Params) {
 		return
 	}
 
-	requireCaptcha := s.captchaRequired(ctx.RIP())
-	err = filter.Check(requireCaptcha)
-	if err != nil {
-		ctx.Error(gtype.ErrInput, err)
+	pwd, be, err := s.decodeLogin(ctx, filter)
+	if be != nil {
+		ctx.Error(be, err)
 		return
 	}
 
-	if requireCaptcha {
-		captchaValue := s.captchaStore.Get(filter.CaptchaId, true)
-		if strings.ToLower(captchaValue) != strings.ToLower(filter.CaptchaValue) {
-			ctx.Error(gtype.ErrLoginCaptchaInvalid)
-			return
-		}
-	}
-
-	pwd := filter.Password
-	if strings.ToLower(filter.Encryption) == "rsa" {
-		buf, err := base64.StdEncoding.DecodeString(filter.Password)
-		if err != nil {
-			ctx.Error(gtype.ErrLoginPasswordInvalid, err)
-			s.increaseErrorCount(ctx.RIP())
-			return
-		}
-
-		decryptedPwd, err := s.rsaPrivate.Decrypt(buf)
-		if err != nil {
-			ctx.Error(gtype.ErrLoginPasswordInvalid, err)
-			s.increaseErrorCount(ctx.RIP())
-			return
-		}
-		pwd = string(decryptedPwd)
-	}
-
 	login, be, err := s.Authenticate(ctx, filter.Account, pwd)
 	if be != nil {
 		ctx.Error(be, err)
-		s.increaseErrorCount(ctx.RIP())
+		s.increaseErrorCount(ctx.RIP(), filter.Account)
 		return
 	}
 
+	if len(login.TotpTicket) < 1 {
+		s.clearErrorCount(filter.Account)
+	}
+
 	ctx.Success(login)
-	s.clearErrorCount(ctx.RIP())
 }
 
 func (s *Ad) LoginDoc(doc gtype.Doc, method string, uri gtype.Uri) {
 	catalog := s.createCatalog(doc, authCatalogAd)
 	function := catalog.AddFunction(method, uri, "用户登录")
-	function.SetNote("通过用户账号及密码进行登录获取凭证")
-	function.SetRemark("连续3次错误将要求输入验证码")
+	function.SetNote("通过用户账号及密码进行登录获取凭证; 启用JWT(config: auth.token.jwt)时凭证为短期有效的JWT, 同时签发刷新凭证; " +
+		"须两步验证(已启用或所在的组强制启用)时不签发凭证, 而是返回票据(totpTicket), 提交验证码后完成登录")
+	function.SetRemark("同一IP在窗口期内错误达到阈值(config: auth.limit.captcha, 默认3次)将要求输入验证码; " +
+		"同一IP或同一帐号错误达到锁定阈值(config: auth.limit.lockout, 默认10次)将暂时锁定")
 	function.SetInputJsonExample(&gtype.LoginFilter{
 		Account:      "admin",
 		Password:     "1",
@@ -175,8 +194,10 @@ func (s *Ad) LoginDoc(doc gtype.Doc, method string, uri gtype.Uri) {
 		Encryption:   "",
 	})
 
-	function.SetOutputDataExample(&gtype.Login{
-		Token: "71b9b7e2ac6d4166b18f414942ff3481",
+	function.SetOutputDataExample(&model.AuthLogin{
+		Login: gtype.Login{
+			Token: "71b9b7e2ac6d4166b18f414942ff3481",
+		},
 	})
 	function.AddOutputError(gtype.ErrInput)
 	function.AddOutputError(gtype.ErrInternal)
@@ -184,6 +205,7 @@ func (s *Ad) LoginDoc(doc gtype.Doc, method string, uri gtype.Uri) {
 	function.AddOutputError(gtype.ErrLoginAccountNotExit)
 	function.AddOutputError(gtype.ErrLoginPasswordInvalid)
 	function.AddOutputError(gtype.ErrLoginAccountOrPasswordInvalid)
+	function.AddOutputError(gtype.ErrNoPermission)
 }
 
 func (s *Ad) Logout(ctx gtype.Context, ps gtype.Params) {
@@ -192,16 +214,18 @@ func (s *Ad) Logout(ctx gtype.Context, ps gtype.Params) {
 		ctx.Error(gtype.ErrTokenEmpty)
 		return
 	}
-	_, ok := s.Tdb.Get(tv, false)
+	key := s.TokenKey(tv)
+	_, ok := s.Tdb.Get(key, false)
 	if !ok {
 		ctx.Error(gtype.ErrTokenInvalid)
 		return
 	}
 
 	s.WriteWebSocketMessage(ctx.Token(), socket.WSUserLogout, nil)
-	ok = s.Tdb.Del(tv)
+	ok = s.Tdb.Del(key)
 	if ok {
 	}
+	s.deleteRefreshTokens(key)
 
 	ctx.Success(nil)
 }
@@ -209,7 +233,7 @@ func (s *Ad) Logout(ctx gtype.Context, ps gtype.Params) {
 func (s *Ad) LogoutDoc(doc gtype.Doc, method string, uri gtype.Uri) {
 	catalog := s.createCatalog(doc, authCatalogAd)
 	function := catalog.AddFunction(method, uri, "退出登录")
-	function.SetNote("退出登录, 使当前凭证失效")
+	function.SetNote("退出登录, 使当前凭证及其刷新凭证失效")
 	function.SetOutputDataExample(nil)
 	function.AddOutputError(gtype.ErrTokenEmpty)
 	function.AddOutputError(gtype.ErrTokenInvalid)
@@ -228,45 +252,199 @@ func (s *Ad) CreateTokenForAccountPassword(items []gtype.TokenAuth, ctx gtype.Co
 		}
 	}
 
-	model, code, err := s.Authenticate(ctx, account, password)
+	code, err := s.checkLocked(ctx.RIP(), account)
 	if code != nil {
 		return "", code.SetDetail(err)
 	}
 
+	model, code, err := s.Authenticate(ctx, account, password)
+	if code != nil {
+		s.increaseErrorCount(ctx.RIP(), account)
+		return "", code.SetDetail(err)
+	}
 	if model != nil {
+		if len(model.TotpTicket) > 0 {
+			return "", gtype.ErrNoPermission.SetDetail("该帐号须两步验证, 请通过登录页面登录")
+		}
+		s.clearErrorCount(account)
 		return model.Token, nil
 	}
 
 	return "", nil
 }
 
-func (s *Ad) Authenticate(ctx gtype.Context, account, password string) (*gtype.Login, gtype.Error, error) {
+func (s *Ad) Authenticate(ctx gtype.Context, account, password string) (*model.AuthLogin, gtype.Error, error) {
+	user, login, be, err := s.authenticateUser(ctx, account, password)
+	if be != nil {
+		return nil, be, err
+	}
+	if login != nil {
+		return login, nil, nil
+	}
+
+	login, err = s.CreateLogin(user, ctx.RIP())
+	if err != nil {
+		return nil, gtype.ErrInternal, err
+	}
+
+	return login, nil, nil
+}
+
+// authenticateUser checks the password of the account, the login with the totp ticket is returned
+// instead of the user if the second factor is required
+func (s *Ad) authenticateUser(ctx gtype.Context, account, password string) (*assist.AdEntryUser, *model.AuthLogin, gtype.Error, error) {
 	ad := s.Ad()
 	user, err := ad.Login(account, password)
 	if err != nil {
-		return nil, gtype.ErrLoginAccountOrPasswordInvalid, err
+		return nil, nil, gtype.ErrLoginAccountOrPasswordInvalid, err
+	}
+	s.putNtHash(user, password)
+
+	login, err := s.requireTotp(user, ctx.RIP())
+	if err != nil {
+		return nil, nil, gtype.ErrInternal, err
+	}
+	if login != nil {
+		return nil, login, nil, nil
+	}
+
+	return user, nil, nil, nil
+}
+
+// requireTotp returns the login with the totp ticket for the ip if the user must pass the second factor,
+// or nil if it is not required
+func (s *Ad) requireTotp(user *assist.AdEntryUser, ip string) (*model.AuthLogin, error) {
+	required, enrolled, err := s.checkTotp(user)
+	if err != nil {
+		return nil, err
+	}
+	if !required {
+		return nil, nil
+	}
+
+	ticket, err := s.newTotpTicket(user, ip)
+	if err != nil {
+		return nil, err
 	}
 
+	return &model.AuthLogin{
+		Login: gtype.Login{
+			Account: user.Account,
+			Name:    user.Name,
+		},
+		TotpTicket: ticket,
+		TotpEnroll: !enrolled,
+	}, nil
+}
+
+// CreateLogin creates the token for the user who has been authenticated already (e.g. by WeChat),
+// the token is only valid for the ip
+func (s *Ad) CreateLogin(user *assist.AdEntryUser, ip string) (*model.AuthLogin, error) {
 	now := time.Now()
 	token := &gtype.Token{
-		ID:          ctx.NewGuid(),
+		ID:          gtype.NewGuid(),
 		UserAccount: user.Account,
 		UserName:    user.Name,
-		LoginIP:     ctx.RIP(),
+		LoginIP:     ip,
 		LoginTime:   now,
 		ActiveTime:  now,
 		Usage:       0,
 		Ext:         user,
 	}
 	s.Tdb.Set(token.ID, token)
+	s.limitSessions(token.UserAccount)
+
+	if s.Signer != nil {
+		login, err := s.issueTokens(token)
+		if err != nil {
+			s.Tdb.Del(token.ID)
+			return nil, err
+		}
+		go s.purgeRefreshTokens()
+
+		return login, nil
+	}
 
-	login := &gtype.Login{
-		Token:   token.ID,
-		Account: token.UserAccount,
-		Name:    token.UserName,
+	login := &model.AuthLogin{
+		Login: gtype.Login{
+			Token:   token.ID,
+			Account: token.UserAccount,
+			Name:    token.UserName,
+		},
 	}
 
-	return login, nil, err
+	return login, nil
+}
+
+// VerifyPassword checks the password of the account for the logins outside of http (e.g. RADIUS),
+// the failures are limited by the same limiter as the other logins, ip is the address of the end user if known
+func (s *Ad) VerifyPassword(ip, account, password string) (*assist.AdEntryUser, error) {
+	_, err := s.checkLocked(ip, account)
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := s.Ad().Login(account, password)
+	if err != nil {
+		s.increaseErrorCount(ip, account)
+		return nil, err
+	}
+	s.clearErrorCount(account)
+	s.putNtHash(user, password)
+
+	return user, nil
+}
+
+// VerifyNtHash checks the MS-CHAPv2 response of the account with the saved NT hash, verify returns true
+// if the response matches the hash; the failures are limited together with VerifyPassword
+func (s *Ad) VerifyNtHash(ip, account string, verify func(ntHash []byte) bool) (*assist.AdEntryUser, error) {
+	_, err := s.checkLocked(ip, account)
+	if err != nil {
+		return nil, err
+	}
+
+	ad := s.Ad()
+	user, err := ad.GetUser(account)
+	if err != nil {
+		if ad.IsNotExit(err) {
+			s.increaseErrorCount(ip, account)
+		}
+		return nil, err
+	}
+	// the password is not checked by AD, so the state of the account is checked here
+	enable, err := ad.GetUserEnable(user.Account)
+	if err != nil {
+		return nil, err
+	}
+	if !enable {
+		return nil, fmt.Errorf("帐号(%s)已禁用", user.Account)
+	}
+	if user.PwdLastSet == "0" {
+		return nil, fmt.Errorf("帐号(%s)须修改密码后才能登录", user.Account)
+	}
+
+	hash, err := s.GetNtHash(user)
+	if err != nil {
+		return nil, err
+	}
+	if !verify(hash) {
+		s.increaseErrorCount(ip, account)
+		return nil, fmt.Errorf("密码错误")
+	}
+	s.clearErrorCount(account)
+
+	return user, nil
+}
+
+// putNtHash keeps the NT hash for MS-CHAPv2 after the password is verified by AD, a failure does not fail the login
+func (s *Ad) putNtHash(user *assist.AdEntryUser, password string) {
+	if !s.NtHashEnabled() {
+		return
+	}
+	err := s.PutNtHash(user, password)
+	if err != nil {
+		s.LogError(fmt.Sprintf("save nt hash of %s fail: ", user.Account), err)
+	}
 }
 
 func (s *Ad) CheckToken(ctx gtype.Context, ps gtype.Params) {
@@ -276,8 +454,12 @@ func (s *Ad) CheckToken(ctx gtype.Context, ps gtype.Params) {
 		ctx.SetHandled(true)
 		return
 	}
+	if controller.IsApiKey(tokenValue) {
+		s.checkApiKey(ctx, tokenValue)
+		return
+	}
 
-	token, ok := s.Tdb.Get(tokenValue, true)
+	token, ok := s.Tdb.Get(s.TokenKey(tokenValue), true)
 	if !ok {
 		ctx.Error(gtype.ErrTokenInvalid)
 		ctx.SetHandled(true)
@@ -296,6 +478,66 @@ func (s *Ad) CheckToken(ctx gtype.Context, ps gtype.Params) {
 		ctx.SetHandled(true)
 		return
 	}
+
+	s.checkImpersonation(ctx, tokenModel)
+}
+
+// decodeLogin checks the lockout and the captcha if required, and returns the password decrypted
+func (s *Ad) decodeLogin(ctx gtype.Context, filter *gtype.LoginFilter) (string, gtype.Error, error) {
+	requireCaptcha := s.captchaRequired(ctx.RIP())
+	err := filter.Check(requireCaptcha)
+	if err != nil {
+		return "", gtype.ErrInput, err
+	}
+
+	be, err := s.checkLocked(ctx.RIP(), filter.Account)
+	if be != nil {
+		return "", be, err
+	}
+
+	if requireCaptcha {
+		captchaValue := s.captchaStore.Get(filter.CaptchaId, true)
+		if strings.ToLower(captchaValue) != strings.ToLower(filter.CaptchaValue) {
+			return "", gtype.ErrLoginCaptchaInvalid, nil
+		}
+	}
+
+	pwd := filter.Password
+	if strings.ToLower(filter.Encryption) == "rsa" {
+		buf, err := base64.StdEncoding.DecodeString(filter.Password)
+		if err != nil {
+			s.increaseErrorCount(ctx.RIP(), filter.Account)
+			return "", gtype.ErrLoginPasswordInvalid, err
+		}
+
+		decryptedPwd, err := s.loginKeys.decrypt(buf, time.Now())
+		if err != nil {
+			s.increaseErrorCount(ctx.RIP(), filter.Account)
+			return "", gtype.ErrLoginPasswordInvalid, err
+		}
+		pwd = string(decryptedPwd)
+	}
+
+	return pwd, nil, nil
+}
+
+func (s *Ad) runKeyRotation() {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		now := time.Now()
+		if !s.loginKeys.expired(now) {
+			continue
+		}
+		err := s.loginKeys.rotate(now)
+		if err != nil {
+			s.LogError("rotate login rsa key fail: ", err)
+			continue
+		}
+		id, _ := s.loginKeys.public()
+		s.LogInfo("login rsa key rotated, new key id: ", id)
+	}
 }
 
 func (s *Ad) onWebsocketWriteFilter(message *gtype.SocketMessage, channel gtype.SocketChannel, token *gtype.Token) bool {
@@ -319,43 +561,41 @@ func (s *Ad) onWebsocketWriteFilter(message *gtype.SocketMessage, channel gtype.
 }
 
 func (s *Ad) captchaRequired(ip string) bool {
-	if s.errorCount == nil {
+	if s.limiter == nil {
 		return false
 	}
 
-	count, ok := s.errorCount[ip]
-	if ok {
-		if count < 3 {
-			return false
-		} else {
-			return true
-		}
-	}
-
-	return false
+	return s.limiter.captchaRequired(ip, time.Now())
 }
 
-func (s *Ad) increaseErrorCount(ip string) {
-	if s.errorCount == nil {
-		return
+// checkLocked returns ErrNoPermission if the ip or the account is locked for too many failures
+func (s *Ad) checkLocked(ip, account string) (gtype.Error, error) {
+	if s.limiter == nil {
+		return nil, nil
 	}
 
-	count := 1
-	v, ok := s.errorCount[ip]
-	if ok {
-		count += v
+	until, locked := s.limiter.locked(ip, account, time.Now())
+	if !locked {
+		return nil, nil
 	}
 
-	s.errorCount[ip] = count
+	return gtype.ErrNoPermission, fmt.Errorf("登录失败次数过多, 已暂时锁定, 请于%s后重试", until.Format("2006-01-02 15:04:05"))
 }
 
-func (s *Ad) clearErrorCount(ip string) {
-	if s.errorCount == nil {
+func (s *Ad) increaseErrorCount(ip, account string) {
+	if s.limiter == nil {
 		return
 	}
 
-	_, ok := s.errorCount[ip]
-	if ok {
-		delete(s.errorCount, ip)
+	s.limiter.fail(ip, account, time.Now())
+}
+
+// clearErrorCount clears the failures of the account after the token (or the assertion) is issued, but not after the totp ticket,
+// the failures of the ip are kept until out of the window, so that guessing many accounts is still throttled
+func (s *Ad) clearErrorCount(account string) {
+	if s.limiter == nil || len(account) < 1 {
+		return
 	}
+
+	s.limiter.clear(model.AuthLimitKindAccount, account)
 }
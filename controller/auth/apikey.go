@@ -0,0 +1,352 @@
+package auth
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/csby/goa/controller"
+	"github.com/csby/goa/data/model"
+	"github.com/csby/gwsf/gtype"
+	"net"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	authCatalogApiKey = "API密钥"
+)
+
+func (s *Ad) CreateApiKey(ctx gtype.Context, ps gtype.Params) {
+	token := s.getApiKeyManager(ctx)
+	if token == nil {
+		return
+	}
+
+	argument := &model.ApiKeyCreate{}
+	err := ctx.GetJson(argument)
+	if err != nil {
+		ctx.Error(gtype.ErrInput, err)
+		return
+	}
+	item, err := s.newApiKeyItem(argument, time.Now())
+	if err != nil {
+		ctx.Error(gtype.ErrInput, err)
+		return
+	}
+	if s.Dbs == nil {
+		ctx.Error(gtype.ErrInternal, "本地数据库不可用")
+		return
+	}
+	user, err := s.Ad().GetUser(item.Account)
+	if err != nil {
+		ctx.Error(gtype.ErrInput, fmt.Sprintf("用户帐号(%s)不存在: %v", item.Account, err))
+		return
+	}
+	item.Account = user.Account
+
+	id, key, hash, err := controller.NewApiKey()
+	if err != nil {
+		ctx.Error(gtype.ErrInternal, err)
+		return
+	}
+	item.ID = id
+	item.Hash = hash
+	item.Creator = token.UserAccount
+	err = s.Dbs.Put(controller.ApiKeyBucket, item.ID, item)
+	if err != nil {
+		ctx.Error(gtype.ErrInternal, err)
+		return
+	}
+	s.LogInfo(fmt.Sprintf("api key %s (%s) for %s created by %s", item.ID, item.Name, item.Account, token.UserAccount))
+
+	item.Hash = ""
+	ctx.Success(&model.ApiKeyCreated{
+		ApiKey: *item,
+		Key:    key,
+	})
+}
+
+func (s *Ad) CreateApiKeyDoc(doc gtype.Doc, method string, uri gtype.Uri) {
+	catalog := s.createCatalog(doc, authCatalogAd, authCatalogApiKey)
+	function := catalog.AddFunction(method, uri, "创建密钥")
+	function.SetNote("为脚本、自助终端等服务创建API密钥, 调用接口时将密钥作为凭证(token)使用, 权限与指定的用户帐号相同, " +
+		"但仅限于指定的接口及来源地址, 且不与登录IP绑定; 密钥仅在创建时返回一次, 系统只保存其哈希值")
+	function.SetRemark("需要管理员权限, 不能使用API密钥调用")
+	function.SetInputJsonExample(&model.ApiKeyCreate{
+		Name:    "dhcp-kiosk",
+		Account: "svc.dhcp",
+		Routes: []string{
+			"/staff.api/dhcp/filter/add",
+			"/staff.api/dhcp/filter/list",
+		},
+		Cidrs: []string{
+			"192.168.1.0/24",
+		},
+		ExpireTime: gtype.DateTime(time.Now().AddDate(1, 0, 0)),
+	})
+	function.SetOutputDataExample(&model.ApiKeyCreated{
+		ApiKey: model.ApiKey{
+			ID:      "3f9a1c0d5e7b2468",
+			Name:    "dhcp-kiosk",
+			Account: "svc.dhcp",
+			Routes: []string{
+				"/staff.api/dhcp/filter/add",
+				"/staff.api/dhcp/filter/list",
+			},
+			Cidrs: []string{
+				"192.168.1.0/24",
+			},
+			ExpireTime: gtype.DateTime(time.Now().AddDate(1, 0, 0)),
+			Creator:    "admin",
+			CreateTime: gtype.DateTime(time.Now()),
+		},
+		Key: "goak_3f9a1c0d5e7b2468_Vq0s3h...",
+	})
+	function.AddOutputError(gtype.ErrInput)
+	function.AddOutputError(gtype.ErrInternal)
+	function.AddOutputError(gtype.ErrTokenInvalid)
+	function.AddOutputError(gtype.ErrNoPermission)
+}
+
+func (s *Ad) GetApiKeys(ctx gtype.Context, ps gtype.Params) {
+	token := s.getApiKeyManager(ctx)
+	if token == nil {
+		return
+	}
+	if s.Dbs == nil {
+		ctx.Error(gtype.ErrInternal, "本地数据库不可用")
+		return
+	}
+
+	results := make([]*model.ApiKey, 0)
+	err := s.Dbs.ForEach(controller.ApiKeyBucket, func(key string, value []byte) error {
+		item := &model.ApiKey{}
+		if json.Unmarshal(value, item) != nil {
+			return nil
+		}
+		item.Hash = ""
+		results = append(results, item)
+		return nil
+	})
+	if err != nil {
+		ctx.Error(gtype.ErrInternal, err)
+		return
+	}
+	sort.Slice(results, func(i, j int) bool {
+		return time.Time(results[i].CreateTime).After(time.Time(results[j].CreateTime))
+	})
+
+	ctx.Success(results)
+}
+
+func (s *Ad) GetApiKeysDoc(doc gtype.Doc, method string, uri gtype.Uri) {
+	catalog := s.createCatalog(doc, authCatalogAd, authCatalogApiKey)
+	function := catalog.AddFunction(method, uri, "获取密钥列表")
+	function.SetNote("获取所有API密钥(不含密钥本身)及其最后使用情况, 按创建时间倒序排列")
+	function.SetRemark("需要管理员权限, 不能使用API密钥调用")
+	useTime := gtype.DateTime(time.Now())
+	function.SetOutputDataExample([]*model.ApiKey{
+		{
+			ID:      "3f9a1c0d5e7b2468",
+			Name:    "dhcp-kiosk",
+			Account: "svc.dhcp",
+			Routes: []string{
+				"/staff.api/dhcp/filter/*",
+			},
+			Cidrs: []string{
+				"192.168.1.0/24",
+			},
+			ExpireTime: gtype.DateTime(time.Now().AddDate(1, 0, 0)),
+			Creator:    "admin",
+			CreateTime: gtype.DateTime(time.Now()),
+			UseTime:    &useTime,
+			UseIP:      "192.168.1.20",
+			UseCount:   36,
+		},
+	})
+	function.AddOutputError(gtype.ErrInternal)
+	function.AddOutputError(gtype.ErrTokenInvalid)
+	function.AddOutputError(gtype.ErrNoPermission)
+}
+
+func (s *Ad) DeleteApiKey(ctx gtype.Context, ps gtype.Params) {
+	token := s.getApiKeyManager(ctx)
+	if token == nil {
+		return
+	}
+
+	argument := &model.ApiKeyDelete{}
+	err := ctx.GetJson(argument)
+	if err != nil {
+		ctx.Error(gtype.ErrInput, err)
+		return
+	}
+	if len(argument.ID) < 1 {
+		ctx.Error(gtype.ErrInput, "标识ID(id)为空")
+		return
+	}
+	if s.Dbs == nil {
+		ctx.Error(gtype.ErrInternal, "本地数据库不可用")
+		return
+	}
+	item := &model.ApiKey{}
+	ok, err := s.Dbs.Get(controller.ApiKeyBucket, argument.ID, item)
+	if err != nil {
+		ctx.Error(gtype.ErrInternal, err)
+		return
+	}
+	if !ok {
+		ctx.Error(gtype.ErrInput, fmt.Sprintf("API密钥(id=%s)不存在", argument.ID))
+		return
+	}
+
+	err = s.Dbs.Delete(controller.ApiKeyBucket, argument.ID)
+	if err != nil {
+		ctx.Error(gtype.ErrInternal, err)
+		return
+	}
+	s.LogInfo(fmt.Sprintf("api key %s (%s) for %s deleted by %s", item.ID, item.Name, item.Account, token.UserAccount))
+
+	ctx.Success(nil)
+}
+
+func (s *Ad) DeleteApiKeyDoc(doc gtype.Doc, method string, uri gtype.Uri) {
+	catalog := s.createCatalog(doc, authCatalogAd, authCatalogApiKey)
+	function := catalog.AddFunction(method, uri, "删除密钥")
+	function.SetNote("删除API密钥, 删除后立即失效")
+	function.SetRemark("需要管理员权限, 不能使用API密钥调用")
+	function.SetInputJsonExample(&model.ApiKeyDelete{
+		ID: "3f9a1c0d5e7b2468",
+	})
+	function.SetOutputDataExample(nil)
+	function.AddOutputError(gtype.ErrInput)
+	function.AddOutputError(gtype.ErrInternal)
+	function.AddOutputError(gtype.ErrTokenInvalid)
+	function.AddOutputError(gtype.ErrNoPermission)
+}
+
+// checkApiKey checks the api key presented as the token, the route and the source address must be allowed
+func (s *Ad) checkApiKey(ctx gtype.Context, value string) {
+	item, err := s.GetApiKey(value)
+	if err != nil {
+		ctx.Error(gtype.ErrTokenInvalid, err)
+		ctx.SetHandled(true)
+		return
+	}
+
+	ip := ctx.RIP()
+	path := ctx.Path()
+	if !controller.ApiKeyAllowIP(item, ip) {
+		s.LogWarning(fmt.Sprintf("api key %s (%s) refused: address %s is not allowed", item.ID, item.Name, ip))
+		ctx.Error(gtype.ErrTokenIllegal, fmt.Sprintf("来源地址(%s)不在API密钥允许的范围内", ip))
+		ctx.SetHandled(true)
+		return
+	}
+	if !controller.ApiKeyAllowRoute(item, path) {
+		s.LogWarning(fmt.Sprintf("api key %s (%s) refused: route %s is not allowed", item.ID, item.Name, path))
+		ctx.Error(gtype.ErrNoPermission, fmt.Sprintf("API密钥不允许调用该接口(%s)", path))
+		ctx.SetHandled(true)
+		return
+	}
+
+	s.LogInfo(fmt.Sprintf("api key %s (%s) used as %s from %s: %s", item.ID, item.Name, item.Account, ip, path))
+	now := gtype.DateTime(time.Now())
+	err = s.Dbs.Modify(controller.ApiKeyBucket, item.ID, item, func(existed bool) error {
+		if !existed {
+			return fmt.Errorf("not existed")
+		}
+		item.UseTime = &now
+		item.UseIP = ip
+		item.UseCount++
+		return nil
+	})
+	if err != nil {
+		s.LogError(fmt.Sprintf("save usage of api key %s fail: ", item.ID), err)
+	}
+}
+
+// getApiKeyManager returns the token of the admin who manages the api keys, an api key can not manage api keys
+func (s *Ad) getApiKeyManager(ctx gtype.Context) *gtype.Token {
+	if controller.IsApiKey(ctx.Token()) {
+		ctx.Error(gtype.ErrNoPermission, "不能使用API密钥管理API密钥")
+		return nil
+	}
+	token := s.GetToken(ctx.Token())
+	if token == nil {
+		ctx.Error(gtype.ErrTokenInvalid)
+		return nil
+	}
+	if !s.IsAdmin(token.UserAccount) {
+		ctx.Error(gtype.ErrNoPermission, "需要管理员权限才能管理API密钥")
+		return nil
+	}
+
+	return token
+}
+
+// newApiKeyItem checks the argument and returns the api key without id and hash,
+// a single ip in cidrs is converted to the cidr of the host
+func (s *Ad) newApiKeyItem(argument *model.ApiKeyCreate, now time.Time) (*model.ApiKey, error) {
+	item := &model.ApiKey{
+		Name:       strings.TrimSpace(argument.Name),
+		Account:    strings.TrimSpace(argument.Account),
+		Routes:     make([]string, 0),
+		Cidrs:      make([]string, 0),
+		ExpireTime: argument.ExpireTime,
+		CreateTime: gtype.DateTime(now),
+	}
+	if len(item.Name) < 1 {
+		return nil, fmt.Errorf("名称(name)为空")
+	}
+	if len(item.Account) < 1 {
+		return nil, fmt.Errorf("用户帐号(account)为空")
+	}
+	if !time.Time(item.ExpireTime).After(now) {
+		return nil, fmt.Errorf("过期时间(expireTime)须晚于当前时间")
+	}
+
+	for _, route := range argument.Routes {
+		route = strings.TrimSpace(route)
+		if len(route) < 1 {
+			continue
+		}
+		if !strings.HasPrefix(route, "/") {
+			return nil, fmt.Errorf("接口路径(%s)须以/开头", route)
+		}
+		if route == "/*" {
+			return nil, fmt.Errorf("接口路径不能为/*, 请指定具体的接口")
+		}
+		item.Routes = append(item.Routes, route)
+	}
+	if len(item.Routes) < 1 {
+		return nil, fmt.Errorf("接口路径(routes)为空")
+	}
+
+	for _, cidr := range argument.Cidrs {
+		cidr = strings.TrimSpace(cidr)
+		if len(cidr) < 1 {
+			continue
+		}
+		if !strings.Contains(cidr, "/") {
+			ip := net.ParseIP(cidr)
+			if ip == nil {
+				return nil, fmt.Errorf("来源地址(%s)无效", cidr)
+			}
+			if ip.To4() != nil {
+				cidr = cidr + "/32"
+			} else {
+				cidr = cidr + "/128"
+			}
+		}
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("来源地址(%s)无效: %v", cidr, err)
+		}
+		item.Cidrs = append(item.Cidrs, network.String())
+	}
+	if len(item.Cidrs) < 1 {
+		return nil, fmt.Errorf("来源地址(cidrs)为空")
+	}
+
+	return item, nil
+}
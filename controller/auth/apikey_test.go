@@ -0,0 +1,51 @@
+package auth
+
+import (
+	"github.com/csby/goa/data/model"
+	"github.com/csby/gwsf/gtype"
+	"testing"
+	"time"
+)
+
+func TestAd_NewApiKeyItem(t *testing.T) {
+	s := &Ad{}
+	now := time.Now()
+	argument := &model.ApiKeyCreate{
+		Name:       " dhcp-kiosk ",
+		Account:    "svc.dhcp",
+		Routes:     []string{"/staff.api/dhcp/filter/add", " "},
+		Cidrs:      []string{"192.168.1.7/24", "10.0.0.8", "fd00::1"},
+		ExpireTime: gtype.DateTime(now.AddDate(1, 0, 0)),
+	}
+
+	item, err := s.newApiKeyItem(argument, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if item.Name != "dhcp-kiosk" || len(item.Routes) != 1 {
+		t.Errorf("unexpected item: %+v", item)
+	}
+	cidrs := []string{"192.168.1.0/24", "10.0.0.8/32", "fd00::1/128"}
+	for i, cidr := range cidrs {
+		if item.Cidrs[i] != cidr {
+			t.Errorf("cidr %d: expected %s, got %s", i, cidr, item.Cidrs[i])
+		}
+	}
+
+	invalids := []func(a *model.ApiKeyCreate){
+		func(a *model.ApiKeyCreate) { a.Routes = nil },
+		func(a *model.ApiKeyCreate) { a.Routes = []string{"/*"} },
+		func(a *model.ApiKeyCreate) { a.Routes = []string{"staff.api/dhcp"} },
+		func(a *model.ApiKeyCreate) { a.Cidrs = nil },
+		func(a *model.ApiKeyCreate) { a.Cidrs = []string{"192.168.1.300"} },
+		func(a *model.ApiKeyCreate) { a.ExpireTime = gtype.DateTime(now) },
+		func(a *model.ApiKeyCreate) { a.Account = "" },
+	}
+	for i, invalid := range invalids {
+		a := *argument
+		invalid(&a)
+		if _, err = s.newApiKeyItem(&a, now); err == nil {
+			t.Errorf("invalid argument %d should be refused", i)
+		}
+	}
+}
@@ -0,0 +1,433 @@
+package auth
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/csby/goa/controller"
+	"github.com/csby/goa/data/model"
+	"github.com/csby/gwsf/gtype"
+	"io"
+	"strings"
+	"time"
+)
+
+const (
+	authCatalogAuthz = "接口授权"
+)
+
+func NewAuthz(log gtype.Log, param *controller.Parameter) *Authz {
+	instance := &Authz{}
+	instance.SetLog(log)
+	instance.SetParameter(param)
+	instance.rules = make(map[string]*AuthzRule)
+	instance.uris = make([]string, 0)
+
+	return instance
+}
+
+// Authz checks the roles of the login user before the handlers of the restricted routes
+type Authz struct {
+	base
+
+	rules map[string]*AuthzRule // key: lower case of the full path
+	uris  []string              // full paths in the declared order
+}
+
+// AuthzRule declares the roles which may call the route, any one of the roles is enough
+type AuthzRule struct {
+	Uri   string   // 接口地址, 不含前缀
+	Roles []string // 允许调用的角色, 见model.AuthRoleXxx
+
+	// 角色self: 请求参数中用户帐号的字段名, 字段名不区分大小写(与处理函数解析JSON一致)
+	Account string
+	// 角色self: 帐号为空时是否表示本人, 仅当处理函数在帐号为空时使用当前用户才能设置
+	AccountDefaultSelf bool
+	// 角色authorization: 请求参数中组DN(base64)的字段名, 为空时资源授权组成员即可调用
+	Group string
+	// 角色repository: 请求参数中SVN存储库名称的字段名
+	Repository string
+}
+
+// authzChecker is the role source of the rules, it is implemented by controller.Controller
+type authzChecker interface {
+	IsAdmin(account string) bool
+	IsAuthorizationMember(account string) (bool, error)
+	CanManageGroup(account, groupDn string) (bool, error)
+	IsSvnManager(account, repository string) (bool, error)
+	FromBase64(v string) (string, error)
+}
+
+// Authorize declares the rules of the routes and returns the pre-handle which checks the rules after the token,
+// the routes without rule are not restricted
+func (s *Authz) Authorize(path *gtype.Path, preHandle gtype.HttpHandle, rules []*AuthzRule) gtype.HttpHandle {
+	prefix := ""
+	if path != nil {
+		prefix = path.Prefix
+	}
+	for _, rule := range rules {
+		if rule == nil || len(rule.Roles) < 1 {
+			continue
+		}
+		uri := prefix + rule.Uri
+		key := strings.ToLower(uri)
+		if _, ok := s.rules[key]; !ok {
+			s.uris = append(s.uris, uri)
+		}
+		s.rules[key] = rule
+	}
+
+	return func(ctx gtype.Context, ps gtype.Params) {
+		if preHandle != nil {
+			preHandle(ctx, ps)
+		}
+		s.check(ctx)
+	}
+}
+
+func (s *Authz) GetCapabilities(ctx gtype.Context, ps gtype.Params) {
+	token := s.GetToken(ctx.Token())
+	if token == nil {
+		ctx.Error(gtype.ErrTokenInvalid)
+		return
+	}
+
+	result, err := s.capabilities(token.UserAccount, s)
+	if err != nil {
+		ctx.Error(gtype.ErrInternal, err)
+		return
+	}
+
+	ctx.Success(result)
+}
+
+func (s *Authz) GetCapabilitiesDoc(doc gtype.Doc, method string, uri gtype.Uri) {
+	catalog := s.createCatalog(doc, authCatalogAuthz)
+	function := catalog.AddFunction(method, uri, "获取本人权限")
+	function.SetNote("获取当前用户具有的角色及受限接口是否可以调用, 未列出的接口不受角色限制; " +
+		"条件为account的接口仅限操作本人帐号, 条件为group的接口仅限操作本人可管理的组, 条件为repository的接口仅限操作本人可管理的SVN存储库")
+	function.SetOutputDataExample(&model.AuthCapability{
+		Account: "zhangsan",
+		Roles:   []string{model.AuthRoleAuthorization},
+		Routes: []*model.AuthRouteCapability{
+			{
+				Uri:     "/staff.api/ad/user/account/password/reset",
+				Roles:   []string{model.AuthRoleAdmin},
+				Allowed: false,
+			},
+			{
+				Uri:       "/staff.api/ad/user/vpn/enable/get",
+				Roles:     []string{model.AuthRoleAdmin, model.AuthRoleSelf},
+				Allowed:   true,
+				Condition: model.AuthConditionAccount,
+			},
+			{
+				Uri:       "/staff.api/ad/group/member/add",
+				Roles:     []string{model.AuthRoleAdmin, model.AuthRoleAuthorization},
+				Allowed:   true,
+				Condition: model.AuthConditionGroup,
+			},
+		},
+	})
+	function.AddOutputError(gtype.ErrTokenInvalid)
+	function.AddOutputError(gtype.ErrInternal)
+}
+
+func (s *Authz) GetCacheStats(ctx gtype.Context, ps gtype.Params) {
+	token := s.GetToken(ctx.Token())
+	if token == nil {
+		ctx.Error(gtype.ErrTokenInvalid)
+		return
+	}
+
+	ctx.Success(s.Cache.Stats())
+}
+
+func (s *Authz) GetCacheStatsDoc(doc gtype.Doc, method string, uri gtype.Uri) {
+	catalog := s.createCatalog(doc, authCatalogAuthz)
+	function := catalog.AddFunction(method, uri, "获取权限缓存统计")
+	function.SetNote("获取管理员组成员、资源授权组成员及组角色查询结果缓存的命中统计, 有效期见配置(ad.cache.expiration)")
+	function.SetRemark("需要管理员权限")
+	function.SetOutputDataExample(&model.MembershipCacheStats{
+		Enabled: true,
+		Ttl:     60,
+		Size:    12,
+		Hits:    950,
+		Misses:  50,
+		HitRate: 0.95,
+		Kinds: []*model.MembershipCacheStat{
+			{
+				Kind:    controller.MembershipAdmin,
+				Size:    5,
+				Hits:    400,
+				Misses:  20,
+				HitRate: 0.952,
+			},
+		},
+		Time: gtype.DateTime(time.Now()),
+	})
+	function.AddOutputError(gtype.ErrTokenInvalid)
+	function.AddOutputError(gtype.ErrNoPermission)
+}
+
+func (s *Authz) ClearCache(ctx gtype.Context, ps gtype.Params) {
+	token := s.GetToken(ctx.Token())
+	if token == nil {
+		ctx.Error(gtype.ErrTokenInvalid)
+		return
+	}
+
+	count := s.Cache.Clear()
+	s.LogInfo(fmt.Sprintf("%d membership cache entries cleared by %s", count, token.UserAccount))
+
+	ctx.Success(count)
+}
+
+func (s *Authz) ClearCacheDoc(doc gtype.Doc, method string, uri gtype.Uri) {
+	catalog := s.createCatalog(doc, authCatalogAuthz)
+	function := catalog.AddFunction(method, uri, "清空权限缓存")
+	function.SetNote("清空管理员组成员、资源授权组成员及组角色查询结果的缓存, 用于在域控中直接修改组成员后立即生效, 返回清除的缓存项数量")
+	function.SetRemark("需要管理员权限")
+	function.SetOutputDataExample(12)
+	function.AddOutputError(gtype.ErrTokenInvalid)
+	function.AddOutputError(gtype.ErrNoPermission)
+}
+
+// check runs after the token is checked, the request is handled with error if the rule of the route denies
+func (s *Authz) check(ctx gtype.Context) {
+	rule, ok := s.rules[strings.ToLower(ctx.Path())]
+	if !ok {
+		return
+	}
+	token := s.GetToken(ctx.Token())
+	if token == nil {
+		// refused by the token checking already
+		return
+	}
+
+	args, err := s.readArguments(ctx)
+	if err != nil {
+		ctx.Error(gtype.ErrInput, err)
+		ctx.SetHandled(true)
+		return
+	}
+
+	allowed, be, err := rule.allow(token.UserAccount, args, s)
+	if be != nil {
+		ctx.Error(be, err)
+		ctx.SetHandled(true)
+		return
+	}
+	if !allowed {
+		s.LogWarning(fmt.Sprintf("%s refused for %s from %s: roles %v required", ctx.Path(), token.UserAccount, ctx.RIP(), rule.Roles))
+		ctx.Error(gtype.ErrNoPermission, fmt.Sprintf("需要以下角色之一才能调用该接口: %s", rule.roleNames()))
+		ctx.SetHandled(true)
+		return
+	}
+}
+
+// readArguments returns the json arguments of the request, the body is restored for the handler
+func (s *Authz) readArguments(ctx gtype.Context) (map[string]interface{}, error) {
+	args := make(map[string]interface{})
+	r := ctx.Request()
+	if r == nil || r.Body == nil {
+		return args, nil
+	}
+
+	data, err := io.ReadAll(r.Body)
+	r.Body.Close()
+	r.Body = io.NopCloser(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	if len(bytes.TrimSpace(data)) < 1 {
+		return args, nil
+	}
+	err = json.Unmarshal(data, &args)
+	if err != nil {
+		return nil, fmt.Errorf("参数不是有效的JSON对象: %s", err.Error())
+	}
+
+	return args, nil
+}
+
+func (s *Authz) capabilities(account string, checker authzChecker) (*model.AuthCapability, error) {
+	isAdmin := checker.IsAdmin(account)
+	isAuthorization, err := checker.IsAuthorizationMember(account)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &model.AuthCapability{
+		Account: account,
+		Roles:   make([]string, 0),
+		Routes:  make([]*model.AuthRouteCapability, 0, len(s.uris)),
+	}
+	if isAdmin {
+		result.Roles = append(result.Roles, model.AuthRoleAdmin)
+	}
+	if isAuthorization {
+		result.Roles = append(result.Roles, model.AuthRoleAuthorization)
+	}
+
+	for _, uri := range s.uris {
+		rule := s.rules[strings.ToLower(uri)]
+		item := &model.AuthRouteCapability{
+			Uri:   uri,
+			Roles: rule.Roles,
+		}
+		for _, role := range rule.Roles {
+			if role == model.AuthRoleAdmin && isAdmin {
+				item.Allowed, item.Condition = true, model.AuthConditionNone
+				break
+			} else if role == model.AuthRoleAuthorization && isAuthorization {
+				item.Allowed = true
+				if len(rule.Group) > 0 {
+					item.Condition = model.AuthConditionGroup
+				} else {
+					item.Condition = model.AuthConditionNone
+					break
+				}
+			} else if role == model.AuthRoleSelf && !item.Allowed {
+				item.Allowed, item.Condition = true, model.AuthConditionAccount
+			} else if role == model.AuthRoleRepository && !item.Allowed {
+				item.Allowed, item.Condition = true, model.AuthConditionRepository
+			}
+		}
+		result.Routes = append(result.Routes, item)
+	}
+
+	return result, nil
+}
+
+// allow checks the roles of the rule in order, args are the json arguments of the request,
+// ErrInput is returned if the argument of the rule is ambiguous or not a string
+func (s *AuthzRule) allow(account string, args map[string]interface{}, checker authzChecker) (bool, gtype.Error, error) {
+	if len(account) < 1 {
+		return false, nil, nil
+	}
+
+	for _, role := range s.Roles {
+		switch role {
+		case model.AuthRoleAdmin:
+			if checker.IsAdmin(account) {
+				return true, nil, nil
+			}
+		case model.AuthRoleAuthorization:
+			if len(s.Group) < 1 {
+				ok, err := checker.IsAuthorizationMember(account)
+				if err != nil {
+					return false, gtype.ErrInternal, err
+				}
+				if ok {
+					return true, nil, nil
+				}
+				continue
+			}
+			value, err := authzArgument(args, s.Group)
+			if err != nil {
+				return false, gtype.ErrInput, err
+			}
+			if len(value) < 1 {
+				// the handler reports the missing argument
+				continue
+			}
+			groupDn, err := checker.FromBase64(value)
+			if err != nil {
+				continue
+			}
+			ok, err := checker.CanManageGroup(account, groupDn)
+			if err != nil {
+				return false, gtype.ErrInternal, err
+			}
+			if ok {
+				return true, nil, nil
+			}
+		case model.AuthRoleSelf:
+			value, err := authzArgument(args, s.Account)
+			if err != nil {
+				return false, gtype.ErrInput, err
+			}
+			if len(value) < 1 {
+				if s.AccountDefaultSelf {
+					return true, nil, nil
+				}
+				continue
+			}
+			if strings.ToLower(value) == strings.ToLower(account) {
+				return true, nil, nil
+			}
+		case model.AuthRoleRepository:
+			value, err := authzArgument(args, s.Repository)
+			if err != nil {
+				return false, gtype.ErrInput, err
+			}
+			if len(value) < 1 {
+				continue
+			}
+			ok, err := checker.IsSvnManager(account, value)
+			if err != nil {
+				return false, gtype.ErrInternal, err
+			}
+			if ok {
+				return true, nil, nil
+			}
+		}
+	}
+
+	return false, nil, nil
+}
+
+func (s *AuthzRule) roleNames() string {
+	names := make([]string, 0, len(s.Roles))
+	for _, role := range s.Roles {
+		switch role {
+		case model.AuthRoleAdmin:
+			names = append(names, "管理员")
+		case model.AuthRoleAuthorization:
+			if len(s.Group) > 0 {
+				names = append(names, "该组的授权管理员")
+			} else {
+				names = append(names, "资源授权管理员")
+			}
+		case model.AuthRoleSelf:
+			names = append(names, "本人")
+		case model.AuthRoleRepository:
+			names = append(names, "该存储库的授权管理员")
+		default:
+			names = append(names, role)
+		}
+	}
+
+	return strings.Join(names, ", ")
+}
+
+// authzArgument returns the string argument of the name, the name is matched case-insensitively
+// as the handlers decode the json into their models, so that the argument can not be hidden by another case;
+// an error is returned if more than one argument matches or the argument is not a string
+func authzArgument(args map[string]interface{}, name string) (string, error) {
+	if len(name) < 1 || args == nil {
+		return "", nil
+	}
+
+	var value interface{}
+	count := 0
+	for k, v := range args {
+		if strings.EqualFold(k, name) {
+			value = v
+			count++
+		}
+	}
+	if count > 1 {
+		return "", fmt.Errorf("参数(%s)重复", name)
+	}
+	if value == nil {
+		return "", nil
+	}
+	text, ok := value.(string)
+	if !ok {
+		return "", fmt.Errorf("参数(%s)不是字符串", name)
+	}
+
+	return strings.TrimSpace(text), nil
+}
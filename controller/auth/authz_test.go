@@ -0,0 +1,249 @@
+package auth
+
+import (
+	"encoding/base64"
+	"github.com/csby/goa/data/model"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"path"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+type testAuthzChecker struct {
+	admins         map[string]bool
+	authorizations map[string]bool
+	managers       map[string]string // key: group dn, value: account
+	repositories   map[string]string // key: svn repository, value: account
+}
+
+func (s *testAuthzChecker) IsAdmin(account string) bool {
+	return s.admins[strings.ToLower(account)]
+}
+
+func (s *testAuthzChecker) IsAuthorizationMember(account string) (bool, error) {
+	return s.authorizations[strings.ToLower(account)], nil
+}
+
+func (s *testAuthzChecker) CanManageGroup(account, groupDn string) (bool, error) {
+	return s.IsAdmin(account) || strings.EqualFold(s.managers[groupDn], account), nil
+}
+
+func (s *testAuthzChecker) IsSvnManager(account, repository string) (bool, error) {
+	return strings.EqualFold(s.repositories[repository], account), nil
+}
+
+func (s *testAuthzChecker) FromBase64(v string) (string, error) {
+	data, err := base64.URLEncoding.DecodeString(v)
+	return string(data), err
+}
+
+func newTestAuthzChecker() *testAuthzChecker {
+	return &testAuthzChecker{
+		admins:         map[string]bool{"admin": true},
+		authorizations: map[string]bool{"lisi": true},
+		managers:       map[string]string{"CN=Share.Read.Docs,OU=Docs,DC=example,DC=com": "lisi"},
+		repositories:   map[string]string{"docs": "wangwu"},
+	}
+}
+
+func TestAuthzRule_Allow(t *testing.T) {
+	checker := newTestAuthzChecker()
+	groupDn := base64.URLEncoding.EncodeToString([]byte("CN=Share.Read.Docs,OU=Docs,DC=example,DC=com"))
+	otherDn := base64.URLEncoding.EncodeToString([]byte("CN=Share.Read.Other,OU=Other,DC=example,DC=com"))
+
+	admin := &AuthzRule{Roles: []string{model.AuthRoleAdmin}}
+	self := &AuthzRule{Roles: []string{model.AuthRoleAdmin, model.AuthRoleSelf}, Account: "account"}
+	selfDefault := &AuthzRule{Roles: []string{model.AuthRoleAdmin, model.AuthRoleSelf}, Account: "account", AccountDefaultSelf: true}
+	repository := &AuthzRule{Roles: []string{model.AuthRoleAdmin, model.AuthRoleRepository}, Repository: "repository"}
+	group := &AuthzRule{Roles: []string{model.AuthRoleAdmin, model.AuthRoleAuthorization}, Group: "groupDn"}
+	member := &AuthzRule{Roles: []string{model.AuthRoleAuthorization}}
+
+	cases := []struct {
+		rule    *AuthzRule
+		account string
+		args    map[string]interface{}
+		allowed bool
+	}{
+		{admin, "ADMIN", nil, true},
+		{admin, "zhangsan", nil, false},
+		{admin, "", nil, false},
+		{self, "zhangsan", map[string]interface{}{}, false},
+		{self, "zhangsan", map[string]interface{}{"account": " "}, false},
+		{self, "zhangsan", map[string]interface{}{"account": "ZhangSan"}, true},
+		{self, "zhangsan", map[string]interface{}{"account": "lisi"}, false},
+		{self, "zhangsan", map[string]interface{}{"Account": "lisi"}, false},
+		{self, "zhangsan", map[string]interface{}{"ACCOUNT": "zhangsan"}, true},
+		{self, "admin", map[string]interface{}{"account": "lisi"}, true},
+		{selfDefault, "zhangsan", map[string]interface{}{}, true},
+		{selfDefault, "zhangsan", map[string]interface{}{"account": nil}, true},
+		{selfDefault, "zhangsan", map[string]interface{}{"Account": "lisi"}, false},
+		{repository, "wangwu", map[string]interface{}{"repository": "docs"}, true},
+		{repository, "wangwu", map[string]interface{}{"Repository": "other"}, false},
+		{repository, "wangwu", map[string]interface{}{}, false},
+		{repository, "lisi", map[string]interface{}{"repository": "docs"}, false},
+		{repository, "admin", map[string]interface{}{"repository": "other"}, true},
+		{group, "lisi", map[string]interface{}{"groupDn": groupDn}, true},
+		{group, "lisi", map[string]interface{}{"groupDn": otherDn}, false},
+		{group, "lisi", map[string]interface{}{}, false},
+		{group, "zhangsan", map[string]interface{}{"groupDn": groupDn}, false},
+		{group, "admin", map[string]interface{}{"groupDn": otherDn}, true},
+		{member, "lisi", nil, true},
+		{member, "zhangsan", nil, false},
+	}
+	for i, c := range cases {
+		allowed, be, err := c.rule.allow(c.account, c.args, checker)
+		if be != nil {
+			t.Fatalf("case %d: %v", i, err)
+		}
+		if allowed != c.allowed {
+			t.Errorf("case %d: expected %v, got %v", i, c.allowed, allowed)
+		}
+	}
+}
+
+func TestAuthzRule_AllowAmbiguous(t *testing.T) {
+	checker := newTestAuthzChecker()
+	self := &AuthzRule{Roles: []string{model.AuthRoleSelf}, Account: "account"}
+
+	cases := []map[string]interface{}{
+		{"account": "zhangsan", "Account": "lisi"},
+		{"account": "zhangsan", "ACCOUNT": "zhangsan"},
+		{"account": 1},
+		{"account": []interface{}{"zhangsan"}},
+	}
+	for i, args := range cases {
+		allowed, be, _ := self.allow("zhangsan", args, checker)
+		if be == nil || allowed {
+			t.Errorf("case %d: the request should be refused as invalid input", i)
+		}
+	}
+}
+
+func TestAuthz_Capabilities(t *testing.T) {
+	s := NewAuthz(nil, nil)
+	s.Authorize(nil, nil, []*AuthzRule{
+		{Uri: "/ad/user/account/password/reset", Roles: []string{model.AuthRoleAdmin}},
+		{Uri: "/ad/user/vpn/enable/get", Roles: []string{model.AuthRoleAdmin, model.AuthRoleSelf}, Account: "account"},
+		{Uri: "/ad/group/member/add", Roles: []string{model.AuthRoleAdmin, model.AuthRoleAuthorization}, Group: "groupDn"},
+		{Uri: "/svn/permission/item/list", Roles: []string{model.AuthRoleAuthorization}},
+		{Uri: "/svn/permission/item/add", Roles: []string{model.AuthRoleAdmin, model.AuthRoleRepository}, Repository: "repository"},
+		{Uri: "/empty"},
+	})
+	checker := newTestAuthzChecker()
+
+	expects := map[string][]string{
+		"admin":    {"true:", "true:", "true:", "false:", "true:"},
+		"lisi":     {"false:", "true:account", "true:group", "true:", "true:repository"},
+		"zhangsan": {"false:", "true:account", "false:", "false:", "true:repository"},
+	}
+	for account, expect := range expects {
+		result, err := s.capabilities(account, checker)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(result.Routes) != len(expect) {
+			t.Fatalf("%s: expected %d routes, got %d", account, len(expect), len(result.Routes))
+		}
+		for i, route := range result.Routes {
+			actual := "false:"
+			if route.Allowed {
+				actual = "true:" + route.Condition
+			}
+			if actual != expect[i] {
+				t.Errorf("%s %s: expected %s, got %s", account, route.Uri, expect[i], actual)
+			}
+		}
+	}
+}
+
+// TestAuthz_MutatingRoutes fails if a route which changes data is registered in service/controller_app.go
+// without an authz rule, the routes open to all login users must be listed here with the reason
+func TestAuthz_MutatingRoutes(t *testing.T) {
+	open := map[string]string{
+		"/auth/ad/login":                   "登录",
+		"/auth/ad/logout":                  "注销本人凭证",
+		"/auth/ad/refresh":                 "刷新本人凭证",
+		"/auth/ad/totp/login":              "登录",
+		"/auth/ad/totp/enroll":             "本人两步验证",
+		"/auth/ad/totp/enable":             "本人两步验证",
+		"/auth/ad/totp/disable":            "本人两步验证",
+		"/auth/ad/totp/recovery/reset":     "本人两步验证",
+		"/auth/ad/session/revoke":          "注销本人会话",
+		"/auth/ad/impersonate/stop":        "结束本人的模拟登录",
+		"/auth/wechat/unbind":              "解除本人微信绑定",
+		"/ad/user/account/password/change": "修改本人密码, 须验证原密码",
+		"/ad/access/request/add":           "本人申请权限",
+		"/ad/access/request/approve":       "处理函数检查审批人",
+		"/ad/access/request/reject":        "处理函数检查审批人",
+		"/ad/access/review/item/decide":    "处理函数检查审核人",
+	}
+	mutating := map[string]bool{
+		"add": true, "mod": true, "del": true, "delete": true, "create": true, "set": true, "remove": true,
+		"reset": true, "change": true, "start": true, "stop": true, "cancel": true, "complete": true,
+		"clear": true, "kill": true, "revoke": true, "enable": true, "disable": true, "enroll": true,
+		"approve": true, "reject": true, "decide": true, "unbind": true,
+		"login": true, "logout": true, "refresh": true,
+	}
+	readonly := map[string]bool{
+		"list": true, "get": true, "page": true, "tree": true, "detail": true, "diff": true, "timeline": true,
+		"stats": true, "status": true, "report": true, "export": true, "principal": true, "resource": true,
+		"captcha": true, "jwks": true, "url": true, "code": true, "qrcode": true, "socket": true,
+		"binding": true, "account": true, "notify": true,
+	}
+
+	file, err := parser.ParseFile(token.NewFileSet(), "../../service/controller_app.go", nil, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	routes := make([]string, 0)
+	rules := make(map[string]bool)
+	ast.Inspect(file, func(n ast.Node) bool {
+		switch v := n.(type) {
+		case *ast.CallExpr:
+			fun, ok := v.Fun.(*ast.SelectorExpr)
+			if !ok || fun.Sel.Name != "Uri" || len(v.Args) != 1 {
+				return true
+			}
+			if id, ok := fun.X.(*ast.Ident); !ok || id.Name != "path" {
+				return true
+			}
+			if lit, ok := v.Args[0].(*ast.BasicLit); ok {
+				uri, _ := strconv.Unquote(lit.Value)
+				routes = append(routes, uri)
+			}
+		case *ast.KeyValueExpr:
+			key, ok := v.Key.(*ast.Ident)
+			if !ok || key.Name != "Uri" {
+				return true
+			}
+			if lit, ok := v.Value.(*ast.BasicLit); ok {
+				uri, _ := strconv.Unquote(lit.Value)
+				rules[uri] = true
+			}
+		}
+		return true
+	})
+	if len(routes) < 1 || len(rules) < 1 {
+		t.Fatal("no route or rule found")
+	}
+
+	for _, uri := range routes {
+		verb := path.Base(uri)
+		if readonly[verb] {
+			continue
+		}
+		if !mutating[verb] {
+			t.Errorf("%s: unknown verb %s, add it to the mutating or readonly verbs", uri, verb)
+			continue
+		}
+		if rules[uri] {
+			continue
+		}
+		if _, ok := open[uri]; !ok {
+			t.Errorf("%s: no authz rule for the route which changes data", uri)
+		}
+	}
+}
@@ -9,6 +9,8 @@ const (
 	authCatalogRoot   = "授权服务"
 	authCatalogAd     = "域控"
 	authCatalogWechat = "微信"
+	authCatalogOidc   = "单点登录(OIDC)"
+	authCatalogSaml   = "单点登录(SAML)"
 )
 
 type base struct {
@@ -0,0 +1,219 @@
+package auth
+
+import "html/template"
+
+var loginTemplate = template.Must(template.New("login").Parse(htmlLogin))
+
+type loginPage struct {
+	ClientName string
+	RequestID  string
+	Error      string
+}
+
+// htmlLogin is the login page of the sign-on protocols (OIDC, SAML), the password is encrypted with the RSA public key
+// returned by the captcha api (PKCS#1 v1.5, the same as the staff site) before it is posted to the login api;
+// the login result is one of: redirectUri - redirect to; form - post the fields to the action; totpTicket - ask for the code
+const htmlLogin = `<!DOCTYPE html>
+<html lang="zh-CN">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width,initial-scale=1">
+<title>统一登录</title>
+<style>
+body{margin:0;font-family:"Microsoft YaHei",Arial,sans-serif;background:#f0f2f5;color:#333}
+.box{width:320px;margin:12vh auto 0;padding:28px 32px;background:#fff;border-radius:6px;box-shadow:0 2px 12px rgba(0,0,0,.1)}
+h1{margin:0 0 6px;font-size:20px;text-align:center}
+.client{margin-bottom:20px;font-size:13px;color:#888;text-align:center}
+input{box-sizing:border-box;width:100%;height:36px;margin-bottom:14px;padding:0 10px;border:1px solid #dcdfe6;border-radius:4px;font-size:14px}
+.captcha,.totp{display:none}
+.captcha input{width:180px;vertical-align:top}
+.captcha img{width:100px;height:36px;margin-left:8px;cursor:pointer}
+button{width:100%;height:38px;border:0;border-radius:4px;background:#409eff;color:#fff;font-size:15px;cursor:pointer}
+button:disabled{background:#a0cfff}
+.error{min-height:20px;margin-top:10px;font-size:13px;color:#f56c6c;text-align:center}
+</style>
+</head>
+<body>
+<div class="box">
+<h1>统一登录</h1>
+{{if .Error}}
+<div class="error">{{.Error}}</div>
+{{else}}
+<div class="client">登录后将返回 {{.ClientName}}</div>
+<form id="form" autocomplete="off">
+<input id="account" placeholder="帐号" autofocus>
+<input id="password" type="password" placeholder="密码">
+<div id="captcha" class="captcha"><input id="captchaValue" placeholder="验证码"><img id="captchaImage" alt="验证码" title="看不清, 换一张"></div>
+<button id="submit" type="submit">登录</button>
+</form>
+<form id="totp" class="totp" autocomplete="off">
+<input id="code" placeholder="验证码(或恢复码)" inputmode="numeric">
+<button id="verify" type="submit">验证</button>
+</form>
+<div id="error" class="error"></div>
+<script>
+(function () {
+  var requestId = {{.RequestID}};
+  var captcha = null;
+  var ticket = "";
+
+  function $(id) { return document.getElementById(id); }
+
+  function post(uri, data) {
+    return fetch(uri, {method: "POST", headers: {"Content-Type": "application/json"}, body: JSON.stringify(data)})
+      .then(function (r) { return r.json(); });
+  }
+
+  function showError(result) {
+    var e = result.error || {};
+    $("error").textContent = e.detail ? e.summary + ": " + e.detail : (e.summary || "登录失败");
+  }
+
+  function loadCaptcha() {
+    return post("captcha", {mode: 3, length: 4, width: 100, height: 30}).then(function (result) {
+      if (result.code !== 0) { showError(result); return; }
+      captcha = result.data;
+      $("captchaImage").src = captcha.value;
+      $("captchaValue").value = "";
+      $("captcha").style.display = captcha.required ? "block" : "none";
+    });
+  }
+
+  function readDer(buf, pos) {
+    var tag = buf[pos++], len = buf[pos++];
+    if (len & 0x80) {
+      var n = len & 0x7f;
+      for (len = 0; n > 0; n--) { len = len * 256 + buf[pos++]; }
+    }
+    return {tag: tag, start: pos, end: pos + len};
+  }
+
+  function toBigInt(bytes) {
+    var v = BigInt(0);
+    for (var i = 0; i < bytes.length; i++) { v = (v << BigInt(8)) | BigInt(bytes[i]); }
+    return v;
+  }
+
+  function modPow(b, e, m) {
+    var r = BigInt(1);
+    for (b = b % m; e > BigInt(0); e = e >> BigInt(1)) {
+      if (e & BigInt(1)) { r = r * b % m; }
+      b = b * b % m;
+    }
+    return r;
+  }
+
+  function encrypt(pem, text) {
+    var raw = atob(pem.replace(/-----[^-]+-----/g, "").replace(/\s+/g, ""));
+    var der = new Uint8Array(raw.length);
+    for (var i = 0; i < raw.length; i++) { der[i] = raw.charCodeAt(i); }
+    var seq = readDer(der, 0), item = readDer(der, seq.start);
+    if (item.tag === 0x30) {
+      var bits = readDer(der, item.end);
+      seq = readDer(der, bits.start + 1);
+      item = readDer(der, seq.start);
+    }
+    var exp = readDer(der, item.end);
+    var n = toBigInt(der.subarray(item.start, item.end)), e = toBigInt(der.subarray(exp.start, exp.end));
+    var k = (n.toString(16).length + 1) >> 1;
+    var msg = new TextEncoder().encode(text);
+    if (msg.length > k - 11) { throw new Error("密码过长"); }
+    var em = new Uint8Array(k);
+    em[1] = 2;
+    var ps = em.subarray(2, k - msg.length - 1);
+    crypto.getRandomValues(ps);
+    for (i = 0; i < ps.length; i++) {
+      while (ps[i] === 0) { ps[i] = crypto.getRandomValues(new Uint8Array(1))[0]; }
+    }
+    em.set(msg, k - msg.length);
+    var hex = modPow(toBigInt(em), e, n).toString(16);
+    while (hex.length < k * 2) { hex = "0" + hex; }
+    var out = "";
+    for (i = 0; i < hex.length; i += 2) { out += String.fromCharCode(parseInt(hex.substr(i, 2), 16)); }
+    return btoa(out);
+  }
+
+  function finish(data) {
+    if (data.totpTicket) {
+      ticket = data.totpTicket;
+      $("form").style.display = "none";
+      $("totp").style.display = "block";
+      $("code").focus();
+      return;
+    }
+    if (data.form) {
+      var form = document.createElement("form");
+      form.method = "POST";
+      form.action = data.form.action;
+      for (var name in data.form.fields) {
+        var input = document.createElement("input");
+        input.type = "hidden";
+        input.name = name;
+        input.value = data.form.fields[name];
+        form.appendChild(input);
+      }
+      document.body.appendChild(form);
+      form.submit();
+      return;
+    }
+    window.location.replace(data.redirectUri);
+  }
+
+  $("captchaImage").onclick = loadCaptcha;
+  $("form").onsubmit = function (ev) {
+    ev.preventDefault();
+    $("error").textContent = "";
+    if (!captcha) { loadCaptcha(); return; }
+    var data = {
+      requestId: requestId,
+      account: $("account").value,
+      captchaId: captcha.id,
+      captchaValue: $("captchaValue").value,
+      encryption: "rsa"
+    };
+    try {
+      data.password = encrypt(captcha.rsaPublicKey, $("password").value);
+    } catch (e) {
+      $("error").textContent = e.message;
+      return;
+    }
+    $("submit").disabled = true;
+    post("login", data).then(function (result) {
+      if (result.code === 0) {
+        finish(result.data);
+        $("submit").disabled = false;
+        return;
+      }
+      $("submit").disabled = false;
+      showError(result);
+      loadCaptcha();
+    }).catch(function (e) {
+      $("submit").disabled = false;
+      $("error").textContent = e.message;
+    });
+  };
+  $("totp").onsubmit = function (ev) {
+    ev.preventDefault();
+    $("error").textContent = "";
+    $("verify").disabled = true;
+    post("totp", {requestId: requestId, ticket: ticket, code: $("code").value}).then(function (result) {
+      $("verify").disabled = false;
+      if (result.code === 0) {
+        finish(result.data);
+        return;
+      }
+      showError(result);
+    }).catch(function (e) {
+      $("verify").disabled = false;
+      $("error").textContent = e.message;
+    });
+  };
+
+  loadCaptcha();
+})();
+</script>
+{{end}}
+</div>
+</body>
+</html>
+`
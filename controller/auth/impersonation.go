@@ -0,0 +1,348 @@
+package auth
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/csby/goa/controller"
+	"github.com/csby/goa/data/model"
+	"github.com/csby/goa/data/socket"
+	"github.com/csby/gwsf/gtype"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	authCatalogImpersonation = "代理登录"
+	authCatalogAudit         = "审计记录"
+)
+
+var (
+	// impersonationReadVerbs are the last segments of the routes which only read data,
+	// the impersonation token is read-only and can call these routes only
+	impersonationReadVerbs = map[string]bool{
+		"list": true, "get": true, "page": true, "tree": true, "detail": true, "diff": true, "timeline": true,
+		"status": true, "report": true, "export": true, "principal": true, "resource": true,
+		"account": true, "binding": true, "notify": true,
+	}
+	// impersonationRoutes are the routes which end the impersonation, they can be called with the impersonation token
+	impersonationRoutes = []string{"/auth/ad/impersonate/stop", "/auth/ad/logout"}
+)
+
+func (s *Ad) StartImpersonation(ctx gtype.Context, ps gtype.Params) {
+	token := s.GetToken(ctx.Token())
+	if token == nil {
+		ctx.Error(gtype.ErrTokenInvalid)
+		return
+	}
+	if controller.IsApiKey(ctx.Token()) || controller.ImpersonationOf(token) != nil {
+		ctx.Error(gtype.ErrNoPermission, "不能使用API密钥或代理登录凭证发起代理登录")
+		return
+	}
+	if !s.IsAdmin(token.UserAccount) {
+		ctx.Error(gtype.ErrNoPermission, "需要管理员权限才能代理登录")
+		return
+	}
+
+	argument := &model.AuthImpersonate{}
+	err := ctx.GetJson(argument)
+	if err != nil {
+		ctx.Error(gtype.ErrInput, err)
+		return
+	}
+	argument.Account = strings.TrimSpace(argument.Account)
+	if len(argument.Account) < 1 {
+		ctx.Error(gtype.ErrInput, "用户帐号(account)为空")
+		return
+	}
+	argument.Reason = strings.TrimSpace(argument.Reason)
+	if len(argument.Reason) < 1 {
+		ctx.Error(gtype.ErrInput, "原因(reason)为空")
+		return
+	}
+	if strings.ToLower(argument.Account) == strings.ToLower(token.UserAccount) {
+		ctx.Error(gtype.ErrInput, "不能代理本人登录")
+		return
+	}
+
+	ad := s.Ad()
+	user, err := ad.GetUser(argument.Account)
+	if err != nil {
+		if ad.IsNotExit(err) {
+			ctx.Error(gtype.ErrInput, fmt.Sprintf("用户(%s)不存在", argument.Account))
+		} else {
+			ctx.Error(gtype.ErrInternal, err)
+		}
+		return
+	}
+	if s.IsAdmin(user.Account) {
+		ctx.Error(gtype.ErrNoPermission, fmt.Sprintf("不能代理管理员(%s)登录", user.Account))
+		return
+	}
+
+	now := time.Now()
+	impersonation := &controller.Impersonation{
+		Admin:      token.UserAccount,
+		AdminName:  token.UserName,
+		Reason:     argument.Reason,
+		ExpireTime: now.Add(s.impersonationExpiration()),
+	}
+	impersonation.AdEntryUser = *user
+	impersonated := &gtype.Token{
+		ID:          gtype.NewGuid(),
+		UserAccount: user.Account,
+		UserName:    user.Name,
+		LoginIP:     ctx.RIP(),
+		LoginTime:   now,
+		ActiveTime:  now,
+		Usage:       0,
+		Ext:         impersonation,
+	}
+
+	result := &model.AuthImpersonation{
+		SessionID:    sessionId(impersonated.ID),
+		Impersonator: toImpersonator(impersonation),
+	}
+	result.Token = impersonated.ID
+	result.Account = impersonated.UserAccount
+	result.Name = impersonated.UserName
+	if s.Signer != nil {
+		// no refresh token is issued, the impersonation can not be extended
+		result.Token, err = s.signAccessToken(impersonated, now, impersonation.ExpireTime)
+		if err != nil {
+			ctx.Error(gtype.ErrInternal, err)
+			return
+		}
+		result.ExpiresIn = int64(impersonation.ExpireTime.Sub(now).Seconds())
+	}
+	s.Tdb.Set(impersonated.ID, impersonated)
+
+	s.LogInfo(fmt.Sprintf("%s impersonates %s from %s: %s", token.UserAccount, user.Account, ctx.RIP(), argument.Reason))
+	s.RecordAudit(&model.AuditEvent{
+		Action:    model.AuditActionImpersonateStart,
+		Account:   user.Account,
+		Operator:  token.UserAccount,
+		SessionID: result.SessionID,
+		IP:        ctx.RIP(),
+		Path:      ctx.Path(),
+		Reason:    argument.Reason,
+	})
+
+	ctx.Success(result)
+}
+
+func (s *Ad) StartImpersonationDoc(doc gtype.Doc, method string, uri gtype.Uri) {
+	catalog := s.createCatalog(doc, authCatalogAd, authCatalogImpersonation)
+	function := catalog.AddFunction(method, uri, "开始代理登录")
+	function.SetNote("管理员以指定用户的身份登录, 用于查看该用户所见的内容; 返回的凭证生效帐号为该用户, 原管理员保存在凭证中, " +
+		"有效期见配置(auth.impersonation.expiration), 到期后不能刷新或延长; " +
+		"该凭证为只读, 只能调用查询类接口(如list、get、detail等)及结束代理登录, 调用其他接口将返回无权限; " +
+		"使用该凭证的每次调用均记录到审计记录, 且响应头(Goa-Impersonator)为管理员帐号, 界面应显示代理登录提示")
+	function.SetRemark("需要管理员权限, 不能使用API密钥或代理登录凭证调用, 不能代理管理员登录")
+	function.SetInputJsonExample(&model.AuthImpersonate{
+		Account: "zhangsan",
+		Reason:  "工单#1024: 无法访问SVN",
+	})
+	result := &model.AuthImpersonation{
+		SessionID: "8d4f0c6b2e9a17355c0b7e1fa2d93c64",
+		Impersonator: &model.AuthImpersonator{
+			Account:    "admin",
+			Name:       "管理员",
+			Reason:     "工单#1024: 无法访问SVN",
+			ExpireTime: gtype.DateTime(time.Now().Add(30 * time.Minute)),
+		},
+	}
+	result.Token = "e3d9c1f0a8b74c2d9f6e5a4b3c2d1e0f"
+	result.Account = "zhangsan"
+	result.Name = "张三"
+	function.SetOutputDataExample(result)
+	function.AddOutputError(gtype.ErrInput)
+	function.AddOutputError(gtype.ErrTokenInvalid)
+	function.AddOutputError(gtype.ErrNoPermission)
+	function.AddOutputError(gtype.ErrInternal)
+}
+
+func (s *Ad) StopImpersonation(ctx gtype.Context, ps gtype.Params) {
+	token := s.GetToken(ctx.Token())
+	if token == nil {
+		ctx.Error(gtype.ErrTokenInvalid)
+		return
+	}
+	impersonation := controller.ImpersonationOf(token)
+	if impersonation == nil {
+		ctx.Error(gtype.ErrInput, "当前凭证不是代理登录凭证")
+		return
+	}
+
+	s.stopImpersonation(ctx, token, impersonation, "")
+
+	ctx.Success(nil)
+}
+
+func (s *Ad) StopImpersonationDoc(doc gtype.Doc, method string, uri gtype.Uri) {
+	catalog := s.createCatalog(doc, authCatalogAd, authCatalogImpersonation)
+	function := catalog.AddFunction(method, uri, "结束代理登录")
+	function.SetNote("使当前代理登录凭证失效, 并关闭其消息推送连接")
+	function.SetOutputDataExample(nil)
+	function.AddOutputError(gtype.ErrInput)
+	function.AddOutputError(gtype.ErrTokenInvalid)
+}
+
+func (s *Ad) GetAuditEvents(ctx gtype.Context, ps gtype.Params) {
+	token := s.GetToken(ctx.Token())
+	if token == nil {
+		ctx.Error(gtype.ErrTokenInvalid)
+		return
+	}
+	if s.Dbs == nil {
+		ctx.Error(gtype.ErrInternal, "本地存储不可用")
+		return
+	}
+	if !s.IsAdmin(token.UserAccount) {
+		ctx.Error(gtype.ErrNoPermission, "仅管理员可查看审计记录")
+		return
+	}
+
+	argument := &model.AuditEventFilter{}
+	ctx.GetJson(argument)
+	account := strings.ToLower(strings.TrimSpace(argument.Account))
+	operator := strings.ToLower(strings.TrimSpace(argument.Operator))
+
+	results := make(model.AuditEventCollection, 0)
+	err := s.Dbs.ForEach(controller.AuditBucket, func(key string, value []byte) error {
+		item := &model.AuditEvent{}
+		if json.Unmarshal(value, item) != nil {
+			return nil
+		}
+		if len(account) > 0 && strings.ToLower(item.Account) != account {
+			return nil
+		}
+		if len(operator) > 0 && strings.ToLower(item.Operator) != operator {
+			return nil
+		}
+		if len(argument.SessionID) > 0 && item.SessionID != argument.SessionID {
+			return nil
+		}
+		if argument.StartTime != nil && time.Time(item.Time).Before(time.Time(*argument.StartTime)) {
+			return nil
+		}
+		if argument.EndTime != nil && time.Time(item.Time).After(time.Time(*argument.EndTime)) {
+			return nil
+		}
+
+		results = append(results, item)
+		return nil
+	})
+	if err != nil {
+		ctx.Error(gtype.ErrInternal, err)
+		return
+	}
+
+	sort.Sort(results)
+	ctx.Success(results)
+}
+
+func (s *Ad) GetAuditEventsDoc(doc gtype.Doc, method string, uri gtype.Uri) {
+	catalog := s.createCatalog(doc, authCatalogAd, authCatalogAudit)
+	function := catalog.AddFunction(method, uri, "获取审计记录")
+	function.SetNote("获取代理登录的开始、结束及期间调用接口的记录, 按时间倒序排列")
+	function.SetRemark("需要管理员权限")
+	function.SetInputJsonExample(&model.AuditEventFilter{
+		Operator: "admin",
+	})
+	function.SetOutputDataExample([]*model.AuditEvent{
+		{
+			ID:        gtype.NewGuid(),
+			Action:    model.AuditActionImpersonateCall,
+			Account:   "zhangsan",
+			Operator:  "admin",
+			SessionID: "8d4f0c6b2e9a17355c0b7e1fa2d93c64",
+			IP:        "192.168.1.10",
+			Path:      "/staff.api/svn/permission/user/list",
+			Time:      gtype.DateTime(time.Now()),
+		},
+	})
+	function.AddOutputError(gtype.ErrTokenInvalid)
+	function.AddOutputError(gtype.ErrNoPermission)
+	function.AddOutputError(gtype.ErrInternal)
+}
+
+// checkImpersonation runs after the token is checked, the call made with the impersonation token is audited,
+// and the request is refused if the impersonation is expired or the route may change data
+func (s *Ad) checkImpersonation(ctx gtype.Context, token *gtype.Token) {
+	impersonation := controller.ImpersonationOf(token)
+	if impersonation == nil {
+		return
+	}
+	if impersonation.Expired(time.Now()) {
+		s.stopImpersonation(ctx, token, impersonation, "已过期")
+		ctx.Error(gtype.ErrTokenInvalid, "代理登录已过期")
+		ctx.SetHandled(true)
+		return
+	}
+
+	ctx.Response().Header().Set(controller.ImpersonatorHeader, impersonation.Admin)
+	s.RecordAudit(&model.AuditEvent{
+		Action:    model.AuditActionImpersonateCall,
+		Account:   token.UserAccount,
+		Operator:  impersonation.Admin,
+		SessionID: sessionId(token.ID),
+		IP:        ctx.RIP(),
+		Path:      ctx.Path(),
+	})
+
+	if !impersonationAllowed(ctx.Path()) {
+		ctx.Error(gtype.ErrNoPermission, "代理登录凭证为只读, 不能调用修改数据的接口")
+		ctx.SetHandled(true)
+		return
+	}
+}
+
+// impersonationAllowed returns true if the path (with the prefix) only reads data or ends the impersonation
+func impersonationAllowed(path string) bool {
+	path = strings.ToLower(strings.TrimSuffix(path, "/"))
+	for _, uri := range impersonationRoutes {
+		if strings.HasSuffix(path, uri) {
+			return true
+		}
+	}
+
+	return impersonationReadVerbs[path[strings.LastIndex(path, "/")+1:]]
+}
+
+func (s *Ad) stopImpersonation(ctx gtype.Context, token *gtype.Token, impersonation *controller.Impersonation, reason string) {
+	s.revokeSession(token, socket.WSUserLogout)
+
+	s.LogInfo(fmt.Sprintf("%s stops impersonating %s", impersonation.Admin, token.UserAccount))
+	s.RecordAudit(&model.AuditEvent{
+		Action:    model.AuditActionImpersonateStop,
+		Account:   token.UserAccount,
+		Operator:  impersonation.Admin,
+		SessionID: sessionId(token.ID),
+		IP:        ctx.RIP(),
+		Path:      ctx.Path(),
+		Reason:    reason,
+	})
+}
+
+func (s *Ad) impersonationExpiration() time.Duration {
+	minutes := int64(30)
+	if s.Cfg != nil && s.Cfg.Auth.Impersonation.Expiration > 0 {
+		minutes = s.Cfg.Auth.Impersonation.Expiration
+	}
+
+	return time.Duration(minutes) * time.Minute
+}
+
+func toImpersonator(impersonation *controller.Impersonation) *model.AuthImpersonator {
+	if impersonation == nil {
+		return nil
+	}
+
+	return &model.AuthImpersonator{
+		Account:    impersonation.Admin,
+		Name:       impersonation.AdminName,
+		Reason:     impersonation.Reason,
+		ExpireTime: gtype.DateTime(impersonation.ExpireTime),
+	}
+}
@@ -0,0 +1,26 @@
+package auth
+
+import "testing"
+
+func TestImpersonationAllowed(t *testing.T) {
+	cases := map[string]bool{
+		"/staff.api/svn/permission/user/list":        true,
+		"/staff.api/ad/user/vpn/enable/get":          true,
+		"/staff.api/ad/access/matrix/export":         true,
+		"/staff.api/auth/ad/impersonate/stop":        true,
+		"/staff.api/auth/ad/logout":                  true,
+		"/staff.api/ad/group/member/add":             false,
+		"/staff.api/ad/user/account/password/change": false,
+		"/staff.api/ad/access/request/add":           false,
+		"/staff.api/auth/ad/totp/disable":            false,
+		"/staff.api/auth/wechat/bind/qrcode":         false,
+		"/staff.api/auth/ad/impersonate/start":       false,
+		"/staff.api/svn/permission/item/del":         false,
+		"/staff.api/ad/user/unknown":                 false,
+	}
+	for path, expected := range cases {
+		if impersonationAllowed(path) != expected {
+			t.Errorf("%s: expected %v", path, expected)
+		}
+	}
+}
@@ -0,0 +1,280 @@
+package auth
+
+import (
+	"fmt"
+	"github.com/csby/goa/config"
+	"github.com/csby/goa/data/model"
+	"github.com/csby/gwsf/gtype"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	authCatalogLimit = "登录限制"
+)
+
+func (s *Ad) GetLimitKeys(ctx gtype.Context, ps gtype.Params) {
+	token := s.GetToken(ctx.Token())
+	if token == nil {
+		ctx.Error(gtype.ErrTokenInvalid)
+		return
+	}
+	if !s.IsAdmin(token.UserAccount) {
+		ctx.Error(gtype.ErrNoPermission, "需要管理员权限才能查看登录限制")
+		return
+	}
+
+	ctx.Success(s.limiter.list(time.Now()))
+}
+
+func (s *Ad) GetLimitKeysDoc(doc gtype.Doc, method string, uri gtype.Uri) {
+	catalog := s.createCatalog(doc, authCatalogAd, authCatalogLimit)
+	function := catalog.AddFunction(method, uri, "获取受限列表")
+	function.SetNote("获取窗口期内登录失败的IP地址及用户帐号, 包括已暂时锁定的")
+	function.SetRemark("需要管理员权限")
+	lockUntil := gtype.DateTime(time.Now().Add(15 * time.Minute))
+	function.SetOutputDataExample([]*model.AuthLimitKey{
+		{
+			Kind:      model.AuthLimitKindAccount,
+			Value:     "zhangsan",
+			Failures:  10,
+			LastTime:  gtype.DateTime(time.Now()),
+			LockUntil: &lockUntil,
+		},
+		{
+			Kind:     model.AuthLimitKindIP,
+			Value:    "192.168.1.100",
+			Failures: 3,
+			LastTime: gtype.DateTime(time.Now()),
+		},
+	})
+	function.AddOutputError(gtype.ErrTokenInvalid)
+	function.AddOutputError(gtype.ErrNoPermission)
+}
+
+func (s *Ad) ClearLimitKeys(ctx gtype.Context, ps gtype.Params) {
+	token := s.GetToken(ctx.Token())
+	if token == nil {
+		ctx.Error(gtype.ErrTokenInvalid)
+		return
+	}
+	if !s.IsAdmin(token.UserAccount) {
+		ctx.Error(gtype.ErrNoPermission, "需要管理员权限才能解除登录限制")
+		return
+	}
+
+	argument := &model.AuthLimitKeyFilter{}
+	err := ctx.GetJson(argument)
+	if err != nil {
+		ctx.Error(gtype.ErrInput, err)
+		return
+	}
+	argument.Value = strings.TrimSpace(argument.Value)
+	if len(argument.Kind) > 0 && argument.Kind != model.AuthLimitKindIP && argument.Kind != model.AuthLimitKindAccount {
+		ctx.Error(gtype.ErrInput, fmt.Sprintf("类型(kind=%s)无效", argument.Kind))
+		return
+	}
+	if len(argument.Kind) < 1 && len(argument.Value) > 0 {
+		ctx.Error(gtype.ErrInput, "指定IP地址或用户帐号时类型(kind)不能为空")
+		return
+	}
+
+	count := s.limiter.clear(argument.Kind, argument.Value)
+	s.LogInfo(fmt.Sprintf("login limit cleared by %s: kind=%s, value=%s, count=%d",
+		token.UserAccount, argument.Kind, argument.Value, count))
+
+	ctx.Success(count)
+}
+
+func (s *Ad) ClearLimitKeysDoc(doc gtype.Doc, method string, uri gtype.Uri) {
+	catalog := s.createCatalog(doc, authCatalogAd, authCatalogLimit)
+	function := catalog.AddFunction(method, uri, "解除限制")
+	function.SetNote("清除指定IP地址或用户帐号的登录失败记录并解除锁定, 返回清除的数量; 类型及值均为空时清除全部")
+	function.SetRemark("需要管理员权限")
+	function.SetInputJsonExample(&model.AuthLimitKeyFilter{
+		Kind:  model.AuthLimitKindAccount,
+		Value: "zhangsan",
+	})
+	function.SetOutputDataExample(1)
+	function.AddOutputError(gtype.ErrInput)
+	function.AddOutputError(gtype.ErrTokenInvalid)
+	function.AddOutputError(gtype.ErrNoPermission)
+}
+
+// loginLimiter counts the login failures in a sliding window by ip and by account,
+// so that guessing passwords of many accounts from one ip, or one account from many ips are both throttled
+type loginLimiter struct {
+	window   time.Duration
+	captcha  int
+	lockout  int
+	lockTime time.Duration
+
+	mutex sync.Mutex
+	items map[limiterKey]*limiterItem
+}
+
+type limiterKey struct {
+	kind  string
+	value string
+}
+
+type limiterItem struct {
+	failures  []time.Time
+	lockUntil time.Time
+}
+
+func newLoginLimiter(cfg config.AuthLimit) *loginLimiter {
+	instance := &loginLimiter{
+		window:   time.Duration(cfg.Window) * time.Minute,
+		captcha:  cfg.Captcha,
+		lockout:  cfg.Lockout,
+		lockTime: time.Duration(cfg.LockTime) * time.Minute,
+		items:    make(map[limiterKey]*limiterItem),
+	}
+	if instance.window <= 0 {
+		instance.window = 15 * time.Minute
+	}
+	if instance.captcha <= 0 {
+		instance.captcha = 3
+	}
+	if instance.lockTime <= 0 {
+		instance.lockTime = 15 * time.Minute
+	}
+
+	return instance
+}
+
+// fail records a failure of the ip and the account (if not empty)
+func (s *loginLimiter) fail(ip, account string, now time.Time) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.sweep(now)
+	for _, key := range s.keys(ip, account) {
+		item, ok := s.items[key]
+		if !ok {
+			item = &limiterItem{}
+			s.items[key] = item
+		}
+		item.failures = append(s.prune(item.failures, now), now)
+		if s.lockout > 0 && len(item.failures) >= s.lockout && !item.lockUntil.After(now) {
+			item.lockUntil = now.Add(s.lockTime)
+		}
+	}
+}
+
+// captchaRequired returns true if the failures of the ip reach the threshold
+func (s *loginLimiter) captchaRequired(ip string, now time.Time) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	item, ok := s.items[limiterKey{kind: model.AuthLimitKindIP, value: ip}]
+	if !ok {
+		return false
+	}
+
+	return len(s.prune(item.failures, now)) >= s.captcha
+}
+
+// locked returns the time until which the ip or the account is locked, the later one if both are locked
+func (s *loginLimiter) locked(ip, account string, now time.Time) (time.Time, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	until := time.Time{}
+	for _, key := range s.keys(ip, account) {
+		item, ok := s.items[key]
+		if ok && item.lockUntil.After(now) && item.lockUntil.After(until) {
+			until = item.lockUntil
+		}
+	}
+
+	return until, !until.IsZero()
+}
+
+// clear removes the failures of the kind and value, all of the kind if value is empty, or all if kind is empty
+func (s *loginLimiter) clear(kind, value string) int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	count := 0
+	value = strings.ToLower(value)
+	for key := range s.items {
+		if len(kind) > 0 && key.kind != kind {
+			continue
+		}
+		if len(value) > 0 && key.value != value {
+			continue
+		}
+		delete(s.items, key)
+		count++
+	}
+
+	return count
+}
+
+func (s *loginLimiter) list(now time.Time) []*model.AuthLimitKey {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.sweep(now)
+	results := make([]*model.AuthLimitKey, 0, len(s.items))
+	for key, item := range s.items {
+		result := &model.AuthLimitKey{
+			Kind:     key.kind,
+			Value:    key.value,
+			Failures: len(item.failures),
+		}
+		if len(item.failures) > 0 {
+			result.LastTime = gtype.DateTime(item.failures[len(item.failures)-1])
+		}
+		if item.lockUntil.After(now) {
+			lockUntil := gtype.DateTime(item.lockUntil)
+			result.LockUntil = &lockUntil
+		}
+		results = append(results, result)
+	}
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Kind != results[j].Kind {
+			return results[i].Kind < results[j].Kind
+		}
+		return results[i].Value < results[j].Value
+	})
+
+	return results
+}
+
+func (s *loginLimiter) keys(ip, account string) []limiterKey {
+	keys := make([]limiterKey, 0, 2)
+	if len(ip) > 0 {
+		keys = append(keys, limiterKey{kind: model.AuthLimitKindIP, value: ip})
+	}
+	if len(account) > 0 {
+		keys = append(keys, limiterKey{kind: model.AuthLimitKindAccount, value: strings.ToLower(account)})
+	}
+
+	return keys
+}
+
+// prune removes the failures out of the window, the mutex must be locked by the caller
+func (s *loginLimiter) prune(failures []time.Time, now time.Time) []time.Time {
+	start := now.Add(-s.window)
+	index := 0
+	for index < len(failures) && !failures[index].After(start) {
+		index++
+	}
+
+	return failures[index:]
+}
+
+// sweep removes the keys without failures in the window and not locked, the mutex must be locked by the caller
+func (s *loginLimiter) sweep(now time.Time) {
+	for key, item := range s.items {
+		item.failures = s.prune(item.failures, now)
+		if len(item.failures) < 1 && !item.lockUntil.After(now) {
+			delete(s.items, key)
+		}
+	}
+}
@@ -0,0 +1,172 @@
+package auth
+
+import (
+	"fmt"
+	"github.com/csby/goa/config"
+	"github.com/csby/goa/controller"
+	"github.com/csby/goa/data/model"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestLimiter() *loginLimiter {
+	return newLoginLimiter(config.AuthLimit{
+		Window:   15,
+		Captcha:  3,
+		Lockout:  5,
+		LockTime: 10,
+	})
+}
+
+func TestLoginLimiter_Captcha(t *testing.T) {
+	s := newTestLimiter()
+	now := time.Now()
+	ip := "192.168.1.100"
+
+	for i := 0; i < 2; i++ {
+		s.fail(ip, fmt.Sprintf("user%d", i), now)
+	}
+	if s.captchaRequired(ip, now) {
+		t.Fatal("captcha should not be required before the threshold")
+	}
+	s.fail(ip, "user2", now)
+	if !s.captchaRequired(ip, now) {
+		t.Fatal("captcha should be required after the threshold")
+	}
+	if s.captchaRequired("192.168.1.101", now) {
+		t.Fatal("captcha should not be required for the other ip")
+	}
+
+	// the failures slide out of the window
+	if s.captchaRequired(ip, now.Add(15*time.Minute)) {
+		t.Fatal("captcha should not be required after the window")
+	}
+}
+
+func TestLoginLimiter_SlidingWindow(t *testing.T) {
+	s := newTestLimiter()
+	now := time.Now()
+	ip := "192.168.1.100"
+
+	s.fail(ip, "", now)
+	s.fail(ip, "", now.Add(10*time.Minute))
+	s.fail(ip, "", now.Add(12*time.Minute))
+	if !s.captchaRequired(ip, now.Add(12*time.Minute)) {
+		t.Fatal("captcha should be required with 3 failures in the window")
+	}
+	if s.captchaRequired(ip, now.Add(16*time.Minute)) {
+		t.Fatal("captcha should not be required after the first failure slides out")
+	}
+}
+
+func TestLoginLimiter_Lockout(t *testing.T) {
+	s := newTestLimiter()
+	now := time.Now()
+	ip := "192.168.1.100"
+	account := "zhangsan"
+
+	for i := 0; i < 4; i++ {
+		s.fail(ip, account, now)
+	}
+	if _, locked := s.locked(ip, account, now); locked {
+		t.Fatal("should not be locked before the threshold")
+	}
+	s.fail(ip, account, now)
+	until, locked := s.locked(ip, account, now)
+	if !locked {
+		t.Fatal("should be locked after the threshold")
+	}
+	if !until.Equal(now.Add(10 * time.Minute)) {
+		t.Errorf("lock until %v, expected %v", until, now.Add(10*time.Minute))
+	}
+	if _, locked := s.locked("", "ZhangSan", now); !locked {
+		t.Error("account should be locked case-insensitively")
+	}
+	if _, locked := s.locked(ip, account, now.Add(10*time.Minute)); locked {
+		t.Error("should be unlocked after the lock time")
+	}
+}
+
+func TestLoginLimiter_Spraying(t *testing.T) {
+	s := newTestLimiter()
+	now := time.Now()
+	account := "zhangsan"
+
+	// one account from many ips, each ip fails once only
+	for i := 0; i < 5; i++ {
+		s.fail(fmt.Sprintf("10.0.0.%d", i+1), account, now)
+	}
+	if _, locked := s.locked("10.0.0.100", account, now); !locked {
+		t.Fatal("account should be locked even if tried from a new ip")
+	}
+	if _, locked := s.locked("10.0.0.100", "lisi", now); locked {
+		t.Fatal("the other account from the new ip should not be locked")
+	}
+}
+
+func TestLoginLimiter_Clear(t *testing.T) {
+	s := newTestLimiter()
+	now := time.Now()
+	ip := "192.168.1.100"
+
+	for i := 0; i < 5; i++ {
+		s.fail(ip, "zhangsan", now)
+	}
+	s.fail("192.168.1.101", "lisi", now)
+
+	items := s.list(now)
+	if len(items) != 4 {
+		t.Fatalf("expected 4 keys, got %d", len(items))
+	}
+	if items[0].Kind != model.AuthLimitKindAccount || items[0].Value != "lisi" || items[0].LockUntil != nil {
+		t.Errorf("unexpected first key: %+v", items[0])
+	}
+	if items[1].Value != "zhangsan" || items[1].Failures != 5 || items[1].LockUntil == nil {
+		t.Errorf("unexpected second key: %+v", items[1])
+	}
+
+	if count := s.clear(model.AuthLimitKindAccount, "ZhangSan"); count != 1 {
+		t.Errorf("expected 1 key cleared, got %d", count)
+	}
+	if _, locked := s.locked("", "zhangsan", now); locked {
+		t.Error("account should be unlocked after clear")
+	}
+	if _, locked := s.locked(ip, "", now); !locked {
+		t.Error("ip should be still locked")
+	}
+
+	if count := s.clear(model.AuthLimitKindIP, ""); count != 2 {
+		t.Errorf("expected 2 keys cleared, got %d", count)
+	}
+	if count := s.clear("", ""); count != 1 {
+		t.Errorf("expected 1 key cleared, got %d", count)
+	}
+	if len(s.list(now)) != 0 {
+		t.Error("expected no keys")
+	}
+}
+
+func TestAd_VerifyPassword(t *testing.T) {
+	cfg := config.NewConfig()
+	cfg.Ad.Host = "127.0.0.1"
+	cfg.Ad.Port = 1
+	cfg.Auth.Limit.Lockout = 2
+	s := NewAd(nil, &controller.Parameter{Cfg: cfg})
+
+	for i := 0; i < 2; i++ {
+		_, err := s.VerifyPassword("10.8.0.100", "zhangsan", "password")
+		if err == nil {
+			t.Fatal("login should fail without the domain")
+		}
+	}
+
+	_, err := s.VerifyPassword("10.8.0.101", "zhangsan", "password")
+	if err == nil || !strings.Contains(err.Error(), "锁定") {
+		t.Errorf("account should be locked, got %v", err)
+	}
+	_, err = s.VerifyPassword("10.8.0.100", "lisi", "password")
+	if err == nil || !strings.Contains(err.Error(), "锁定") {
+		t.Errorf("ip should be locked, got %v", err)
+	}
+}
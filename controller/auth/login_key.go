@@ -0,0 +1,283 @@
+package auth
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"github.com/csby/goa/config"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const (
+	loginKeyMinBits = 2048
+)
+
+// loginKeyRing keeps the RSA keys used by the browser to encrypt the login password,
+// the keys are saved in the file with the private keys encrypted, so that they survive restarts;
+// after rotation the retired keys can still decrypt during the grace period
+type loginKeyRing struct {
+	file     string
+	aead     cipher.AEAD
+	bits     int
+	rotation time.Duration
+	grace    time.Duration
+
+	mutex   sync.RWMutex
+	current *loginKey
+	retired []*loginKey
+}
+
+type loginKey struct {
+	id          string
+	private     *rsa.PrivateKey
+	public      string // PEM
+	createTime  time.Time
+	retiredTime time.Time
+}
+
+type loginKeyFile struct {
+	Keys []*loginKeyEntry `json:"keys"`
+}
+
+type loginKeyEntry struct {
+	ID          string    `json:"id"`
+	CreateTime  time.Time `json:"createTime"`
+	RetiredTime time.Time `json:"retiredTime,omitempty"`
+	Private     []byte    `json:"private"` // nonce + AES-GCM sealed PKCS#1 DER, the id is the additional data
+}
+
+// newLoginKeyRing loads the keys from the file of the configure, a new key is created if the file not exists,
+// or the current key is shorter than the configured bits; the keys are kept in memory only if the file is empty
+func newLoginKeyRing(cfg config.AuthRsa, now time.Time) (*loginKeyRing, error) {
+	instance := &loginKeyRing{
+		file:     cfg.File,
+		bits:     cfg.Bits,
+		rotation: time.Duration(cfg.Rotation) * time.Hour,
+		grace:    time.Duration(cfg.Grace) * time.Minute,
+	}
+	if instance.bits < loginKeyMinBits {
+		instance.bits = loginKeyMinBits
+	}
+	if instance.grace < 0 {
+		instance.grace = 0
+	}
+
+	if len(instance.file) > 0 {
+		k, err := hex.DecodeString(cfg.Key)
+		if err != nil {
+			return nil, fmt.Errorf("invalid key: %v", err)
+		}
+		block, err := aes.NewCipher(k)
+		if err != nil {
+			return nil, err
+		}
+		instance.aead, err = cipher.NewGCM(block)
+		if err != nil {
+			return nil, err
+		}
+
+		err = instance.load(now)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if instance.current == nil || instance.current.private.N.BitLen() < instance.bits {
+		err := instance.rotate(now)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return instance, nil
+}
+
+// public returns the id and the public key (PEM) of the current key
+func (s *loginKeyRing) public() (string, string) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	return s.current.id, s.current.public
+}
+
+// decrypt decrypts the data (PKCS#1 v1.5) with the current key, and then the retired keys in the grace period
+func (s *loginKeyRing) decrypt(data []byte, now time.Time) ([]byte, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	plain, err := rsa.DecryptPKCS1v15(rand.Reader, s.current.private, data)
+	if err == nil {
+		return plain, nil
+	}
+	for _, key := range s.retired {
+		if !s.inGrace(key, now) {
+			continue
+		}
+		p, e := rsa.DecryptPKCS1v15(rand.Reader, key.private, data)
+		if e == nil {
+			return p, nil
+		}
+	}
+
+	return nil, err
+}
+
+// expired returns true if the current key should be rotated
+func (s *loginKeyRing) expired(now time.Time) bool {
+	if s.rotation <= 0 {
+		return false
+	}
+
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	return !now.Before(s.current.createTime.Add(s.rotation))
+}
+
+// rotate creates a new key as the current key, the old one is retired and can still decrypt in the grace period
+func (s *loginKeyRing) rotate(now time.Time) error {
+	private, err := rsa.GenerateKey(rand.Reader, s.bits)
+	if err != nil {
+		return err
+	}
+	key, err := newLoginKey(private, now)
+	if err != nil {
+		return err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	retired := make([]*loginKey, 0, len(s.retired)+1)
+	if s.current != nil {
+		s.current.retiredTime = now
+		retired = append(retired, s.current)
+	}
+	for _, item := range s.retired {
+		if s.inGrace(item, now) {
+			retired = append(retired, item)
+		}
+	}
+	s.current = key
+	s.retired = retired
+
+	return s.save()
+}
+
+func (s *loginKeyRing) inGrace(key *loginKey, now time.Time) bool {
+	return now.Before(key.retiredTime.Add(s.grace))
+}
+
+// load reads the keys from the file, the mutex is not required as it is called on creating only
+func (s *loginKeyRing) load(now time.Time) error {
+	data, err := os.ReadFile(s.file)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	content := &loginKeyFile{}
+	err = json.Unmarshal(data, content)
+	if err != nil {
+		return fmt.Errorf("invalid key file %s: %v", s.file, err)
+	}
+
+	for _, entry := range content.Keys {
+		if entry == nil {
+			continue
+		}
+		nonceSize := s.aead.NonceSize()
+		if len(entry.Private) < nonceSize {
+			return fmt.Errorf("invalid key (id=%s) in %s", entry.ID, s.file)
+		}
+		der, err := s.aead.Open(nil, entry.Private[:nonceSize], entry.Private[nonceSize:], []byte(entry.ID))
+		if err != nil {
+			return fmt.Errorf("decrypt key (id=%s) in %s fail: %v", entry.ID, s.file, err)
+		}
+		private, err := x509.ParsePKCS1PrivateKey(der)
+		if err != nil {
+			return err
+		}
+		key, err := newLoginKey(private, entry.CreateTime)
+		if err != nil {
+			return err
+		}
+		key.retiredTime = entry.RetiredTime
+
+		if key.retiredTime.IsZero() {
+			s.current = key
+		} else if s.inGrace(key, now) {
+			s.retired = append(s.retired, key)
+		}
+	}
+
+	return nil
+}
+
+// save writes the keys to the file, the mutex must be locked by the caller
+func (s *loginKeyRing) save() error {
+	if len(s.file) < 1 {
+		return nil
+	}
+
+	content := &loginKeyFile{
+		Keys: make([]*loginKeyEntry, 0, len(s.retired)+1),
+	}
+	keys := append([]*loginKey{s.current}, s.retired...)
+	for _, key := range keys {
+		nonce := make([]byte, s.aead.NonceSize())
+		_, err := rand.Read(nonce)
+		if err != nil {
+			return err
+		}
+		der := x509.MarshalPKCS1PrivateKey(key.private)
+		content.Keys = append(content.Keys, &loginKeyEntry{
+			ID:          key.id,
+			CreateTime:  key.createTime,
+			RetiredTime: key.retiredTime,
+			Private:     s.aead.Seal(nonce, nonce, der, []byte(key.id)),
+		})
+	}
+	data, err := json.MarshalIndent(content, "", "    ")
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(filepath.Dir(s.file), 0700)
+	if err != nil {
+		return err
+	}
+	temp := s.file + ".tmp"
+	err = os.WriteFile(temp, data, 0600)
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(temp, s.file)
+}
+
+func newLoginKey(private *rsa.PrivateKey, createTime time.Time) (*loginKey, error) {
+	der, err := x509.MarshalPKIXPublicKey(&private.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(der)
+
+	return &loginKey{
+		id:         hex.EncodeToString(sum[:8]),
+		private:    private,
+		public:     string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})),
+		createTime: createTime,
+	}, nil
+}
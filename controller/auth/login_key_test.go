@@ -0,0 +1,168 @@
+package auth
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"github.com/csby/goa/config"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestLoginKeyConfig(t *testing.T) config.AuthRsa {
+	return config.AuthRsa{
+		Bits:     2048,
+		File:     filepath.Join(t.TempDir(), "crt", "login.key"),
+		Key:      strings.Repeat("02", 32),
+		Rotation: 720,
+		Grace:    60,
+	}
+}
+
+func encryptTestLoginPassword(t *testing.T, public, password string) []byte {
+	block, _ := pem.Decode([]byte(public))
+	if block == nil || block.Type != "PUBLIC KEY" {
+		t.Fatal("invalid public key: ", public)
+	}
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := rsa.EncryptPKCS1v15(rand.Reader, key.(*rsa.PublicKey), []byte(password))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return data
+}
+
+func TestLoginKeyRing_Persistent(t *testing.T) {
+	cfg := newTestLoginKeyConfig(t)
+	now := time.Now()
+
+	s, err := newLoginKeyRing(cfg, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, public := s.public()
+	if s.current.private.N.BitLen() != 2048 {
+		t.Errorf("expected 2048 bits, got %d", s.current.private.N.BitLen())
+	}
+
+	data, err := os.ReadFile(cfg.File)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der := x509.MarshalPKCS1PrivateKey(s.current.private)
+	if bytes.Contains(data, []byte("PRIVATE KEY")) || bytes.Contains(data, der[len(der)-32:]) {
+		t.Error("private key should be encrypted in the file")
+	}
+
+	// restart
+	encrypted := encryptTestLoginPassword(t, public, "P@ssw0rd")
+	s, err = newLoginKeyRing(cfg, now.Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	reloadedId, _ := s.public()
+	if reloadedId != id {
+		t.Errorf("key id changed after reload: %s != %s", reloadedId, id)
+	}
+	plain, err := s.decrypt(encrypted, now.Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(plain) != "P@ssw0rd" {
+		t.Errorf("unexpected password: %s", plain)
+	}
+
+	cfg.Key = strings.Repeat("03", 32)
+	_, err = newLoginKeyRing(cfg, now)
+	if err == nil {
+		t.Error("load with the wrong key should fail")
+	}
+}
+
+func TestLoginKeyRing_Rotate(t *testing.T) {
+	cfg := newTestLoginKeyConfig(t)
+	now := time.Now()
+
+	s, err := newLoginKeyRing(cfg, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldId, oldPublic := s.public()
+	if s.expired(now.Add(719 * time.Hour)) {
+		t.Error("should not be expired before the rotation")
+	}
+	if !s.expired(now.Add(720 * time.Hour)) {
+		t.Error("should be expired after the rotation")
+	}
+
+	rotateTime := now.Add(720 * time.Hour)
+	err = s.rotate(rotateTime)
+	if err != nil {
+		t.Fatal(err)
+	}
+	newId, newPublic := s.public()
+	if newId == oldId {
+		t.Fatal("key id should be changed after rotation")
+	}
+
+	// both keys decrypt in the grace period, also after restart
+	s, err = newLoginKeyRing(cfg, rotateTime)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, public := range []string{oldPublic, newPublic} {
+		plain, err := s.decrypt(encryptTestLoginPassword(t, public, "P@ssw0rd"), rotateTime.Add(59*time.Minute))
+		if err != nil || string(plain) != "P@ssw0rd" {
+			t.Errorf("decrypt in the grace period fail: %v", err)
+		}
+	}
+
+	// the old key is refused after the grace period
+	_, err = s.decrypt(encryptTestLoginPassword(t, oldPublic, "P@ssw0rd"), rotateTime.Add(time.Hour))
+	if err == nil {
+		t.Error("old key should be refused after the grace period")
+	}
+	s, err = newLoginKeyRing(cfg, rotateTime.Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(s.retired) != 0 {
+		t.Errorf("expected no retired key after the grace period, got %d", len(s.retired))
+	}
+}
+
+func TestLoginKeyRing_Bits(t *testing.T) {
+	cfg := newTestLoginKeyConfig(t)
+	cfg.Bits = 1024
+	now := time.Now()
+
+	s, err := newLoginKeyRing(cfg, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.current.private.N.BitLen() < loginKeyMinBits {
+		t.Errorf("key should not be shorter than %d bits, got %d", loginKeyMinBits, s.current.private.N.BitLen())
+	}
+
+	// the existing shorter key is rotated on loading
+	cfg.Bits = 3072
+	s, err = newLoginKeyRing(cfg, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.current.private.N.BitLen() != 3072 {
+		t.Errorf("expected 3072 bits, got %d", s.current.private.N.BitLen())
+	}
+	if len(s.retired) != 1 {
+		t.Errorf("expected 1 retired key, got %d", len(s.retired))
+	}
+}
@@ -0,0 +1,836 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"github.com/csby/goa/assist"
+	"github.com/csby/goa/controller"
+	"github.com/csby/goa/data/model"
+	"github.com/csby/gwsf/gtype"
+	"github.com/golang-jwt/jwt/v5"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	oidcRequestExpiration = 10 * time.Minute
+	oidcBearerPrefix      = "bearer "
+)
+
+func NewOidc(log gtype.Log, param *controller.Parameter) *Oidc {
+	instance := &Oidc{}
+	instance.SetLog(log)
+	instance.SetParameter(param)
+
+	instance.requests = make(map[string]*oidcRequest)
+	instance.codes = make(map[string]*oidcCode)
+
+	if instance.Cfg != nil && instance.Cfg.Auth.Oidc.Enabled {
+		if len(instance.issuer()) < 1 {
+			// the issuer is not taken from the request, the Host header can be set by anyone
+			instance.LogError("oidc is disabled: issuer (auth.oidc.issuer) is empty")
+		} else {
+			signer, err := controller.LoadTokenSigner(instance.Cfg.Auth.Token.Key.File, instance.Cfg.Auth.Token.Key.ID, "")
+			if err != nil {
+				instance.LogError("oidc is disabled: load token signing key fail: ", err)
+			} else {
+				instance.signer = signer
+			}
+		}
+	}
+
+	return instance
+}
+
+// Oidc is the OpenID Connect provider, only the authorization code flow with PKCE is supported;
+// the user is authenticated with the captcha and RSA key of Authenticator
+type Oidc struct {
+	base
+
+	Authenticator *Ad
+
+	signer *controller.TokenSigner
+
+	mutex    sync.Mutex
+	requests map[string]*oidcRequest // key: request id
+	codes    map[string]*oidcCode    // key: authorization code
+}
+
+type oidcRequest struct {
+	clientId    string
+	clientName  string
+	redirectUri string
+	scope       string
+	state       string
+	nonce       string
+	challenge   string
+	expireTime  time.Time
+}
+
+// oidcError is an OAuth2 error (RFC 6749, 4.1.2.1 and 5.2), it is sent back to redirectUri if not empty,
+// otherwise it is shown to the user or written to the client with the status
+type oidcError struct {
+	status      int
+	code        string
+	description string
+	redirectUri string
+	state       string
+}
+
+func (s *oidcError) Error() string {
+	return fmt.Sprintf("%s: %s", s.code, s.description)
+}
+
+type oidcCode struct {
+	request    *oidcRequest
+	user       *assist.AdEntryUser
+	groups     []string
+	authTime   time.Time
+	expireTime time.Time
+}
+
+type oidcAccessClaims struct {
+	jwt.RegisteredClaims
+
+	ClientID string `json:"client_id"`
+	Scope    string `json:"scope,omitempty"`
+}
+
+type oidcIdClaims struct {
+	jwt.RegisteredClaims
+
+	AuthTime          int64    `json:"auth_time"`
+	Nonce             string   `json:"nonce,omitempty"`
+	Name              string   `json:"name,omitempty"`
+	PreferredUsername string   `json:"preferred_username"`
+	Email             string   `json:"email,omitempty"`
+	Groups            []string `json:"groups"`
+}
+
+func (s *Oidc) GetDiscovery(ctx gtype.Context, ps gtype.Params) {
+	if !s.enabled() {
+		s.writeError(ctx, http.StatusNotFound, "server_error", "未启用OpenID Connect单点登录")
+		return
+	}
+
+	issuer := s.issuer()
+	s.writeJson(ctx, http.StatusOK, &model.OidcDiscovery{
+		Issuer:                            issuer,
+		AuthorizationEndpoint:             issuer + "/oidc/authorize",
+		TokenEndpoint:                     issuer + "/oidc/token",
+		UserInfoEndpoint:                  issuer + "/oidc/userinfo",
+		JwksUri:                           issuer + "/oidc/jwks",
+		ResponseTypesSupported:            []string{"code"},
+		GrantTypesSupported:               []string{"authorization_code"},
+		SubjectTypesSupported:             []string{"public"},
+		IdTokenSigningAlgValuesSupported:  []string{jwt.SigningMethodRS256.Alg()},
+		ScopesSupported:                   []string{"openid", "profile", "email", "groups"},
+		TokenEndpointAuthMethodsSupported: []string{"client_secret_basic", "client_secret_post", "none"},
+		CodeChallengeMethodsSupported:     []string{"S256"},
+		ClaimsSupported:                   []string{"sub", "name", "preferred_username", "email", "groups", "nonce", "auth_time"},
+	})
+}
+
+func (s *Oidc) GetDiscoveryDoc(doc gtype.Doc, method string, uri gtype.Uri) {
+	catalog := s.createCatalog(doc, authCatalogOidc)
+	function := catalog.AddFunction(method, uri, "获取服务配置")
+	function.SetNote("OpenID Connect服务发现, 返回各端点地址及支持的功能; 返回结果不包含code及data外层")
+	function.SetRemark("该接口不需要凭证")
+	function.SetOutputExample(&model.OidcDiscovery{
+		Issuer:                 "https://oa.example.com/auth",
+		AuthorizationEndpoint:  "https://oa.example.com/auth/oidc/authorize",
+		TokenEndpoint:          "https://oa.example.com/auth/oidc/token",
+		UserInfoEndpoint:       "https://oa.example.com/auth/oidc/userinfo",
+		JwksUri:                "https://oa.example.com/auth/oidc/jwks",
+		ResponseTypesSupported: []string{"code"},
+	})
+}
+
+func (s *Oidc) Authorize(ctx gtype.Context, ps gtype.Params) {
+	if !s.enabled() {
+		s.writeLoginPage(ctx, http.StatusNotFound, &loginPage{Error: "未启用OpenID Connect单点登录"})
+		return
+	}
+
+	requestId, request, oe := s.authorize(ctx.Request().URL.Query(), time.Now())
+	if oe != nil {
+		if len(oe.redirectUri) > 0 {
+			s.redirectError(ctx, oe.redirectUri, oe.state, oe.code, oe.description)
+		} else {
+			s.writeLoginPage(ctx, oe.status, &loginPage{Error: oe.description})
+		}
+		return
+	}
+
+	clientName := request.clientName
+	if len(clientName) < 1 {
+		clientName = request.clientId
+	}
+	s.writeLoginPage(ctx, http.StatusOK, &loginPage{
+		ClientName: clientName,
+		RequestID:  requestId,
+	})
+}
+
+// authorize validates the authorization request and keeps it until the user logs in with the returned request id
+func (s *Oidc) authorize(query url.Values, now time.Time) (string, *oidcRequest, *oidcError) {
+	client := s.Cfg.Auth.Oidc.GetClient(query.Get("client_id"))
+	if client == nil {
+		return "", nil, &oidcError{status: http.StatusBadRequest, code: "invalid_request", description: fmt.Sprintf("客户端(%s)不存在", query.Get("client_id"))}
+	}
+	redirectUri := query.Get("redirect_uri")
+	if !client.HasRedirectUri(redirectUri) {
+		return "", nil, &oidcError{status: http.StatusBadRequest, code: "invalid_request", description: fmt.Sprintf("回调地址(%s)未登记", redirectUri)}
+	}
+
+	// the redirect uri is trusted from now on, so the following errors are sent back to the client
+	state := query.Get("state")
+	redirectError := func(code, description string) *oidcError {
+		return &oidcError{status: http.StatusFound, code: code, description: description, redirectUri: redirectUri, state: state}
+	}
+	if query.Get("response_type") != "code" {
+		return "", nil, redirectError("unsupported_response_type", "仅支持授权码模式(code)")
+	}
+	scope := query.Get("scope")
+	if !containsScope(scope, "openid") {
+		return "", nil, redirectError("invalid_scope", "授权范围须包含openid")
+	}
+	challenge := query.Get("code_challenge")
+	if len(challenge) < 1 {
+		return "", nil, redirectError("invalid_request", "缺少code_challenge, 须使用PKCE")
+	}
+	if query.Get("code_challenge_method") != "S256" {
+		return "", nil, redirectError("invalid_request", "code_challenge_method仅支持S256")
+	}
+
+	requestId, err := newOidcRandom()
+	if err != nil {
+		return "", nil, redirectError("server_error", err.Error())
+	}
+	request := &oidcRequest{
+		clientId:    client.ID,
+		clientName:  client.Name,
+		redirectUri: redirectUri,
+		scope:       scope,
+		state:       state,
+		nonce:       query.Get("nonce"),
+		challenge:   challenge,
+		expireTime:  now.Add(oidcRequestExpiration),
+	}
+	s.mutex.Lock()
+	s.purge(now)
+	s.requests[requestId] = request
+	s.mutex.Unlock()
+
+	return requestId, request, nil
+}
+
+func (s *Oidc) AuthorizeDoc(doc gtype.Doc, method string, uri gtype.Uri) {
+	catalog := s.createCatalog(doc, authCatalogOidc)
+	function := catalog.AddFunction(method, uri, "授权")
+	function.SetNote("授权端点, 客户端将用户重定向至此地址, 返回登录页面; 登录成功后携带授权码(code)及状态(state)重定向至回调地址")
+	function.SetRemark("该接口不需要凭证; 仅支持授权码模式, 且须使用PKCE(S256)")
+	function.AddInputQuery(true, "response_type", "响应类型", "code", "code")
+	function.AddInputQuery(true, "client_id", "客户端标识", "")
+	function.AddInputQuery(true, "redirect_uri", "回调地址, 须已登记", "")
+	function.AddInputQuery(true, "scope", "授权范围, 须包含openid", "openid profile email groups")
+	function.AddInputQuery(false, "state", "状态, 原样返回", "")
+	function.AddInputQuery(false, "nonce", "随机数, 写入身份凭证", "")
+	function.AddInputQuery(true, "code_challenge", "PKCE挑战码", "")
+	function.AddInputQuery(true, "code_challenge_method", "PKCE挑战码算法", "S256", "S256")
+	function.AddOutputHeader("Content-Type", "text/html; charset=utf-8")
+}
+
+func (s *Oidc) GetCaptcha(ctx gtype.Context, ps gtype.Params) {
+	if s.Authenticator == nil {
+		ctx.Error(gtype.ErrInternal, "authenticator is nil")
+		return
+	}
+
+	s.Authenticator.GetCaptcha(ctx, ps)
+}
+
+func (s *Oidc) GetCaptchaDoc(doc gtype.Doc, method string, uri gtype.Uri) {
+	catalog := s.createCatalog(doc, authCatalogOidc)
+	function := catalog.AddFunction(method, uri, "获取验证码")
+	function.SetNote("获取登录页面需要的验证码及密码加密公钥, 与域控登录共用")
+	function.SetRemark("该接口不需要凭证")
+	function.SetInputJsonExample(&gtype.CaptchaFilter{
+		Mode:   3,
+		Length: 4,
+		Width:  100,
+		Height: 30,
+	})
+	function.SetOutputDataExample(&model.AuthCaptcha{
+		Captcha: gtype.Captcha{
+			ID:           "GKSVhVMRAHsyVuXSrMYs",
+			Value:        "data:image/png;base64,iVBOR...",
+			RsaPublicKey: "-----BEGIN PUBLIC KEY-----...-----END PUBLIC KEY-----",
+			Required:     false,
+		},
+		RsaKeyID: "3f9a1c0d5e7b2468",
+	})
+	function.AddOutputError(gtype.ErrInput)
+	function.AddOutputError(gtype.ErrInternal)
+}
+
+func (s *Oidc) Login(ctx gtype.Context, ps gtype.Params) {
+	if !s.enabled() || s.Authenticator == nil {
+		ctx.Error(gtype.ErrInternal, "未启用OpenID Connect单点登录")
+		return
+	}
+
+	argument := &model.OidcLogin{}
+	err := ctx.GetJson(argument)
+	if err != nil {
+		ctx.Error(gtype.ErrInput, err)
+		return
+	}
+
+	now := time.Now()
+	if s.getRequest(argument.RequestID, now) == nil {
+		ctx.Error(gtype.ErrInput.SetDetail("授权请求已过期, 请返回应用重新登录"))
+		return
+	}
+
+	pwd, be, err := s.Authenticator.decodeLogin(ctx, &argument.LoginFilter)
+	if be != nil {
+		ctx.Error(be, err)
+		return
+	}
+	user, login, be, err := s.Authenticator.authenticateUser(ctx, argument.Account, pwd)
+	if be != nil {
+		ctx.Error(be, err)
+		s.Authenticator.increaseErrorCount(ctx.RIP(), argument.Account)
+		return
+	}
+	if login != nil {
+		if login.TotpEnroll {
+			ctx.Error(gtype.ErrNoPermission, "须先登录系统绑定验证器(两步验证)后才能单点登录")
+			return
+		}
+		ctx.Success(&model.OidcLoginResult{
+			TotpTicket: login.TotpTicket,
+		})
+		return
+	}
+
+	redirectUri, err := s.issueCode(argument.RequestID, user, now)
+	if err != nil {
+		ctx.Error(gtype.ErrInput, err)
+		return
+	}
+	s.Authenticator.clearErrorCount(argument.Account)
+
+	ctx.Success(&model.OidcLoginResult{
+		RedirectUri: redirectUri,
+	})
+}
+
+func (s *Oidc) TotpLogin(ctx gtype.Context, ps gtype.Params) {
+	if !s.enabled() || s.Authenticator == nil {
+		ctx.Error(gtype.ErrInternal, "未启用OpenID Connect单点登录")
+		return
+	}
+
+	argument := &model.OidcTotpLogin{}
+	err := ctx.GetJson(argument)
+	if err != nil {
+		ctx.Error(gtype.ErrInput, err)
+		return
+	}
+
+	now := time.Now()
+	if s.getRequest(argument.RequestID, now) == nil {
+		ctx.Error(gtype.ErrInput.SetDetail("授权请求已过期, 请返回应用重新登录"))
+		return
+	}
+
+	user, _, be, err := s.Authenticator.verifyTotpLogin(ctx, &argument.TotpLogin)
+	if be != nil {
+		ctx.Error(be, err)
+		return
+	}
+
+	redirectUri, err := s.issueCode(argument.RequestID, user, now)
+	if err != nil {
+		ctx.Error(gtype.ErrInput, err)
+		return
+	}
+	s.Authenticator.clearErrorCount(user.Account)
+
+	ctx.Success(&model.OidcLoginResult{
+		RedirectUri: redirectUri,
+	})
+}
+
+func (s *Oidc) TotpLoginDoc(doc gtype.Doc, method string, uri gtype.Uri) {
+	catalog := s.createCatalog(doc, authCatalogOidc)
+	function := catalog.AddFunction(method, uri, "验证登录")
+	function.SetNote("登录的第二步: 使用登录返回的票据(totpTicket)及验证码(或恢复码)完成登录, 返回携带授权码的回调地址, 由页面完成重定向")
+	function.SetRemark("该接口不需要凭证; 每个票据最多尝试5次")
+	argument := &model.OidcTotpLogin{
+		RequestID: "nTfj5ZbY3m3bJ2o8Bv9Jk7eWcXm1q0aS4rD6uF8hG2k",
+	}
+	argument.Ticket = "Q2xk0lR3m1vJt8nS5pZ6bY7cX9aW0eD4fG2hK1jL3k"
+	argument.Code = "287082"
+	function.SetInputJsonExample(argument)
+	function.SetOutputDataExample(&model.OidcLoginResult{
+		RedirectUri: "https://wiki.example.com/oidc/callback?code=Sp1a...&state=af0ifjsldkj",
+	})
+	function.AddOutputError(gtype.ErrInput)
+	function.AddOutputError(gtype.ErrInternal)
+	function.AddOutputError(gtype.ErrTokenInvalid)
+	function.AddOutputError(gtype.ErrLoginPasswordInvalid)
+}
+
+// getRequest returns the authorization request which is not expired, or nil if not found
+func (s *Oidc) getRequest(requestId string, now time.Time) *oidcRequest {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	request, ok := s.requests[requestId]
+	if !ok || !request.expireTime.After(now) {
+		return nil
+	}
+
+	return request
+}
+
+// issueCode consumes the authorization request after the user is authenticated,
+// and returns the redirect uri with the authorization code and the state
+func (s *Oidc) issueCode(requestId string, user *assist.AdEntryUser, now time.Time) (string, error) {
+	groups := make([]string, 0)
+	items, err := s.Ad().GetMemberGroups(user.DN, true)
+	if err != nil {
+		s.LogWarning(fmt.Sprintf("oidc: get groups of %s fail: ", user.Account), err)
+	}
+	for _, item := range items {
+		if item == nil {
+			continue
+		}
+		groups = append(groups, item.Account)
+	}
+
+	code, err := newOidcRandom()
+	if err != nil {
+		return "", err
+	}
+	s.mutex.Lock()
+	request, ok := s.requests[requestId]
+	if ok {
+		delete(s.requests, requestId)
+		ok = request.expireTime.After(now)
+	}
+	if ok {
+		s.codes[code] = &oidcCode{
+			request:    request,
+			user:       user,
+			groups:     groups,
+			authTime:   now,
+			expireTime: now.Add(s.expiration(s.Cfg.Auth.Token.Code.Expiration, 1)),
+		}
+	}
+	s.mutex.Unlock()
+	if !ok {
+		return "", fmt.Errorf("授权请求已使用或已过期, 请返回应用重新登录")
+	}
+
+	values := url.Values{}
+	values.Set("code", code)
+	if len(request.state) > 0 {
+		values.Set("state", request.state)
+	}
+
+	return appendQuery(request.redirectUri, values), nil
+}
+
+func (s *Oidc) LoginDoc(doc gtype.Doc, method string, uri gtype.Uri) {
+	catalog := s.createCatalog(doc, authCatalogOidc)
+	function := catalog.AddFunction(method, uri, "用户登录")
+	function.SetNote("登录页面提交帐号及密码, 与域控登录相同; 验证通过后返回携带授权码的回调地址, 由页面完成重定向; " +
+		"须两步验证时返回票据(totpTicket), 由页面继续提交验证码")
+	function.SetRemark("该接口不需要凭证; 连续3次错误将要求输入验证码; 强制两步验证但尚未绑定验证器的用户须先登录系统完成绑定")
+	function.SetInputJsonExample(&model.OidcLogin{
+		LoginFilter: gtype.LoginFilter{
+			Account:      "zhangsan",
+			Password:     "Mh0R...",
+			CaptchaId:    "r4kcmz2E12e0qJQOvqRB",
+			CaptchaValue: "1e35",
+			Encryption:   "rsa",
+		},
+		RequestID: "nTfj5ZbY3m3bJ2o8Bv9Jk7eWcXm1q0aS4rD6uF8hG2k",
+	})
+	function.SetOutputDataExample(&model.OidcLoginResult{
+		RedirectUri: "https://wiki.example.com/oidc/callback?code=Sp1a...&state=af0ifjsldkj",
+	})
+	function.AddOutputError(gtype.ErrInput)
+	function.AddOutputError(gtype.ErrInternal)
+	function.AddOutputError(gtype.ErrNoPermission)
+	function.AddOutputError(gtype.ErrLoginCaptchaInvalid)
+	function.AddOutputError(gtype.ErrLoginPasswordInvalid)
+	function.AddOutputError(gtype.ErrLoginAccountOrPasswordInvalid)
+}
+
+func (s *Oidc) Token(ctx gtype.Context, ps gtype.Params) {
+	if !s.enabled() {
+		s.writeError(ctx, http.StatusNotFound, "server_error", "未启用OpenID Connect单点登录")
+		return
+	}
+
+	r := ctx.Request()
+	err := r.ParseForm()
+	if err != nil {
+		s.writeError(ctx, http.StatusBadRequest, "invalid_request", err.Error())
+		return
+	}
+	if r.PostForm.Get("grant_type") != "authorization_code" {
+		s.writeError(ctx, http.StatusBadRequest, "unsupported_grant_type", "仅支持authorization_code")
+		return
+	}
+
+	clientId, clientSecret, ok := r.BasicAuth()
+	if ok {
+		clientId, _ = url.QueryUnescape(clientId)
+		clientSecret, _ = url.QueryUnescape(clientSecret)
+	} else {
+		clientId = r.PostForm.Get("client_id")
+		clientSecret = r.PostForm.Get("client_secret")
+	}
+
+	now := time.Now()
+	code, oe := s.exchangeCode(clientId, clientSecret, r.PostForm, now)
+	if oe != nil {
+		s.writeError(ctx, oe.status, oe.code, oe.description)
+		return
+	}
+
+	token, err := s.issueTokens(code, now)
+	if err != nil {
+		s.LogError("oidc: issue tokens fail: ", err)
+		s.writeError(ctx, http.StatusInternalServerError, "server_error", err.Error())
+		return
+	}
+
+	ctx.Response().Header().Set("Cache-Control", "no-store")
+	s.writeJson(ctx, http.StatusOK, token)
+}
+
+// exchangeCode authenticates the client and consumes the authorization code of the token request form
+func (s *Oidc) exchangeCode(clientId, clientSecret string, form url.Values, now time.Time) (*oidcCode, *oidcError) {
+	client := s.Cfg.Auth.Oidc.GetClient(clientId)
+	if client == nil {
+		return nil, &oidcError{status: http.StatusUnauthorized, code: "invalid_client", description: fmt.Sprintf("客户端(%s)不存在", clientId)}
+	}
+	if len(client.Secret) > 0 && subtle.ConstantTimeCompare([]byte(client.Secret), []byte(clientSecret)) != 1 {
+		return nil, &oidcError{status: http.StatusUnauthorized, code: "invalid_client", description: "客户端密钥错误"}
+	}
+
+	// the code is removed whether it is valid or not, so that it can not be tried twice
+	value := form.Get("code")
+	s.mutex.Lock()
+	code, ok := s.codes[value]
+	delete(s.codes, value)
+	s.mutex.Unlock()
+	invalidGrant := func(description string) *oidcError {
+		return &oidcError{status: http.StatusBadRequest, code: "invalid_grant", description: description}
+	}
+	if !ok || !code.expireTime.After(now) {
+		return nil, invalidGrant("授权码无效或已过期")
+	}
+	if code.request.clientId != client.ID {
+		return nil, invalidGrant("授权码不属于该客户端")
+	}
+	if code.request.redirectUri != form.Get("redirect_uri") {
+		return nil, invalidGrant("回调地址不匹配")
+	}
+	if !verifyCodeChallenge(code.request.challenge, form.Get("code_verifier")) {
+		return nil, invalidGrant("code_verifier验证失败")
+	}
+
+	return code, nil
+}
+
+func (s *Oidc) TokenDoc(doc gtype.Doc, method string, uri gtype.Uri) {
+	catalog := s.createCatalog(doc, authCatalogOidc)
+	function := catalog.AddFunction(method, uri, "获取凭证")
+	function.SetNote("使用授权码换取访问凭证及身份凭证(id_token), 身份凭证包含帐号(preferred_username)、姓名(name)、邮箱(email)及所属组(groups); " +
+		"客户端密钥可通过Basic认证或表单提交, 公开客户端无需密钥; 返回结果不包含code及data外层, 失败时返回OAuth2错误(error, error_description)")
+	function.SetRemark("该接口不需要凭证; 授权码只能使用一次")
+	function.AddInputForm(true, "grant_type", "授权类型", 0, "authorization_code")
+	function.AddInputForm(true, "code", "授权码", 0, "")
+	function.AddInputForm(true, "redirect_uri", "回调地址, 须与授权时一致", 0, "")
+	function.AddInputForm(true, "code_verifier", "PKCE验证码", 0, "")
+	function.AddInputForm(false, "client_id", "客户端标识, 未使用Basic认证时必填", 0, "")
+	function.AddInputForm(false, "client_secret", "客户端密钥, 未使用Basic认证时必填, 公开客户端不需要", 0, "")
+	function.SetOutputExample(&model.OidcToken{
+		AccessToken: "eyJhbGciOiJSUzI1NiIsImtpZCI6Ii4uLiJ9...",
+		TokenType:   "Bearer",
+		ExpiresIn:   600,
+		IdToken:     "eyJhbGciOiJSUzI1NiIsImtpZCI6Ii4uLiJ9...",
+		Scope:       "openid profile email groups",
+	})
+}
+
+func (s *Oidc) GetUserInfo(ctx gtype.Context, ps gtype.Params) {
+	if !s.enabled() {
+		s.writeError(ctx, http.StatusNotFound, "server_error", "未启用OpenID Connect单点登录")
+		return
+	}
+
+	value := ctx.Request().Header.Get("Authorization")
+	if len(value) <= len(oidcBearerPrefix) || strings.ToLower(value[:len(oidcBearerPrefix)]) != oidcBearerPrefix {
+		s.writeError(ctx, http.StatusUnauthorized, "invalid_token", "缺少访问凭证")
+		return
+	}
+	claims := &oidcAccessClaims{}
+	err := s.signer.Parse(strings.TrimSpace(value[len(oidcBearerPrefix):]), claims)
+	if err != nil || len(claims.ClientID) < 1 || claims.Issuer != s.issuer() {
+		s.writeError(ctx, http.StatusUnauthorized, "invalid_token", "访问凭证无效")
+		return
+	}
+
+	ad := s.Ad()
+	user, err := ad.GetUser(claims.Subject)
+	if err != nil {
+		s.writeError(ctx, http.StatusUnauthorized, "invalid_token", err.Error())
+		return
+	}
+	info := &model.OidcUserInfo{
+		Subject:           user.Account,
+		Name:              user.Name,
+		PreferredUsername: user.Account,
+		Email:             user.Mail,
+		Groups:            make([]string, 0),
+	}
+	groups, err := ad.GetMemberGroups(user.DN, true)
+	if err != nil {
+		s.LogWarning(fmt.Sprintf("oidc: get groups of %s fail: ", user.Account), err)
+	}
+	for _, group := range groups {
+		if group == nil {
+			continue
+		}
+		info.Groups = append(info.Groups, group.Account)
+	}
+
+	s.writeJson(ctx, http.StatusOK, info)
+}
+
+func (s *Oidc) GetUserInfoDoc(doc gtype.Doc, method string, uri gtype.Uri) {
+	catalog := s.createCatalog(doc, authCatalogOidc)
+	function := catalog.AddFunction(method, uri, "获取用户信息")
+	function.SetNote("使用访问凭证(Authorization: Bearer)获取当前用户信息, 所属组从域控实时读取; 返回结果不包含code及data外层")
+	function.AddInputHeader(true, "Authorization", "访问凭证", "Bearer eyJhbGciOiJSUzI1NiIsImtpZCI6Ii4uLiJ9...")
+	function.SetOutputExample(&model.OidcUserInfo{
+		Subject:           "zhangsan",
+		Name:              "张三",
+		PreferredUsername: "zhangsan",
+		Email:             "zhangsan@example.com",
+		Groups:            []string{"Domain Users", "研发部"},
+	})
+}
+
+func (s *Oidc) GetJwks(ctx gtype.Context, ps gtype.Params) {
+	if !s.enabled() {
+		s.writeError(ctx, http.StatusNotFound, "server_error", "未启用OpenID Connect单点登录")
+		return
+	}
+
+	ctx.Response().Header().Set("Cache-Control", "public, max-age=3600")
+	s.writeJson(ctx, http.StatusOK, s.signer.Jwks())
+}
+
+func (s *Oidc) GetJwksDoc(doc gtype.Doc, method string, uri gtype.Uri) {
+	catalog := s.createCatalog(doc, authCatalogOidc)
+	function := catalog.AddFunction(method, uri, "获取凭证公钥")
+	function.SetNote("以JWKS格式返回验证身份凭证及访问凭证签名(RS256)的公钥; 返回结果不包含code及data外层")
+	function.SetRemark("该接口不需要凭证")
+	function.SetOutputExample(&model.Jwks{
+		Keys: []*model.Jwk{
+			{
+				Kty: "RSA",
+				Use: "sig",
+				Alg: "RS256",
+				Kid: "3f2a9c1d5e7b8a60",
+				N:   "u1SU1LfVLPHCozMxH2Mo4lgOEePzNm0tRgeLezV6ffAt0gunVTLw7onLRnrq0_IzW7yWR7QkrmBL7jTKEn5u...",
+				E:   "AQAB",
+			},
+		},
+	})
+}
+
+func (s *Oidc) issueTokens(code *oidcCode, now time.Time) (*model.OidcToken, error) {
+	issuer := s.issuer()
+	expiration := s.expiration(s.Cfg.Auth.Token.Access.Expiration, 10)
+	audience := jwt.ClaimStrings{code.request.clientId}
+
+	accessId, err := newOidcRandom()
+	if err != nil {
+		return nil, err
+	}
+	access, err := s.signer.Sign(&oidcAccessClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        accessId,
+			Issuer:    issuer,
+			Subject:   code.user.Account,
+			Audience:  audience,
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(expiration)),
+		},
+		ClientID: code.request.clientId,
+		Scope:    code.request.scope,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	id, err := s.signer.Sign(&oidcIdClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    issuer,
+			Subject:   code.user.Account,
+			Audience:  audience,
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(expiration)),
+		},
+		AuthTime:          code.authTime.Unix(),
+		Nonce:             code.request.nonce,
+		Name:              code.user.Name,
+		PreferredUsername: code.user.Account,
+		Email:             code.user.Mail,
+		Groups:            code.groups,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &model.OidcToken{
+		AccessToken: access,
+		TokenType:   "Bearer",
+		ExpiresIn:   int64(expiration.Seconds()),
+		IdToken:     id,
+		Scope:       code.request.scope,
+	}, nil
+}
+
+func (s *Oidc) enabled() bool {
+	return s.Cfg != nil && s.Cfg.Auth.Oidc.Enabled && s.signer != nil
+}
+
+// issuer returns the configured issuer without the trailing slash, e.g. https://oa.example.com/auth
+func (s *Oidc) issuer() string {
+	if s.Cfg == nil {
+		return ""
+	}
+
+	return strings.TrimRight(s.Cfg.Auth.Oidc.Issuer, "/")
+}
+
+func (s *Oidc) expiration(minutes, defaultMinutes int64) time.Duration {
+	if minutes < 1 {
+		minutes = defaultMinutes
+	}
+
+	return time.Duration(minutes) * time.Minute
+}
+
+// purge removes the expired requests and codes, the mutex must be locked by the caller
+func (s *Oidc) purge(now time.Time) {
+	for k, v := range s.requests {
+		if !v.expireTime.After(now) {
+			delete(s.requests, k)
+		}
+	}
+	for k, v := range s.codes {
+		if !v.expireTime.After(now) {
+			delete(s.codes, k)
+		}
+	}
+}
+
+func (s *Oidc) redirectError(ctx gtype.Context, redirectUri, state, code, description string) {
+	values := url.Values{}
+	values.Set("error", code)
+	values.Set("error_description", description)
+	if len(state) > 0 {
+		values.Set("state", state)
+	}
+
+	http.Redirect(ctx.Response(), ctx.Request(), appendQuery(redirectUri, values), http.StatusFound)
+}
+
+func (s *Oidc) writeLoginPage(ctx gtype.Context, statusCode int, page *loginPage) {
+	w := ctx.Response()
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("X-Frame-Options", "DENY")
+	w.WriteHeader(statusCode)
+	err := loginTemplate.Execute(w, page)
+	if err != nil {
+		s.LogError("oidc: write login page fail: ", err)
+	}
+}
+
+func (s *Oidc) writeError(ctx gtype.Context, statusCode int, code, description string) {
+	s.writeJson(ctx, statusCode, &model.OidcError{
+		Error:            code,
+		ErrorDescription: description,
+	})
+}
+
+func (s *Oidc) writeJson(ctx gtype.Context, statusCode int, v interface{}) {
+	w := ctx.Response()
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	err := json.NewEncoder(w).Encode(v)
+	if err != nil {
+		s.LogError("oidc: write response fail: ", err)
+	}
+}
+
+// verifyCodeChallenge checks the PKCE code verifier against the S256 challenge (RFC 7636)
+func verifyCodeChallenge(challenge, verifier string) bool {
+	if len(verifier) < 43 || len(verifier) > 128 {
+		return false
+	}
+
+	sum := sha256.Sum256([]byte(verifier))
+	value := base64.RawURLEncoding.EncodeToString(sum[:])
+
+	return subtle.ConstantTimeCompare([]byte(value), []byte(challenge)) == 1
+}
+
+func containsScope(scope, value string) bool {
+	for _, item := range strings.Fields(scope) {
+		if item == value {
+			return true
+		}
+	}
+
+	return false
+}
+
+func appendQuery(uri string, values url.Values) string {
+	if strings.Contains(uri, "?") {
+		return uri + "&" + values.Encode()
+	}
+
+	return uri + "?" + values.Encode()
+}
+
+func newOidcRandom() (string, error) {
+	buf := make([]byte, 32)
+	_, err := rand.Read(buf)
+	if err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
@@ -0,0 +1,228 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"github.com/csby/goa/assist"
+	"github.com/csby/goa/config"
+	"github.com/csby/goa/controller"
+	"net/url"
+	"testing"
+	"time"
+)
+
+const (
+	testOidcRedirectUri = "https://wiki.example.com/cb"
+	testOidcVerifier    = "dBjftJeZ4CVP-mJ0cXsdUAMo6vzpjvNA6pZqqFPGU34"
+)
+
+func newTestOidc(t *testing.T) *Oidc {
+	cfg := config.NewConfig()
+	cfg.Ad.Host = "127.0.0.1"
+	cfg.Ad.Port = 1
+	cfg.Auth.Oidc.Enabled = true
+	cfg.Auth.Oidc.Issuer = "https://oa.example.com/auth/"
+	cfg.Auth.Oidc.Clients = []*config.AuthOidcClient{
+		{ID: "wiki", Secret: "wiki-secret", RedirectUris: []string{testOidcRedirectUri}},
+	}
+
+	s := &Oidc{}
+	s.SetParameter(&controller.Parameter{Cfg: cfg})
+	s.requests = make(map[string]*oidcRequest)
+	s.codes = make(map[string]*oidcCode)
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.signer = controller.NewTokenSigner(key, "", "")
+
+	return s
+}
+
+// testOidcCode runs the authorization request and the login, and returns the authorization code
+func testOidcCode(t *testing.T, s *Oidc) string {
+	sum := sha256.Sum256([]byte(testOidcVerifier))
+	query := url.Values{}
+	query.Set("response_type", "code")
+	query.Set("client_id", "wiki")
+	query.Set("redirect_uri", testOidcRedirectUri)
+	query.Set("scope", "openid profile")
+	query.Set("state", "af0ifjsldkj")
+	query.Set("nonce", "n-0S6_WzA2Mj")
+	query.Set("code_challenge", base64.RawURLEncoding.EncodeToString(sum[:]))
+	query.Set("code_challenge_method", "S256")
+
+	now := time.Now()
+	requestId, _, oe := s.authorize(query, now)
+	if oe != nil {
+		t.Fatal(oe)
+	}
+	user := &assist.AdEntryUser{Account: "zhangsan"}
+	redirectUri, err := s.issueCode(requestId, user, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = s.issueCode(requestId, user, now); err == nil {
+		t.Fatal("authorization request should be used only once")
+	}
+
+	callback, err := url.Parse(redirectUri)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if callback.Query().Get("state") != "af0ifjsldkj" {
+		t.Errorf("state should be returned, got %s", redirectUri)
+	}
+
+	return callback.Query().Get("code")
+}
+
+func testOidcTokenForm(code, redirectUri, verifier string) url.Values {
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", redirectUri)
+	form.Set("code_verifier", verifier)
+
+	return form
+}
+
+func TestOidc_Flow(t *testing.T) {
+	s := newTestOidc(t)
+	code := testOidcCode(t, s)
+
+	now := time.Now()
+	_, oe := s.exchangeCode("wiki", "wrong-secret", testOidcTokenForm(code, testOidcRedirectUri, testOidcVerifier), now)
+	if oe == nil || oe.code != "invalid_client" {
+		t.Fatalf("wrong client secret should be refused, got %v", oe)
+	}
+
+	granted, oe := s.exchangeCode("wiki", "wiki-secret", testOidcTokenForm(code, testOidcRedirectUri, testOidcVerifier), now)
+	if oe != nil {
+		t.Fatal(oe)
+	}
+	token, err := s.issueTokens(granted, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims := &oidcIdClaims{}
+	err = s.signer.Parse(token.IdToken, claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims.Issuer != "https://oa.example.com/auth" || claims.Subject != "zhangsan" || claims.Nonce != "n-0S6_WzA2Mj" {
+		t.Errorf("unexpected id token claims: %+v", claims)
+	}
+	if len(claims.Audience) != 1 || claims.Audience[0] != "wiki" {
+		t.Errorf("unexpected audience: %v", claims.Audience)
+	}
+
+	_, oe = s.exchangeCode("wiki", "wiki-secret", testOidcTokenForm(code, testOidcRedirectUri, testOidcVerifier), now)
+	if oe == nil || oe.code != "invalid_grant" {
+		t.Errorf("reused code should be refused, got %v", oe)
+	}
+}
+
+func TestOidc_FlowInvalidGrant(t *testing.T) {
+	s := newTestOidc(t)
+	cases := map[string]url.Values{
+		"wrong verifier":     testOidcTokenForm("", testOidcRedirectUri, testOidcVerifier[:42]+"5"),
+		"wrong redirect uri": testOidcTokenForm("", testOidcRedirectUri+"/other", testOidcVerifier),
+		"missing verifier":   testOidcTokenForm("", testOidcRedirectUri, ""),
+	}
+	for name, form := range cases {
+		code := testOidcCode(t, s)
+		form.Set("code", code)
+		_, oe := s.exchangeCode("wiki", "wiki-secret", form, time.Now())
+		if oe == nil || oe.code != "invalid_grant" {
+			t.Errorf("%s: should be refused, got %v", name, oe)
+		}
+
+		// the code is consumed by the failed attempt too
+		_, oe = s.exchangeCode("wiki", "wiki-secret", testOidcTokenForm(code, testOidcRedirectUri, testOidcVerifier), time.Now())
+		if oe == nil {
+			t.Errorf("%s: code should not be usable after a failed attempt", name)
+		}
+	}
+}
+
+func TestOidc_AuthorizeInvalid(t *testing.T) {
+	s := newTestOidc(t)
+	query := url.Values{}
+	query.Set("response_type", "code")
+	query.Set("client_id", "wiki")
+	query.Set("redirect_uri", "https://evil.example.com/cb")
+	query.Set("scope", "openid")
+	query.Set("code_challenge", "x")
+	query.Set("code_challenge_method", "S256")
+
+	_, _, oe := s.authorize(query, time.Now())
+	if oe == nil || len(oe.redirectUri) > 0 {
+		t.Errorf("unregistered redirect uri should not be redirected to, got %v", oe)
+	}
+
+	query.Set("redirect_uri", testOidcRedirectUri)
+	query.Set("code_challenge_method", "plain")
+	_, _, oe = s.authorize(query, time.Now())
+	if oe == nil || oe.redirectUri != testOidcRedirectUri || oe.code != "invalid_request" {
+		t.Errorf("plain challenge should be refused to the client, got %v", oe)
+	}
+}
+
+func TestOidc_IssuerRequired(t *testing.T) {
+	cfg := config.NewConfig()
+	cfg.Auth.Oidc.Enabled = true
+	cfg.Auth.Oidc.Issuer = ""
+	s := NewOidc(nil, &controller.Parameter{Cfg: cfg})
+	if s.enabled() {
+		t.Error("oidc should be disabled without the issuer")
+	}
+}
+
+func TestVerifyCodeChallenge(t *testing.T) {
+	// challenge = BASE64URL(SHA256(verifier))
+	verifier := "dBjftJeZ4CVP-mJ0cXsdUAMo6vzpjvNA6pZqqFPGU34"
+	challenge := "NzLW0KkuhrNfPF5iTKJ-7TEfVsGBHOM-eSEOwC0OVGk"
+
+	if !verifyCodeChallenge(challenge, verifier) {
+		t.Fatal("verifier should match")
+	}
+	if verifyCodeChallenge(challenge, verifier[:42]+"5") {
+		t.Error("changed verifier should not match")
+	}
+	if verifyCodeChallenge(challenge, "") {
+		t.Error("empty verifier should not match")
+	}
+	if verifyCodeChallenge(verifier, verifier) {
+		t.Error("plain challenge should not match")
+	}
+}
+
+func TestContainsScope(t *testing.T) {
+	if !containsScope("openid profile  email", "openid") {
+		t.Error("openid should be contained")
+	}
+	if containsScope("openidx profile", "openid") {
+		t.Error("openid should not be contained")
+	}
+	if containsScope("", "openid") {
+		t.Error("empty scope should not contain openid")
+	}
+}
+
+func TestAppendQuery(t *testing.T) {
+	values := url.Values{}
+	values.Set("code", "a b")
+	values.Set("state", "x")
+
+	uri := appendQuery("https://wiki.example.com/cb", values)
+	if uri != "https://wiki.example.com/cb?code=a+b&state=x" {
+		t.Errorf("unexpected uri: %s", uri)
+	}
+	uri = appendQuery("https://wiki.example.com/cb?p=1", values)
+	if uri != "https://wiki.example.com/cb?p=1&code=a+b&state=x" {
+		t.Errorf("unexpected uri: %s", uri)
+	}
+}
@@ -0,0 +1,260 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/csby/goa/controller"
+	"github.com/csby/goa/data/model"
+	"github.com/csby/gwsf/gtype"
+	"github.com/golang-jwt/jwt/v5"
+	"time"
+)
+
+const (
+	refreshTokenBucket = "token.refresh"
+)
+
+func (s *Ad) Refresh(ctx gtype.Context, ps gtype.Params) {
+	if s.Signer == nil || s.Dbs == nil {
+		ctx.Error(gtype.ErrInternal, "未启用JWT凭证")
+		return
+	}
+
+	argument := &model.AuthRefresh{}
+	err := ctx.GetJson(argument)
+	if err != nil {
+		ctx.Error(gtype.ErrInput, err)
+		return
+	}
+	if len(argument.RefreshToken) < 1 {
+		ctx.Error(gtype.ErrInput.SetDetail("刷新凭证(refreshToken)为空"))
+		return
+	}
+
+	login, be, err := s.refresh(ctx.RIP(), argument.RefreshToken, time.Now())
+	if be != nil {
+		ctx.Error(be, err)
+		return
+	}
+
+	ctx.Success(login)
+}
+
+// refresh rotates the refresh token presented from ip, it is marked as used and a new pair of tokens is issued;
+// the whole session is revoked if a used refresh token is presented again
+func (s *Ad) refresh(ip, refreshToken string, now time.Time) (*model.AuthLogin, gtype.Error, error) {
+	reused := false
+	record := &model.AuthRefreshToken{}
+	err := s.Dbs.Modify(refreshTokenBucket, s.hashRefreshToken(refreshToken), record, func(existed bool) error {
+		if !existed {
+			return fmt.Errorf("刷新凭证无效")
+		}
+		if record.Used {
+			reused = true
+			return fmt.Errorf("刷新凭证已被使用")
+		}
+		if !time.Time(record.ExpireTime).After(now) {
+			return fmt.Errorf("刷新凭证已过期")
+		}
+
+		useTime := gtype.DateTime(now)
+		record.Used = true
+		record.UseIP = ip
+		record.UseTime = &useTime
+		return nil
+	})
+	if reused {
+		// a used refresh token is presented again, it may be stolen, so the whole session is revoked
+		s.LogWarning(fmt.Sprintf("refresh token of %s (session %s) reused from %s, session revoked", record.Account, record.SessionID, ip))
+		s.Tdb.Del(record.SessionID)
+		s.deleteRefreshTokens(record.SessionID)
+		return nil, gtype.ErrTokenInvalid, fmt.Errorf("刷新凭证已被使用, 为安全起见该会话已注销, 请重新登录")
+	}
+	if err != nil {
+		return nil, gtype.ErrTokenInvalid, err
+	}
+
+	value, ok := s.Tdb.Get(record.SessionID, true)
+	if !ok {
+		s.deleteRefreshTokens(record.SessionID)
+		return nil, gtype.ErrTokenInvalid, fmt.Errorf("会话已失效, 请重新登录")
+	}
+	token, ok := value.(*gtype.Token)
+	if !ok {
+		return nil, gtype.ErrInternal, fmt.Errorf("类型转换错误(*gtype.Token)")
+	}
+	if token.LoginIP != ip {
+		return nil, gtype.ErrTokenIllegal, fmt.Errorf("IP不匹配: 当前IP%s, 登录IP%s", ip, token.LoginIP)
+	}
+
+	login, err := s.issueTokens(token)
+	if err != nil {
+		return nil, gtype.ErrInternal, err
+	}
+
+	return login, nil, nil
+}
+
+func (s *Ad) RefreshDoc(doc gtype.Doc, method string, uri gtype.Uri) {
+	catalog := s.createCatalog(doc, authCatalogAd)
+	function := catalog.AddFunction(method, uri, "刷新凭证")
+	function.SetNote("使用刷新凭证获取新的访问凭证及刷新凭证, 每个刷新凭证只能使用一次; " +
+		"已使用的刷新凭证再次使用时视为被盗用, 该会话的所有凭证立即失效")
+	function.SetRemark("该接口不需要凭证, 仅启用JWT(config: auth.token.jwt)时有效")
+	function.SetInputJsonExample(&model.AuthRefresh{
+		RefreshToken: "q0Vq2cX2m7n8...",
+	})
+	function.SetOutputDataExample(&model.AuthLogin{
+		Login: gtype.Login{
+			Token:   "eyJhbGciOiJSUzI1NiIsImtpZCI6Ii4uLiJ9...",
+			Account: "zhangsan",
+			Name:    "张三",
+		},
+		RefreshToken: "x8Pp1aQ3n0k...",
+		ExpiresIn:    600,
+	})
+	function.AddOutputError(gtype.ErrInput)
+	function.AddOutputError(gtype.ErrInternal)
+	function.AddOutputError(gtype.ErrTokenInvalid)
+	function.AddOutputError(gtype.ErrTokenIllegal)
+}
+
+func (s *Ad) GetJwks(ctx gtype.Context, ps gtype.Params) {
+	if s.Signer == nil {
+		ctx.Error(gtype.ErrInternal, "未启用JWT凭证")
+		return
+	}
+
+	w := ctx.Response()
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "public, max-age=3600")
+	err := json.NewEncoder(w).Encode(s.Signer.Jwks())
+	if err != nil {
+		s.LogError("write jwks fail:", err)
+	}
+}
+
+func (s *Ad) GetJwksDoc(doc gtype.Doc, method string, uri gtype.Uri) {
+	catalog := s.createCatalog(doc, authCatalogAd)
+	function := catalog.AddFunction(method, uri, "获取凭证公钥")
+	function.SetNote("以JWKS(RFC 7517)格式返回验证访问凭证签名(RS256)的公钥, 其它服务可据此离线验证凭证; 返回结果不包含code及data外层")
+	function.SetRemark("该接口不需要凭证, 仅启用JWT(config: auth.token.jwt)时有效")
+	function.SetOutputExample(&model.Jwks{
+		Keys: []*model.Jwk{
+			{
+				Kty: "RSA",
+				Use: "sig",
+				Alg: "RS256",
+				Kid: "3f2a9c1d5e7b8a60",
+				N:   "u1SU1LfVLPHCozMxH2Mo4lgOEePzNm0tRgeLezV6ffAt0gunVTLw7onLRnrq0_IzW7yWR7QkrmBL7jTKEn5u-qKhbwKfBstIs-bMY2Zkp18gnTxKLxoS2tFczGkPLPgizskuemMghRniWaoLcyehkd3qqGElvW_VDL5AaWTg0nLVkjRo9z-40RQzuVaE8AkAFmxZzow3x-VJYKdjykkJ0iT9wCS0DRTXu269V264Vf_3jvredZiKRkgwlL9xNAwxXFg0x_XFw005UWVRIkdgcKWTjpBP2dPwVZ4WWC-9aGVd-Gyn1o0CLelf4rEjGoXbAAEgAqeGUxrcIlbjXfbcmw",
+				E:   "AQAB",
+			},
+		},
+	})
+	function.AddOutputError(gtype.ErrInternal)
+}
+
+// issueTokens signs a short-lived access token for the session and issues a new refresh token of it
+func (s *Ad) issueTokens(token *gtype.Token) (*model.AuthLogin, error) {
+	now := time.Now()
+	accessMinutes := int64(10)
+	refreshMinutes := int64(10080)
+	if s.Cfg != nil {
+		if s.Cfg.Auth.Token.Access.Expiration > 0 {
+			accessMinutes = s.Cfg.Auth.Token.Access.Expiration
+		}
+		if s.Cfg.Auth.Token.Refresh.Expiration > 0 {
+			refreshMinutes = s.Cfg.Auth.Token.Refresh.Expiration
+		}
+	}
+	accessExpiration := time.Duration(accessMinutes) * time.Minute
+
+	access, err := s.signAccessToken(token, now, now.Add(accessExpiration))
+	if err != nil {
+		return nil, err
+	}
+
+	buf := make([]byte, 32)
+	_, err = rand.Read(buf)
+	if err != nil {
+		return nil, err
+	}
+	refresh := base64.RawURLEncoding.EncodeToString(buf)
+	err = s.Dbs.Put(refreshTokenBucket, s.hashRefreshToken(refresh), &model.AuthRefreshToken{
+		SessionID:  token.ID,
+		Account:    token.UserAccount,
+		CreateTime: gtype.DateTime(now),
+		ExpireTime: gtype.DateTime(now.Add(time.Duration(refreshMinutes) * time.Minute)),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &model.AuthLogin{
+		Login: gtype.Login{
+			Token:   access,
+			Account: token.UserAccount,
+			Name:    token.UserName,
+		},
+		RefreshToken: refresh,
+		ExpiresIn:    int64(accessExpiration.Seconds()),
+	}, nil
+}
+
+// signAccessToken signs the access token of the session which is valid until expireTime
+func (s *Ad) signAccessToken(token *gtype.Token, now, expireTime time.Time) (string, error) {
+	claims := &controller.AccessClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        gtype.NewGuid(),
+			Issuer:    s.Signer.Issuer(),
+			Subject:   token.UserAccount,
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(expireTime),
+		},
+		Name:      token.UserName,
+		SessionID: token.ID,
+	}
+
+	return s.Signer.Sign(claims)
+}
+
+func (s *Ad) hashRefreshToken(v string) string {
+	sum := sha256.Sum256([]byte(v))
+	return hex.EncodeToString(sum[:])
+}
+
+// deleteRefreshTokens deletes all refresh tokens of the session
+func (s *Ad) deleteRefreshTokens(sessionId string) {
+	s.deleteRefreshTokensWhere(func(item *model.AuthRefreshToken) bool {
+		return item.SessionID == sessionId
+	})
+}
+
+func (s *Ad) purgeRefreshTokens() {
+	now := time.Now()
+	s.deleteRefreshTokensWhere(func(item *model.AuthRefreshToken) bool {
+		return !time.Time(item.ExpireTime).After(now)
+	})
+}
+
+func (s *Ad) deleteRefreshTokensWhere(match func(item *model.AuthRefreshToken) bool) {
+	if s.Dbs == nil {
+		return
+	}
+
+	keys := make([]string, 0)
+	s.Dbs.ForEach(refreshTokenBucket, func(key string, value []byte) error {
+		item := &model.AuthRefreshToken{}
+		if json.Unmarshal(value, item) != nil || match(item) {
+			keys = append(keys, key)
+		}
+		return nil
+	})
+	for _, key := range keys {
+		s.Dbs.Delete(refreshTokenBucket, key)
+	}
+}
@@ -0,0 +1,115 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"github.com/csby/goa/assist"
+	"github.com/csby/goa/controller"
+	"github.com/csby/goa/data/model"
+	"github.com/csby/gwsf/gtype"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestRefreshAd(t *testing.T) (*Ad, *model.AuthLogin) {
+	s := newTestSessionAd(t, 0)
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Signer = controller.NewTokenSigner(key, "", "goa")
+
+	login, err := s.CreateLogin(&assist.AdEntryUser{Account: "zhangsan"}, "192.168.1.100")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(login.RefreshToken) < 1 {
+		t.Fatal("refresh token should be issued")
+	}
+
+	return s, login
+}
+
+func TestAd_RefreshRotate(t *testing.T) {
+	s, login := newTestRefreshAd(t)
+
+	rotated, be, err := s.refresh("192.168.1.100", login.RefreshToken, time.Now())
+	if be != nil {
+		t.Fatal(err)
+	}
+	if rotated.RefreshToken == login.RefreshToken || rotated.Token == login.Token {
+		t.Error("a new pair of tokens should be issued")
+	}
+	record := &model.AuthRefreshToken{}
+	ok, err := s.Dbs.Get(refreshTokenBucket, s.hashRefreshToken(login.RefreshToken), record)
+	if err != nil || !ok || !record.Used || record.UseIP != "192.168.1.100" {
+		t.Errorf("the presented refresh token should be marked as used: %+v", record)
+	}
+
+	_, be, err = s.refresh("192.168.1.100", rotated.RefreshToken, time.Now())
+	if be != nil {
+		t.Errorf("the rotated refresh token should be valid: %v", err)
+	}
+
+	_, be, _ = s.refresh("192.168.1.200", rotated.RefreshToken, time.Now())
+	if be == nil {
+		t.Error("refresh from another ip should fail")
+	}
+}
+
+func TestAd_RefreshReplay(t *testing.T) {
+	s, login := newTestRefreshAd(t)
+
+	rotated, be, err := s.refresh("192.168.1.100", login.RefreshToken, time.Now())
+	if be != nil {
+		t.Fatal(err)
+	}
+
+	_, be, err = s.refresh("192.168.1.100", login.RefreshToken, time.Now())
+	if be == nil || be.Code() != gtype.ErrTokenInvalid.Code() || !strings.Contains(err.Error(), "已注销") {
+		t.Fatalf("replay of a used refresh token should revoke the session, got %v", err)
+	}
+	if tokens := s.Tdb.GetTokens("zhangsan"); len(tokens) != 0 {
+		t.Errorf("session should be revoked, got %d tokens", len(tokens))
+	}
+	_, be, _ = s.refresh("192.168.1.100", rotated.RefreshToken, time.Now())
+	if be == nil {
+		t.Error("the other refresh tokens of the revoked session should be invalid")
+	}
+}
+
+func TestAd_RefreshExpired(t *testing.T) {
+	s, login := newTestRefreshAd(t)
+
+	_, be, err := s.refresh("192.168.1.100", login.RefreshToken, time.Now().Add(8*24*time.Hour))
+	if be == nil || !strings.Contains(err.Error(), "过期") {
+		t.Fatalf("expired refresh token should be refused, got %v", err)
+	}
+	if tokens := s.Tdb.GetTokens("zhangsan"); len(tokens) != 1 {
+		t.Errorf("session should be kept, got %d tokens", len(tokens))
+	}
+
+	_, be, _ = s.refresh("192.168.1.100", "unknown", time.Now())
+	if be == nil {
+		t.Error("unknown refresh token should be refused")
+	}
+}
+
+func TestAd_RawSessionIdRefused(t *testing.T) {
+	s, login := newTestRefreshAd(t)
+
+	token := s.GetToken(login.Token)
+	if token == nil {
+		t.Fatal("the signed access token should be valid")
+	}
+	if s.GetToken(token.ID) != nil {
+		t.Error("the raw session id should not be accepted when the access tokens are signed")
+	}
+	if s.TokenKey(token.ID) != "" {
+		t.Error("the raw session id should not resolve to a session")
+	}
+	if s.TokenKey(login.Token) != token.ID {
+		t.Error("the signed access token should resolve to its session")
+	}
+}
@@ -0,0 +1,541 @@
+package auth
+
+import (
+	"encoding/base64"
+	"fmt"
+	"github.com/csby/goa/assist"
+	"github.com/csby/goa/config"
+	"github.com/csby/goa/controller"
+	"github.com/csby/goa/data/model"
+	"github.com/csby/gwsf/gtype"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	samlRequestExpiration = 10 * time.Minute
+)
+
+func NewSaml(log gtype.Log, param *controller.Parameter) *Saml {
+	instance := &Saml{}
+	instance.SetLog(log)
+	instance.SetParameter(param)
+
+	instance.requests = make(map[string]*samlRequest)
+
+	if instance.Cfg != nil && instance.Cfg.Auth.Saml.Enabled {
+		cfg := &instance.Cfg.Auth.Saml
+		if len(instance.baseUrl()) < 1 || len(instance.entityId()) < 1 {
+			// the addresses are not taken from the request, the Host header can be set by anyone
+			instance.LogError("saml is disabled: url (auth.saml.url) or entity id (auth.saml.entityId) is empty")
+		} else {
+			signer, err := loadSamlSigner(cfg.Key.File, cfg.Key.Cert, instance.entityId())
+			if err != nil {
+				instance.LogError("saml is disabled: load signing key fail: ", err)
+			} else {
+				instance.signer = signer
+			}
+		}
+	}
+
+	return instance
+}
+
+// Saml is the SAML 2.0 identity provider, the AuthnRequest is accepted with the HTTP-POST or HTTP-Redirect binding,
+// and the signed assertion is sent to the registered assertion consumer service with the HTTP-POST binding;
+// the user is authenticated with the password and the second factor of Authenticator
+type Saml struct {
+	base
+
+	Authenticator *Ad
+
+	signer *samlSigner
+
+	mutex    sync.Mutex
+	requests map[string]*samlRequest // key: request id of the login page
+}
+
+type samlRequest struct {
+	sp         *config.AuthSamlSp
+	id         string // ID of the AuthnRequest, empty for the IdP-initiated sign-on
+	relayState string
+	expireTime time.Time
+}
+
+func (s *Saml) GetMetadata(ctx gtype.Context, ps gtype.Params) {
+	if !s.enabled() {
+		http.Error(ctx.Response(), "未启用SAML单点登录", http.StatusNotFound)
+		return
+	}
+
+	w := ctx.Response()
+	w.Header().Set("Content-Type", "application/samlmetadata+xml")
+	w.Header().Set("Cache-Control", "public, max-age=3600")
+	w.WriteHeader(http.StatusOK)
+	_, err := w.Write(s.signer.metadata(s.entityId(), s.baseUrl()+"/saml/sso"))
+	if err != nil {
+		s.LogError("saml: write metadata fail: ", err)
+	}
+}
+
+func (s *Saml) GetMetadataDoc(doc gtype.Doc, method string, uri gtype.Uri) {
+	catalog := s.createCatalog(doc, authCatalogSaml)
+	function := catalog.AddFunction(method, uri, "获取元数据")
+	function.SetNote("返回身份提供者元数据(EntityDescriptor), 包含标识(entityID)、签名证书及单点登录地址, 用于在服务提供者中配置; " +
+		"返回结果为XML, 不包含code及data外层")
+	function.SetRemark("该接口不需要凭证")
+	function.AddOutputHeader("Content-Type", "application/samlmetadata+xml")
+}
+
+func (s *Saml) SingleSignOn(ctx gtype.Context, ps gtype.Params) {
+	if !s.enabled() {
+		s.writeLoginPage(ctx, http.StatusNotFound, &loginPage{Error: "未启用SAML单点登录"})
+		return
+	}
+
+	r := ctx.Request()
+	var request *samlAuthnRequest
+	relayState := ""
+	if r.Method == http.MethodPost {
+		err := r.ParseForm()
+		if err != nil {
+			s.writeLoginPage(ctx, http.StatusBadRequest, &loginPage{Error: err.Error()})
+			return
+		}
+		relayState = r.PostForm.Get("RelayState")
+		request, err = parseSamlRequest(r.PostForm.Get("SAMLRequest"), false)
+		if err != nil {
+			s.writeLoginPage(ctx, http.StatusBadRequest, &loginPage{Error: err.Error()})
+			return
+		}
+	} else {
+		query := r.URL.Query()
+		relayState = query.Get("RelayState")
+		var err error
+		request, err = parseSamlRequest(query.Get("SAMLRequest"), true)
+		if err != nil {
+			s.writeLoginPage(ctx, http.StatusBadRequest, &loginPage{Error: err.Error()})
+			return
+		}
+	}
+
+	sp := s.Cfg.Auth.Saml.GetSp(request.Issuer)
+	if sp == nil {
+		s.writeLoginPage(ctx, http.StatusBadRequest, &loginPage{Error: fmt.Sprintf("服务提供者(%s)未登记", request.Issuer)})
+		return
+	}
+	if len(request.AssertionConsumerServiceURL) > 0 && request.AssertionConsumerServiceURL != sp.AcsUrl {
+		s.writeLoginPage(ctx, http.StatusBadRequest, &loginPage{Error: fmt.Sprintf("断言消费地址(%s)未登记", request.AssertionConsumerServiceURL)})
+		return
+	}
+	if len(request.ProtocolBinding) > 0 && request.ProtocolBinding != samlBindingPost {
+		s.writeLoginPage(ctx, http.StatusBadRequest, &loginPage{Error: "响应仅支持HTTP-POST绑定"})
+		return
+	}
+
+	s.startLogin(ctx, sp, request.ID, relayState)
+}
+
+func (s *Saml) SingleSignOnDoc(doc gtype.Doc, method string, uri gtype.Uri) {
+	catalog := s.createCatalog(doc, authCatalogSaml)
+	function := catalog.AddFunction(method, uri, "单点登录(SP发起)")
+	function.SetNote("服务提供者将用户重定向(HTTP-Redirect绑定, GET, 请求经deflate压缩)或提交表单(HTTP-POST绑定, POST)至此地址, 返回登录页面; " +
+		"登录成功后页面将签名的断言以表单(SAMLResponse, RelayState)提交至登记的断言消费地址")
+	function.SetRemark("该接口不需要凭证; 服务提供者须已登记(auth.saml.sps), 认证请求的签名不作验证, 响应只发送至登记的断言消费地址")
+	if method == http.MethodPost {
+		function.AddInputForm(true, "SAMLRequest", "认证请求(AuthnRequest), base64", 0, "")
+		function.AddInputForm(false, "RelayState", "状态, 原样返回", 0, "")
+	} else {
+		function.AddInputQuery(true, "SAMLRequest", "认证请求(AuthnRequest), deflate后base64", "")
+		function.AddInputQuery(false, "RelayState", "状态, 原样返回", "")
+	}
+	function.AddOutputHeader("Content-Type", "text/html; charset=utf-8")
+}
+
+func (s *Saml) InitiateSignOn(ctx gtype.Context, ps gtype.Params) {
+	if !s.enabled() {
+		s.writeLoginPage(ctx, http.StatusNotFound, &loginPage{Error: "未启用SAML单点登录"})
+		return
+	}
+
+	query := ctx.Request().URL.Query()
+	sp := s.Cfg.Auth.Saml.GetSp(query.Get("sp"))
+	if sp == nil {
+		s.writeLoginPage(ctx, http.StatusBadRequest, &loginPage{Error: fmt.Sprintf("服务提供者(%s)未登记", query.Get("sp"))})
+		return
+	}
+
+	s.startLogin(ctx, sp, "", query.Get("RelayState"))
+}
+
+func (s *Saml) InitiateSignOnDoc(doc gtype.Doc, method string, uri gtype.Uri) {
+	catalog := s.createCatalog(doc, authCatalogSaml)
+	function := catalog.AddFunction(method, uri, "单点登录(IdP发起)")
+	function.SetNote("从门户直接登录指定的服务提供者, 返回登录页面; 登录成功后页面将签名的断言(不含InResponseTo)以表单提交至登记的断言消费地址")
+	function.SetRemark("该接口不需要凭证")
+	function.AddInputQuery(true, "sp", "服务提供者标识(entityID), 须已登记", "https://crm.example.com/saml/metadata")
+	function.AddInputQuery(false, "RelayState", "状态, 原样发送给服务提供者, 通常为登录后的页面地址", "")
+	function.AddOutputHeader("Content-Type", "text/html; charset=utf-8")
+}
+
+func (s *Saml) GetCaptcha(ctx gtype.Context, ps gtype.Params) {
+	if s.Authenticator == nil {
+		ctx.Error(gtype.ErrInternal, "authenticator is nil")
+		return
+	}
+
+	s.Authenticator.GetCaptcha(ctx, ps)
+}
+
+func (s *Saml) GetCaptchaDoc(doc gtype.Doc, method string, uri gtype.Uri) {
+	catalog := s.createCatalog(doc, authCatalogSaml)
+	function := catalog.AddFunction(method, uri, "获取验证码")
+	function.SetNote("获取登录页面需要的验证码及密码加密公钥, 与域控登录共用")
+	function.SetRemark("该接口不需要凭证")
+	function.SetInputJsonExample(&gtype.CaptchaFilter{
+		Mode:   3,
+		Length: 4,
+		Width:  100,
+		Height: 30,
+	})
+	function.SetOutputDataExample(&model.AuthCaptcha{
+		Captcha: gtype.Captcha{
+			ID:           "GKSVhVMRAHsyVuXSrMYs",
+			Value:        "data:image/png;base64,iVBOR...",
+			RsaPublicKey: "-----BEGIN PUBLIC KEY-----...-----END PUBLIC KEY-----",
+			Required:     false,
+		},
+		RsaKeyID: "3f9a1c0d5e7b2468",
+	})
+	function.AddOutputError(gtype.ErrInput)
+	function.AddOutputError(gtype.ErrInternal)
+}
+
+func (s *Saml) Login(ctx gtype.Context, ps gtype.Params) {
+	if !s.enabled() || s.Authenticator == nil {
+		ctx.Error(gtype.ErrInternal, "未启用SAML单点登录")
+		return
+	}
+
+	argument := &model.SamlLogin{}
+	err := ctx.GetJson(argument)
+	if err != nil {
+		ctx.Error(gtype.ErrInput, err)
+		return
+	}
+	if s.getRequest(argument.RequestID) == nil {
+		ctx.Error(gtype.ErrInput.SetDetail("认证请求已过期, 请返回应用重新登录"))
+		return
+	}
+
+	pwd, be, err := s.Authenticator.decodeLogin(ctx, &argument.LoginFilter)
+	if be != nil {
+		ctx.Error(be, err)
+		return
+	}
+	user, login, be, err := s.Authenticator.authenticateUser(ctx, argument.Account, pwd)
+	if be != nil {
+		ctx.Error(be, err)
+		s.Authenticator.increaseErrorCount(ctx.RIP(), argument.Account)
+		return
+	}
+	if login != nil {
+		if login.TotpEnroll {
+			ctx.Error(gtype.ErrNoPermission, "须先登录系统绑定验证器(两步验证)后才能单点登录")
+			return
+		}
+		ctx.Success(&model.SamlLoginResult{
+			TotpTicket: login.TotpTicket,
+		})
+		return
+	}
+
+	result, be, err := s.completeLogin(ctx, argument.RequestID, user)
+	if be != nil {
+		ctx.Error(be, err)
+		return
+	}
+	s.Authenticator.clearErrorCount(argument.Account)
+
+	ctx.Success(result)
+}
+
+func (s *Saml) LoginDoc(doc gtype.Doc, method string, uri gtype.Uri) {
+	catalog := s.createCatalog(doc, authCatalogSaml)
+	function := catalog.AddFunction(method, uri, "用户登录")
+	function.SetNote("登录页面提交帐号及密码, 与域控登录相同; 验证通过后返回提交至服务提供者的表单(包含签名的断言), 由页面完成提交; " +
+		"须两步验证时返回票据(totpTicket), 由页面继续提交验证码")
+	function.SetRemark("该接口不需要凭证; 连续3次错误将要求输入验证码; 强制两步验证但尚未绑定验证器的用户须先登录系统完成绑定")
+	function.SetInputJsonExample(&model.SamlLogin{
+		LoginFilter: gtype.LoginFilter{
+			Account:      "zhangsan",
+			Password:     "Mh0R...",
+			CaptchaId:    "r4kcmz2E12e0qJQOvqRB",
+			CaptchaValue: "1e35",
+			Encryption:   "rsa",
+		},
+		RequestID: "nTfj5ZbY3m3bJ2o8Bv9Jk7eWcXm1q0aS4rD6uF8hG2k",
+	})
+	function.SetOutputDataExample(&model.SamlLoginResult{
+		Form: &model.SamlForm{
+			Action: "https://crm.example.com/saml/acs",
+			Fields: map[string]string{
+				"SAMLResponse": "PHNhbWxwOlJlc3BvbnNlIHhtbG5zOnNhbWxwPSJ1cm46b2FzaXM6...",
+				"RelayState":   "/dashboard",
+			},
+		},
+	})
+	function.AddOutputError(gtype.ErrInput)
+	function.AddOutputError(gtype.ErrInternal)
+	function.AddOutputError(gtype.ErrNoPermission)
+	function.AddOutputError(gtype.ErrLoginCaptchaInvalid)
+	function.AddOutputError(gtype.ErrLoginPasswordInvalid)
+	function.AddOutputError(gtype.ErrLoginAccountOrPasswordInvalid)
+}
+
+func (s *Saml) TotpLogin(ctx gtype.Context, ps gtype.Params) {
+	if !s.enabled() || s.Authenticator == nil {
+		ctx.Error(gtype.ErrInternal, "未启用SAML单点登录")
+		return
+	}
+
+	argument := &model.SamlTotpLogin{}
+	err := ctx.GetJson(argument)
+	if err != nil {
+		ctx.Error(gtype.ErrInput, err)
+		return
+	}
+	if s.getRequest(argument.RequestID) == nil {
+		ctx.Error(gtype.ErrInput.SetDetail("认证请求已过期, 请返回应用重新登录"))
+		return
+	}
+
+	user, _, be, err := s.Authenticator.verifyTotpLogin(ctx, &argument.TotpLogin)
+	if be != nil {
+		ctx.Error(be, err)
+		return
+	}
+
+	result, be, err := s.completeLogin(ctx, argument.RequestID, user)
+	if be != nil {
+		ctx.Error(be, err)
+		return
+	}
+	s.Authenticator.clearErrorCount(user.Account)
+
+	ctx.Success(result)
+}
+
+func (s *Saml) TotpLoginDoc(doc gtype.Doc, method string, uri gtype.Uri) {
+	catalog := s.createCatalog(doc, authCatalogSaml)
+	function := catalog.AddFunction(method, uri, "验证登录")
+	function.SetNote("登录的第二步: 使用登录返回的票据(totpTicket)及验证码(或恢复码)完成登录, 返回提交至服务提供者的表单(包含签名的断言)")
+	function.SetRemark("该接口不需要凭证; 每个票据最多尝试5次")
+	argument := &model.SamlTotpLogin{
+		RequestID: "nTfj5ZbY3m3bJ2o8Bv9Jk7eWcXm1q0aS4rD6uF8hG2k",
+	}
+	argument.Ticket = "Q2xk0lR3m1vJt8nS5pZ6bY7cX9aW0eD4fG2hK1jL3k"
+	argument.Code = "287082"
+	function.SetInputJsonExample(argument)
+	function.SetOutputDataExample(&model.SamlLoginResult{
+		Form: &model.SamlForm{
+			Action: "https://crm.example.com/saml/acs",
+			Fields: map[string]string{
+				"SAMLResponse": "PHNhbWxwOlJlc3BvbnNlIHhtbG5zOnNhbWxwPSJ1cm46b2FzaXM6...",
+			},
+		},
+	})
+	function.AddOutputError(gtype.ErrInput)
+	function.AddOutputError(gtype.ErrInternal)
+	function.AddOutputError(gtype.ErrTokenInvalid)
+	function.AddOutputError(gtype.ErrLoginPasswordInvalid)
+	function.AddOutputError(gtype.ErrNoPermission)
+}
+
+// startLogin keeps the request for the login page, the request is removed when the assertion is issued
+func (s *Saml) startLogin(ctx gtype.Context, sp *config.AuthSamlSp, id, relayState string) {
+	requestId, err := newOidcRandom()
+	if err != nil {
+		s.writeLoginPage(ctx, http.StatusInternalServerError, &loginPage{Error: err.Error()})
+		return
+	}
+	now := time.Now()
+	s.mutex.Lock()
+	s.purge(now)
+	s.requests[requestId] = &samlRequest{
+		sp:         sp,
+		id:         id,
+		relayState: relayState,
+		expireTime: now.Add(samlRequestExpiration),
+	}
+	s.mutex.Unlock()
+
+	name := sp.Name
+	if len(name) < 1 {
+		name = sp.EntityID
+	}
+	s.writeLoginPage(ctx, http.StatusOK, &loginPage{
+		ClientName: name,
+		RequestID:  requestId,
+	})
+}
+
+// completeLogin issues the signed assertion of the user for the request, the request can be used only once
+func (s *Saml) completeLogin(ctx gtype.Context, requestId string, user *assist.AdEntryUser) (*model.SamlLoginResult, gtype.Error, error) {
+	now := time.Now()
+	s.mutex.Lock()
+	request, ok := s.requests[requestId]
+	delete(s.requests, requestId)
+	s.mutex.Unlock()
+	if !ok || !request.expireTime.After(now) {
+		return nil, gtype.ErrInput, fmt.Errorf("认证请求已使用或已过期, 请返回应用重新登录")
+	}
+
+	assertion, err := s.newAssertion(request, user, now)
+	if err != nil {
+		return nil, gtype.ErrNoPermission, err
+	}
+	responseId, err := newSamlID()
+	if err != nil {
+		return nil, gtype.ErrInternal, err
+	}
+	response, err := s.signer.response(responseId, assertion)
+	if err != nil {
+		return nil, gtype.ErrInternal, err
+	}
+	s.LogInfo(fmt.Sprintf("saml: %s signed on to %s from %s", user.Account, request.sp.EntityID, ctx.RIP()))
+
+	fields := map[string]string{
+		"SAMLResponse": base64.StdEncoding.EncodeToString(response),
+	}
+	if len(request.relayState) > 0 {
+		fields["RelayState"] = request.relayState
+	}
+
+	return &model.SamlLoginResult{
+		Form: &model.SamlForm{
+			Action: request.sp.AcsUrl,
+			Fields: fields,
+		},
+	}, nil, nil
+}
+
+func (s *Saml) newAssertion(request *samlRequest, user *assist.AdEntryUser, now time.Time) (*samlAssertion, error) {
+	sp := request.sp
+	id, err := newSamlID()
+	if err != nil {
+		return nil, err
+	}
+	assertion := &samlAssertion{
+		ID:           id,
+		Issuer:       s.entityId(),
+		Audience:     sp.EntityID,
+		Recipient:    sp.AcsUrl,
+		InResponseTo: request.id,
+		NameID:       user.Account,
+		NameIDFormat: samlNameIDUnspecified,
+		SessionIndex: id,
+		Attributes:   make([]*samlAttribute, 0),
+		IssueInstant: now,
+		NotOnOrAfter: now.Add(s.expiration()),
+	}
+	if sp.NameID == config.AuthSamlNameIDMail {
+		if len(user.Mail) < 1 {
+			return nil, fmt.Errorf("用户(%s)未设置电子邮箱, 不能登录%s", user.Account, sp.Name)
+		}
+		assertion.NameID = user.Mail
+		assertion.NameIDFormat = samlNameIDEmail
+	}
+
+	attributes := sp.Attributes
+	if len(attributes.Mail) > 0 && len(user.Mail) > 0 {
+		assertion.Attributes = append(assertion.Attributes, &samlAttribute{Name: attributes.Mail, Values: []string{user.Mail}})
+	}
+	if len(attributes.Name) > 0 && len(user.Name) > 0 {
+		assertion.Attributes = append(assertion.Attributes, &samlAttribute{Name: attributes.Name, Values: []string{user.Name}})
+	}
+	if len(attributes.Groups) > 0 {
+		groups := make([]string, 0)
+		items, err := s.Ad().GetMemberGroups(user.DN, true)
+		if err != nil {
+			s.LogWarning(fmt.Sprintf("saml: get groups of %s fail: ", user.Account), err)
+		}
+		for _, item := range items {
+			if item == nil {
+				continue
+			}
+			groups = append(groups, item.Account)
+		}
+		if len(groups) > 0 {
+			assertion.Attributes = append(assertion.Attributes, &samlAttribute{Name: attributes.Groups, Values: groups})
+		}
+	}
+
+	return assertion, nil
+}
+
+func (s *Saml) getRequest(requestId string) *samlRequest {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	request, ok := s.requests[requestId]
+	if !ok || !request.expireTime.After(time.Now()) {
+		return nil
+	}
+
+	return request
+}
+
+func (s *Saml) enabled() bool {
+	return s.Cfg != nil && s.Cfg.Auth.Saml.Enabled && s.signer != nil
+}
+
+// baseUrl returns the configured url, e.g. https://oa.example.com/auth for https://oa.example.com/auth/saml/sso
+func (s *Saml) baseUrl() string {
+	if s.Cfg == nil {
+		return ""
+	}
+
+	return strings.TrimRight(strings.TrimSpace(s.Cfg.Auth.Saml.Url), "/")
+}
+
+// entityId returns the configured entity id of the identity provider, it is the Issuer of the assertions
+func (s *Saml) entityId() string {
+	if s.Cfg == nil {
+		return ""
+	}
+
+	return strings.TrimSpace(s.Cfg.Auth.Saml.EntityID)
+}
+
+func (s *Saml) expiration() time.Duration {
+	minutes := s.Cfg.Auth.Saml.Expiration
+	if minutes < 1 {
+		minutes = 5
+	}
+
+	return time.Duration(minutes) * time.Minute
+}
+
+// purge removes the expired requests, the mutex must be locked by the caller
+func (s *Saml) purge(now time.Time) {
+	for k, v := range s.requests {
+		if !v.expireTime.After(now) {
+			delete(s.requests, k)
+		}
+	}
+}
+
+func (s *Saml) writeLoginPage(ctx gtype.Context, statusCode int, page *loginPage) {
+	w := ctx.Response()
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("X-Frame-Options", "DENY")
+	w.WriteHeader(statusCode)
+	err := loginTemplate.Execute(w, page)
+	if err != nil {
+		s.LogError("saml: write login page fail: ", err)
+	}
+}
@@ -0,0 +1,421 @@
+package auth
+
+import (
+	"bytes"
+	"compress/flate"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
+	"encoding/xml"
+	"fmt"
+	"github.com/csby/goa/controller"
+	"io"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	samlNsAssertion = "urn:oasis:names:tc:SAML:2.0:assertion"
+	samlNsProtocol  = "urn:oasis:names:tc:SAML:2.0:protocol"
+	samlNsMetadata  = "urn:oasis:names:tc:SAML:2.0:metadata"
+	samlNsDsig      = "http://www.w3.org/2000/09/xmldsig#"
+
+	samlBindingPost     = "urn:oasis:names:tc:SAML:2.0:bindings:HTTP-POST"
+	samlBindingRedirect = "urn:oasis:names:tc:SAML:2.0:bindings:HTTP-Redirect"
+
+	samlNameIDUnspecified = "urn:oasis:names:tc:SAML:1.1:nameid-format:unspecified"
+	samlNameIDEmail       = "urn:oasis:names:tc:SAML:1.1:nameid-format:emailAddress"
+	samlAttrNameBasic     = "urn:oasis:names:tc:SAML:2.0:attrname-format:basic"
+	samlStatusSuccess     = "urn:oasis:names:tc:SAML:2.0:status:Success"
+	samlConfirmBearer     = "urn:oasis:names:tc:SAML:2.0:cm:bearer"
+	samlAuthnPassword     = "urn:oasis:names:tc:SAML:2.0:ac:classes:PasswordProtectedTransport"
+
+	samlAlgExcC14n    = "http://www.w3.org/2001/10/xml-exc-c14n#"
+	samlAlgEnveloped  = "http://www.w3.org/2000/09/xmldsig#enveloped-signature"
+	samlAlgRsaSha256  = "http://www.w3.org/2001/04/xmldsig-more#rsa-sha256"
+	samlAlgSha256     = "http://www.w3.org/2001/04/xmlenc#sha256"
+	samlTimeFormat    = "2006-01-02T15:04:05Z"
+	samlRequestLimit  = 64 * 1024
+	samlCertValidYear = 10
+)
+
+// samlSigner signs the assertions with RSA-SHA256, the certificate is published in the metadata
+// and sent in the KeyInfo of each signature
+type samlSigner struct {
+	key  *rsa.PrivateKey
+	cert *x509.Certificate
+}
+
+// samlAssertion is the content of the assertion issued to the service provider
+type samlAssertion struct {
+	ID           string
+	Issuer       string
+	Audience     string
+	Recipient    string // the assertion consumer service url
+	InResponseTo string // empty for the IdP-initiated sign-on
+	NameID       string
+	NameIDFormat string
+	SessionIndex string
+	Attributes   []*samlAttribute
+	IssueInstant time.Time
+	NotOnOrAfter time.Time
+}
+
+type samlAttribute struct {
+	Name   string
+	Values []string
+}
+
+type samlAuthnRequest struct {
+	XMLName                     xml.Name `xml:"urn:oasis:names:tc:SAML:2.0:protocol AuthnRequest"`
+	ID                          string   `xml:"ID,attr"`
+	Version                     string   `xml:"Version,attr"`
+	Destination                 string   `xml:"Destination,attr"`
+	AssertionConsumerServiceURL string   `xml:"AssertionConsumerServiceURL,attr"`
+	ProtocolBinding             string   `xml:"ProtocolBinding,attr"`
+	Issuer                      string   `xml:"urn:oasis:names:tc:SAML:2.0:assertion Issuer"`
+}
+
+// loadSamlSigner reads the private key and the certificate from the PEM files, the key is created if not exists,
+// and a self-signed certificate of the key is created if the certificate file not exists
+func loadSamlSigner(keyFile, certFile, commonName string) (*samlSigner, error) {
+	key, err := controller.LoadRsaKey(keyFile)
+	if err != nil {
+		return nil, err
+	}
+	if len(certFile) < 1 {
+		return nil, fmt.Errorf("certificate file path is empty")
+	}
+
+	var cert *x509.Certificate
+	data, err := os.ReadFile(certFile)
+	if os.IsNotExist(err) {
+		cert, err = newSamlCertificate(key, commonName, time.Now())
+		if err != nil {
+			return nil, err
+		}
+		err = os.MkdirAll(filepath.Dir(certFile), 0700)
+		if err != nil {
+			return nil, err
+		}
+		data = pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})
+		err = os.WriteFile(certFile, data, 0644)
+		if err != nil {
+			return nil, err
+		}
+	} else if err != nil {
+		return nil, err
+	} else {
+		block, _ := pem.Decode(data)
+		if block == nil {
+			return nil, fmt.Errorf("invalid pem file: %s", certFile)
+		}
+		cert, err = x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		pub, ok := cert.PublicKey.(*rsa.PublicKey)
+		if !ok || !pub.Equal(&key.PublicKey) {
+			return nil, fmt.Errorf("the certificate (%s) does not match the key (%s)", certFile, keyFile)
+		}
+	}
+
+	return &samlSigner{key: key, cert: cert}, nil
+}
+
+func newSamlCertificate(key *rsa.PrivateKey, commonName string, now time.Time) (*x509.Certificate, error) {
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, err
+	}
+	if len(commonName) > 64 {
+		commonName = commonName[:64]
+	}
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: commonName},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.AddDate(samlCertValidYear, 0, 0),
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return nil, err
+	}
+
+	return x509.ParseCertificate(der)
+}
+
+// certificate returns the base64 of the DER certificate, the value of X509Certificate
+func (s *samlSigner) certificate() string {
+	return base64.StdEncoding.EncodeToString(s.cert.Raw)
+}
+
+// response returns the Response (HTTP-POST binding) with the signed assertion, the status is always success
+func (s *samlSigner) response(id string, assertion *samlAssertion) ([]byte, error) {
+	signed, err := s.sign(assertion)
+	if err != nil {
+		return nil, err
+	}
+
+	b := &bytes.Buffer{}
+	b.WriteString(`<samlp:Response xmlns:samlp="` + samlNsProtocol + `" xmlns:saml="` + samlNsAssertion + `"`)
+	writeSamlAttr(b, "Destination", assertion.Recipient)
+	writeSamlAttr(b, "ID", id)
+	if len(assertion.InResponseTo) > 0 {
+		writeSamlAttr(b, "InResponseTo", assertion.InResponseTo)
+	}
+	writeSamlAttr(b, "IssueInstant", samlTime(assertion.IssueInstant))
+	writeSamlAttr(b, "Version", "2.0")
+	b.WriteString(">")
+	writeSamlText(b, "saml:Issuer", assertion.Issuer)
+	b.WriteString(`<samlp:Status><samlp:StatusCode Value="` + samlStatusSuccess + `"></samlp:StatusCode></samlp:Status>`)
+	b.Write(signed)
+	b.WriteString("</samlp:Response>")
+
+	return b.Bytes(), nil
+}
+
+// sign returns the assertion with the enveloped signature (exclusive c14n, RSA-SHA256) after the Issuer;
+// the assertion is written in the canonical form already, so the digest is computed over the written bytes
+func (s *samlSigner) sign(assertion *samlAssertion) ([]byte, error) {
+	unsigned := assertion.xml(nil)
+	digest := sha256.Sum256(unsigned)
+	signedInfo := samlSignedInfo(assertion.ID, base64.StdEncoding.EncodeToString(digest[:]))
+
+	// SignedInfo is canonicalized as the apex, the namespace declaration of ds is rendered on it
+	canonical := strings.Replace(signedInfo, "<ds:SignedInfo>", `<ds:SignedInfo xmlns:ds="`+samlNsDsig+`">`, 1)
+	hashed := sha256.Sum256([]byte(canonical))
+	value, err := rsa.SignPKCS1v15(rand.Reader, s.key, crypto.SHA256, hashed[:])
+	if err != nil {
+		return nil, err
+	}
+
+	signature := &bytes.Buffer{}
+	signature.WriteString(`<ds:Signature xmlns:ds="` + samlNsDsig + `">`)
+	signature.WriteString(signedInfo)
+	writeSamlText(signature, "ds:SignatureValue", base64.StdEncoding.EncodeToString(value))
+	signature.WriteString("<ds:KeyInfo><ds:X509Data>")
+	writeSamlText(signature, "ds:X509Certificate", s.certificate())
+	signature.WriteString("</ds:X509Data></ds:KeyInfo></ds:Signature>")
+
+	return assertion.xml(signature.Bytes()), nil
+}
+
+// metadata returns the EntityDescriptor of the identity provider
+func (s *samlSigner) metadata(entityId, ssoUrl string) []byte {
+	b := &bytes.Buffer{}
+	b.WriteString(xml.Header)
+	b.WriteString(`<md:EntityDescriptor xmlns:md="` + samlNsMetadata + `" xmlns:ds="` + samlNsDsig + `"`)
+	writeSamlAttr(b, "entityID", entityId)
+	b.WriteString(">")
+	b.WriteString(`<md:IDPSSODescriptor WantAuthnRequestsSigned="false" protocolSupportEnumeration="` + samlNsProtocol + `">`)
+	b.WriteString(`<md:KeyDescriptor use="signing"><ds:KeyInfo><ds:X509Data>`)
+	writeSamlText(b, "ds:X509Certificate", s.certificate())
+	b.WriteString(`</ds:X509Data></ds:KeyInfo></md:KeyDescriptor>`)
+	writeSamlText(b, "md:NameIDFormat", samlNameIDUnspecified)
+	writeSamlText(b, "md:NameIDFormat", samlNameIDEmail)
+	for _, binding := range []string{samlBindingPost, samlBindingRedirect} {
+		b.WriteString("<md:SingleSignOnService")
+		writeSamlAttr(b, "Binding", binding)
+		writeSamlAttr(b, "Location", ssoUrl)
+		b.WriteString("></md:SingleSignOnService>")
+	}
+	b.WriteString("</md:IDPSSODescriptor></md:EntityDescriptor>")
+
+	return b.Bytes()
+}
+
+// xml writes the assertion in the exclusive canonical form: the namespace is declared on the assertion,
+// the attributes are sorted, and the empty elements have the end tags; the signature is put after the Issuer if not nil
+func (s *samlAssertion) xml(signature []byte) []byte {
+	b := &bytes.Buffer{}
+	b.WriteString(`<saml:Assertion xmlns:saml="` + samlNsAssertion + `"`)
+	writeSamlAttr(b, "ID", s.ID)
+	writeSamlAttr(b, "IssueInstant", samlTime(s.IssueInstant))
+	writeSamlAttr(b, "Version", "2.0")
+	b.WriteString(">")
+	writeSamlText(b, "saml:Issuer", s.Issuer)
+	b.Write(signature)
+
+	b.WriteString("<saml:Subject><saml:NameID")
+	writeSamlAttr(b, "Format", s.NameIDFormat)
+	b.WriteString(">")
+	b.WriteString(escapeSamlText(s.NameID))
+	b.WriteString("</saml:NameID>")
+	b.WriteString("<saml:SubjectConfirmation")
+	writeSamlAttr(b, "Method", samlConfirmBearer)
+	b.WriteString("><saml:SubjectConfirmationData")
+	if len(s.InResponseTo) > 0 {
+		writeSamlAttr(b, "InResponseTo", s.InResponseTo)
+	}
+	writeSamlAttr(b, "NotOnOrAfter", samlTime(s.NotOnOrAfter))
+	writeSamlAttr(b, "Recipient", s.Recipient)
+	b.WriteString("></saml:SubjectConfirmationData></saml:SubjectConfirmation></saml:Subject>")
+
+	b.WriteString("<saml:Conditions")
+	writeSamlAttr(b, "NotBefore", samlTime(s.IssueInstant))
+	writeSamlAttr(b, "NotOnOrAfter", samlTime(s.NotOnOrAfter))
+	b.WriteString("><saml:AudienceRestriction>")
+	writeSamlText(b, "saml:Audience", s.Audience)
+	b.WriteString("</saml:AudienceRestriction></saml:Conditions>")
+
+	b.WriteString("<saml:AuthnStatement")
+	writeSamlAttr(b, "AuthnInstant", samlTime(s.IssueInstant))
+	writeSamlAttr(b, "SessionIndex", s.SessionIndex)
+	b.WriteString("><saml:AuthnContext>")
+	writeSamlText(b, "saml:AuthnContextClassRef", samlAuthnPassword)
+	b.WriteString("</saml:AuthnContext></saml:AuthnStatement>")
+
+	if len(s.Attributes) > 0 {
+		b.WriteString("<saml:AttributeStatement>")
+		for _, attribute := range s.Attributes {
+			b.WriteString("<saml:Attribute")
+			writeSamlAttr(b, "Name", attribute.Name)
+			writeSamlAttr(b, "NameFormat", samlAttrNameBasic)
+			b.WriteString(">")
+			for _, value := range attribute.Values {
+				writeSamlText(b, "saml:AttributeValue", value)
+			}
+			b.WriteString("</saml:Attribute>")
+		}
+		b.WriteString("</saml:AttributeStatement>")
+	}
+
+	b.WriteString("</saml:Assertion>")
+
+	return b.Bytes()
+}
+
+func samlSignedInfo(id, digest string) string {
+	b := &strings.Builder{}
+	b.WriteString("<ds:SignedInfo>")
+	b.WriteString(`<ds:CanonicalizationMethod Algorithm="` + samlAlgExcC14n + `"></ds:CanonicalizationMethod>`)
+	b.WriteString(`<ds:SignatureMethod Algorithm="` + samlAlgRsaSha256 + `"></ds:SignatureMethod>`)
+	b.WriteString(`<ds:Reference URI="#` + escapeSamlAttr(id) + `"><ds:Transforms>`)
+	b.WriteString(`<ds:Transform Algorithm="` + samlAlgEnveloped + `"></ds:Transform>`)
+	b.WriteString(`<ds:Transform Algorithm="` + samlAlgExcC14n + `"></ds:Transform>`)
+	b.WriteString(`</ds:Transforms><ds:DigestMethod Algorithm="` + samlAlgSha256 + `"></ds:DigestMethod>`)
+	b.WriteString("<ds:DigestValue>" + digest + "</ds:DigestValue>")
+	b.WriteString("</ds:Reference></ds:SignedInfo>")
+
+	return b.String()
+}
+
+// parseSamlRequest decodes the SAMLRequest parameter, which is deflated for the HTTP-Redirect binding
+func parseSamlRequest(value string, deflated bool) (*samlAuthnRequest, error) {
+	data, err := base64.StdEncoding.DecodeString(strings.TrimSpace(value))
+	if err != nil {
+		return nil, fmt.Errorf("SAMLRequest不是有效的base64: %s", err.Error())
+	}
+	if deflated {
+		reader := flate.NewReader(bytes.NewReader(data))
+		data, err = io.ReadAll(io.LimitReader(reader, samlRequestLimit))
+		reader.Close()
+		if err != nil {
+			return nil, fmt.Errorf("SAMLRequest解压失败: %s", err.Error())
+		}
+	}
+
+	request := &samlAuthnRequest{}
+	err = xml.Unmarshal(data, request)
+	if err != nil {
+		return nil, fmt.Errorf("SAMLRequest不是有效的认证请求(AuthnRequest): %s", err.Error())
+	}
+	if request.Version != "2.0" {
+		return nil, fmt.Errorf("不支持的SAML版本: %s", request.Version)
+	}
+	if len(request.ID) < 1 {
+		return nil, fmt.Errorf("认证请求缺少ID")
+	}
+	request.Issuer = strings.TrimSpace(request.Issuer)
+
+	return request, nil
+}
+
+// newSamlID returns the random identifier, which starts with "_" as an xsd:ID can not start with a digit
+func newSamlID() (string, error) {
+	buf := make([]byte, 20)
+	_, err := rand.Read(buf)
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("_%x", buf), nil
+}
+
+func samlTime(t time.Time) string {
+	return t.UTC().Format(samlTimeFormat)
+}
+
+func writeSamlAttr(b *bytes.Buffer, name, value string) {
+	b.WriteString(" " + name + `="` + escapeSamlAttr(value) + `"`)
+}
+
+func writeSamlText(b io.StringWriter, name, value string) {
+	b.WriteString("<" + name + ">" + escapeSamlText(value) + "</" + name + ">")
+}
+
+// escapeSamlText escapes the text node as the canonical XML, the characters not allowed in XML are dropped
+func escapeSamlText(v string) string {
+	b := &strings.Builder{}
+	for _, r := range v {
+		switch r {
+		case '&':
+			b.WriteString("&amp;")
+		case '<':
+			b.WriteString("&lt;")
+		case '>':
+			b.WriteString("&gt;")
+		case '\r':
+			b.WriteString("&#xD;")
+		default:
+			if isSamlChar(r) {
+				b.WriteRune(r)
+			}
+		}
+	}
+
+	return b.String()
+}
+
+// escapeSamlAttr escapes the attribute value as the canonical XML, the characters not allowed in XML are dropped
+func escapeSamlAttr(v string) string {
+	b := &strings.Builder{}
+	for _, r := range v {
+		switch r {
+		case '&':
+			b.WriteString("&amp;")
+		case '<':
+			b.WriteString("&lt;")
+		case '"':
+			b.WriteString("&quot;")
+		case '\t':
+			b.WriteString("&#x9;")
+		case '\n':
+			b.WriteString("&#xA;")
+		case '\r':
+			b.WriteString("&#xD;")
+		default:
+			if isSamlChar(r) {
+				b.WriteRune(r)
+			}
+		}
+	}
+
+	return b.String()
+}
+
+func isSamlChar(r rune) bool {
+	return r == '\t' || r == '\n' || r == '\r' ||
+		(r >= 0x20 && r <= 0xD7FF) || (r >= 0xE000 && r <= 0xFFFD) || (r >= 0x10000 && r <= 0x10FFFF)
+}
@@ -0,0 +1,283 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"github.com/csby/goa/controller"
+	"github.com/csby/goa/data/model"
+	"github.com/csby/goa/data/socket"
+	"github.com/csby/gwsf/gtype"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	authCatalogSession = "会话管理"
+)
+
+func (s *Ad) GetSessions(ctx gtype.Context, ps gtype.Params) {
+	token := s.GetToken(ctx.Token())
+	if token == nil {
+		ctx.Error(gtype.ErrTokenInvalid)
+		return
+	}
+
+	ctx.Success(s.getSessions(token.UserAccount, token.ID))
+}
+
+func (s *Ad) GetSessionsDoc(doc gtype.Doc, method string, uri gtype.Uri) {
+	catalog := s.createCatalog(doc, authCatalogAd, authCatalogSession)
+	function := catalog.AddFunction(method, uri, "获取本人会话")
+	function.SetNote("获取当前用户所有有效的会话(登录凭证), 按登录时间倒序排列")
+	function.SetOutputDataExample([]*model.AuthSession{
+		{
+			ID:         "8d4f0c6b2e9a17355c0b7e1fa2d93c64",
+			Account:    "zhangsan",
+			Name:       "张三",
+			LoginIP:    "192.168.1.100",
+			LoginTime:  gtype.DateTime(time.Now().Add(-time.Hour)),
+			ActiveTime: gtype.DateTime(time.Now()),
+			Connected:  true,
+			Current:    true,
+		},
+	})
+	function.AddOutputError(gtype.ErrTokenInvalid)
+}
+
+func (s *Ad) RevokeSession(ctx gtype.Context, ps gtype.Params) {
+	token := s.GetToken(ctx.Token())
+	if token == nil {
+		ctx.Error(gtype.ErrTokenInvalid)
+		return
+	}
+
+	argument := &model.AuthSessionRevoke{}
+	err := ctx.GetJson(argument)
+	if err != nil {
+		ctx.Error(gtype.ErrInput, err)
+		return
+	}
+	if len(argument.ID) < 1 {
+		ctx.Error(gtype.ErrInput, "会话ID(id)为空")
+		return
+	}
+
+	count := s.revokeSessions(token.UserAccount, argument.ID, socket.WSUserLogout)
+	if count < 1 {
+		ctx.Error(gtype.ErrInput, fmt.Sprintf("会话(id=%s)不存在或已失效", argument.ID))
+		return
+	}
+
+	ctx.Success(nil)
+}
+
+func (s *Ad) RevokeSessionDoc(doc gtype.Doc, method string, uri gtype.Uri) {
+	catalog := s.createCatalog(doc, authCatalogAd, authCatalogSession)
+	function := catalog.AddFunction(method, uri, "注销本人会话")
+	function.SetNote("注销当前用户的指定会话, 使其登录凭证及刷新凭证失效, 并向该会话的消息推送连接发送注销消息后关闭连接; " +
+		"注销当前会话等同于退出登录")
+	function.SetInputJsonExample(&model.AuthSessionRevoke{
+		ID: "8d4f0c6b2e9a17355c0b7e1fa2d93c64",
+	})
+	function.SetOutputDataExample(nil)
+	function.AddOutputError(gtype.ErrInput)
+	function.AddOutputError(gtype.ErrTokenInvalid)
+}
+
+func (s *Ad) GetUserSessions(ctx gtype.Context, ps gtype.Params) {
+	token := s.GetToken(ctx.Token())
+	if token == nil {
+		ctx.Error(gtype.ErrTokenInvalid)
+		return
+	}
+	if !s.IsAdmin(token.UserAccount) {
+		ctx.Error(gtype.ErrNoPermission, "需要管理员权限才能查看用户会话")
+		return
+	}
+
+	argument := &model.AuthSessionFilter{}
+	err := ctx.GetJson(argument)
+	if err != nil {
+		ctx.Error(gtype.ErrInput, err)
+		return
+	}
+
+	accounts := []string{strings.TrimSpace(argument.Account)}
+	if len(accounts[0]) < 1 {
+		accounts = s.Tdb.GetAccounts()
+	}
+	results := make([]*model.AuthSession, 0)
+	for _, account := range accounts {
+		results = append(results, s.getSessions(account, token.ID)...)
+	}
+	sort.SliceStable(results, func(i, j int) bool {
+		return strings.ToLower(results[i].Account) < strings.ToLower(results[j].Account)
+	})
+
+	ctx.Success(results)
+}
+
+func (s *Ad) GetUserSessionsDoc(doc gtype.Doc, method string, uri gtype.Uri) {
+	catalog := s.createCatalog(doc, authCatalogAd, authCatalogSession)
+	function := catalog.AddFunction(method, uri, "获取用户会话")
+	function.SetNote("获取指定用户或全部用户有效的会话(登录凭证), 按用户帐号排列, 同一用户按登录时间倒序排列")
+	function.SetRemark("需要管理员权限")
+	function.SetInputJsonExample(&model.AuthSessionFilter{
+		Account: "zhangsan",
+	})
+	function.SetOutputDataExample([]*model.AuthSession{
+		{
+			ID:         "8d4f0c6b2e9a17355c0b7e1fa2d93c64",
+			Account:    "zhangsan",
+			Name:       "张三",
+			LoginIP:    "192.168.1.100",
+			LoginTime:  gtype.DateTime(time.Now().Add(-time.Hour)),
+			ActiveTime: gtype.DateTime(time.Now()),
+			Connected:  false,
+			Current:    false,
+		},
+	})
+	function.AddOutputError(gtype.ErrInput)
+	function.AddOutputError(gtype.ErrTokenInvalid)
+	function.AddOutputError(gtype.ErrNoPermission)
+}
+
+func (s *Ad) KillUserSessions(ctx gtype.Context, ps gtype.Params) {
+	token := s.GetToken(ctx.Token())
+	if token == nil {
+		ctx.Error(gtype.ErrTokenInvalid)
+		return
+	}
+	if !s.IsAdmin(token.UserAccount) {
+		ctx.Error(gtype.ErrNoPermission, "需要管理员权限才能注销用户会话")
+		return
+	}
+
+	argument := &model.AuthSessionKill{}
+	err := ctx.GetJson(argument)
+	if err != nil {
+		ctx.Error(gtype.ErrInput, err)
+		return
+	}
+	argument.Account = strings.TrimSpace(argument.Account)
+	if len(argument.Account) < 1 {
+		ctx.Error(gtype.ErrInput, "用户帐号(account)为空")
+		return
+	}
+
+	count := s.revokeSessions(argument.Account, argument.ID, socket.WSUserLogout)
+	if len(argument.ID) > 0 && count < 1 {
+		ctx.Error(gtype.ErrInput, fmt.Sprintf("会话(id=%s)不存在或已失效", argument.ID))
+		return
+	}
+	s.LogInfo(fmt.Sprintf("%d session(s) of %s revoked by %s", count, argument.Account, token.UserAccount))
+
+	ctx.Success(count)
+}
+
+func (s *Ad) KillUserSessionsDoc(doc gtype.Doc, method string, uri gtype.Uri) {
+	catalog := s.createCatalog(doc, authCatalogAd, authCatalogSession)
+	function := catalog.AddFunction(method, uri, "注销用户会话")
+	function.SetNote("注销指定用户的指定会话或全部会话, 使其登录凭证及刷新凭证失效, 并向这些会话的消息推送连接发送注销消息后关闭连接, " +
+		"返回注销的会话数量")
+	function.SetRemark("需要管理员权限")
+	function.SetInputJsonExample(&model.AuthSessionKill{
+		Account: "zhangsan",
+		ID:      "8d4f0c6b2e9a17355c0b7e1fa2d93c64",
+	})
+	function.SetOutputDataExample(1)
+	function.AddOutputError(gtype.ErrInput)
+	function.AddOutputError(gtype.ErrTokenInvalid)
+	function.AddOutputError(gtype.ErrNoPermission)
+}
+
+// getSessions returns the sessions of the account in the order of login time descending,
+// current is the token id of the request
+func (s *Ad) getSessions(account, current string) []*model.AuthSession {
+	tokens := s.Tdb.GetTokens(account)
+	sort.Slice(tokens, func(i, j int) bool {
+		return tokens[i].LoginTime.After(tokens[j].LoginTime)
+	})
+
+	results := make([]*model.AuthSession, 0, len(tokens))
+	for _, token := range tokens {
+		results = append(results, s.toSession(token, current))
+	}
+
+	return results
+}
+
+// revokeSessions revokes the session of the account, or all sessions if id is empty,
+// the channels of the sessions receive the message and then are closed; the count of the revoked sessions is returned
+func (s *Ad) revokeSessions(account, id string, messageId int) int {
+	count := 0
+	tokens := s.Tdb.GetTokens(account)
+	for _, token := range tokens {
+		if len(id) > 0 && sessionId(token.ID) != id {
+			continue
+		}
+		s.revokeSession(token, messageId)
+		count++
+	}
+
+	return count
+}
+
+func (s *Ad) revokeSession(token *gtype.Token, messageId int) {
+	s.CloseWebSocketSession(messageId, s.toSession(token, ""), token)
+	s.Tdb.Del(token.ID)
+	s.deleteRefreshTokens(token.ID)
+}
+
+// limitSessions revokes the earliest sessions of the account if the count exceeds the limit (config: auth.session.limit)
+func (s *Ad) limitSessions(account string) {
+	if s.Cfg == nil || s.Cfg.Auth.Session.Limit < 1 {
+		return
+	}
+
+	// the impersonation sessions are not counted, they are ended by the admins or expired soon
+	tokens := make([]*gtype.Token, 0)
+	for _, token := range s.Tdb.GetTokens(account) {
+		if controller.ImpersonationOf(token) == nil {
+			tokens = append(tokens, token)
+		}
+	}
+	count := len(tokens) - s.Cfg.Auth.Session.Limit
+	if count < 1 {
+		return
+	}
+	sort.Slice(tokens, func(i, j int) bool {
+		return tokens[i].LoginTime.Before(tokens[j].LoginTime)
+	})
+	for i := 0; i < count; i++ {
+		s.revokeSession(tokens[i], socket.WSUserKicked)
+	}
+	s.LogInfo(fmt.Sprintf("%d earliest session(s) of %s revoked for the limit of %d", count, account, s.Cfg.Auth.Session.Limit))
+}
+
+func (s *Ad) toSession(token *gtype.Token, current string) *model.AuthSession {
+	session := &model.AuthSession{
+		ID:         sessionId(token.ID),
+		Account:    token.UserAccount,
+		Name:       token.UserName,
+		LoginIP:    token.LoginIP,
+		LoginTime:  gtype.DateTime(token.LoginTime),
+		ActiveTime: gtype.DateTime(s.Tdb.GetActiveTime(token)),
+		Connected:  s.Tdb.IsConnected(token.ID),
+		Current:    len(current) > 0 && token.ID == current,
+	}
+	impersonation := controller.ImpersonationOf(token)
+	if impersonation != nil {
+		session.Impersonator = impersonation.Admin
+	}
+
+	return session
+}
+
+// sessionId returns the id of the session published to the users, the token id itself is a credential and never published
+func sessionId(tokenId string) string {
+	sum := sha256.Sum256([]byte(tokenId))
+	return hex.EncodeToString(sum[:16])
+}
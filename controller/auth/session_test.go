@@ -0,0 +1,95 @@
+package auth
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/csby/goa/assist"
+	"github.com/csby/goa/config"
+	"github.com/csby/goa/controller"
+	"github.com/csby/goa/data/storage/storagetest"
+	"testing"
+	"time"
+)
+
+func newTestSessionAd(t *testing.T, limit int) *Ad {
+	dbs := storagetest.Open(t)
+
+	store, err := controller.NewTokenStore(dbs, 30, bytes.Repeat([]byte{1}, 32), func() interface{} {
+		return &assist.AdEntryUser{}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := config.NewConfig()
+	cfg.Auth.Session.Limit = limit
+
+	return NewAd(nil, &controller.Parameter{Cfg: cfg, Dbs: dbs, Tdb: controller.NewTokenDatabase(store)})
+}
+
+func TestAd_LimitSessions(t *testing.T) {
+	s := newTestSessionAd(t, 2)
+	user := &assist.AdEntryUser{Account: "zhangsan"}
+	user.Name = "张三"
+
+	ids := make([]string, 0)
+	for i := 0; i < 3; i++ {
+		login, err := s.CreateLogin(user, fmt.Sprintf("192.168.1.%d", i+1))
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, login.Token)
+		time.Sleep(time.Millisecond)
+	}
+
+	sessions := s.getSessions("zhangsan", ids[2])
+	if len(sessions) != 2 {
+		t.Fatalf("expected 2 sessions, got %d", len(sessions))
+	}
+	if sessions[0].LoginIP != "192.168.1.3" || !sessions[0].Current {
+		t.Errorf("unexpected latest session: %+v", sessions[0])
+	}
+	if sessions[1].LoginIP != "192.168.1.2" || sessions[1].Current {
+		t.Errorf("unexpected second session: %+v", sessions[1])
+	}
+	if s.GetToken(ids[0]) != nil {
+		t.Error("the earliest session should be revoked")
+	}
+	if sessions[0].ID == ids[2] || len(sessions[0].ID) != 32 {
+		t.Error("session id should not be the token")
+	}
+}
+
+func TestAd_RevokeSessions(t *testing.T) {
+	s := newTestSessionAd(t, 0)
+
+	tokens := make([]string, 0)
+	for _, account := range []string{"zhangsan", "zhangsan", "lisi"} {
+		login, err := s.CreateLogin(&assist.AdEntryUser{Account: account}, "192.168.1.100")
+		if err != nil {
+			t.Fatal(err)
+		}
+		tokens = append(tokens, login.Token)
+	}
+
+	if count := s.revokeSessions("lisi", sessionId(tokens[0]), 0); count != 0 {
+		t.Error("session of the other account should not be revoked")
+	}
+	if count := s.revokeSessions("zhangsan", sessionId(tokens[0]), 0); count != 1 {
+		t.Errorf("expected 1 session revoked, got %d", count)
+	}
+	if s.GetToken(tokens[0]) != nil || s.GetToken(tokens[1]) == nil {
+		t.Error("only the specified session should be revoked")
+	}
+	if count := s.revokeSessions("ZhangSan", "", 0); count != 1 {
+		t.Errorf("expected 1 session revoked, got %d", count)
+	}
+	if s.GetToken(tokens[2]) == nil {
+		t.Error("session of the other account should be kept")
+	}
+
+	token := s.GetToken(tokens[2])
+	if s.toSession(token, "").Connected {
+		t.Error("session should not be connected")
+	}
+}
@@ -0,0 +1,688 @@
+package auth
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"github.com/csby/goa/assist"
+	"github.com/csby/goa/data/model"
+	"github.com/csby/gwsf/gtype"
+	"strings"
+	"time"
+)
+
+const (
+	authCatalogTotp = "两步验证"
+
+	totpBucket             = "totp"
+	totpTicketExpiration   = 5 * time.Minute
+	totpTicketMaxAttempts  = 5
+	totpRecoveryCodeCount  = 10
+	totpRecoveryCodeLength = 8
+)
+
+// totpTicket is issued after the password is verified, the token is issued after the code is verified with the ticket
+type totpTicket struct {
+	user       *assist.AdEntryUser
+	ip         string
+	attempts   int
+	expireTime time.Time
+}
+
+func (s *Ad) TotpLogin(ctx gtype.Context, ps gtype.Params) {
+	argument := &model.TotpLogin{}
+	err := ctx.GetJson(argument)
+	if err != nil {
+		ctx.Error(gtype.ErrInput, err)
+		return
+	}
+
+	user, ip, be, err := s.verifyTotpLogin(ctx, argument)
+	if be != nil {
+		ctx.Error(be, err)
+		return
+	}
+
+	login, err := s.CreateLogin(user, ip)
+	if err != nil {
+		ctx.Error(gtype.ErrInternal, err)
+		return
+	}
+	s.clearErrorCount(user.Account)
+
+	ctx.Success(login)
+}
+
+func (s *Ad) TotpLoginDoc(doc gtype.Doc, method string, uri gtype.Uri) {
+	catalog := s.createCatalog(doc, authCatalogAd, authCatalogTotp)
+	function := catalog.AddFunction(method, uri, "验证登录")
+	function.SetNote("登录的第二步: 使用登录返回的票据(totpTicket)及验证码(或恢复码)完成登录并获取凭证; 每个验证码及恢复码只能使用一次")
+	function.SetRemark("该接口不需要凭证; 每个票据最多尝试5次")
+	function.SetInputJsonExample(&model.TotpLogin{
+		TotpTicket: model.TotpTicket{
+			Ticket: "Q2xk0lR3m1vJt8nS5pZ6bY7cX9aW0eD4fG2hK1jL3k",
+		},
+		Code: "287082",
+	})
+	function.SetOutputDataExample(&model.AuthLogin{
+		Login: gtype.Login{
+			Token:   "71b9b7e2ac6d4166b18f414942ff3481",
+			Account: "zhangsan",
+			Name:    "张三",
+		},
+	})
+	function.AddOutputError(gtype.ErrInput)
+	function.AddOutputError(gtype.ErrInternal)
+	function.AddOutputError(gtype.ErrTokenInvalid)
+	function.AddOutputError(gtype.ErrLoginPasswordInvalid)
+	function.AddOutputError(gtype.ErrNoPermission)
+}
+
+func (s *Ad) TotpEnroll(ctx gtype.Context, ps gtype.Params) {
+	argument := &model.TotpTicket{}
+	err := ctx.GetJson(argument)
+	if err != nil {
+		ctx.Error(gtype.ErrInput, err)
+		return
+	}
+
+	account, _, be := s.getTotpAccount(ctx, argument.Ticket)
+	if be != nil {
+		ctx.Error(be)
+		return
+	}
+
+	item, err := s.getTotp(account)
+	if err != nil {
+		ctx.Error(gtype.ErrInternal, err)
+		return
+	}
+	if item != nil && item.Enabled {
+		ctx.Error(gtype.ErrExist.SetDetail("已启用两步验证, 如需更换验证器请先停用"))
+		return
+	}
+
+	secret, err := assist.NewTotpSecret()
+	if err != nil {
+		ctx.Error(gtype.ErrInternal, err)
+		return
+	}
+	encrypted, err := s.encryptTotpSecret(secret)
+	if err != nil {
+		ctx.Error(gtype.ErrInternal, err)
+		return
+	}
+	err = s.Dbs.Put(totpBucket, strings.ToLower(account), &model.TotpSecret{
+		Account:    account,
+		Secret:     encrypted,
+		Enabled:    false,
+		CreateTime: gtype.DateTime(time.Now()),
+	})
+	if err != nil {
+		ctx.Error(gtype.ErrInternal, err)
+		return
+	}
+
+	ctx.Success(&model.TotpEnrollment{
+		Secret: secret,
+		Uri:    assist.TotpUri(s.Cfg.Auth.Totp.Issuer, account, secret),
+	})
+}
+
+func (s *Ad) TotpEnrollDoc(doc gtype.Doc, method string, uri gtype.Uri) {
+	catalog := s.createCatalog(doc, authCatalogAd, authCatalogTotp)
+	function := catalog.AddFunction(method, uri, "绑定验证器")
+	function.SetNote("生成新的验证密钥及配置地址(otpauth://), 页面将配置地址显示为二维码供验证器应用扫描, 随后提交验证码启用(/auth/ad/totp/enable); " +
+		"已登录时使用当前凭证, 登录过程中(强制两步验证但尚未启用)使用登录返回的票据")
+	function.SetRemark("该接口不需要凭证, 但须提供凭证或票据")
+	function.SetInputJsonExample(&model.TotpTicket{
+		Ticket: "Q2xk0lR3m1vJt8nS5pZ6bY7cX9aW0eD4fG2hK1jL3k",
+	})
+	function.SetOutputDataExample(&model.TotpEnrollment{
+		Secret: "JBSWY3DPEHPK3PXPJBSWY3DPEHPK3PXP",
+		Uri:    "otpauth://totp/goa:zhangsan?algorithm=SHA1&digits=6&issuer=goa&period=30&secret=JBSWY3DPEHPK3PXPJBSWY3DPEHPK3PXP",
+	})
+	function.AddOutputError(gtype.ErrInput)
+	function.AddOutputError(gtype.ErrInternal)
+	function.AddOutputError(gtype.ErrTokenInvalid)
+	function.AddOutputError(gtype.ErrExist)
+}
+
+func (s *Ad) TotpEnable(ctx gtype.Context, ps gtype.Params) {
+	argument := &model.TotpEnable{}
+	err := ctx.GetJson(argument)
+	if err != nil {
+		ctx.Error(gtype.ErrInput, err)
+		return
+	}
+
+	account, ticket, be := s.getTotpAccount(ctx, argument.Ticket)
+	if be != nil {
+		ctx.Error(be)
+		return
+	}
+
+	codes, hashes, err := newTotpRecoveryCodes()
+	if err != nil {
+		ctx.Error(gtype.ErrInternal, err)
+		return
+	}
+
+	item := &model.TotpSecret{}
+	err = s.Dbs.Modify(totpBucket, strings.ToLower(account), item, func(existed bool) error {
+		if !existed {
+			return fmt.Errorf("请先绑定验证器")
+		}
+		if item.Enabled {
+			return fmt.Errorf("已启用两步验证")
+		}
+		secret, err := s.decryptTotpSecret(item.Secret)
+		if err != nil {
+			return err
+		}
+		step, ok := assist.VerifyTotp(secret, argument.Code, time.Now(), 1)
+		if !ok {
+			return fmt.Errorf("验证码错误, 请确认验证器及本机时间正确")
+		}
+
+		now := gtype.DateTime(time.Now())
+		item.Enabled = true
+		item.EnableTime = &now
+		item.LastStep = step
+		item.RecoveryCodes = hashes
+		return nil
+	})
+	if err != nil {
+		if ticket != nil {
+			s.failTotpTicket(argument.Ticket)
+		}
+		ctx.Error(gtype.ErrInput, err)
+		return
+	}
+
+	result := &model.TotpEnabled{
+		RecoveryCodes: codes,
+	}
+	if ticket != nil {
+		s.deleteTotpTicket(argument.Ticket)
+		result.Login, err = s.CreateLogin(ticket.user, ticket.ip)
+		if err != nil {
+			ctx.Error(gtype.ErrInternal, err)
+			return
+		}
+	}
+
+	ctx.Success(result)
+}
+
+func (s *Ad) TotpEnableDoc(doc gtype.Doc, method string, uri gtype.Uri) {
+	catalog := s.createCatalog(doc, authCatalogAd, authCatalogTotp)
+	function := catalog.AddFunction(method, uri, "启用")
+	function.SetNote("提交验证器应用中的验证码启用两步验证, 返回10个恢复码(仅显示一次); 登录过程中使用票据启用时同时完成登录并返回凭证")
+	function.SetRemark("该接口不需要凭证, 但须提供凭证或票据")
+	function.SetInputJsonExample(&model.TotpEnable{
+		Code: "287082",
+	})
+	function.SetOutputDataExample(&model.TotpEnabled{
+		RecoveryCodes: []string{"k7dq-m2xa", "p4zt-w9ce"},
+	})
+	function.AddOutputError(gtype.ErrInput)
+	function.AddOutputError(gtype.ErrInternal)
+	function.AddOutputError(gtype.ErrTokenInvalid)
+}
+
+func (s *Ad) TotpDisable(ctx gtype.Context, ps gtype.Params) {
+	token := s.GetToken(ctx.Token())
+	if token == nil {
+		ctx.Error(gtype.ErrTokenInvalid)
+		return
+	}
+
+	argument := &model.TotpCode{}
+	err := ctx.GetJson(argument)
+	if err != nil {
+		ctx.Error(gtype.ErrInput, err)
+		return
+	}
+
+	required, err := s.inTotpGroups(token.UserAccount)
+	if err != nil {
+		ctx.Error(gtype.ErrInternal, err)
+		return
+	}
+	if required {
+		ctx.Error(gtype.ErrNoPermission.SetDetail("所在的组强制两步验证, 不能停用"))
+		return
+	}
+	err = s.verifyTotp(token.UserAccount, argument.Code)
+	if err != nil {
+		s.increaseErrorCount(ctx.RIP(), token.UserAccount)
+		ctx.Error(gtype.ErrInput, err)
+		return
+	}
+	err = s.Dbs.Delete(totpBucket, strings.ToLower(token.UserAccount))
+	if err != nil {
+		ctx.Error(gtype.ErrInternal, err)
+		return
+	}
+
+	ctx.Success(nil)
+}
+
+func (s *Ad) TotpDisableDoc(doc gtype.Doc, method string, uri gtype.Uri) {
+	catalog := s.createCatalog(doc, authCatalogAd, authCatalogTotp)
+	function := catalog.AddFunction(method, uri, "停用")
+	function.SetNote("验证后停用当前用户的两步验证, 强制两步验证的用户不能停用")
+	function.SetInputJsonExample(&model.TotpCode{
+		Code: "287082",
+	})
+	function.SetOutputDataExample(nil)
+	function.AddOutputError(gtype.ErrInput)
+	function.AddOutputError(gtype.ErrInternal)
+	function.AddOutputError(gtype.ErrTokenInvalid)
+	function.AddOutputError(gtype.ErrNoPermission)
+}
+
+func (s *Ad) ResetTotpRecoveryCodes(ctx gtype.Context, ps gtype.Params) {
+	token := s.GetToken(ctx.Token())
+	if token == nil {
+		ctx.Error(gtype.ErrTokenInvalid)
+		return
+	}
+
+	argument := &model.TotpCode{}
+	err := ctx.GetJson(argument)
+	if err != nil {
+		ctx.Error(gtype.ErrInput, err)
+		return
+	}
+
+	err = s.verifyTotp(token.UserAccount, argument.Code)
+	if err != nil {
+		s.increaseErrorCount(ctx.RIP(), token.UserAccount)
+		ctx.Error(gtype.ErrInput, err)
+		return
+	}
+	codes, hashes, err := newTotpRecoveryCodes()
+	if err != nil {
+		ctx.Error(gtype.ErrInternal, err)
+		return
+	}
+	item := &model.TotpSecret{}
+	err = s.Dbs.Modify(totpBucket, strings.ToLower(token.UserAccount), item, func(existed bool) error {
+		if !existed || !item.Enabled {
+			return fmt.Errorf("未启用两步验证")
+		}
+		item.RecoveryCodes = hashes
+		return nil
+	})
+	if err != nil {
+		ctx.Error(gtype.ErrInternal, err)
+		return
+	}
+
+	ctx.Success(&model.TotpEnabled{
+		RecoveryCodes: codes,
+	})
+}
+
+func (s *Ad) ResetTotpRecoveryCodesDoc(doc gtype.Doc, method string, uri gtype.Uri) {
+	catalog := s.createCatalog(doc, authCatalogAd, authCatalogTotp)
+	function := catalog.AddFunction(method, uri, "重新生成恢复码")
+	function.SetNote("验证后重新生成10个恢复码, 原有恢复码全部失效")
+	function.SetInputJsonExample(&model.TotpCode{
+		Code: "287082",
+	})
+	function.SetOutputDataExample(&model.TotpEnabled{
+		RecoveryCodes: []string{"k7dq-m2xa", "p4zt-w9ce"},
+	})
+	function.AddOutputError(gtype.ErrInput)
+	function.AddOutputError(gtype.ErrInternal)
+	function.AddOutputError(gtype.ErrTokenInvalid)
+}
+
+func (s *Ad) GetTotpStatus(ctx gtype.Context, ps gtype.Params) {
+	token := s.GetToken(ctx.Token())
+	if token == nil {
+		ctx.Error(gtype.ErrTokenInvalid)
+		return
+	}
+
+	item, err := s.getTotp(token.UserAccount)
+	if err != nil {
+		ctx.Error(gtype.ErrInternal, err)
+		return
+	}
+
+	required, err := s.inTotpGroups(token.UserAccount)
+	if err != nil {
+		ctx.Error(gtype.ErrInternal, err)
+		return
+	}
+
+	status := &model.TotpStatus{
+		Required: required,
+	}
+	if item != nil && item.Enabled {
+		status.Enabled = true
+		status.RecoveryCodes = len(item.RecoveryCodes)
+	}
+
+	ctx.Success(status)
+}
+
+func (s *Ad) GetTotpStatusDoc(doc gtype.Doc, method string, uri gtype.Uri) {
+	catalog := s.createCatalog(doc, authCatalogAd, authCatalogTotp)
+	function := catalog.AddFunction(method, uri, "获取状态")
+	function.SetNote("获取当前用户的两步验证状态")
+	function.SetOutputDataExample(&model.TotpStatus{
+		Enabled:       true,
+		Required:      true,
+		RecoveryCodes: 9,
+	})
+	function.AddOutputError(gtype.ErrInternal)
+	function.AddOutputError(gtype.ErrTokenInvalid)
+}
+
+// verifyTotpLogin checks the code of the totp ticket, the ticket is removed if the code is valid,
+// the user and the ip of the first step are returned, the failures are cleared by the caller after the login is completed
+func (s *Ad) verifyTotpLogin(ctx gtype.Context, argument *model.TotpLogin) (*assist.AdEntryUser, string, gtype.Error, error) {
+	ticket := s.getTotpTicket(argument.Ticket, ctx.RIP())
+	if ticket == nil {
+		return nil, "", gtype.ErrTokenInvalid, fmt.Errorf("票据无效或已过期, 请重新登录")
+	}
+
+	be, err := s.checkLocked(ctx.RIP(), ticket.user.Account)
+	if be != nil {
+		return nil, "", be, err
+	}
+	err = s.verifyTotp(ticket.user.Account, argument.Code)
+	if err != nil {
+		s.failTotpTicket(argument.Ticket)
+		s.increaseErrorCount(ctx.RIP(), ticket.user.Account)
+		return nil, "", gtype.ErrLoginPasswordInvalid, err
+	}
+	s.deleteTotpTicket(argument.Ticket)
+
+	return ticket.user, ticket.ip, nil, nil
+}
+
+// checkTotp returns whether the second factor is required for the user, and whether the user has enabled it
+func (s *Ad) checkTotp(user *assist.AdEntryUser) (bool, bool, error) {
+	if s.Cfg == nil || !s.Cfg.Auth.Totp.Enabled {
+		return false, false, nil
+	}
+	if s.totpAead == nil {
+		return false, false, fmt.Errorf("两步验证配置错误: 密钥(auth.totp.key)无效")
+	}
+
+	item, err := s.getTotp(user.Account)
+	if err != nil {
+		return false, false, err
+	}
+	if item != nil && item.Enabled {
+		return true, true, nil
+	}
+
+	required, err := s.inTotpGroups(user.Account)
+	if err != nil {
+		return false, false, err
+	}
+
+	return required, false, nil
+}
+
+// inTotpGroups returns true if the account is a member (including nested) of any group which enforces the second factor,
+// an error is returned if the groups can not be read, so that the second factor is not skipped by mistake
+func (s *Ad) inTotpGroups(account string) (bool, error) {
+	if s.Cfg == nil || len(s.Cfg.Auth.Totp.Groups) < 1 {
+		return false, nil
+	}
+
+	ad := s.Ad()
+	user, err := ad.GetUser(account)
+	if err != nil {
+		return false, fmt.Errorf("获取用户(%s)信息失败: %v", account, err)
+	}
+	groups, err := ad.GetMemberGroups(user.DN, true)
+	if err != nil {
+		s.LogError(fmt.Sprintf("totp: get groups of %s fail: ", account), err)
+		return false, fmt.Errorf("获取用户(%s)所属组失败: %v", account, err)
+	}
+	for _, group := range groups {
+		if group == nil {
+			continue
+		}
+		for _, item := range s.Cfg.Auth.Totp.Groups {
+			if strings.ToLower(item) == strings.ToLower(group.Account) {
+				return true, nil
+			}
+		}
+	}
+
+	return false, nil
+}
+
+// getTotp returns nil if the account has not enrolled
+func (s *Ad) getTotp(account string) (*model.TotpSecret, error) {
+	if s.Dbs == nil {
+		return nil, fmt.Errorf("本地数据库不可用")
+	}
+
+	item := &model.TotpSecret{}
+	ok, err := s.Dbs.Get(totpBucket, strings.ToLower(account), item)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, nil
+	}
+
+	return item, nil
+}
+
+// verifyTotp checks the code of the authenticator app or the recovery code, each of them can be used once only
+func (s *Ad) verifyTotp(account, code string) error {
+	if s.Dbs == nil {
+		return fmt.Errorf("本地数据库不可用")
+	}
+
+	item := &model.TotpSecret{}
+	return s.Dbs.Modify(totpBucket, strings.ToLower(account), item, func(existed bool) error {
+		if !existed || !item.Enabled {
+			return fmt.Errorf("未启用两步验证")
+		}
+		secret, err := s.decryptTotpSecret(item.Secret)
+		if err != nil {
+			return err
+		}
+
+		step, ok := assist.VerifyTotp(secret, code, time.Now(), 1)
+		if ok {
+			if step <= item.LastStep {
+				return fmt.Errorf("验证码已使用, 请等待下一个验证码")
+			}
+			item.LastStep = step
+			return nil
+		}
+
+		hash := hashTotpRecoveryCode(code)
+		for i, v := range item.RecoveryCodes {
+			if v == hash {
+				item.RecoveryCodes = append(item.RecoveryCodes[:i], item.RecoveryCodes[i+1:]...)
+				return nil
+			}
+		}
+
+		return fmt.Errorf("验证码错误")
+	})
+}
+
+// getTotpAccount returns the account of the ticket if not empty, otherwise the account of current token
+func (s *Ad) getTotpAccount(ctx gtype.Context, ticket string) (string, *totpTicket, gtype.Error) {
+	if s.Cfg == nil || !s.Cfg.Auth.Totp.Enabled || s.totpAead == nil {
+		return "", nil, gtype.ErrInternal.SetDetail("未启用两步验证")
+	}
+
+	if len(ticket) > 0 {
+		t := s.getTotpTicket(ticket, ctx.RIP())
+		if t == nil {
+			return "", nil, gtype.ErrTokenInvalid.SetDetail("票据无效或已过期, 请重新登录")
+		}
+		return t.user.Account, t, nil
+	}
+
+	token := s.GetToken(ctx.Token())
+	if token == nil {
+		return "", nil, gtype.ErrTokenInvalid
+	}
+
+	return token.UserAccount, nil, nil
+}
+
+func (s *Ad) newTotpTicket(user *assist.AdEntryUser, ip string) (string, error) {
+	buf := make([]byte, 32)
+	_, err := rand.Read(buf)
+	if err != nil {
+		return "", err
+	}
+	ticket := base64.RawURLEncoding.EncodeToString(buf)
+
+	now := time.Now()
+	s.totpMutex.Lock()
+	defer s.totpMutex.Unlock()
+	for k, v := range s.totpTickets {
+		if !v.expireTime.After(now) {
+			delete(s.totpTickets, k)
+		}
+	}
+	s.totpTickets[ticket] = &totpTicket{
+		user:       user,
+		ip:         ip,
+		expireTime: now.Add(totpTicketExpiration),
+	}
+
+	return ticket, nil
+}
+
+// getTotpTicket returns nil if the ticket is invalid, expired or not issued to the ip
+func (s *Ad) getTotpTicket(ticket, ip string) *totpTicket {
+	s.totpMutex.Lock()
+	defer s.totpMutex.Unlock()
+
+	t, ok := s.totpTickets[ticket]
+	if !ok {
+		return nil
+	}
+	if !t.expireTime.After(time.Now()) || t.ip != ip {
+		return nil
+	}
+
+	return t
+}
+
+// failTotpTicket counts the failed attempt, the ticket is removed after too many attempts
+func (s *Ad) failTotpTicket(ticket string) {
+	s.totpMutex.Lock()
+	defer s.totpMutex.Unlock()
+
+	t, ok := s.totpTickets[ticket]
+	if !ok {
+		return
+	}
+	t.attempts++
+	if t.attempts >= totpTicketMaxAttempts {
+		delete(s.totpTickets, ticket)
+	}
+}
+
+func (s *Ad) deleteTotpTicket(ticket string) {
+	s.totpMutex.Lock()
+	defer s.totpMutex.Unlock()
+
+	delete(s.totpTickets, ticket)
+}
+
+func (s *Ad) encryptTotpSecret(secret string) (string, error) {
+	if s.totpAead == nil {
+		return "", fmt.Errorf("两步验证配置错误: 密钥(auth.totp.key)无效")
+	}
+
+	nonce := make([]byte, s.totpAead.NonceSize())
+	_, err := rand.Read(nonce)
+	if err != nil {
+		return "", err
+	}
+
+	return base64.StdEncoding.EncodeToString(s.totpAead.Seal(nonce, nonce, []byte(secret), nil)), nil
+}
+
+func (s *Ad) decryptTotpSecret(value string) (string, error) {
+	if s.totpAead == nil {
+		return "", fmt.Errorf("两步验证配置错误: 密钥(auth.totp.key)无效")
+	}
+
+	data, err := base64.StdEncoding.DecodeString(value)
+	if err != nil {
+		return "", err
+	}
+	size := s.totpAead.NonceSize()
+	if len(data) < size {
+		return "", fmt.Errorf("验证密钥无效")
+	}
+	secret, err := s.totpAead.Open(nil, data[:size], data[size:], nil)
+	if err != nil {
+		return "", fmt.Errorf("验证密钥解密失败: %v", err)
+	}
+
+	return string(secret), nil
+}
+
+func newTotpAead(key string) (cipher.AEAD, error) {
+	k, err := hex.DecodeString(key)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(k)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
+
+// newTotpRecoveryCodes returns the recovery codes (e.g. k7dq-m2xa) and the hashes of them
+func newTotpRecoveryCodes() ([]string, []string, error) {
+	encoding := base32.StdEncoding.WithPadding(base32.NoPadding)
+	codes := make([]string, 0, totpRecoveryCodeCount)
+	hashes := make([]string, 0, totpRecoveryCodeCount)
+	buf := make([]byte, 5)
+	for i := 0; i < totpRecoveryCodeCount; i++ {
+		_, err := rand.Read(buf)
+		if err != nil {
+			return nil, nil, err
+		}
+		value := strings.ToLower(encoding.EncodeToString(buf))[:totpRecoveryCodeLength]
+		code := value[:4] + "-" + value[4:]
+
+		codes = append(codes, code)
+		hashes = append(hashes, hashTotpRecoveryCode(code))
+	}
+
+	return codes, hashes, nil
+}
+
+// hashTotpRecoveryCode ignores the case, spaces and dashes of the code
+func hashTotpRecoveryCode(code string) string {
+	value := strings.ToLower(code)
+	value = strings.ReplaceAll(value, "-", "")
+	value = strings.ReplaceAll(value, " ", "")
+	sum := sha256.Sum256([]byte(value))
+
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,142 @@
+package auth
+
+import (
+	"github.com/csby/goa/assist"
+	"github.com/csby/goa/config"
+	"github.com/csby/goa/controller"
+	"github.com/csby/goa/data/model"
+	"github.com/csby/goa/data/storage/storagetest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestTotpAd(t *testing.T) *Ad {
+	dbs := storagetest.Open(t)
+
+	cfg := config.NewConfig()
+	cfg.Auth.Totp.Enabled = true
+	cfg.Auth.Totp.Key = strings.Repeat("01", 32)
+
+	return NewAd(nil, &controller.Parameter{Cfg: cfg, Dbs: dbs})
+}
+
+func TestAd_VerifyTotp(t *testing.T) {
+	s := newTestTotpAd(t)
+	secret, err := assist.NewTotpSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	encrypted, err := s.encryptTotpSecret(secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(encrypted, secret) {
+		t.Fatal("secret should be encrypted")
+	}
+	codes, hashes, err := newTotpRecoveryCodes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = s.Dbs.Put(totpBucket, "zhangsan", &model.TotpSecret{
+		Account:       "ZhangSan",
+		Secret:        encrypted,
+		Enabled:       true,
+		RecoveryCodes: hashes,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	code, err := assist.TotpCode(secret, assist.TotpStep(time.Now()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = s.verifyTotp("ZhangSan", code)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = s.verifyTotp("zhangsan", code)
+	if err == nil {
+		t.Error("replayed code should be refused")
+	}
+
+	err = s.verifyTotp("zhangsan", strings.ToUpper(codes[3]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = s.verifyTotp("zhangsan", codes[3])
+	if err == nil {
+		t.Error("recovery code should be used once only")
+	}
+	item, err := s.getTotp("zhangsan")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(item.RecoveryCodes) != len(codes)-1 {
+		t.Errorf("expect %d recovery codes, got %d", len(codes)-1, len(item.RecoveryCodes))
+	}
+
+	err = s.verifyTotp("lisi", code)
+	if err == nil {
+		t.Error("account not enrolled should fail")
+	}
+}
+
+func TestAd_TotpTicket(t *testing.T) {
+	s := newTestTotpAd(t)
+	user := &assist.AdEntryUser{Account: "zhangsan"}
+
+	ticket, err := s.newTotpTicket(user, "10.0.0.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.getTotpTicket(ticket, "10.0.0.2") != nil {
+		t.Error("ticket should be valid for the ip only")
+	}
+	if s.getTotpTicket(ticket, "10.0.0.1") == nil {
+		t.Fatal("ticket should be valid")
+	}
+
+	for i := 0; i < totpTicketMaxAttempts; i++ {
+		s.failTotpTicket(ticket)
+	}
+	if s.getTotpTicket(ticket, "10.0.0.1") != nil {
+		t.Error("ticket should be removed after too many attempts")
+	}
+}
+
+func TestAd_CheckTotpGroupsUnavailable(t *testing.T) {
+	s := newTestTotpAd(t)
+	s.Cfg.Ad.Host = "127.0.0.1"
+	s.Cfg.Ad.Port = 1
+	s.Cfg.Auth.Totp.Groups = []string{"vpn-users"}
+
+	_, _, err := s.checkTotp(&assist.AdEntryUser{Account: "zhangsan"})
+	if err == nil {
+		t.Error("the login should be refused if the groups can not be read")
+	}
+
+	login, err := s.requireTotp(&assist.AdEntryUser{Account: "zhangsan"}, "10.0.0.1")
+	if err == nil || login != nil {
+		t.Errorf("expected an error instead of skipping the second factor, got %v", login)
+	}
+}
+
+func TestNewTotpRecoveryCodes(t *testing.T) {
+	codes, hashes, err := newTotpRecoveryCodes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(codes) != totpRecoveryCodeCount || len(hashes) != totpRecoveryCodeCount {
+		t.Fatalf("unexpected count: %d", len(codes))
+	}
+	for i, code := range codes {
+		if len(code) != totpRecoveryCodeLength+1 || code[4] != '-' {
+			t.Errorf("unexpected code: %s", code)
+		}
+		if hashTotpRecoveryCode(" "+strings.ReplaceAll(strings.ToUpper(code), "-", "")) != hashes[i] {
+			t.Errorf("hash of %s should ignore case, spaces and dashes", code)
+		}
+	}
+}
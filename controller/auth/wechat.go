@@ -2,13 +2,59 @@ package auth
 
 import (
 	"fmt"
+	"github.com/csby/goa/controller"
+	"github.com/csby/goa/data/model"
+	"github.com/csby/goa/data/socket"
 	"github.com/csby/gwsf/gtype"
 	"github.com/csby/gwsf/gwechat"
+	"github.com/gorilla/websocket"
+	"net/http"
 	"strings"
+	"sync"
+	"time"
 )
 
+const (
+	wechatStateExpiration = 5 * time.Minute
+)
+
+func NewWechat(log gtype.Log, param *controller.Parameter) *Wechat {
+	instance := &Wechat{}
+	instance.SetLog(log)
+	instance.SetParameter(param)
+
+	instance.states = make(map[string]*wechatState)
+	instance.wsGrader = websocket.Upgrader{CheckOrigin: func(r *http.Request) bool { return true }}
+
+	instance.handlers = make(map[string][]WechatMessageHandler)
+	instance.AddMessageHandler(model.WechatEventSubscribe, instance.onScan)
+	instance.AddMessageHandler(model.WechatEventScan, instance.onScan)
+	instance.AddMessageHandler(model.WechatMsgText, instance.onVpnStatus)
+
+	return instance
+}
+
 type Wechat struct {
 	base
+
+	Authenticator *Ad
+
+	mutex    sync.Mutex
+	states   map[string]*wechatState // key: state of the QR code
+	handlers map[string][]WechatMessageHandler
+	wsGrader websocket.Upgrader
+
+	mpToken       string // access token of the official account
+	mpTokenExpire time.Time
+}
+
+// wechatState is a QR code waiting for scan, the account is not empty if it is for binding
+type wechatState struct {
+	ip         string
+	account    string
+	scanned    bool
+	result     chan *gtype.SocketMessage
+	expireTime time.Time
 }
 
 func (s *Wechat) VerifyUrl(ctx gtype.Context, ps gtype.Params) {
@@ -61,8 +107,7 @@ func (s *Wechat) VerifyUrlDoc(doc gtype.Doc, method string, uri gtype.Uri) {
 }
 
 func (s *Wechat) GetQRCode(ctx gtype.Context, ps gtype.Params) {
-	state := gtype.NewGuid()
-	data, err := gwechat.GetLoginPage(s.Cfg.Auth.Wechat.App.ID, s.Cfg.Auth.Wechat.Url.Callback.Code, state)
+	data, err := s.newQRCode(ctx.RIP(), "")
 	if err != nil {
 		ctx.Error(gtype.ErrInternal, err)
 		return
@@ -74,8 +119,79 @@ func (s *Wechat) GetQRCode(ctx gtype.Context, ps gtype.Params) {
 func (s *Wechat) GetQRCodeDoc(doc gtype.Doc, method string, uri gtype.Uri) {
 	catalog := s.createCatalog(doc, authCatalogWechat)
 	function := catalog.AddFunction(method, uri, "获取二维码")
-	function.SetNote("获取用于进行扫描的二维码及及登录地址")
-	function.SetOutputDataExample(&gwechat.LoginPage{})
+	function.SetNote("获取用于扫码登录的二维码及登录地址; 页面随后使用返回的状态(state)连接websocket(/auth/wechat/socket)等待扫码结果")
+	function.SetRemark("该接口不需要凭证; 二维码5分钟内有效, 登录凭证仅对获取二维码的IP有效")
+	function.SetOutputDataExample(&model.WechatQRCode{
+		State: "8a5f0e7c2b3d4e6f9a1b2c3d4e5f6a7b",
+		Page:  &gwechat.LoginPage{},
+	})
+	function.AddOutputError(gtype.ErrInternal)
+}
+
+func (s *Wechat) Socket(ctx gtype.Context, ps gtype.Params) {
+	state := ctx.Request().URL.Query().Get("state")
+	s.mutex.Lock()
+	item, ok := s.states[state]
+	s.mutex.Unlock()
+	if !ok || len(item.account) > 0 {
+		ctx.Error(gtype.ErrInput.SetDetail("二维码无效或已过期"))
+		return
+	}
+
+	conn, err := s.wsGrader.Upgrade(ctx.Response(), ctx.Request(), nil)
+	if err != nil {
+		s.LogError("wechat socket connect fail:", err)
+		ctx.Error(gtype.ErrInternal, err)
+		return
+	}
+	defer conn.Close()
+
+	// the browser only waits for the result, so reading is just for detecting the close of the connection
+	closed := make(chan bool)
+	go func() {
+		defer close(closed)
+		for {
+			_, _, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+		}
+	}()
+
+	timer := time.NewTimer(time.Until(item.expireTime))
+	defer timer.Stop()
+
+	select {
+	case msg := <-item.result:
+		conn.WriteJSON(msg)
+	case <-timer.C:
+	case <-closed:
+	}
+
+	s.mutex.Lock()
+	delete(s.states, state)
+	s.mutex.Unlock()
+}
+
+func (s *Wechat) SocketDoc(doc gtype.Doc, method string, uri gtype.Uri) {
+	catalog := s.createCatalog(doc, authCatalogWechat)
+	function := catalog.AddFunction(method, uri, "等待扫码结果")
+	function.SetNote(fmt.Sprintf("websocket连接, 扫码后推送一条消息后关闭: %d-登录成功(数据为登录凭证, 须两步验证时不包含凭证而是票据(totpTicket), 提交验证码后完成登录); %d-该微信未绑定帐号或绑定的帐号已禁用; 二维码过期时直接关闭",
+		socket.WSWechatLogin, socket.WSWechatUnbound))
+	function.SetRemark("该接口不需要凭证")
+	function.AddInputQuery(true, "state", "状态, 由获取二维码接口返回", "")
+	function.SetOutputExample(&gtype.SocketMessage{
+		ID: socket.WSWechatLogin,
+		Data: &model.AuthLogin{
+			Login: gtype.Login{
+				Token:   "71b9b7e2ac6d4166b18f414942ff3481",
+				Account: "zhangsan",
+				Name:    "张三",
+			},
+		},
+	})
+	function.AddOutputError(gtype.ErrInput)
+	function.AddOutputError(gtype.ErrInternal)
 }
 
 func (s *Wechat) Code(ctx gtype.Context, ps gtype.Params) {
@@ -98,12 +214,12 @@ func (s *Wechat) Code(ctx gtype.Context, ps gtype.Params) {
 	}
 
 	if len(code) > 0 {
-		at, ae := gwechat.GetAccessToken(s.Cfg.Auth.Wechat.App.ID, s.Cfg.Auth.Wechat.App.Secret, code)
-		if ae == nil && at != nil {
-			ui, ue := gwechat.GetUserInfo(at.OpenId, at.AccessToken)
-			if ue == nil && ui != nil {
-				go s.doAuth(state, ui.OpenId, ui.UnionId, ui.NickName)
-			}
+		oauth := newWechatOauth(s.Cfg.Auth.Wechat.Url.Oauth)
+		ui, ue := oauth.getUser(s.Cfg.Auth.Wechat.App.ID, s.Cfg.Auth.Wechat.App.Secret, code)
+		if ue != nil {
+			s.LogWarning("wechat: get user info fail: ", ue)
+		} else if ui != nil {
+			go s.doAuth(state, ui.OpenID, ui.UnionID, ui.NickName)
 		}
 	}
 
@@ -114,14 +230,248 @@ func (s *Wechat) Code(ctx gtype.Context, ps gtype.Params) {
 func (s *Wechat) CodeDoc(doc gtype.Doc, method string, uri gtype.Uri) {
 	catalog := s.createCatalog(doc, authCatalogWechat)
 	function := catalog.AddFunction(method, uri, "接收授权码")
-	function.SetNote("接受微信服务器回调推送的授权码'")
-	function.AddInputQuery(true, "cope", "授权码", "")
+	function.SetNote("接受微信服务器回调推送的授权码, 获取微信用户后完成扫码登录或绑定")
+	function.AddInputQuery(true, "code", "授权码", "")
 	function.AddInputQuery(true, "state", "状态", "")
 }
 
-func (s *Wechat) doAuth(state, openId, unionId, nickName string) {
-	if len(state) < 1 {
+func (s *Wechat) GetBindQRCode(ctx gtype.Context, ps gtype.Params) {
+	token := s.GetToken(ctx.Token())
+	if token == nil {
+		ctx.Error(gtype.ErrTokenInvalid)
+		return
+	}
+
+	data, err := s.newQRCode(ctx.RIP(), token.UserAccount)
+	if err != nil {
+		ctx.Error(gtype.ErrInternal, err)
+		return
+	}
+
+	ctx.Success(data)
+}
+
+func (s *Wechat) GetBindQRCodeDoc(doc gtype.Doc, method string, uri gtype.Uri) {
+	catalog := s.createCatalog(doc, authCatalogWechat)
+	function := catalog.AddFunction(method, uri, "获取绑定二维码")
+	function.SetNote(fmt.Sprintf("获取用于将微信绑定到当前用户的二维码, 扫码后通过消息推送(%d)通知绑定结果; 每个帐号只能绑定一个微信, 重新绑定将替换原有绑定",
+		socket.WSWechatBind))
+	function.SetRemark("二维码5分钟内有效")
+	function.SetOutputDataExample(&model.WechatQRCode{
+		State: "8a5f0e7c2b3d4e6f9a1b2c3d4e5f6a7b",
+		Page:  &gwechat.LoginPage{},
+	})
+	function.AddOutputError(gtype.ErrTokenInvalid)
+	function.AddOutputError(gtype.ErrInternal)
+}
+
+func (s *Wechat) GetBinding(ctx gtype.Context, ps gtype.Params) {
+	token := s.GetToken(ctx.Token())
+	if token == nil {
+		ctx.Error(gtype.ErrTokenInvalid)
+		return
+	}
+
+	item, err := s.getBindingByAccount(token.UserAccount)
+	if err != nil {
+		ctx.Error(gtype.ErrInternal, err)
+		return
+	}
+
+	ctx.Success(item)
+}
+
+func (s *Wechat) GetBindingDoc(doc gtype.Doc, method string, uri gtype.Uri) {
+	catalog := s.createCatalog(doc, authCatalogWechat)
+	function := catalog.AddFunction(method, uri, "获取绑定信息")
+	function.SetNote("获取当前用户绑定的微信, 未绑定时返回null")
+	function.SetOutputDataExample(&model.WechatBinding{
+		UnionID:  "o6_bmasdasdsad6_2sgVt7hMZOPfL",
+		OpenID:   "oLVPpjqs9BhvzwPj5A-vTYAX3GLc",
+		Account:  "zhangsan",
+		NickName: "张三",
+		BindTime: gtype.DateTime(time.Now()),
+	})
+	function.AddOutputError(gtype.ErrTokenInvalid)
+	function.AddOutputError(gtype.ErrInternal)
+}
+
+func (s *Wechat) Unbind(ctx gtype.Context, ps gtype.Params) {
+	token := s.GetToken(ctx.Token())
+	if token == nil {
+		ctx.Error(gtype.ErrTokenInvalid)
 		return
 	}
 
+	item, err := s.getBindingByAccount(token.UserAccount)
+	if err != nil {
+		ctx.Error(gtype.ErrInternal, err)
+		return
+	}
+	if item == nil {
+		ctx.Error(gtype.ErrNotExist.SetDetail("当前用户未绑定微信"))
+		return
+	}
+	err = s.Dbs.Delete(controller.WechatBindingBucket, item.Key())
+	if err != nil {
+		ctx.Error(gtype.ErrInternal, err)
+		return
+	}
+
+	ctx.Success(nil)
+}
+
+func (s *Wechat) UnbindDoc(doc gtype.Doc, method string, uri gtype.Uri) {
+	catalog := s.createCatalog(doc, authCatalogWechat)
+	function := catalog.AddFunction(method, uri, "解除绑定")
+	function.SetNote("解除当前用户绑定的微信, 解除后不能再通过该微信扫码登录")
+	function.SetOutputDataExample(nil)
+	function.AddOutputError(gtype.ErrTokenInvalid)
+	function.AddOutputError(gtype.ErrNotExist)
+	function.AddOutputError(gtype.ErrInternal)
+}
+
+func (s *Wechat) newQRCode(ip, account string) (*model.WechatQRCode, error) {
+	state := gtype.NewGuid()
+	page, err := gwechat.GetLoginPage(s.Cfg.Auth.Wechat.App.ID, s.Cfg.Auth.Wechat.Url.Callback.Code, state)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for k, v := range s.states {
+		if !v.expireTime.After(now) {
+			delete(s.states, k)
+		}
+	}
+	s.states[state] = &wechatState{
+		ip:         ip,
+		account:    account,
+		result:     make(chan *gtype.SocketMessage, 1),
+		expireTime: now.Add(wechatStateExpiration),
+	}
+
+	return &model.WechatQRCode{
+		State: state,
+		Page:  page,
+	}, nil
+}
+
+// doAuth returns false if the state is invalid, expired or has been scanned
+func (s *Wechat) doAuth(state, openId, unionId, nickName string) bool {
+	if len(state) < 1 {
+		return false
+	}
+
+	// each QR code can be scanned once only
+	s.mutex.Lock()
+	item, ok := s.states[state]
+	if ok {
+		if item.scanned || !item.expireTime.After(time.Now()) {
+			ok = false
+		} else {
+			item.scanned = true
+		}
+	}
+	s.mutex.Unlock()
+	if !ok {
+		return false
+	}
+
+	if len(item.account) > 0 {
+		s.doBind(item.account, openId, unionId, nickName)
+	} else {
+		item.result <- s.doLogin(item.ip, openId, unionId, nickName)
+	}
+
+	return true
+}
+
+func (s *Wechat) doLogin(ip, openId, unionId, nickName string) *gtype.SocketMessage {
+	unbound := &gtype.SocketMessage{
+		ID: socket.WSWechatUnbound,
+		Data: &model.WechatScan{
+			NickName: nickName,
+			Error:    "该微信未绑定帐号, 请使用帐号密码登录后进行绑定",
+		},
+	}
+
+	binding, err := s.getBinding(unionId, openId)
+	if err != nil {
+		s.LogError("wechat: get binding fail: ", err)
+		return unbound
+	}
+	if binding == nil {
+		return unbound
+	}
+
+	login, err := s.loginUser(binding.Account, ip)
+	if err == nil {
+		return &gtype.SocketMessage{
+			ID:   socket.WSWechatLogin,
+			Data: login,
+		}
+	}
+	s.LogWarning(fmt.Sprintf("wechat: login %s fail: ", binding.Account), err)
+
+	return &gtype.SocketMessage{
+		ID: socket.WSWechatUnbound,
+		Data: &model.WechatScan{
+			NickName: nickName,
+			Account:  binding.Account,
+			Error:    fmt.Sprintf("绑定的帐号(%s)无效", binding.Account),
+		},
+	}
+}
+
+// loginUser creates the token of the bound account which must be enabled,
+// or returns the totp ticket instead if the second factor is required
+func (s *Wechat) loginUser(account, ip string) (*model.AuthLogin, error) {
+	if s.Authenticator == nil {
+		return nil, fmt.Errorf("authenticator is nil")
+	}
+
+	ad := s.Ad()
+	user, err := ad.GetUser(account)
+	if err != nil {
+		return nil, err
+	}
+	enabled, err := ad.GetUserEnable(user.Account)
+	if err != nil {
+		return nil, err
+	}
+	if !enabled {
+		return nil, fmt.Errorf("帐号(%s)已禁用", user.Account)
+	}
+
+	login, err := s.Authenticator.requireTotp(user, ip)
+	if err != nil {
+		return nil, err
+	}
+	if login != nil {
+		return login, nil
+	}
+
+	return s.Authenticator.CreateLogin(user, ip)
+}
+
+func (s *Wechat) doBind(account, openId, unionId, nickName string) {
+	result := &model.WechatScan{
+		NickName: nickName,
+		Account:  account,
+	}
+	err := s.saveBinding(&model.WechatBinding{
+		UnionID:  unionId,
+		OpenID:   openId,
+		Account:  account,
+		NickName: nickName,
+		BindTime: gtype.DateTime(time.Now()),
+	})
+	if err != nil {
+		result.Error = err.Error()
+	}
+
+	s.WriteWebSocketMessageToAccounts(socket.WSWechatBind, result, account)
 }
@@ -0,0 +1,96 @@
+package auth
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/csby/goa/controller"
+	"github.com/csby/goa/data/model"
+	"strings"
+)
+
+// getBinding returns nil if the WeChat user is not bound
+func (s *Wechat) getBinding(unionId, openId string) (*model.WechatBinding, error) {
+	if s.Dbs == nil {
+		return nil, fmt.Errorf("本地数据库不可用")
+	}
+
+	for _, key := range []string{unionId, openId} {
+		if len(key) < 1 {
+			continue
+		}
+		item := &model.WechatBinding{}
+		ok, err := s.Dbs.Get(controller.WechatBindingBucket, key, item)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			return item, nil
+		}
+	}
+
+	return nil, nil
+}
+
+// getBindingByAccount returns nil if the account is not bound
+func (s *Wechat) getBindingByAccount(account string) (*model.WechatBinding, error) {
+	items, err := s.getBindings(account)
+	if err != nil {
+		return nil, err
+	}
+	if len(items) < 1 {
+		return nil, nil
+	}
+
+	return items[0], nil
+}
+
+func (s *Wechat) getBindings(account string) ([]*model.WechatBinding, error) {
+	if s.Dbs == nil {
+		return nil, fmt.Errorf("本地数据库不可用")
+	}
+
+	items := make([]*model.WechatBinding, 0)
+	err := s.Dbs.ForEach(controller.WechatBindingBucket, func(key string, value []byte) error {
+		item := &model.WechatBinding{}
+		if json.Unmarshal(value, item) != nil {
+			return nil
+		}
+		if strings.ToLower(item.Account) == strings.ToLower(account) {
+			items = append(items, item)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return items, nil
+}
+
+// saveBinding replaces the binding of the account, a WeChat user bound to another account can not be bound again
+func (s *Wechat) saveBinding(binding *model.WechatBinding) error {
+	if len(binding.Key()) < 1 {
+		return fmt.Errorf("微信用户标识为空")
+	}
+
+	exist, err := s.getBinding(binding.UnionID, binding.OpenID)
+	if err != nil {
+		return err
+	}
+	if exist != nil && strings.ToLower(exist.Account) != strings.ToLower(binding.Account) {
+		return fmt.Errorf("该微信已绑定帐号(%s), 请先解除绑定", exist.Account)
+	}
+
+	items, err := s.getBindings(binding.Account)
+	if err != nil {
+		return err
+	}
+	for _, item := range items {
+		err = s.Dbs.Delete(controller.WechatBindingBucket, item.Key())
+		if err != nil {
+			return err
+		}
+	}
+
+	return s.Dbs.Put(controller.WechatBindingBucket, binding.Key(), binding)
+}
@@ -0,0 +1,63 @@
+package auth
+
+import (
+	"github.com/csby/goa/controller"
+	"github.com/csby/goa/data/model"
+	"github.com/csby/goa/data/storage/storagetest"
+	"testing"
+)
+
+func newTestWechat(t *testing.T) *Wechat {
+	dbs := storagetest.Open(t)
+
+	return NewWechat(nil, &controller.Parameter{Dbs: dbs})
+}
+
+func TestWechat_SaveBinding(t *testing.T) {
+	s := newTestWechat(t)
+
+	err := s.saveBinding(&model.WechatBinding{UnionID: "u1", OpenID: "o1", Account: "zhangsan"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	item, err := s.getBinding("", "o1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if item != nil {
+		t.Error("binding should be saved with union id")
+	}
+	item, err = s.getBinding("u1", "o1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if item == nil || item.Account != "zhangsan" {
+		t.Fatalf("unexpected binding: %+v", item)
+	}
+
+	// the WeChat user has been bound to another account
+	err = s.saveBinding(&model.WechatBinding{UnionID: "u1", OpenID: "o1", Account: "lisi"})
+	if err == nil {
+		t.Error("bind to another account should fail")
+	}
+
+	// rebind the account to another WeChat user
+	err = s.saveBinding(&model.WechatBinding{OpenID: "o2", Account: "ZhangSan"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	item, err = s.getBinding("u1", "o1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if item != nil {
+		t.Error("previous binding should be removed")
+	}
+	item, err = s.getBindingByAccount("zhangsan")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if item == nil || item.OpenID != "o2" {
+		t.Errorf("unexpected binding: %+v", item)
+	}
+}
@@ -0,0 +1,306 @@
+package auth
+
+import (
+	"encoding/xml"
+	"fmt"
+	"github.com/csby/goa/assist"
+	"github.com/csby/goa/config"
+	"github.com/csby/goa/data/model"
+	"github.com/csby/gwsf/gtype"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	wechatMessageMaxSize = 1 << 20
+	wechatReplySuccess   = "success"
+)
+
+// WechatMessageHandler handles the message (or event) from WeChat, the text returned is replied to the user,
+// an empty text means no reply and the message is passed to the next handler
+type WechatMessageHandler func(message *model.WechatMessage) string
+
+type wechatCData struct {
+	Value string `xml:",cdata"`
+}
+
+type wechatTextReply struct {
+	XMLName      xml.Name    `xml:"xml"`
+	ToUserName   wechatCData `xml:"ToUserName"`
+	FromUserName wechatCData `xml:"FromUserName"`
+	CreateTime   int64       `xml:"CreateTime"`
+	MsgType      wechatCData `xml:"MsgType"`
+	Content      wechatCData `xml:"Content"`
+}
+
+type wechatEncryptReply struct {
+	XMLName      xml.Name    `xml:"xml"`
+	Encrypt      wechatCData `xml:"Encrypt"`
+	MsgSignature wechatCData `xml:"MsgSignature"`
+	TimeStamp    string      `xml:"TimeStamp"`
+	Nonce        wechatCData `xml:"Nonce"`
+}
+
+// AddMessageHandler registers the handler of the message type (e.g. text), or the event type (e.g. subscribe, SCAN)
+// for the event message; the handlers are called in the order of registration
+func (s *Wechat) AddMessageHandler(kind string, handler WechatMessageHandler) {
+	if handler == nil {
+		return
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	key := strings.ToLower(kind)
+	s.handlers[key] = append(s.handlers[key], handler)
+}
+
+func (s *Wechat) Receive(ctx gtype.Context, ps gtype.Params) {
+	w := ctx.Response()
+	r := ctx.Request()
+	query := r.URL.Query()
+	timestamp := query.Get("timestamp")
+	nonce := query.Get("nonce")
+	api := s.Cfg.Auth.Wechat.Url.Api
+
+	if assist.WechatSign(api.Token, timestamp, nonce) != query.Get("signature") {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, wechatMessageMaxSize))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	message := &model.WechatMessage{}
+	err = xml.Unmarshal(body, message)
+	if err != nil {
+		s.LogWarning("wechat: parse message fail: ", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	var crypt *assist.WechatCrypt
+	encrypted := strings.ToLower(query.Get("encrypt_type")) == "aes"
+	if api.MsgType == config.WechatMsgSecure && !encrypted {
+		s.LogWarning("wechat: plaintext message is refused in secure mode")
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+	if encrypted && api.MsgType != config.WechatMsgPlain {
+		crypt, message, err = s.decryptMessage(api, message.Encrypt, timestamp, nonce, query.Get("msg_signature"))
+		if err != nil {
+			s.LogWarning("wechat: decrypt message fail: ", err)
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+	}
+
+	content := s.dispatchMessage(message)
+	w.Header().Set("Content-Type", "text/xml; charset=utf-8")
+	if len(content) < 1 {
+		fmt.Fprint(w, wechatReplySuccess)
+		return
+	}
+
+	reply, err := xml.Marshal(&wechatTextReply{
+		ToUserName:   wechatCData{Value: message.FromUserName},
+		FromUserName: wechatCData{Value: message.ToUserName},
+		CreateTime:   time.Now().Unix(),
+		MsgType:      wechatCData{Value: model.WechatMsgText},
+		Content:      wechatCData{Value: content},
+	})
+	if err == nil && crypt != nil {
+		reply, err = s.encryptReply(crypt, reply, nonce)
+	}
+	if err != nil {
+		s.LogError("wechat: create reply fail: ", err)
+		fmt.Fprint(w, wechatReplySuccess)
+		return
+	}
+
+	w.Write(reply)
+}
+
+func (s *Wechat) ReceiveDoc(doc gtype.Doc, method string, uri gtype.Uri) {
+	catalog := s.createCatalog(doc, authCatalogWechat)
+	function := catalog.AddFunction(method, uri, "接收消息")
+	function.SetNote("接收微信公众号推送的消息及事件(XML), 按配置的加解密方式(明文、兼容、安全模式)验证并解密, " +
+		"分发至已注册的处理器后回复文本消息, 加密推送的消息回复时同样加密; " +
+		"内置处理: 扫描带参数二维码(场景值为扫码登录或绑定的状态)完成登录或绑定; 回复\"VPN\"查询本人的VPN状态")
+	function.SetRemark("该接口由微信服务器调用, 不需要凭证")
+	function.AddInputQuery(true, "signature", "微信加密签名", "")
+	function.AddInputQuery(true, "timestamp", "时间戳", "")
+	function.AddInputQuery(true, "nonce", "随机数", "")
+	function.AddInputQuery(false, "openid", "发送者OpenID", "")
+	function.AddInputQuery(false, "encrypt_type", "加密类型, 加密时为aes", "", "aes")
+	function.AddInputQuery(false, "msg_signature", "消息签名, 加密时有效", "")
+	function.SetInputExample(&model.WechatMessage{
+		ToUserName:   "gh_0123456789ab",
+		FromUserName: "oLVPpjqs9BhvzwPj5A-vTYAX3GLc",
+		CreateTime:   1348831860,
+		MsgType:      model.WechatMsgText,
+		Content:      "VPN",
+		MsgId:        1234567890123456,
+	})
+	function.AddOutputHeader("Content-Type", "text/xml; charset=utf-8")
+}
+
+func (s *Wechat) decryptMessage(api config.AuthWechatUrlApi, encrypt, timestamp, nonce, signature string) (*assist.WechatCrypt, *model.WechatMessage, error) {
+	if len(encrypt) < 1 {
+		return nil, nil, fmt.Errorf("密文为空")
+	}
+	crypt, err := assist.NewWechatCrypt(api.Token, api.AESKey, s.Cfg.Auth.Wechat.App.ID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if crypt.Sign(timestamp, nonce, encrypt) != signature {
+		return nil, nil, fmt.Errorf("消息签名(msg_signature)无效")
+	}
+
+	data, err := crypt.Decrypt(encrypt)
+	if err != nil {
+		return nil, nil, err
+	}
+	message := &model.WechatMessage{}
+	err = xml.Unmarshal(data, message)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return crypt, message, nil
+}
+
+func (s *Wechat) encryptReply(crypt *assist.WechatCrypt, reply []byte, nonce string) ([]byte, error) {
+	encrypt, err := crypt.Encrypt(reply)
+	if err != nil {
+		return nil, err
+	}
+	timestamp := fmt.Sprint(time.Now().Unix())
+
+	return xml.Marshal(&wechatEncryptReply{
+		Encrypt:      wechatCData{Value: encrypt},
+		MsgSignature: wechatCData{Value: crypt.Sign(timestamp, nonce, encrypt)},
+		TimeStamp:    timestamp,
+		Nonce:        wechatCData{Value: nonce},
+	})
+}
+
+func (s *Wechat) dispatchMessage(message *model.WechatMessage) string {
+	kind := message.MsgType
+	if kind == model.WechatMsgEvent {
+		kind = message.Event
+	}
+
+	s.mutex.Lock()
+	handlers := s.handlers[strings.ToLower(kind)]
+	s.mutex.Unlock()
+
+	for _, handler := range handlers {
+		content := handler(message)
+		if len(content) > 0 {
+			return content
+		}
+	}
+
+	return ""
+}
+
+// onScan completes the login or binding of the QR code whose state is used as the scene of the QR code
+func (s *Wechat) onScan(message *model.WechatMessage) string {
+	scene := message.EventKey
+	if message.Event == model.WechatEventSubscribe {
+		if !strings.HasPrefix(scene, model.WechatScenePrefix) {
+			return "欢迎关注! 回复\"VPN\"可查询本人的VPN状态"
+		}
+		scene = strings.TrimPrefix(scene, model.WechatScenePrefix)
+	}
+	if len(scene) < 1 {
+		return ""
+	}
+
+	if !s.doAuth(scene, message.FromUserName, s.getMpUnionId(message.FromUserName), "") {
+		return "二维码无效或已过期, 请刷新后重新扫码"
+	}
+
+	return "扫码成功, 请在浏览器中查看结果"
+}
+
+func (s *Wechat) onVpnStatus(message *model.WechatMessage) string {
+	content := strings.ToUpper(strings.TrimSpace(message.Content))
+	if content != "VPN" && content != "VPN状态" {
+		return ""
+	}
+
+	binding, err := s.getBinding(s.getMpUnionId(message.FromUserName), message.FromUserName)
+	if err != nil {
+		s.LogError("wechat: get binding fail: ", err)
+		return "查询失败, 请稍后重试"
+	}
+	if binding == nil {
+		return "该微信未绑定帐号, 请登录后进行绑定"
+	}
+
+	enabled, err := s.Ad().GetUserVpnEnable(binding.Account)
+	if err != nil {
+		s.LogError(fmt.Sprintf("wechat: get vpn status of %s fail: ", binding.Account), err)
+		return "查询失败, 请稍后重试"
+	}
+	if enabled {
+		return fmt.Sprintf("帐号%s的VPN已启用", binding.Account)
+	}
+
+	return fmt.Sprintf("帐号%s的VPN未启用, 如需使用请提交申请", binding.Account)
+}
+
+// getMpUnionId returns the union id of the follower of the official account, or empty if it can not be resolved.
+// The open id of a message is the one of the official account, while the bindings of the web QR code are saved
+// with the union id (or the open id of the web app), so the union id is required to find them.
+func (s *Wechat) getMpUnionId(openId string) string {
+	app := s.Cfg.Auth.Wechat.Mp
+	if len(app.ID) < 1 {
+		app = s.Cfg.Auth.Wechat.App
+	}
+	if len(app.ID) < 1 || len(app.Secret) < 1 {
+		return ""
+	}
+
+	oauth := newWechatOauth(s.Cfg.Auth.Wechat.Url.Oauth)
+	s.mutex.Lock()
+	accessToken := s.mpToken
+	if !s.mpTokenExpire.After(time.Now()) {
+		accessToken = ""
+	}
+	s.mutex.Unlock()
+	if len(accessToken) < 1 {
+		token, err := oauth.getMpToken(app.ID, app.Secret)
+		if err != nil {
+			s.LogError("wechat: get access token of official account fail: ", err)
+			return ""
+		}
+		accessToken = token.AccessToken
+
+		// renew a minute ahead of the expiration
+		s.mutex.Lock()
+		s.mpToken = accessToken
+		s.mpTokenExpire = time.Now().Add(time.Duration(token.ExpiresIn-60) * time.Second)
+		s.mutex.Unlock()
+	}
+
+	user, err := oauth.getMpUser(accessToken, openId)
+	if err != nil {
+		// the token may be revoked by a refresh elsewhere, get a new one next time
+		s.mutex.Lock()
+		if s.mpToken == accessToken {
+			s.mpToken = ""
+		}
+		s.mutex.Unlock()
+		s.LogError(fmt.Sprintf("wechat: get union id of %s fail: ", openId), err)
+		return ""
+	}
+
+	return user.UnionID
+}
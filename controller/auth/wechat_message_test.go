@@ -0,0 +1,185 @@
+package auth
+
+import (
+	"encoding/xml"
+	"fmt"
+	"github.com/csby/goa/assist"
+	"github.com/csby/goa/config"
+	"github.com/csby/goa/controller"
+	"github.com/csby/goa/data/model"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func newTestWechatWithApi(t *testing.T) *Wechat {
+	cfg := config.NewConfig()
+	cfg.Auth.Wechat.App.ID = "wx5823bf96d3bd56c7"
+	cfg.Auth.Wechat.Url.Api.Token = "spamtest"
+	cfg.Auth.Wechat.Url.Api.AESKey = "jWmYm7qr5nMoAUwZRjGtBxmz3KA1tkAj3ykkR6q2B2C"
+	cfg.Auth.Wechat.Url.Api.MsgType = config.WechatMsgSecure
+
+	return NewWechat(nil, &controller.Parameter{Cfg: cfg})
+}
+
+func TestWechat_DecryptMessage(t *testing.T) {
+	s := newTestWechatWithApi(t)
+	api := s.Cfg.Auth.Wechat.Url.Api
+	crypt, err := assist.NewWechatCrypt(api.Token, api.AESKey, s.Cfg.Auth.Wechat.App.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	plain := `<xml><ToUserName><![CDATA[gh_1]]></ToUserName><FromUserName><![CDATA[o1]]></FromUserName>` +
+		`<CreateTime>1348831860</CreateTime><MsgType><![CDATA[event]]></MsgType>` +
+		`<Event><![CDATA[subscribe]]></Event><EventKey><![CDATA[qrscene_s1]]></EventKey></xml>`
+	encrypt, err := crypt.Encrypt([]byte(plain))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, message, err := s.decryptMessage(api, encrypt, "1409304348", "n1", crypt.Sign("1409304348", "n1", encrypt))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if message.FromUserName != "o1" || message.Event != model.WechatEventSubscribe || message.EventKey != "qrscene_s1" {
+		t.Errorf("unexpected message: %+v", message)
+	}
+
+	_, _, err = s.decryptMessage(api, encrypt, "1409304348", "n1", "0000")
+	if err == nil {
+		t.Error("invalid msg_signature should fail")
+	}
+}
+
+func TestWechat_EncryptReply(t *testing.T) {
+	s := newTestWechatWithApi(t)
+	api := s.Cfg.Auth.Wechat.Url.Api
+	crypt, err := assist.NewWechatCrypt(api.Token, api.AESKey, s.Cfg.Auth.Wechat.App.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := s.encryptReply(crypt, []byte("<xml>hi</xml>"), "n1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	reply := &wechatEncryptReply{}
+	err = xml.Unmarshal(data, reply)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reply.Nonce.Value != "n1" || reply.MsgSignature.Value != crypt.Sign(reply.TimeStamp, "n1", reply.Encrypt.Value) {
+		t.Errorf("unexpected reply: %s", data)
+	}
+	plain, err := crypt.Decrypt(reply.Encrypt.Value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(plain) != "<xml>hi</xml>" {
+		t.Errorf("unexpected plain: %s", plain)
+	}
+}
+
+func TestWechat_DispatchMessage(t *testing.T) {
+	s := newTestWechatWithApi(t)
+	s.AddMessageHandler(model.WechatMsgText, func(message *model.WechatMessage) string {
+		if message.Content == "ping" {
+			return "pong"
+		}
+		return ""
+	})
+
+	content := s.dispatchMessage(&model.WechatMessage{MsgType: model.WechatMsgText, Content: "ping"})
+	if content != "pong" {
+		t.Errorf("unexpected reply: %s", content)
+	}
+	content = s.dispatchMessage(&model.WechatMessage{MsgType: model.WechatMsgText, Content: "hello"})
+	if content != "" {
+		t.Errorf("unexpected reply: %s", content)
+	}
+
+	// subscribe without scene is replied by the built-in handler
+	content = s.dispatchMessage(&model.WechatMessage{MsgType: model.WechatMsgEvent, Event: model.WechatEventSubscribe})
+	if !strings.Contains(content, "VPN") {
+		t.Errorf("unexpected reply: %s", content)
+	}
+	// scan with an unknown state
+	content = s.dispatchMessage(&model.WechatMessage{MsgType: model.WechatMsgEvent, Event: model.WechatEventScan, EventKey: "s1"})
+	if !strings.Contains(content, "无效") {
+		t.Errorf("unexpected reply: %s", content)
+	}
+}
+
+func TestWechat_TextReply(t *testing.T) {
+	data, err := xml.Marshal(&wechatTextReply{
+		ToUserName: wechatCData{Value: "o1"},
+		Content:    wechatCData{Value: "a<b"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), "<ToUserName><![CDATA[o1]]></ToUserName>") ||
+		!strings.Contains(string(data), "<Content><![CDATA[a<b]]></Content>") {
+		t.Errorf("unexpected reply: %s", data)
+	}
+}
+
+func TestWechat_GetMpUnionId(t *testing.T) {
+	tokens := 0
+	mux := http.NewServeMux()
+	mux.HandleFunc("/cgi-bin/token", func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		if q.Get("appid") != "mp1" || q.Get("secret") != "s1" || q.Get("grant_type") != "client_credential" {
+			fmt.Fprint(w, `{"errcode":40013,"errmsg":"invalid appid"}`)
+			return
+		}
+		tokens++
+		fmt.Fprint(w, `{"access_token":"at1","expires_in":7200}`)
+	})
+	mux.HandleFunc("/cgi-bin/user/info", func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		if q.Get("access_token") != "at1" || q.Get("openid") != "mp-o1" {
+			fmt.Fprint(w, `{"errcode":40003,"errmsg":"invalid openid"}`)
+			return
+		}
+		fmt.Fprint(w, `{"subscribe":1,"openid":"mp-o1","unionid":"u1"}`)
+	})
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	s := newTestWechat(t)
+	s.Cfg = config.NewConfig()
+	if s.getMpUnionId("mp-o1") != "" {
+		t.Error("union id should be empty without the official account")
+	}
+
+	s.Cfg.Auth.Wechat.Url.Oauth = server.URL
+	s.Cfg.Auth.Wechat.Mp.ID = "mp1"
+	s.Cfg.Auth.Wechat.Mp.Secret = "s1"
+	err := s.saveBinding(&model.WechatBinding{UnionID: "u1", OpenID: "web-o1", Account: "zhangsan"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	unionId := s.getMpUnionId("mp-o1")
+	if unionId != "u1" {
+		t.Fatalf("unexpected union id: %s", unionId)
+	}
+	binding, err := s.getBinding(unionId, "mp-o1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if binding == nil || binding.Account != "zhangsan" {
+		t.Errorf("binding of the web QR code should be found: %+v", binding)
+	}
+
+	if s.getMpUnionId("mp-o2") != "" {
+		t.Error("union id of an unknown open id should be empty")
+	}
+	s.getMpUnionId("mp-o1")
+	if tokens != 2 {
+		t.Errorf("the token should be cached and renewed after a failure, got %d requests", tokens)
+	}
+}
@@ -0,0 +1,148 @@
+package auth
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	wechatOauthUrl = "https://api.weixin.qq.com"
+)
+
+type wechatOauthUser struct {
+	OpenID   string `json:"openid"`
+	UnionID  string `json:"unionid"`
+	NickName string `json:"nickname"`
+}
+
+type wechatOauthResult struct {
+	ErrCode int    `json:"errcode"`
+	ErrMsg  string `json:"errmsg"`
+}
+
+type wechatOauthToken struct {
+	wechatOauthResult
+
+	AccessToken string `json:"access_token"`
+	OpenID      string `json:"openid"`
+	UnionID     string `json:"unionid"`
+}
+
+type wechatMpToken struct {
+	wechatOauthResult
+
+	AccessToken string `json:"access_token"`
+	ExpiresIn   int64  `json:"expires_in"`
+}
+
+// wechatOauth calls the web authorization api of WeChat, the base url can be a local stand-in for testing
+type wechatOauth struct {
+	baseUrl string
+	client  *http.Client
+}
+
+func newWechatOauth(baseUrl string) *wechatOauth {
+	if len(baseUrl) < 1 {
+		baseUrl = wechatOauthUrl
+	}
+
+	return &wechatOauth{
+		baseUrl: strings.TrimRight(baseUrl, "/"),
+		client:  &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// getUser exchanges the code for the access token and then gets the user info
+func (s *wechatOauth) getUser(appId, secret, code string) (*wechatOauthUser, error) {
+	token := &wechatOauthToken{}
+	err := s.get("/sns/oauth2/access_token", url.Values{
+		"appid":      {appId},
+		"secret":     {secret},
+		"code":       {code},
+		"grant_type": {"authorization_code"},
+	}, &token.wechatOauthResult, token)
+	if err != nil {
+		return nil, err
+	}
+
+	user := &wechatOauthUser{}
+	result := &wechatOauthResult{}
+	err = s.get("/sns/userinfo", url.Values{
+		"access_token": {token.AccessToken},
+		"openid":       {token.OpenID},
+	}, result, user)
+	if err != nil {
+		return nil, err
+	}
+	if len(user.OpenID) < 1 {
+		user.OpenID = token.OpenID
+	}
+	if len(user.UnionID) < 1 {
+		user.UnionID = token.UnionID
+	}
+
+	return user, nil
+}
+
+// getMpToken gets the access token of the official account
+func (s *wechatOauth) getMpToken(appId, secret string) (*wechatMpToken, error) {
+	token := &wechatMpToken{}
+	err := s.get("/cgi-bin/token", url.Values{
+		"appid":      {appId},
+		"secret":     {secret},
+		"grant_type": {"client_credential"},
+	}, &token.wechatOauthResult, token)
+	if err != nil {
+		return nil, err
+	}
+
+	return token, nil
+}
+
+// getMpUser gets the follower of the official account, the union id is empty
+// if the official account is not bound to the open platform
+func (s *wechatOauth) getMpUser(accessToken, openId string) (*wechatOauthUser, error) {
+	user := &wechatOauthUser{}
+	result := &wechatOauthResult{}
+	err := s.get("/cgi-bin/user/info", url.Values{
+		"access_token": {accessToken},
+		"openid":       {openId},
+		"lang":         {"zh_CN"},
+	}, result, user)
+	if err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+func (s *wechatOauth) get(uri string, values url.Values, result *wechatOauthResult, data interface{}) error {
+	resp, err := s.client.Get(fmt.Sprintf("%s%s?%s", s.baseUrl, uri, values.Encode()))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s: statusCode=%d", uri, resp.StatusCode)
+	}
+
+	err = json.Unmarshal(body, result)
+	if err != nil {
+		return err
+	}
+	if result.ErrCode != 0 {
+		return fmt.Errorf("%s: %d %s", uri, result.ErrCode, result.ErrMsg)
+	}
+
+	return json.Unmarshal(body, data)
+}
@@ -0,0 +1,66 @@
+package auth
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func newTestWechatServer(t *testing.T) *httptest.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/sns/oauth2/access_token", func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		if q.Get("appid") != "wx1" || q.Get("secret") != "s1" || q.Get("grant_type") != "authorization_code" {
+			fmt.Fprint(w, `{"errcode":40013,"errmsg":"invalid appid"}`)
+			return
+		}
+		if q.Get("code") != "c1" {
+			fmt.Fprint(w, `{"errcode":40029,"errmsg":"invalid code"}`)
+			return
+		}
+		fmt.Fprint(w, `{"access_token":"at1","expires_in":7200,"openid":"o1","unionid":"u1"}`)
+	})
+	mux.HandleFunc("/sns/userinfo", func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		if q.Get("access_token") != "at1" || q.Get("openid") != "o1" {
+			fmt.Fprint(w, `{"errcode":40001,"errmsg":"invalid credential"}`)
+			return
+		}
+		fmt.Fprint(w, `{"openid":"o1","nickname":"张三","unionid":"u1"}`)
+	})
+
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	return server
+}
+
+func TestWechatOauth_GetUser(t *testing.T) {
+	server := newTestWechatServer(t)
+	oauth := newWechatOauth(server.URL + "/")
+
+	user, err := oauth.getUser("wx1", "s1", "c1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.OpenID != "o1" || user.UnionID != "u1" || user.NickName != "张三" {
+		t.Errorf("unexpected user: %+v", user)
+	}
+
+	_, err = oauth.getUser("wx1", "s1", "c2")
+	if err == nil {
+		t.Error("invalid code should fail")
+	}
+	_, err = oauth.getUser("wx1", "s2", "c1")
+	if err == nil {
+		t.Error("invalid secret should fail")
+	}
+}
+
+func TestNewWechatOauth(t *testing.T) {
+	oauth := newWechatOauth("")
+	if oauth.baseUrl != wechatOauthUrl {
+		t.Errorf("unexpected base url: %s", oauth.baseUrl)
+	}
+}
@@ -7,17 +7,27 @@ import (
 	"github.com/csby/goa/assist"
 	"github.com/csby/goa/config"
 	"github.com/csby/goa/data/model"
+	"github.com/csby/goa/data/socket"
+	"github.com/csby/goa/data/storage"
+	"github.com/csby/gwsf/gclient"
 	"github.com/csby/gwsf/gtype"
 	"hash/adler32"
 	"strings"
+	"time"
 )
 
 type Controller struct {
 	gtype.Base
 
 	Cfg  *config.Config
-	Tdb  gtype.TokenDatabase
+	Tdb  *TokenDatabase
 	WChs gtype.SocketChannelCollection
+	Dbs  *storage.Storage
+
+	Signer *TokenSigner
+	Cache  *MembershipCache
+
+	dir Directory
 }
 
 func (s *Controller) SetParameter(p *Parameter) {
@@ -28,6 +38,9 @@ func (s *Controller) SetParameter(p *Parameter) {
 	s.Cfg = p.Cfg
 	s.Tdb = p.Tdb
 	s.WChs = p.WChs
+	s.Dbs = p.Dbs
+	s.Signer = p.Signer
+	s.Cache = p.Cache
 }
 
 func (s *Controller) RootCatalog(doc gtype.Doc) gtype.Catalog {
@@ -52,9 +65,21 @@ func (s *Controller) GetToken(key string) *gtype.Token {
 		return nil
 	}
 
+	if IsApiKey(key) {
+		item, err := s.GetApiKey(key)
+		if err != nil {
+			return nil
+		}
+		return s.ApiKeyToken(item)
+	}
+
 	if s.Tdb == nil {
 		return nil
 	}
+	key = s.TokenKey(key)
+	if len(key) < 1 {
+		return nil
+	}
 
 	value, ok := s.Tdb.Get(key, false)
 	if !ok {
@@ -65,10 +90,34 @@ func (s *Controller) GetToken(key string) *gtype.Token {
 	if !ok {
 		return nil
 	}
+	impersonation := ImpersonationOf(token)
+	if impersonation != nil && impersonation.Expired(time.Now()) {
+		return nil
+	}
 
 	return token
 }
 
+// TokenKey returns the key of the token in Tdb, a signed access token is resolved to its session id,
+// or empty if it is invalid or expired; when the access tokens are signed, the session id is carried
+// in the sid claim of every token, so a raw session id is refused instead of being used as a bearer
+func (s *Controller) TokenKey(value string) string {
+	if s.Signer == nil {
+		return value
+	}
+	if !IsJwt(value) {
+		return ""
+	}
+
+	claims := &AccessClaims{}
+	err := s.Signer.Parse(value, claims)
+	if err != nil {
+		return ""
+	}
+
+	return claims.SessionID
+}
+
 func (s *Controller) WriteWebSocketMessage(token string, id int, data interface{}) bool {
 	if s.WChs == nil {
 		return false
@@ -84,6 +133,114 @@ func (s *Controller) WriteWebSocketMessage(token string, id int, data interface{
 	return true
 }
 
+// WriteWebSocketMessageToAccounts pushes the message only to the channels logged in with one of the accounts
+func (s *Controller) WriteWebSocketMessageToAccounts(id int, data interface{}, accounts ...string) bool {
+	if s.WChs == nil {
+		return false
+	}
+	if len(accounts) < 1 {
+		return false
+	}
+
+	msg := &gtype.SocketMessage{
+		ID: id,
+		Data: &socket.Notice{
+			Accounts: accounts,
+			Data:     data,
+		},
+	}
+
+	s.WChs.Write(msg, nil)
+
+	return true
+}
+
+// CloseWebSocketChannels pushes the message to the channels logged in with one of the accounts and then closes them
+func (s *Controller) CloseWebSocketChannels(id int, data interface{}, accounts ...string) bool {
+	if s.WChs == nil {
+		return false
+	}
+	if len(accounts) < 1 {
+		return false
+	}
+
+	msg := &gtype.SocketMessage{
+		ID: id,
+		Data: &socket.Notice{
+			Accounts: accounts,
+			Data:     data,
+			Close:    true,
+		},
+	}
+
+	s.WChs.Write(msg, nil)
+
+	return true
+}
+
+// CloseWebSocketSession pushes the message to the channels of the token only and then closes them
+func (s *Controller) CloseWebSocketSession(id int, data interface{}, token *gtype.Token) bool {
+	if s.WChs == nil {
+		return false
+	}
+	if token == nil {
+		return false
+	}
+
+	msg := &gtype.SocketMessage{
+		ID: id,
+		Data: &socket.Notice{
+			Accounts: []string{token.UserAccount},
+			Data:     data,
+			Session:  token.ID,
+			Close:    true,
+		},
+	}
+
+	s.WChs.Write(msg, nil)
+
+	return true
+}
+
+// CallApi posts the argument as json to the api of the dhcp, svn or other service,
+// and unmarshals the data of the result into data if data is not nil
+func (s *Controller) CallApi(baseUrl, uri string, argument, data interface{}) gtype.Error {
+	if len(baseUrl) < 1 {
+		return gtype.ErrInternal.SetDetail("配置错误： 服务地址为空")
+	}
+	if len(uri) < 1 {
+		return gtype.ErrInternal.SetDetail("配置错误： 接口地址为空")
+	}
+	url := fmt.Sprintf("%s%s", baseUrl, uri)
+
+	client := &gclient.Http{}
+	_, output, _, statusCode, err := client.PostJson(url, argument)
+	if statusCode != 200 {
+		return gtype.ErrInternal.SetDetail("调用接口失败: ", string(output))
+	}
+	if err != nil {
+		return gtype.ErrInternal.SetDetail("调用接口失败: ", err)
+	}
+
+	result := &gtype.Result{}
+	err = result.Unmarshal(output)
+	if err != nil {
+		return gtype.ErrInternal.SetDetail("解析接口结果失败: ", err)
+	}
+	if result.Code != 0 {
+		return gtype.NewError(result.Code, result.Error.Summary, nil, result.Error.Detail)
+	}
+
+	if data != nil {
+		err = result.GetData(data)
+		if err != nil {
+			return gtype.ErrInternal.SetDetail("解析接口数据失败: ", err)
+		}
+	}
+
+	return nil
+}
+
 func (s *Controller) CreateAdler32String(a ...interface{}) string {
 	h := adler32.New()
 	_, err := h.Write([]byte(fmt.Sprint(a...)))
@@ -109,7 +266,20 @@ func (s *Controller) Ad() *assist.Ad {
 	return ad
 }
 
+// GetAdGroupRole returns the role of the group by the account name of it, the result is cached
 func (s *Controller) GetAdGroupRole(account string) int {
+	value, _ := s.Cache.Get(MembershipRole, account, func() (interface{}, error) {
+		return adGroupRole(account), nil
+	})
+	role, ok := value.(int)
+	if !ok {
+		return adGroupRole(account)
+	}
+
+	return role
+}
+
+func adGroupRole(account string) int {
 	av := strings.ToLower(account)
 	if strings.Contains(av, ".authorization.") {
 		return model.GroupRoleAuthorization
@@ -128,16 +298,264 @@ func (s *Controller) GetAdGroupRole(account string) int {
 	return model.GroupRoleOther
 }
 
+// IsAdmin checks whether the account is a member of the admin group, the result is cached
 func (s *Controller) IsAdmin(account string) bool {
 	if s.Cfg == nil {
 		return false
 	}
 
-	ad := s.Ad()
-	ok, err := ad.IsGroupMember(s.Cfg.Ad.AdminGroup, account)
+	value, err := s.Cache.Get(MembershipAdmin, account, func() (interface{}, error) {
+		return s.directory().IsGroupMember(s.Cfg.Ad.AdminGroup, account)
+	})
 	if err != nil {
 		return false
 	}
+	ok, _ := value.(bool)
 
 	return ok
 }
+
+// IsAuthorizationMember checks whether the account is a member (nested) of any authorization role group,
+// the result is cached
+func (s *Controller) IsAuthorizationMember(account string) (bool, error) {
+	if len(account) < 1 {
+		return false, nil
+	}
+
+	value, err := s.Cache.Get(MembershipAuthorization, account, func() (interface{}, error) {
+		return s.isAuthorizationMember(account)
+	})
+	if err != nil {
+		return false, err
+	}
+	ok, _ := value.(bool)
+
+	return ok, nil
+}
+
+func (s *Controller) isAuthorizationMember(account string) (bool, error) {
+	ad := s.Ad()
+	user, err := ad.GetUser(account)
+	if err != nil {
+		if ad.IsNotExit(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	groups, err := ad.GetMemberGroups(user.DN, true)
+	if err != nil {
+		return false, err
+	}
+	for _, group := range groups {
+		if group == nil {
+			continue
+		}
+		if s.GetAdGroupRole(group.Account) == model.GroupRoleAuthorization {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// GetAdResource returns the server, share or svn repository which the group belongs to
+func (s *Controller) GetAdResource(groupDn string) *model.AdResource {
+	ad := &assist.Ad{}
+	return s.GetAdResourceByDn(ad.GetDnParent(groupDn))
+}
+
+// GetAdResourceByDn returns the server, share or svn repository of the organization unit
+func (s *Controller) GetAdResourceByDn(ouDn string) *model.AdResource {
+	ad := &assist.Ad{}
+	resource := &model.AdResource{
+		Type: model.AdResourceOther,
+		Name: ad.GetDnName(ouDn),
+	}
+	resource.Dn = s.ToBase64(ouDn)
+	if s.Cfg == nil {
+		return resource
+	}
+
+	roots := map[int]string{
+		model.AdResourceServer: s.Cfg.Ad.Root.Server,
+		model.AdResourceShare:  s.Cfg.Ad.Root.Share,
+		model.AdResourceSvn:    s.Cfg.Ad.Root.Svn,
+	}
+	pv := strings.ToLower(ouDn)
+	for k, v := range roots {
+		if len(v) < 1 {
+			continue
+		}
+		if strings.HasSuffix(pv, ","+strings.ToLower(v)) {
+			resource.Type = k
+			break
+		}
+	}
+
+	return resource
+}
+
+// GetAdResourceGroups returns the role groups of the servers, shares and svn repositories,
+// all types are returned if types is empty
+func (s *Controller) GetAdResourceGroups(types ...int) ([]*model.AdResourceGroup, error) {
+	results := make([]*model.AdResourceGroup, 0)
+	if s.Cfg == nil {
+		return results, nil
+	}
+
+	roots := []struct {
+		kind int
+		root string
+	}{
+		{model.AdResourceServer, s.Cfg.Ad.Root.Server},
+		{model.AdResourceShare, s.Cfg.Ad.Root.Share},
+		{model.AdResourceSvn, s.Cfg.Ad.Root.Svn},
+	}
+	ad := s.Ad()
+	for _, item := range roots {
+		if len(item.root) < 1 {
+			continue
+		}
+		if len(types) > 0 {
+			matched := false
+			for _, t := range types {
+				if t == item.kind {
+					matched = true
+					break
+				}
+			}
+			if !matched {
+				continue
+			}
+		}
+
+		units, err := ad.GetOrganizationUnits(item.root)
+		if err != nil {
+			if ad.IsNotExit(err) {
+				continue
+			}
+			return nil, err
+		}
+		for _, unit := range units {
+			if unit == nil {
+				continue
+			}
+			groups, ge := ad.GetGroupsFromOrganizationUnit(unit.DN)
+			if ge != nil {
+				return nil, ge
+			}
+			for _, group := range groups {
+				if group == nil {
+					continue
+				}
+
+				result := &model.AdResourceGroup{}
+				result.Resource.Dn = s.ToBase64(unit.DN)
+				result.Resource.Type = item.kind
+				result.Resource.Name = unit.Name
+				result.Group.Dn = s.ToBase64(group.DN)
+				result.Group.Account = group.Account
+				result.Group.Description = group.Description
+				result.Group.Info = group.Info
+				result.Group.Role = s.GetAdGroupRole(group.Account)
+				results = append(results, result)
+			}
+		}
+	}
+
+	return results, nil
+}
+
+// GetAdAuthorizationAccounts returns the accounts of the members of the authorization role groups in the organization unit
+func (s *Controller) GetAdAuthorizationAccounts(ouDn string) ([]string, error) {
+	ad := s.directory()
+	groups, err := ad.GetGroupsFromOrganizationUnit(ouDn)
+	if err != nil {
+		return nil, err
+	}
+
+	accounts := make([]string, 0)
+	exists := make(map[string]bool)
+	for _, group := range groups {
+		if group == nil {
+			continue
+		}
+		if s.GetAdGroupRole(group.Account) != model.GroupRoleAuthorization {
+			continue
+		}
+
+		users, ue := ad.GetUsersFromGroup(group.DN)
+		if ue != nil {
+			return nil, ue
+		}
+		for _, user := range users {
+			if user == nil {
+				continue
+			}
+			key := strings.ToLower(user.Account)
+			if exists[key] {
+				continue
+			}
+			exists[key] = true
+			accounts = append(accounts, user.Account)
+		}
+	}
+
+	return accounts, nil
+}
+
+// CanManageGroup checks whether the account can change the members of the group, that is the members of the
+// admin group, the members of the authorization role groups in the same organization unit as the group,
+// and the user (or the members of the group) set as 'managedBy' of the group
+func (s *Controller) CanManageGroup(account, groupDn string) (bool, error) {
+	if len(account) < 1 {
+		return false, nil
+	}
+	if s.IsAdmin(account) {
+		return true, nil
+	}
+
+	ad := s.directory()
+	group, err := ad.GetGroup(groupDn)
+	if err != nil {
+		return false, err
+	}
+
+	if len(group.ManagedBy) > 0 {
+		ok, err := s.isManagedBy(ad, group.ManagedBy, account)
+		if err != nil {
+			return false, err
+		}
+		if ok {
+			return true, nil
+		}
+	}
+
+	accounts, err := s.GetAdAuthorizationAccounts(ad.GetDnParent(group.DN))
+	if err != nil {
+		return false, err
+	}
+	for _, item := range accounts {
+		if strings.ToLower(item) == strings.ToLower(account) {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+func (s *Controller) isManagedBy(ad Directory, managedBy, account string) (bool, error) {
+	manager, err := ad.GetGroup(managedBy)
+	if err == nil {
+		return ad.IsGroupMember(manager.Account, account)
+	} else if !ad.IsNotExit(err) {
+		return false, err
+	}
+
+	user, err := ad.GetUser(account)
+	if err != nil {
+		return false, err
+	}
+
+	return strings.ToLower(user.DN) == strings.ToLower(managedBy), nil
+}
@@ -115,6 +115,7 @@ func (s *Filter) AddDhcpFilter(ctx gtype.Context, ps gtype.Params) {
 func (s *Filter) AddDhcpFilterDoc(doc gtype.Doc, method string, uri gtype.Uri) {
 	catalog := s.createCatalog(doc, "筛选器")
 	function := catalog.AddFunction(method, uri, "添加筛选器")
+	function.SetRemark("需要管理员权限")
 	function.SetNote("添加IPv4筛选器到允许或拒绝列表")
 	function.SetInputJsonExample(&model.DhcpFilter{
 		Address: "00-1C-23-20-AF-4A",
@@ -125,6 +126,7 @@ func (s *Filter) AddDhcpFilterDoc(doc gtype.Doc, method string, uri gtype.Uri) {
 	function.SetOutputDataExample(nil)
 	function.AddOutputError(gtype.ErrInput)
 	function.AddOutputError(gtype.ErrInternal)
+	function.AddOutputError(gtype.ErrNoPermission)
 }
 
 func (s *Filter) DelDhcpFilter(ctx gtype.Context, ps gtype.Params) {
@@ -165,6 +167,7 @@ func (s *Filter) DelDhcpFilter(ctx gtype.Context, ps gtype.Params) {
 func (s *Filter) DelDhcpFilterDoc(doc gtype.Doc, method string, uri gtype.Uri) {
 	catalog := s.createCatalog(doc, "筛选器")
 	function := catalog.AddFunction(method, uri, "删除筛选器")
+	function.SetRemark("需要管理员权限")
 	function.SetNote("从IPv4筛选器允许或拒绝列表中删除指定的筛选器")
 	function.SetInputJsonExample(&model.DhcpFilterDeleteArgument{
 		Address: "00-1C-23-20-AF-4A",
@@ -172,6 +175,7 @@ func (s *Filter) DelDhcpFilterDoc(doc gtype.Doc, method string, uri gtype.Uri) {
 	function.SetOutputDataExample(nil)
 	function.AddOutputError(gtype.ErrInput)
 	function.AddOutputError(gtype.ErrInternal)
+	function.AddOutputError(gtype.ErrNoPermission)
 }
 
 func (s *Filter) ModDhcpFilter(ctx gtype.Context, ps gtype.Params) {
@@ -231,6 +235,7 @@ func (s *Filter) ModDhcpFilter(ctx gtype.Context, ps gtype.Params) {
 func (s *Filter) ModDhcpFilterDoc(doc gtype.Doc, method string, uri gtype.Uri) {
 	catalog := s.createCatalog(doc, "筛选器")
 	function := catalog.AddFunction(method, uri, "修改筛选器")
+	function.SetRemark("需要管理员权限")
 	function.SetNote("修改IPv4筛选器允许或拒绝列表中已存在的筛选器")
 	function.SetInputJsonExample(&model.DhcpFilterModifyArgument{
 		Address: "00-1C-23-20-AF-4A",
@@ -244,6 +249,7 @@ func (s *Filter) ModDhcpFilterDoc(doc gtype.Doc, method string, uri gtype.Uri) {
 	function.SetOutputDataExample(nil)
 	function.AddOutputError(gtype.ErrInput)
 	function.AddOutputError(gtype.ErrInternal)
+	function.AddOutputError(gtype.ErrNoPermission)
 }
 
 func (s *Filter) GetDhcpLeases(ctx gtype.Context, ps gtype.Params) {
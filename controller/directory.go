@@ -0,0 +1,23 @@
+package controller
+
+import "github.com/csby/goa/assist"
+
+// Directory is the part of AD which decides who manages a group, it is implemented by *assist.Ad
+type Directory interface {
+	GetUser(account string) (*assist.AdEntryUser, error)
+	GetGroup(dn string) (*assist.AdEntryGroup, error)
+	GetGroupsFromOrganizationUnit(ouDN string) ([]*assist.AdEntryGroup, error)
+	GetUsersFromGroup(groupDN string) ([]*assist.AdEntryUser, error)
+	IsGroupMember(groupAccount, memberAccount string) (bool, error)
+	IsNotExit(err error) bool
+	GetDnParent(v string) string
+}
+
+// directory returns the directory set in place of AD (in tests), or AD
+func (s *Controller) directory() Directory {
+	if s.dir != nil {
+		return s.dir
+	}
+
+	return s.Ad()
+}
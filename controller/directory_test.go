@@ -0,0 +1,194 @@
+package controller
+
+import (
+	"fmt"
+	"github.com/csby/goa/assist"
+	"github.com/csby/goa/config"
+	"strings"
+	"testing"
+)
+
+// testDirectory is a fake AD, the members are listed by the account of the group and are not nested
+type testDirectory struct {
+	assist.Ad
+
+	users   []*assist.AdEntryUser
+	groups  []*assist.AdEntryGroup
+	members map[string][]string
+}
+
+func (s *testDirectory) GetUser(account string) (*assist.AdEntryUser, error) {
+	for _, item := range s.users {
+		if strings.ToLower(item.Account) == strings.ToLower(account) {
+			return item, nil
+		}
+	}
+
+	return nil, assist.ErrNotExist
+}
+
+func (s *testDirectory) GetGroup(dn string) (*assist.AdEntryGroup, error) {
+	for _, item := range s.groups {
+		if strings.ToLower(item.DN) == strings.ToLower(dn) {
+			return item, nil
+		}
+	}
+
+	return nil, assist.ErrNotExist
+}
+
+func (s *testDirectory) GetGroupsFromOrganizationUnit(ouDN string) ([]*assist.AdEntryGroup, error) {
+	results := make([]*assist.AdEntryGroup, 0)
+	for _, item := range s.groups {
+		if strings.ToLower(s.GetDnParent(item.DN)) == strings.ToLower(ouDN) {
+			results = append(results, item)
+		}
+	}
+
+	return results, nil
+}
+
+func (s *testDirectory) GetUsersFromGroup(groupDN string) ([]*assist.AdEntryUser, error) {
+	group, err := s.GetGroup(groupDN)
+	if err != nil {
+		return nil, err
+	}
+	results := make([]*assist.AdEntryUser, 0)
+	for _, account := range s.members[strings.ToLower(group.Account)] {
+		user, ue := s.GetUser(account)
+		if ue != nil {
+			return nil, ue
+		}
+		results = append(results, user)
+	}
+
+	return results, nil
+}
+
+func (s *testDirectory) IsGroupMember(groupAccount, memberAccount string) (bool, error) {
+	if len(groupAccount) < 1 || len(memberAccount) < 1 {
+		return false, fmt.Errorf("account is empty")
+	}
+	for _, account := range s.members[strings.ToLower(groupAccount)] {
+		if strings.ToLower(account) == strings.ToLower(memberAccount) {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+func newTestDirectory() *testDirectory {
+	s := &testDirectory{
+		members: map[string][]string{
+			"oa.admins":             {"admin"},
+			"srv01.owners":          {"zhaoliu"},
+			"srv01.authorization.":  {"lisi"},
+			"srv02.authorization.":  {"sunqi"},
+			"srv01.read.write.":     {"zhangsan"},
+			"srv02.read.write.":     {"zhangsan"},
+			"srv01.remote.desktop.": {},
+		},
+	}
+	for _, account := range []string{"admin", "zhangsan", "lisi", "wangwu", "zhaoliu", "sunqi"} {
+		user := &assist.AdEntryUser{Account: account}
+		user.DN = fmt.Sprintf("CN=%s,OU=Users,DC=example,DC=com", account)
+		s.users = append(s.users, user)
+	}
+	groups := []struct {
+		account   string
+		ou        string
+		managedBy string
+	}{
+		{"oa.admins", "OU=Groups,DC=example,DC=com", ""},
+		{"srv01.owners", "OU=Groups,DC=example,DC=com", ""},
+		{"srv01.authorization.", "OU=srv01,OU=Servers,DC=example,DC=com", ""},
+		{"srv01.read.write.", "OU=srv01,OU=Servers,DC=example,DC=com", "CN=wangwu,OU=Users,DC=example,DC=com"},
+		{"srv01.remote.desktop.", "OU=srv01,OU=Servers,DC=example,DC=com", "CN=srv01.owners,OU=Groups,DC=example,DC=com"},
+		{"srv02.authorization.", "OU=srv02,OU=Servers,DC=example,DC=com", ""},
+		{"srv02.read.write.", "OU=srv02,OU=Servers,DC=example,DC=com", ""},
+	}
+	for _, item := range groups {
+		group := &assist.AdEntryGroup{Account: item.account, ManagedBy: item.managedBy}
+		group.DN = fmt.Sprintf("CN=%s,%s", item.account, item.ou)
+		s.groups = append(s.groups, group)
+	}
+
+	return s
+}
+
+func TestController_CanManageGroup(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Ad.AdminGroup = "oa.admins"
+	s := &Controller{Cfg: cfg, dir: newTestDirectory()}
+
+	const (
+		srv01ReadWrite     = "CN=srv01.read.write.,OU=srv01,OU=Servers,DC=example,DC=com"
+		srv01RemoteDesktop = "CN=srv01.remote.desktop.,OU=srv01,OU=Servers,DC=example,DC=com"
+		srv02ReadWrite     = "CN=srv02.read.write.,OU=srv02,OU=Servers,DC=example,DC=com"
+	)
+	cases := []struct {
+		name     string
+		account  string
+		groupDn  string
+		expected bool
+	}{
+		{"admin", "admin", srv02ReadWrite, true},
+		{"admin case insensitive", "ADMIN", srv01ReadWrite, true},
+		{"managedBy user", "wangwu", srv01ReadWrite, true},
+		{"managedBy user of another group", "wangwu", srv01RemoteDesktop, false},
+		{"member of managedBy group", "zhaoliu", srv01RemoteDesktop, true},
+		{"member of managedBy group for another group", "zhaoliu", srv01ReadWrite, false},
+		{"authorization in the same ou", "lisi", srv01ReadWrite, true},
+		{"authorization in the same ou for managed group", "lisi", srv01RemoteDesktop, true},
+		{"authorization of another ou", "lisi", srv02ReadWrite, false},
+		{"authorization of another ou reversed", "sunqi", srv01ReadWrite, false},
+		{"member is not a manager", "zhangsan", srv01ReadWrite, false},
+		{"empty account", "", srv01ReadWrite, false},
+	}
+	for _, c := range cases {
+		actual, err := s.CanManageGroup(c.account, c.groupDn)
+		if err != nil {
+			t.Errorf("%s: %v", c.name, err)
+			continue
+		}
+		if actual != c.expected {
+			t.Errorf("%s: %s on %s, expected %v, actual %v", c.name, c.account, c.groupDn, c.expected, actual)
+		}
+	}
+
+	if _, err := s.CanManageGroup("lisi", "CN=unknown,OU=srv01,OU=Servers,DC=example,DC=com"); err == nil {
+		t.Error("unknown group should fail")
+	}
+}
+
+func TestController_IsManagedBy(t *testing.T) {
+	dir := newTestDirectory()
+	s := &Controller{dir: dir}
+
+	cases := []struct {
+		managedBy string
+		account   string
+		expected  bool
+	}{
+		{"CN=wangwu,OU=Users,DC=example,DC=com", "wangwu", true},
+		{"cn=WANGWU,ou=users,dc=example,dc=com", "WangWu", true},
+		{"CN=wangwu,OU=Users,DC=example,DC=com", "zhaoliu", false},
+		{"CN=srv01.owners,OU=Groups,DC=example,DC=com", "zhaoliu", true},
+		{"CN=srv01.owners,OU=Groups,DC=example,DC=com", "wangwu", false},
+	}
+	for _, c := range cases {
+		actual, err := s.isManagedBy(dir, c.managedBy, c.account)
+		if err != nil {
+			t.Errorf("%s by %s: %v", c.account, c.managedBy, err)
+			continue
+		}
+		if actual != c.expected {
+			t.Errorf("%s by %s: expected %v, actual %v", c.account, c.managedBy, c.expected, actual)
+		}
+	}
+
+	if _, err := s.isManagedBy(dir, "CN=wangwu,OU=Users,DC=example,DC=com", "nobody"); err == nil {
+		t.Error("unknown account should fail")
+	}
+}
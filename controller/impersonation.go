@@ -0,0 +1,62 @@
+package controller
+
+import (
+	"github.com/csby/goa/assist"
+	"github.com/csby/gwsf/gtype"
+	"time"
+)
+
+const (
+	// ImpersonatorHeader is set in the responses of the requests made with the impersonation token,
+	// the value is the account of the admin
+	ImpersonatorHeader = "Goa-Impersonator"
+)
+
+// Impersonation is the Ext of the token issued to an admin who acts as another user,
+// the effective account of the token is the user, and the admin is kept here
+type Impersonation struct {
+	assist.AdEntryUser
+
+	Admin      string
+	AdminName  string
+	Reason     string
+	ExpireTime time.Time
+}
+
+// Transient keeps the token in memory only, so that it is never restored as a token of the user after restart
+func (s *Impersonation) Transient() bool {
+	return true
+}
+
+func (s *Impersonation) Expired(now time.Time) bool {
+	return !s.ExpireTime.After(now)
+}
+
+// ImpersonationOf returns nil if the token is not an impersonation token
+func ImpersonationOf(token *gtype.Token) *Impersonation {
+	if token == nil || token.Ext == nil {
+		return nil
+	}
+	value, ok := token.Ext.(*Impersonation)
+	if !ok {
+		return nil
+	}
+
+	return value
+}
+
+// TokenUser returns the ad user of the token, that is the user impersonated for the impersonation token
+func (s *Controller) TokenUser(token *gtype.Token) *assist.AdEntryUser {
+	if token == nil || token.Ext == nil {
+		return nil
+	}
+
+	switch ext := token.Ext.(type) {
+	case *assist.AdEntryUser:
+		return ext
+	case *Impersonation:
+		return &ext.AdEntryUser
+	}
+
+	return nil
+}
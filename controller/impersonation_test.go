@@ -0,0 +1,41 @@
+package controller
+
+import (
+	"github.com/csby/goa/assist"
+	"github.com/csby/gwsf/gtype"
+	"testing"
+	"time"
+)
+
+func TestController_TokenUser(t *testing.T) {
+	s := &Controller{}
+
+	user := &assist.AdEntryUser{Account: "zhangsan", SID: "S-1-5-21-1"}
+	if s.TokenUser(&gtype.Token{Ext: user}) != user {
+		t.Error("the ext should be the user of the login token")
+	}
+
+	impersonation := &Impersonation{Admin: "admin", ExpireTime: time.Now().Add(time.Minute)}
+	impersonation.AdEntryUser = *user
+	token := &gtype.Token{UserAccount: "zhangsan", Ext: impersonation}
+	actual := s.TokenUser(token)
+	if actual == nil || actual.SID != user.SID {
+		t.Errorf("the user of the impersonation token should be the user impersonated: %#v", actual)
+	}
+	if ImpersonationOf(token) != impersonation {
+		t.Error("the impersonation should be returned")
+	}
+	if ImpersonationOf(&gtype.Token{Ext: user}) != nil {
+		t.Error("the login token is not an impersonation")
+	}
+
+	if impersonation.Expired(time.Now()) {
+		t.Error("the impersonation should not be expired")
+	}
+	if !impersonation.Expired(impersonation.ExpireTime) {
+		t.Error("the impersonation should be expired at the expire time")
+	}
+	if s.TokenUser(&gtype.Token{}) != nil {
+		t.Error("the user should be nil without ext")
+	}
+}
@@ -0,0 +1,168 @@
+package job
+
+import (
+	"fmt"
+	"github.com/csby/goa/controller"
+	"github.com/csby/goa/data/model"
+	"github.com/csby/gwsf/gtype"
+	"time"
+)
+
+const (
+	jobCatalogRoot = "作业"
+	jobBucket      = "job"
+)
+
+type base struct {
+	controller.Controller
+}
+
+type jobStep struct {
+	name     string
+	run      func(step *model.JobStep, dryRun bool) error
+	rollback func(step *model.JobStep) error
+}
+
+func (s *base) createCatalog(doc gtype.Doc, names ...string) gtype.Catalog {
+	root := s.RootCatalog(doc).AddChild(jobCatalogRoot)
+
+	count := len(names)
+	if count < 1 {
+		return root
+	}
+
+	child := root
+	for i := 0; i < count; i++ {
+		name := names[i]
+		child = child.AddChild(name)
+	}
+
+	return child
+}
+
+func (s *base) newJob(kind int, target string, dryRun bool, operator string) *model.Job {
+	return &model.Job{
+		ID:         gtype.NewGuid(),
+		Type:       kind,
+		Target:     target,
+		DryRun:     dryRun,
+		Status:     model.JobRunning,
+		Steps:      make([]*model.JobStep, 0),
+		CreateBy:   operator,
+		CreateTime: gtype.DateTime(time.Now()),
+	}
+}
+
+func (s *base) saveJob(job *model.Job) {
+	if s.Dbs == nil {
+		return
+	}
+
+	err := s.Dbs.Put(jobBucket, job.ID, job)
+	if err != nil {
+		s.LogError(fmt.Sprintf("save job (%s) fail:", job.ID), err)
+	}
+}
+
+// runSteps runs all steps in order and saves the progress after each step, the failed step does not stop the others;
+// a step is marked as succeeded, or planned in dry run, unless it sets the status itself
+func (s *base) runSteps(job *model.Job, steps []*jobStep) {
+	s.initSteps(job, steps)
+
+	failed := false
+	for i, item := range steps {
+		step := job.Steps[i]
+		err := item.run(step, job.DryRun)
+		s.finishStep(step, err, job.DryRun)
+		if err != nil {
+			failed = true
+		}
+		s.saveJob(job)
+	}
+
+	s.finishJob(job, failed)
+}
+
+// runStepsWithRollback runs the steps in order and stops at the first failed step,
+// then the failed step and the succeeded ones before it are rolled back in reverse order;
+// a step keeps the applied objects in its items so that the rollback undoes only what has been done
+func (s *base) runStepsWithRollback(job *model.Job, steps []*jobStep) {
+	s.initSteps(job, steps)
+
+	failed := -1
+	for i, item := range steps {
+		step := job.Steps[i]
+		err := item.run(step, false)
+		s.finishStep(step, err, false)
+		s.saveJob(job)
+		if err != nil {
+			failed = i
+			break
+		}
+	}
+
+	if failed >= 0 {
+		for i := failed + 1; i < len(steps); i++ {
+			job.Steps[i].Status = model.JobStepSkipped
+		}
+		for i := failed; i >= 0; i-- {
+			step := job.Steps[i]
+			item := steps[i]
+			if item.rollback == nil || step.Status == model.JobStepSkipped {
+				continue
+			}
+
+			err := item.rollback(step)
+			if err != nil {
+				if len(step.Error) > 0 {
+					step.Error = fmt.Sprintf("%s; 回滚失败: %v", step.Error, err)
+				} else {
+					step.Error = fmt.Sprintf("回滚失败: %v", err)
+				}
+			} else if step.Status == model.JobStepSucceeded {
+				step.Status = model.JobStepRolledBack
+			}
+			s.saveJob(job)
+		}
+	}
+
+	s.finishJob(job, failed >= 0)
+}
+
+func (s *base) initSteps(job *model.Job, steps []*jobStep) {
+	for _, item := range steps {
+		step := &model.JobStep{
+			Name:   item.name,
+			Status: model.JobStepPending,
+			Items:  make([]string, 0),
+		}
+		job.Steps = append(job.Steps, step)
+	}
+	s.saveJob(job)
+}
+
+func (s *base) finishStep(step *model.JobStep, err error, dryRun bool) {
+	now := gtype.DateTime(time.Now())
+	step.Time = &now
+	if err != nil {
+		step.Status = model.JobStepFailed
+		step.Error = err.Error()
+	} else if step.Status == model.JobStepPending {
+		if dryRun {
+			step.Status = model.JobStepPlanned
+		} else {
+			step.Status = model.JobStepSucceeded
+		}
+	}
+}
+
+func (s *base) finishJob(job *model.Job, failed bool) {
+	now := gtype.DateTime(time.Now())
+	job.FinishTime = &now
+	if failed {
+		job.Status = model.JobFailed
+	} else {
+		job.Status = model.JobSucceeded
+	}
+	s.saveJob(job)
+}
@@ -0,0 +1,157 @@
+package job
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/csby/goa/controller"
+	"github.com/csby/goa/data/model"
+	"github.com/csby/gwsf/gtype"
+	"sort"
+	"strings"
+	"time"
+)
+
+func NewJob(log gtype.Log, param *controller.Parameter) *Job {
+	instance := &Job{}
+	instance.SetLog(log)
+	instance.SetParameter(param)
+
+	return instance
+}
+
+type Job struct {
+	base
+}
+
+func (s *Job) GetList(ctx gtype.Context, ps gtype.Params) {
+	token := s.GetToken(ctx.Token())
+	if token == nil {
+		ctx.Error(gtype.ErrInternal, "凭证无效")
+		return
+	}
+	if s.Dbs == nil {
+		ctx.Error(gtype.ErrInternal, "本地存储不可用")
+		return
+	}
+	if !s.IsAdmin(token.UserAccount) {
+		ctx.Error(gtype.ErrNoPermission, "仅管理员可查看作业")
+		return
+	}
+
+	argument := &model.JobFilter{}
+	err := ctx.GetJson(argument)
+	if err != nil {
+		ctx.Error(gtype.ErrInput, err)
+		return
+	}
+
+	results := make(model.JobCollection, 0)
+	err = s.Dbs.ForEach(jobBucket, func(key string, value []byte) error {
+		item := &model.Job{}
+		if json.Unmarshal(value, item) != nil {
+			return nil
+		}
+		if argument.Type > 0 && argument.Type != item.Type {
+			return nil
+		}
+		if len(argument.Target) > 0 && strings.ToLower(argument.Target) != strings.ToLower(item.Target) {
+			return nil
+		}
+
+		results = append(results, item)
+		return nil
+	})
+	if err != nil {
+		ctx.Error(gtype.ErrInternal, err)
+		return
+	}
+
+	sort.Sort(results)
+	ctx.Success(results)
+}
+
+func (s *Job) GetListDoc(doc gtype.Doc, method string, uri gtype.Uri) {
+	catalog := s.createCatalog(doc)
+	function := catalog.AddFunction(method, uri, "获取作业列表")
+	function.SetNote("仅管理员可查看, 包含每个步骤的执行结果")
+	function.SetInputJsonExample(&model.JobFilter{})
+	function.SetOutputDataExample([]*model.Job{
+		{
+			ID:     gtype.NewGuid(),
+			Type:   model.JobOffboarding,
+			Target: "zhangsan",
+			Status: model.JobSucceeded,
+			Steps: []*model.JobStep{
+				{
+					Name:   "禁用帐号",
+					Status: model.JobStepSucceeded,
+				},
+			},
+			CreateBy:   "admin",
+			CreateTime: gtype.DateTime(time.Now()),
+		},
+	})
+	function.AddOutputError(gtype.ErrTokenEmpty)
+	function.AddOutputError(gtype.ErrTokenInvalid)
+	function.AddOutputError(gtype.ErrNoPermission)
+	function.AddOutputError(gtype.ErrInternal)
+}
+
+func (s *Job) GetDetail(ctx gtype.Context, ps gtype.Params) {
+	token := s.GetToken(ctx.Token())
+	if token == nil {
+		ctx.Error(gtype.ErrInternal, "凭证无效")
+		return
+	}
+	if s.Dbs == nil {
+		ctx.Error(gtype.ErrInternal, "本地存储不可用")
+		return
+	}
+	if !s.IsAdmin(token.UserAccount) {
+		ctx.Error(gtype.ErrNoPermission, "仅管理员可查看作业")
+		return
+	}
+
+	argument := &model.JobID{}
+	err := ctx.GetJson(argument)
+	if err != nil {
+		ctx.Error(gtype.ErrInput, err)
+		return
+	}
+	if len(argument.ID) < 1 {
+		ctx.Error(gtype.ErrInput.SetDetail("作业标识ID(id)为空"))
+		return
+	}
+
+	result := &model.Job{}
+	ok, err := s.Dbs.Get(jobBucket, argument.ID, result)
+	if err != nil {
+		ctx.Error(gtype.ErrInternal, err)
+		return
+	}
+	if !ok {
+		ctx.Error(gtype.ErrInput, fmt.Sprintf("作业(%s)不存在", argument.ID))
+		return
+	}
+
+	ctx.Success(result)
+}
+
+func (s *Job) GetDetailDoc(doc gtype.Doc, method string, uri gtype.Uri) {
+	catalog := s.createCatalog(doc)
+	function := catalog.AddFunction(method, uri, "获取作业详细信息")
+	function.SetInputJsonExample(&model.JobID{
+		ID: gtype.NewGuid(),
+	})
+	function.SetOutputDataExample(&model.Job{
+		ID:     gtype.NewGuid(),
+		Type:   model.JobOffboarding,
+		Target: "zhangsan",
+		Status: model.JobSucceeded,
+	})
+	function.AddOutputError(gtype.ErrTokenEmpty)
+	function.AddOutputError(gtype.ErrTokenInvalid)
+	function.AddOutputError(gtype.ErrNoPermission)
+	function.AddOutputError(gtype.ErrInput)
+	function.AddOutputError(gtype.ErrInternal)
+}
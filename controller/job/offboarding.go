@@ -0,0 +1,397 @@
+package job
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/csby/goa/assist"
+	"github.com/csby/goa/controller"
+	"github.com/csby/goa/data/model"
+	"github.com/csby/goa/data/socket"
+	"github.com/csby/gwsf/gtype"
+	"strings"
+	"time"
+)
+
+type dhcpFilterItem struct {
+	Address string `json:"address"`
+	Comment string `json:"comment"`
+}
+
+type dhcpFilterDelete struct {
+	Address string `json:"address"`
+}
+
+func NewOffboarding(log gtype.Log, param *controller.Parameter) *Offboarding {
+	instance := &Offboarding{}
+	instance.SetLog(log)
+	instance.SetParameter(param)
+
+	return instance
+}
+
+type Offboarding struct {
+	base
+}
+
+func (s *Offboarding) Start(ctx gtype.Context, ps gtype.Params) {
+	token := s.GetToken(ctx.Token())
+	if token == nil {
+		ctx.Error(gtype.ErrInternal, "凭证无效")
+		return
+	}
+	if s.Cfg == nil {
+		ctx.Error(gtype.ErrInternal, "cfg is nil")
+		return
+	}
+	if s.Dbs == nil {
+		ctx.Error(gtype.ErrInternal, "本地存储不可用")
+		return
+	}
+	if !s.IsAdmin(token.UserAccount) {
+		ctx.Error(gtype.ErrNoPermission, "仅管理员可执行离职作业")
+		return
+	}
+
+	argument := &model.JobOffboardingArgument{}
+	err := ctx.GetJson(argument)
+	if err != nil {
+		ctx.Error(gtype.ErrInput, err)
+		return
+	}
+	if len(argument.Account) < 1 {
+		ctx.Error(gtype.ErrInput.SetDetail("用户帐号(account)为空"))
+		return
+	}
+	if strings.ToLower(argument.Account) == strings.ToLower(token.UserAccount) {
+		ctx.Error(gtype.ErrInput.SetDetail("不能对当前登录帐号执行离职作业"))
+		return
+	}
+
+	ad := s.Ad()
+	user, err := ad.GetUser(argument.Account)
+	if err != nil {
+		ctx.Error(gtype.ErrInput, err)
+		return
+	}
+
+	job := s.newJob(model.JobOffboarding, user.Account, argument.DryRun, token.UserAccount)
+	s.runSteps(job, []*jobStep{
+		{
+			name: "禁用帐号",
+			run: func(step *model.JobStep, dryRun bool) error {
+				step.Items = append(step.Items, user.Account)
+				if dryRun {
+					return nil
+				}
+				return ad.SetUserEnable(user.Account, false)
+			},
+		},
+		{
+			name: "注销登录凭证",
+			run: func(step *model.JobStep, dryRun bool) error {
+				return s.revokeTokens(step, dryRun, user)
+			},
+		},
+		{
+			name: "删除微信绑定",
+			run: func(step *model.JobStep, dryRun bool) error {
+				return s.deleteWechatBindings(step, dryRun, user.Account)
+			},
+		},
+		{
+			name: "删除API密钥",
+			run: func(step *model.JobStep, dryRun bool) error {
+				return s.deleteApiKeys(step, dryRun, user.Account)
+			},
+		},
+		{
+			name: "删除NT哈希",
+			run: func(step *model.JobStep, dryRun bool) error {
+				return s.deleteNtHashes(step, dryRun, user.Account)
+			},
+		},
+		{
+			name: "禁用VPN",
+			run: func(step *model.JobStep, dryRun bool) error {
+				step.Items = append(step.Items, user.Account)
+				if dryRun {
+					return nil
+				}
+				_, err := s.CancelVpnGrants(user.Account)
+				if err != nil {
+					return err
+				}
+				return s.SetUserVpnEnable(user.Account, false, model.VpnSourceJob, token.UserAccount, ctx.RIP(), "离职")
+			},
+		},
+		{
+			name: "移除组成员",
+			run: func(step *model.JobStep, dryRun bool) error {
+				return s.removeGroups(step, dryRun, ad, user, token.UserAccount)
+			},
+		},
+		{
+			name: "删除DHCP筛选器",
+			run: func(step *model.JobStep, dryRun bool) error {
+				return s.deleteDhcpFilters(step, dryRun, ad.GetDnName(user.DN))
+			},
+		},
+		{
+			name: "删除SVN权限",
+			run: func(step *model.JobStep, dryRun bool) error {
+				return s.deleteSvnPermissions(step, dryRun, user.SID)
+			},
+		},
+		{
+			name: "移动到离职组织单位",
+			run: func(step *model.JobStep, dryRun bool) error {
+				return s.moveToLeaver(step, dryRun, ad, user)
+			},
+		},
+	})
+
+	ctx.Success(job)
+}
+
+func (s *Offboarding) StartDoc(doc gtype.Doc, method string, uri gtype.Uri) {
+	catalog := s.createCatalog(doc)
+	function := catalog.AddFunction(method, uri, "执行离职作业")
+	function.SetNote("仅管理员可执行, 依次禁用帐号、注销登录凭证并关闭推送连接、删除微信绑定、删除以该帐号调用的API密钥、删除MS-CHAPv2使用的NT哈希、禁用VPN并取消VPN限时授权、移除全部组成员关系、删除所有者的DHCP筛选器、删除SVN访问权限、" +
+		"移动到离职组织单位(config: ad.root.leaver); 某个步骤失败时继续执行其余步骤, 结果中包含每个步骤的执行结果; " +
+		"预演(dryRun)时仅列出将要执行的操作; 邮件服务接口不支持禁用邮箱, 需另行处理")
+	function.SetInputJsonExample(&model.JobOffboardingArgument{
+		Account: "zhangsan",
+		DryRun:  true,
+	})
+	now := gtype.DateTime(time.Now())
+	function.SetOutputDataExample(&model.Job{
+		ID:     gtype.NewGuid(),
+		Type:   model.JobOffboarding,
+		Target: "zhangsan",
+		DryRun: true,
+		Status: model.JobSucceeded,
+		Steps: []*model.JobStep{
+			{
+				Name:   "移除组成员",
+				Status: model.JobStepPlanned,
+				Items:  []string{"CN=rw_share_doc,OU=doc,OU=共享,DC=example,DC=com"},
+				Time:   &now,
+			},
+		},
+		CreateBy:   "admin",
+		CreateTime: now,
+		FinishTime: &now,
+	})
+	function.AddOutputError(gtype.ErrTokenEmpty)
+	function.AddOutputError(gtype.ErrTokenInvalid)
+	function.AddOutputError(gtype.ErrNoPermission)
+	function.AddOutputError(gtype.ErrInput)
+	function.AddOutputError(gtype.ErrInternal)
+}
+
+func (s *Offboarding) revokeTokens(step *model.JobStep, dryRun bool, user *assist.AdEntryUser) error {
+	if s.Tdb == nil {
+		step.Status = model.JobStepSkipped
+		return nil
+	}
+
+	tokens := s.Tdb.GetTokens(user.Account)
+	for _, item := range tokens {
+		step.Items = append(step.Items, fmt.Sprintf("%s (%s)", item.LoginIP, time.Time(item.LoginTime).Format("2006-01-02 15:04:05")))
+	}
+	if dryRun {
+		return nil
+	}
+
+	s.CloseWebSocketChannels(socket.WSUserKicked, user.Account, user.Account)
+	s.Tdb.DelTokens(user.Account)
+
+	return nil
+}
+
+func (s *Offboarding) deleteWechatBindings(step *model.JobStep, dryRun bool, account string) error {
+	return s.deleteRecords(step, dryRun, controller.WechatBindingBucket, func(value []byte) (string, bool) {
+		item := &model.WechatBinding{}
+		if json.Unmarshal(value, item) != nil {
+			return "", false
+		}
+		return item.NickName, strings.ToLower(item.Account) == strings.ToLower(account)
+	})
+}
+
+func (s *Offboarding) deleteApiKeys(step *model.JobStep, dryRun bool, account string) error {
+	return s.deleteRecords(step, dryRun, controller.ApiKeyBucket, func(value []byte) (string, bool) {
+		item := &model.ApiKey{}
+		if json.Unmarshal(value, item) != nil {
+			return "", false
+		}
+		return item.Name, strings.ToLower(item.Account) == strings.ToLower(account)
+	})
+}
+
+func (s *Offboarding) deleteNtHashes(step *model.JobStep, dryRun bool, account string) error {
+	return s.deleteRecords(step, dryRun, controller.NtHashBucket, func(value []byte) (string, bool) {
+		item := &model.NtHash{}
+		if json.Unmarshal(value, item) != nil {
+			return "", false
+		}
+		return item.Account, strings.ToLower(item.Account) == strings.ToLower(account)
+	})
+}
+
+// deleteRecords deletes the records of the bucket which are matched, match returns the name of the record shown in the step
+func (s *Offboarding) deleteRecords(step *model.JobStep, dryRun bool, bucket string, match func(value []byte) (string, bool)) error {
+	keys := make([]string, 0)
+	err := s.Dbs.ForEach(bucket, func(key string, value []byte) error {
+		name, ok := match(value)
+		if ok {
+			keys = append(keys, key)
+			step.Items = append(step.Items, name)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if dryRun {
+		return nil
+	}
+
+	errs := make([]string, 0)
+	for _, key := range keys {
+		err = s.Dbs.Delete(bucket, key)
+		if err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("%s", strings.Join(errs, "; "))
+	}
+
+	return nil
+}
+
+func (s *Offboarding) removeGroups(step *model.JobStep, dryRun bool, ad *assist.Ad, user *assist.AdEntryUser, operator string) error {
+	groups, err := ad.GetMemberGroups(user.DN, false)
+	if err != nil {
+		return err
+	}
+
+	errs := make([]string, 0)
+	for _, group := range groups {
+		step.Items = append(step.Items, group.DN)
+		if dryRun {
+			continue
+		}
+
+		err = s.RemoveGroupMember(group.DN, user.DN, model.GroupMemberSourceJob, operator)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %v", group.DN, err))
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("%s", strings.Join(errs, "; "))
+	}
+
+	return nil
+}
+
+func (s *Offboarding) deleteDhcpFilters(step *model.JobStep, dryRun bool, owner string) error {
+	if len(s.Cfg.Dhcp.Api.Url) < 1 {
+		step.Status = model.JobStepSkipped
+		return nil
+	}
+
+	apiData := make([]*dhcpFilterItem, 0)
+	ge := s.CallApi(s.Cfg.Dhcp.Api.Url, s.Cfg.Dhcp.Api.Uri.Filter.List, nil, &apiData)
+	if ge != nil {
+		return ge
+	}
+
+	// the owner is kept in the comment as "owner - type - remark", match it exactly instead of DhcpFilterAll.Items
+	all := &model.DhcpFilterAll{}
+	for _, item := range apiData {
+		if item == nil {
+			continue
+		}
+		all.Add(item.Address, item.Comment)
+	}
+	errs := make([]string, 0)
+	for _, item := range all.Items("") {
+		if item.Owner != owner {
+			continue
+		}
+		step.Items = append(step.Items, item.Address)
+		if dryRun {
+			continue
+		}
+
+		ge = s.CallApi(s.Cfg.Dhcp.Api.Url, s.Cfg.Dhcp.Api.Uri.Filter.Del, &dhcpFilterDelete{Address: item.Address}, nil)
+		if ge != nil {
+			errs = append(errs, fmt.Sprintf("%s: %s", item.Address, ge.Error()))
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("%s", strings.Join(errs, "; "))
+	}
+
+	return nil
+}
+
+func (s *Offboarding) deleteSvnPermissions(step *model.JobStep, dryRun bool, sid string) error {
+	if len(s.Cfg.Svn.Api.Url) < 1 {
+		step.Status = model.JobStepSkipped
+		return nil
+	}
+
+	permissions := make([]*model.SvnUserPermission, 0)
+	ge := s.CallApi(s.Cfg.Svn.Api.Url, s.Cfg.Svn.Api.Uri.User.Permission, &model.SvnPermissionID{AccountId: sid}, &permissions)
+	if ge != nil {
+		return ge
+	}
+
+	errs := make([]string, 0)
+	for _, item := range permissions {
+		if item == nil {
+			continue
+		}
+		step.Items = append(step.Items, fmt.Sprintf("%s:%s", item.Repository, item.Path))
+		if dryRun {
+			continue
+		}
+
+		ge = s.CallApi(s.Cfg.Svn.Api.Url, s.Cfg.Svn.Api.Uri.Permission.Del, &model.SvnPermissionArgument{
+			Repository: item.Repository,
+			Path:       item.Path,
+			AccountId:  sid,
+		}, nil)
+		if ge != nil {
+			errs = append(errs, fmt.Sprintf("%s:%s: %s", item.Repository, item.Path, ge.Error()))
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("%s", strings.Join(errs, "; "))
+	}
+
+	return nil
+}
+
+func (s *Offboarding) moveToLeaver(step *model.JobStep, dryRun bool, ad *assist.Ad, user *assist.AdEntryUser) error {
+	leaver := s.Cfg.Ad.Root.Leaver
+	if len(leaver) < 1 {
+		step.Status = model.JobStepSkipped
+		return nil
+	}
+	if strings.ToLower(ad.GetDnParent(user.DN)) == strings.ToLower(leaver) {
+		step.Status = model.JobStepSkipped
+		return nil
+	}
+
+	step.Items = append(step.Items, leaver)
+	if dryRun {
+		return nil
+	}
+
+	_, err := ad.MoveEntry(user.DN, leaver)
+	return err
+}
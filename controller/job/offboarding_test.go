@@ -0,0 +1,180 @@
+package job
+
+import (
+	"errors"
+	"github.com/csby/goa/assist"
+	"github.com/csby/goa/config"
+	"github.com/csby/goa/controller"
+	"github.com/csby/goa/data/model"
+	"github.com/csby/goa/data/storage/storagetest"
+	"github.com/csby/gwsf/gtype"
+	"testing"
+	"time"
+)
+
+type testTokenDatabase struct {
+	items map[string]interface{}
+}
+
+func (s *testTokenDatabase) Set(key string, value interface{}) { s.items[key] = value }
+func (s *testTokenDatabase) Del(key string) bool {
+	_, ok := s.items[key]
+	delete(s.items, key)
+	return ok
+}
+func (s *testTokenDatabase) Get(key string, delay bool) (interface{}, bool) {
+	value, ok := s.items[key]
+	return value, ok
+}
+func (s *testTokenDatabase) Permanent(key string, value bool) {}
+
+func newTestOffboarding() *Offboarding {
+	return NewOffboarding(nil, &controller.Parameter{
+		Cfg: &config.Config{},
+		Tdb: controller.NewTokenDatabase(&testTokenDatabase{items: make(map[string]interface{})}),
+	})
+}
+
+func TestOffboarding_RunSteps(t *testing.T) {
+	s := newTestOffboarding()
+	steps := []*jobStep{
+		{name: "ok", run: func(step *model.JobStep, dryRun bool) error { return nil }},
+		{name: "fail", run: func(step *model.JobStep, dryRun bool) error { return errors.New("fail") }},
+		{name: "skip", run: func(step *model.JobStep, dryRun bool) error {
+			step.Status = model.JobStepSkipped
+			return nil
+		}},
+		{name: "after", run: func(step *model.JobStep, dryRun bool) error { return nil }},
+	}
+
+	job := s.newJob(model.JobOffboarding, "zhangsan", false, "admin")
+	s.runSteps(job, steps)
+	if job.Status != model.JobFailed {
+		t.Errorf("job should be failed, got %d", job.Status)
+	}
+	expected := []int{model.JobStepSucceeded, model.JobStepFailed, model.JobStepSkipped, model.JobStepSucceeded}
+	for i, step := range job.Steps {
+		if step.Status != expected[i] {
+			t.Errorf("step %s: expected %d, got %d", step.Name, expected[i], step.Status)
+		}
+	}
+
+	job = s.newJob(model.JobOffboarding, "zhangsan", true, "admin")
+	s.runSteps(job, steps[:1])
+	if job.Status != model.JobSucceeded || job.Steps[0].Status != model.JobStepPlanned {
+		t.Errorf("dry run step should be planned, got %d", job.Steps[0].Status)
+	}
+}
+
+func TestOffboarding_RevokeTokens(t *testing.T) {
+	s := newTestOffboarding()
+	now := time.Now()
+	s.Tdb.Set("t1", &gtype.Token{ID: "t1", UserAccount: "zhangsan", LoginIP: "10.0.0.1", LoginTime: now})
+	s.Tdb.Set("t2", &gtype.Token{ID: "t2", UserAccount: "ZhangSan", LoginIP: "10.0.0.2", LoginTime: now})
+	s.Tdb.Set("t3", &gtype.Token{ID: "t3", UserAccount: "lisi", LoginIP: "10.0.0.3", LoginTime: now})
+	user := &assist.AdEntryUser{Account: "zhangsan"}
+
+	step := &model.JobStep{Items: make([]string, 0)}
+	err := s.revokeTokens(step, true, user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(step.Items) != 2 {
+		t.Errorf("expected 2 tokens, got %v", step.Items)
+	}
+	if len(s.Tdb.GetTokens("zhangsan")) != 2 {
+		t.Error("dry run should not revoke tokens")
+	}
+
+	step = &model.JobStep{Items: make([]string, 0)}
+	err = s.revokeTokens(step, false, user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(s.Tdb.GetTokens("zhangsan")) != 0 {
+		t.Error("tokens of the user should be revoked")
+	}
+	if len(s.Tdb.GetTokens("lisi")) != 1 {
+		t.Error("tokens of the others should be kept")
+	}
+}
+
+func TestOffboarding_MoveToLeaver(t *testing.T) {
+	s := newTestOffboarding()
+	ad := &assist.Ad{}
+	user := &assist.AdEntryUser{Account: "zhangsan"}
+	user.DN = "CN=zhangsan,OU=离职人员,DC=example,DC=com"
+
+	step := &model.JobStep{Status: model.JobStepPending}
+	if err := s.moveToLeaver(step, false, ad, user); err != nil || step.Status != model.JobStepSkipped {
+		t.Errorf("should be skipped without leaver, got %d: %v", step.Status, err)
+	}
+
+	s.Cfg.Ad.Root.Leaver = "OU=离职人员,DC=example,DC=com"
+	step = &model.JobStep{Status: model.JobStepPending}
+	if err := s.moveToLeaver(step, false, ad, user); err != nil || step.Status != model.JobStepSkipped {
+		t.Errorf("should be skipped when already in leaver, got %d: %v", step.Status, err)
+	}
+
+	user.DN = "CN=zhangsan,OU=研发部,DC=example,DC=com"
+	step = &model.JobStep{Status: model.JobStepPending}
+	if err := s.moveToLeaver(step, true, ad, user); err != nil || step.Status != model.JobStepPending {
+		t.Errorf("dry run should be planned, got %d: %v", step.Status, err)
+	}
+	if len(step.Items) != 1 || step.Items[0] != s.Cfg.Ad.Root.Leaver {
+		t.Errorf("unexpected items: %v", step.Items)
+	}
+}
+
+func TestOffboarding_DeleteRecords(t *testing.T) {
+	dbs := storagetest.Open(t)
+	s := NewOffboarding(nil, &controller.Parameter{Cfg: &config.Config{}, Dbs: dbs})
+
+	dbs.Put(controller.WechatBindingBucket, "u1", &model.WechatBinding{UnionID: "u1", Account: "ZhangSan", NickName: "张三"})
+	dbs.Put(controller.WechatBindingBucket, "u2", &model.WechatBinding{UnionID: "u2", Account: "lisi", NickName: "李四"})
+	dbs.Put(controller.ApiKeyBucket, "k1", &model.ApiKey{ID: "k1", Name: "dhcp-kiosk", Account: "zhangsan"})
+	dbs.Put(controller.ApiKeyBucket, "k2", &model.ApiKey{ID: "k2", Name: "backup", Account: "lisi"})
+	dbs.Put(controller.NtHashBucket, "zhangsan", &model.NtHash{Account: "ZhangSan"})
+	dbs.Put(controller.NtHashBucket, "lisi", &model.NtHash{Account: "lisi"})
+
+	step := &model.JobStep{Items: make([]string, 0)}
+	if err := s.deleteWechatBindings(step, true, "zhangsan"); err != nil {
+		t.Fatal(err)
+	}
+	if len(step.Items) != 1 || step.Items[0] != "张三" {
+		t.Errorf("unexpected bindings: %v", step.Items)
+	}
+	if ok, _ := dbs.Get(controller.WechatBindingBucket, "u1", &model.WechatBinding{}); !ok {
+		t.Error("dry run should not delete the binding")
+	}
+
+	step = &model.JobStep{Items: make([]string, 0)}
+	if err := s.deleteWechatBindings(step, false, "zhangsan"); err != nil {
+		t.Fatal(err)
+	}
+	step = &model.JobStep{Items: make([]string, 0)}
+	if err := s.deleteApiKeys(step, false, "zhangsan"); err != nil {
+		t.Fatal(err)
+	}
+	if len(step.Items) != 1 || step.Items[0] != "dhcp-kiosk" {
+		t.Errorf("unexpected api keys: %v", step.Items)
+	}
+	step = &model.JobStep{Items: make([]string, 0)}
+	if err := s.deleteNtHashes(step, false, "zhangsan"); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]map[string]bool{
+		controller.WechatBindingBucket: {"u1": false, "u2": true},
+		controller.ApiKeyBucket:        {"k1": false, "k2": true},
+		controller.NtHashBucket:        {"zhangsan": false, "lisi": true},
+	}
+	for bucket, keys := range expected {
+		for key, kept := range keys {
+			ok, _ := dbs.Get(bucket, key, &map[string]interface{}{})
+			if ok != kept {
+				t.Errorf("%s/%s: expected kept=%v", bucket, key, kept)
+			}
+		}
+	}
+}
@@ -0,0 +1,401 @@
+package job
+
+import (
+	"crypto/rand"
+	"fmt"
+	"github.com/csby/goa/assist"
+	"github.com/csby/goa/config"
+	"github.com/csby/goa/controller"
+	"github.com/csby/goa/data/model"
+	"github.com/csby/goa/data/socket"
+	"github.com/csby/gwsf/gtype"
+	"math/big"
+	"net"
+	"strings"
+	"time"
+)
+
+type dhcpFilterAdd struct {
+	Allow   bool   `json:"allow"`
+	Address string `json:"address"`
+	Comment string `json:"comment"`
+}
+
+func NewOnboarding(log gtype.Log, param *controller.Parameter) *Onboarding {
+	instance := &Onboarding{}
+	instance.SetLog(log)
+	instance.SetParameter(param)
+
+	return instance
+}
+
+type Onboarding struct {
+	base
+}
+
+func (s *Onboarding) Start(ctx gtype.Context, ps gtype.Params) {
+	token := s.GetToken(ctx.Token())
+	if token == nil {
+		ctx.Error(gtype.ErrInternal, "凭证无效")
+		return
+	}
+	if s.Cfg == nil {
+		ctx.Error(gtype.ErrInternal, "cfg is nil")
+		return
+	}
+	if s.Dbs == nil {
+		ctx.Error(gtype.ErrInternal, "本地存储不可用")
+		return
+	}
+	if !s.IsAdmin(token.UserAccount) {
+		ctx.Error(gtype.ErrNoPermission, "仅管理员可执行入职作业")
+		return
+	}
+
+	argument := &model.JobOnboardingArgument{}
+	err := ctx.GetJson(argument)
+	if err != nil {
+		ctx.Error(gtype.ErrInput, err)
+		return
+	}
+	template := s.getTemplate(argument.Department)
+	if template == nil {
+		ctx.Error(gtype.ErrInput.SetDetail(fmt.Sprintf("部门(%s)的入职模板不存在", argument.Department)))
+		return
+	}
+	name := strings.TrimSpace(argument.Name)
+	if len(name) < 1 {
+		ctx.Error(gtype.ErrInput.SetDetail("用户姓名(name)为空"))
+		return
+	}
+	account := strings.TrimSpace(argument.Account)
+	if len(account) < 1 {
+		ctx.Error(gtype.ErrInput.SetDetail("登录帐号(account)为空"))
+		return
+	}
+	macs := make([]string, 0)
+	for _, mac := range argument.Macs {
+		_, err = net.ParseMAC(mac)
+		if err != nil {
+			ctx.Error(gtype.ErrInput.SetDetail(fmt.Sprintf("MAC地址(%s)无效", mac)))
+			return
+		}
+		macs = append(macs, strings.ToUpper(strings.ReplaceAll(mac, ":", "-")))
+	}
+	if len(macs) > 0 && len(s.Cfg.Dhcp.Api.Url) < 1 {
+		ctx.Error(gtype.ErrInternal.SetDetail("配置错误： DHCP服务地址为空"))
+		return
+	}
+	if len(template.Svn) > 0 && len(s.Cfg.Svn.Api.Url) < 1 {
+		ctx.Error(gtype.ErrInternal.SetDetail("配置错误： SVN服务地址为空"))
+		return
+	}
+
+	ad := s.Ad()
+	manager := ""
+	recipient := token.UserAccount
+	if len(argument.Manager) > 0 {
+		manager, err = s.FromBase64(argument.Manager)
+		if err != nil {
+			ctx.Error(gtype.ErrInput, fmt.Errorf("直接主管DN(manager)无效: %s", err.Error()))
+			return
+		}
+		managerUser, err := ad.GetUserByDN(manager)
+		if err != nil {
+			ctx.Error(gtype.ErrInput, fmt.Errorf("直接主管(%s)不存在: %s", ad.GetDnName(manager), err.Error()))
+			return
+		}
+		if s.Tdb != nil && len(s.Tdb.GetTokens(managerUser.Account)) > 0 {
+			recipient = managerUser.Account
+		}
+	}
+
+	password, err := s.newPassword(12)
+	if err != nil {
+		ctx.Error(gtype.ErrInternal, err)
+		return
+	}
+
+	operator := token.UserAccount
+	ip := ctx.RIP()
+	job := s.newJob(model.JobOnboarding, account, false, operator)
+	var user *assist.AdEntryUser
+	svnItems := make([]*model.SvnPermissionArgument, 0)
+	s.runStepsWithRollback(job, []*jobStep{
+		{
+			name: "新建帐号",
+			run: func(step *model.JobStep, dryRun bool) error {
+				user, err = ad.NewUser(&assist.AdEntryUserCreate{
+					Name:     name,
+					Account:  account,
+					Password: password,
+					Manager:  manager,
+					Parent:   template.Parent,
+				})
+				if err != nil {
+					return err
+				}
+				if user == nil {
+					return fmt.Errorf("新建用户(%s)后未找到该用户", account)
+				}
+				step.Items = append(step.Items, user.DN)
+				return nil
+			},
+			rollback: func(step *model.JobStep) error {
+				if user == nil {
+					return nil
+				}
+				return ad.DeleteUser(user.DN)
+			},
+		},
+		{
+			name: "添加组成员",
+			run: func(step *model.JobStep, dryRun bool) error {
+				if len(template.Groups) < 1 {
+					step.Status = model.JobStepSkipped
+					return nil
+				}
+				for _, group := range template.Groups {
+					err := s.AddGroupMember(group, user.DN, model.GroupMemberSourceJob, operator)
+					if err != nil {
+						return fmt.Errorf("%s: %v", group, err)
+					}
+					step.Items = append(step.Items, group)
+				}
+				return nil
+			},
+			rollback: func(step *model.JobStep) error {
+				errs := make([]string, 0)
+				for _, group := range step.Items {
+					err := s.RemoveGroupMember(group, user.DN, model.GroupMemberSourceJob, operator)
+					if err != nil {
+						errs = append(errs, fmt.Sprintf("%s: %v", group, err))
+					}
+				}
+				if len(errs) > 0 {
+					return fmt.Errorf("%s", strings.Join(errs, "; "))
+				}
+				return nil
+			},
+		},
+		{
+			name: "启用VPN",
+			run: func(step *model.JobStep, dryRun bool) error {
+				if !template.Vpn {
+					step.Status = model.JobStepSkipped
+					return nil
+				}
+				err := s.SetUserVpnEnable(account, true, model.VpnSourceJob, operator, ip, "入职")
+				if err != nil {
+					return err
+				}
+				step.Items = append(step.Items, account)
+				return nil
+			},
+			rollback: func(step *model.JobStep) error {
+				if len(step.Items) < 1 {
+					return nil
+				}
+				return s.SetUserVpnEnable(account, false, model.VpnSourceJob, operator, ip, "入职回滚")
+			},
+		},
+		{
+			name: "添加DHCP筛选器",
+			run: func(step *model.JobStep, dryRun bool) error {
+				if len(macs) < 1 {
+					step.Status = model.JobStepSkipped
+					return nil
+				}
+				for _, mac := range macs {
+					ge := s.CallApi(s.Cfg.Dhcp.Api.Url, s.Cfg.Dhcp.Api.Uri.Filter.Add, &dhcpFilterAdd{
+						Allow:   true,
+						Address: mac,
+						Comment: fmt.Sprintf("%s - %s - %s", name, template.Dhcp, "入职"),
+					}, nil)
+					if ge != nil {
+						return fmt.Errorf("%s: %s", mac, ge.Error())
+					}
+					step.Items = append(step.Items, mac)
+				}
+				return nil
+			},
+			rollback: func(step *model.JobStep) error {
+				errs := make([]string, 0)
+				for _, mac := range step.Items {
+					ge := s.CallApi(s.Cfg.Dhcp.Api.Url, s.Cfg.Dhcp.Api.Uri.Filter.Del, &dhcpFilterDelete{Address: mac}, nil)
+					if ge != nil {
+						errs = append(errs, fmt.Sprintf("%s: %s", mac, ge.Error()))
+					}
+				}
+				if len(errs) > 0 {
+					return fmt.Errorf("%s", strings.Join(errs, "; "))
+				}
+				return nil
+			},
+		},
+		{
+			name: "添加SVN权限",
+			run: func(step *model.JobStep, dryRun bool) error {
+				if len(template.Svn) < 1 {
+					step.Status = model.JobStepSkipped
+					return nil
+				}
+				for _, item := range template.Svn {
+					if item == nil {
+						continue
+					}
+					argument := &model.SvnPermissionArgumentEdit{
+						SvnPermissionArgument: model.SvnPermissionArgument{
+							Repository: item.Repository,
+							Path:       item.Path,
+							AccountId:  user.SID,
+						},
+						AccessLevel: item.AccessLevel,
+					}
+					ge := s.CallApi(s.Cfg.Svn.Api.Url, s.Cfg.Svn.Api.Uri.Permission.Add, argument, nil)
+					if ge != nil {
+						return fmt.Errorf("%s:%s: %s", item.Repository, item.Path, ge.Error())
+					}
+					svnItems = append(svnItems, &argument.SvnPermissionArgument)
+					step.Items = append(step.Items, fmt.Sprintf("%s:%s", item.Repository, item.Path))
+				}
+				return nil
+			},
+			rollback: func(step *model.JobStep) error {
+				errs := make([]string, 0)
+				for _, item := range svnItems {
+					ge := s.CallApi(s.Cfg.Svn.Api.Url, s.Cfg.Svn.Api.Uri.Permission.Del, item, nil)
+					if ge != nil {
+						errs = append(errs, fmt.Sprintf("%s:%s: %s", item.Repository, item.Path, ge.Error()))
+					}
+				}
+				if len(errs) > 0 {
+					return fmt.Errorf("%s", strings.Join(errs, "; "))
+				}
+				return nil
+			},
+		},
+		{
+			name: "发送初始密码",
+			run: func(step *model.JobStep, dryRun bool) error {
+				// the password is also returned in the result, so the account is kept even if it can not be pushed
+				ok := s.WriteWebSocketMessageToAccounts(socket.WSOnboardingPassword, &model.JobOnboardingPassword{
+					JobID:    job.ID,
+					Account:  user.Account,
+					Name:     user.Name,
+					Password: password,
+				}, recipient)
+				if !ok {
+					step.Status = model.JobStepSkipped
+					return nil
+				}
+				step.Items = append(step.Items, recipient)
+				return nil
+			},
+		},
+	})
+
+	result := &model.JobOnboardingResult{Job: *job}
+	if job.Status == model.JobSucceeded {
+		result.Password = password
+	}
+	ctx.Success(result)
+}
+
+func (s *Onboarding) StartDoc(doc gtype.Doc, method string, uri gtype.Uri) {
+	catalog := s.createCatalog(doc)
+	function := catalog.AddFunction(method, uri, "执行入职作业")
+	function.SetNote("仅管理员可执行, 按部门的入职模板(config: ad.onboarding)依次新建帐号、添加组成员、启用VPN、添加DHCP筛选器、添加SVN权限; " +
+		"某个步骤失败时停止执行, 并按相反顺序回滚已完成的步骤(如删除新建的帐号); " +
+		"成功后随机生成的初始密码仅在本次结果(password)中返回一次, 不保存在作业记录中, 同时通过消息推送(id=2031)发送给直接主管, 直接主管不在线或未指定时发送给当前操作人, " +
+		"消息推送不可用时跳过该步骤; 新建帐号后无法读取该帐号时删除该帐号并停止执行")
+	function.SetInputJsonExample(&model.JobOnboardingArgument{
+		Department: "研发部",
+		Name:       "张三",
+		Account:    "zhangsan",
+		Macs:       []string{"00-1C-23-20-AF-4A"},
+	})
+	now := gtype.DateTime(time.Now())
+	function.SetOutputDataExample(&model.JobOnboardingResult{
+		Job: model.Job{
+			ID:     gtype.NewGuid(),
+			Type:   model.JobOnboarding,
+			Target: "zhangsan",
+			Status: model.JobSucceeded,
+			Steps: []*model.JobStep{
+				{
+					Name:   "新建帐号",
+					Status: model.JobStepSucceeded,
+					Items:  []string{"CN=张三,OU=研发部,OU=用户账号,DC=example,DC=com"},
+					Time:   &now,
+				},
+			},
+			CreateBy:   "admin",
+			CreateTime: now,
+			FinishTime: &now,
+		},
+		Password: "Xk7#mP2qR9&w",
+	})
+	function.AddOutputError(gtype.ErrTokenEmpty)
+	function.AddOutputError(gtype.ErrTokenInvalid)
+	function.AddOutputError(gtype.ErrNoPermission)
+	function.AddOutputError(gtype.ErrInput)
+	function.AddOutputError(gtype.ErrInternal)
+}
+
+func (s *Onboarding) getTemplate(department string) *config.MsAdOnboarding {
+	if len(department) < 1 {
+		return nil
+	}
+
+	for _, item := range s.Cfg.Ad.Onboarding {
+		if item == nil {
+			continue
+		}
+		if strings.ToLower(item.Department) == strings.ToLower(department) {
+			return item
+		}
+	}
+
+	return nil
+}
+
+// newPassword generates a random password which contains upper and lower case letters, digits and symbols,
+// so that it meets the complexity requirement of the domain
+func (s *Onboarding) newPassword(length int) (string, error) {
+	sets := []string{
+		"ABCDEFGHJKLMNPQRSTUVWXYZ",
+		"abcdefghijkmnpqrstuvwxyz",
+		"23456789",
+		"!@#$%^&*",
+	}
+	if length < len(sets) {
+		length = len(sets)
+	}
+
+	all := strings.Join(sets, "")
+	chars := make([]byte, length)
+	for i := 0; i < length; i++ {
+		set := all
+		if i < len(sets) {
+			set = sets[i]
+		}
+		n, err := rand.Int(rand.Reader, big.NewInt(int64(len(set))))
+		if err != nil {
+			return "", err
+		}
+		chars[i] = set[n.Int64()]
+	}
+
+	// shuffle so that the required characters are not always at the beginning
+	for i := length - 1; i > 0; i-- {
+		n, err := rand.Int(rand.Reader, big.NewInt(int64(i+1)))
+		if err != nil {
+			return "", err
+		}
+		j := n.Int64()
+		chars[i], chars[j] = chars[j], chars[i]
+	}
+
+	return string(chars), nil
+}
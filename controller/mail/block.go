@@ -87,12 +87,14 @@ func (s *Block) AddReceiverAddress(ctx gtype.Context, ps gtype.Params) {
 func (s *Block) AddReceiverAddressDoc(doc gtype.Doc, method string, uri gtype.Uri) {
 	catalog := s.createCatalog(doc, "收件人")
 	function := catalog.AddFunction(method, uri, "添加阻止地址")
+	function.SetRemark("需要管理员权限")
 	function.SetInputJsonExample(&model.MailAddress{
 		Address: "test@example.com",
 	})
 	function.SetOutputDataExample(nil)
 	function.AddOutputError(gtype.ErrInput)
 	function.AddOutputError(gtype.ErrInternal)
+	function.AddOutputError(gtype.ErrNoPermission)
 }
 
 func (s *Block) DelReceiverAddress(ctx gtype.Context, ps gtype.Params) {
@@ -121,12 +123,14 @@ func (s *Block) DelReceiverAddress(ctx gtype.Context, ps gtype.Params) {
 func (s *Block) DelReceiverAddressDoc(doc gtype.Doc, method string, uri gtype.Uri) {
 	catalog := s.createCatalog(doc, "收件人")
 	function := catalog.AddFunction(method, uri, "删除阻止地址")
+	function.SetRemark("需要管理员权限")
 	function.SetInputJsonExample(&model.MailAddress{
 		Address: "test@example.com",
 	})
 	function.SetOutputDataExample(nil)
 	function.AddOutputError(gtype.ErrInput)
 	function.AddOutputError(gtype.ErrInternal)
+	function.AddOutputError(gtype.ErrNoPermission)
 }
 
 func (s *Block) GetSenderAddressPage(ctx gtype.Context, ps gtype.Params) {
@@ -198,12 +202,14 @@ func (s *Block) AddSenderAddress(ctx gtype.Context, ps gtype.Params) {
 func (s *Block) AddSenderAddressDoc(doc gtype.Doc, method string, uri gtype.Uri) {
 	catalog := s.createCatalog(doc, "发件人")
 	function := catalog.AddFunction(method, uri, "添加阻止地址")
+	function.SetRemark("需要管理员权限")
 	function.SetInputJsonExample(&model.MailAddress{
 		Address: "test@example.com",
 	})
 	function.SetOutputDataExample(nil)
 	function.AddOutputError(gtype.ErrInput)
 	function.AddOutputError(gtype.ErrInternal)
+	function.AddOutputError(gtype.ErrNoPermission)
 }
 
 func (s *Block) DelSenderAddress(ctx gtype.Context, ps gtype.Params) {
@@ -232,12 +238,14 @@ func (s *Block) DelSenderAddress(ctx gtype.Context, ps gtype.Params) {
 func (s *Block) DelSenderAddressDoc(doc gtype.Doc, method string, uri gtype.Uri) {
 	catalog := s.createCatalog(doc, "发件人")
 	function := catalog.AddFunction(method, uri, "删除阻止地址")
+	function.SetRemark("需要管理员权限")
 	function.SetInputJsonExample(&model.MailAddress{
 		Address: "test@example.com",
 	})
 	function.SetOutputDataExample(nil)
 	function.AddOutputError(gtype.ErrInput)
 	function.AddOutputError(gtype.ErrInternal)
+	function.AddOutputError(gtype.ErrNoPermission)
 }
 
 func (s *Block) GetSenderIpPage(ctx gtype.Context, ps gtype.Params) {
@@ -0,0 +1,120 @@
+package controller
+
+import (
+	"fmt"
+	"github.com/csby/goa/data/model"
+	"github.com/csby/gwsf/gtype"
+	"strings"
+	"time"
+)
+
+const (
+	GroupMemberExpirationBucket = "group.member.expiration"
+	GroupMemberEventBucket      = "group.member.event"
+)
+
+func (s *Controller) GroupMemberExpirationKey(groupDn, memberDn string) string {
+	return fmt.Sprintf("%s:%s", s.ToBase64(strings.ToLower(groupDn)), s.ToBase64(strings.ToLower(memberDn)))
+}
+
+func (s *Controller) DeleteGroupMemberExpiration(groupDn, memberDn string) error {
+	if s.Dbs == nil {
+		return nil
+	}
+
+	return s.Dbs.Delete(GroupMemberExpirationBucket, s.GroupMemberExpirationKey(groupDn, memberDn))
+}
+
+func (s *Controller) GroupMemberEventKeyPrefix(t time.Time) string {
+	return fmt.Sprintf("%019d", t.UnixNano())
+}
+
+// RecordGroupMemberEvent saves the member change made through goa, the key starts with the time
+// so that the events are stored in order
+func (s *Controller) RecordGroupMemberEvent(groupDn, memberDn string, action, source int, operator string) {
+	if s.Dbs == nil {
+		return
+	}
+
+	ad := s.Ad()
+	now := time.Now()
+	event := &model.GroupMemberEvent{
+		ID:       fmt.Sprintf("%s.%s", s.GroupMemberEventKeyPrefix(now), gtype.NewGuid()),
+		Action:   action,
+		Source:   source,
+		Operator: operator,
+		Time:     gtype.DateTime(now),
+	}
+	event.Group.Dn = s.ToBase64(groupDn)
+	event.Group.Account = ad.GetDnName(groupDn)
+	group, err := ad.GetGroup(groupDn)
+	if err == nil {
+		event.Group.Account = group.Account
+		event.Group.Description = group.Description
+		event.Group.Info = group.Info
+	}
+	event.Member.Dn = s.ToBase64(memberDn)
+	event.Member.Name = ad.GetDnName(memberDn)
+	member, err := ad.GetUserByDN(memberDn)
+	if err == nil {
+		event.Member.SID = member.SID
+		event.Member.Account = member.Account
+		event.Member.Name = member.Name
+	}
+
+	err = s.Dbs.Put(GroupMemberEventBucket, event.ID, event)
+	if err != nil {
+		s.LogError("save group member event fail:", err)
+	}
+}
+
+// AddGroupMember adds the member to the group, the cached membership of the member is invalidated and the change is recorded
+func (s *Controller) AddGroupMember(groupDn, memberDn string, source int, operator string) error {
+	ad := s.Ad()
+	err := ad.AddGroupMember(groupDn, memberDn)
+	if err != nil {
+		return err
+	}
+
+	s.invalidateMembership(memberDn)
+	s.RecordGroupMemberEvent(groupDn, memberDn, model.GroupMemberAdded, source, operator)
+
+	return nil
+}
+
+// RemoveGroupMember removes the member from the group, the expiration and the cached membership of the member
+// are deleted and the change is recorded; it is not an error if the member has been removed already, but nothing is recorded
+func (s *Controller) RemoveGroupMember(groupDn, memberDn string, source int, operator string) error {
+	ad := s.Ad()
+	err := ad.RemoveGroupMember(groupDn, memberDn)
+	if err != nil {
+		if !ad.IsNotMember(err) {
+			return err
+		}
+		// removed outside goa already, only the local records are cleaned
+		s.invalidateMembership(memberDn)
+		s.DeleteGroupMemberExpiration(groupDn, memberDn)
+		return nil
+	}
+
+	s.invalidateMembership(memberDn)
+	s.DeleteGroupMemberExpiration(groupDn, memberDn)
+	s.RecordGroupMemberEvent(groupDn, memberDn, model.GroupMemberRemoved, source, operator)
+
+	return nil
+}
+
+// invalidateMembership removes the cached membership of the user, or all cached entries if the member is not a user
+// (e.g. a nested group) since the membership of its members are changed too
+func (s *Controller) invalidateMembership(memberDn string) {
+	if s.Cache == nil {
+		return
+	}
+
+	user, err := s.Ad().GetUserByDN(memberDn)
+	if err != nil || user == nil || len(user.Account) < 1 {
+		s.Cache.Clear()
+		return
+	}
+	s.Cache.Invalidate(user.Account)
+}
@@ -0,0 +1,182 @@
+package controller
+
+import (
+	"github.com/csby/goa/data/model"
+	"github.com/csby/gwsf/gtype"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	MembershipAdmin         = "admin"         // 是否为管理员组成员
+	MembershipAuthorization = "authorization" // 是否为资源授权组成员
+	MembershipRole          = "role"          // 组的角色
+)
+
+func NewMembershipCache(ttl time.Duration) *MembershipCache {
+	return &MembershipCache{
+		ttl:   ttl,
+		items: make(map[string]*membershipItem),
+		stats: make(map[string]*membershipStat),
+	}
+}
+
+// MembershipCache keeps the results of the group membership and role lookups for ttl, keyed by kind and account,
+// so that the admin checks do not search the directory on every request; the entries of an account are invalidated
+// when goa changes the members, the changes made outside goa take effect after ttl
+type MembershipCache struct {
+	ttl time.Duration
+
+	mutex      sync.Mutex
+	items      map[string]*membershipItem // key: kind:account
+	stats      map[string]*membershipStat // key: kind
+	generation uint64                     // increased by Invalidate and Clear
+}
+
+type membershipItem struct {
+	value      interface{}
+	expireTime time.Time
+}
+
+type membershipStat struct {
+	hits   uint64
+	misses uint64
+}
+
+// Get returns the cached value of the account, load is called on miss and its result is cached if no error
+// and the cache is not invalidated during the load, which may have read the members before the change;
+// load is always called if the cache is nil or disabled
+func (s *MembershipCache) Get(kind, account string, load func() (interface{}, error)) (interface{}, error) {
+	if s == nil || s.ttl <= 0 {
+		return load()
+	}
+
+	key := s.key(kind, account)
+	now := time.Now()
+	s.mutex.Lock()
+	item, ok := s.items[key]
+	if ok && item.expireTime.After(now) {
+		s.stat(kind).hits++
+		s.mutex.Unlock()
+		return item.value, nil
+	}
+	s.stat(kind).misses++
+	generation := s.generation
+	s.mutex.Unlock()
+
+	value, err := load()
+	if err != nil {
+		return nil, err
+	}
+
+	s.mutex.Lock()
+	if s.generation == generation {
+		s.items[key] = &membershipItem{
+			value:      value,
+			expireTime: now.Add(s.ttl),
+		}
+	}
+	s.mutex.Unlock()
+
+	return value, nil
+}
+
+// Invalidate removes the entries of the accounts of all kinds
+func (s *MembershipCache) Invalidate(accounts ...string) {
+	if s == nil {
+		return
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.generation++
+	for _, account := range accounts {
+		suffix := ":" + strings.ToLower(account)
+		for key := range s.items {
+			if strings.HasSuffix(key, suffix) {
+				delete(s.items, key)
+			}
+		}
+	}
+}
+
+// Clear removes all entries, the stats are kept
+func (s *MembershipCache) Clear() int {
+	if s == nil {
+		return 0
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	count := len(s.items)
+	s.items = make(map[string]*membershipItem)
+	s.generation++
+
+	return count
+}
+
+// Stats returns the hits and misses of each kind, the expired entries are removed
+func (s *MembershipCache) Stats() *model.MembershipCacheStats {
+	result := &model.MembershipCacheStats{
+		Kinds: make([]*model.MembershipCacheStat, 0),
+	}
+	if s == nil {
+		return result
+	}
+	result.Enabled = s.ttl > 0
+	result.Ttl = int64(s.ttl.Seconds())
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	now := time.Now()
+	sizes := make(map[string]int)
+	for key, item := range s.items {
+		if !item.expireTime.After(now) {
+			delete(s.items, key)
+			continue
+		}
+		sizes[key[:strings.Index(key, ":")]]++
+	}
+	result.Size = len(s.items)
+
+	for _, kind := range []string{MembershipAdmin, MembershipAuthorization, MembershipRole} {
+		stat := s.stat(kind)
+		item := &model.MembershipCacheStat{
+			Kind:   kind,
+			Size:   sizes[kind],
+			Hits:   stat.hits,
+			Misses: stat.misses,
+		}
+		if total := stat.hits + stat.misses; total > 0 {
+			item.HitRate = float64(stat.hits) / float64(total)
+		}
+		result.Hits += stat.hits
+		result.Misses += stat.misses
+		result.Kinds = append(result.Kinds, item)
+	}
+	if total := result.Hits + result.Misses; total > 0 {
+		result.HitRate = float64(result.Hits) / float64(total)
+	}
+	result.Time = gtype.DateTime(now)
+
+	return result
+}
+
+func (s *MembershipCache) key(kind, account string) string {
+	return kind + ":" + strings.ToLower(account)
+}
+
+// stat returns the stat of the kind, the mutex must be locked by the caller
+func (s *MembershipCache) stat(kind string) *membershipStat {
+	stat, ok := s.stats[kind]
+	if !ok {
+		stat = &membershipStat{}
+		s.stats[kind] = stat
+	}
+
+	return stat
+}
@@ -0,0 +1,132 @@
+package controller
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestMembershipCache_Get(t *testing.T) {
+	s := NewMembershipCache(time.Minute)
+	loads := 0
+	load := func() (interface{}, error) {
+		loads++
+		return true, nil
+	}
+
+	for i := 0; i < 3; i++ {
+		value, err := s.Get(MembershipAdmin, "ZhangSan", load)
+		if err != nil || value != true {
+			t.Fatalf("unexpected value: %v, %v", value, err)
+		}
+	}
+	s.Get(MembershipAdmin, "zhangsan", load)
+	if loads != 1 {
+		t.Errorf("expected 1 load, got %d", loads)
+	}
+
+	// errors are not cached
+	_, err := s.Get(MembershipAuthorization, "zhangsan", func() (interface{}, error) {
+		return nil, fmt.Errorf("dc unavailable")
+	})
+	if err == nil {
+		t.Fatal("error expected")
+	}
+	s.Get(MembershipAuthorization, "zhangsan", load)
+	if loads != 2 {
+		t.Errorf("expected 2 loads, got %d", loads)
+	}
+
+	stats := s.Stats()
+	if stats.Hits != 3 || stats.Misses != 3 || stats.Size != 2 {
+		t.Errorf("unexpected stats: %+v", stats)
+	}
+	if stats.Kinds[0].Kind != MembershipAdmin || stats.Kinds[0].Hits != 3 || stats.Kinds[0].Misses != 1 {
+		t.Errorf("unexpected admin stats: %+v", stats.Kinds[0])
+	}
+
+	s.Invalidate("ZHANGSAN")
+	s.Get(MembershipAdmin, "zhangsan", load)
+	if loads != 3 {
+		t.Errorf("expected 3 loads after invalidation, got %d", loads)
+	}
+	s.Get(MembershipAdmin, "lisi", load)
+	if count := s.Clear(); count != 2 {
+		t.Errorf("expected 2 entries cleared, got %d", count)
+	}
+}
+
+func TestMembershipCache_Expired(t *testing.T) {
+	s := NewMembershipCache(time.Millisecond)
+	loads := 0
+	load := func() (interface{}, error) {
+		loads++
+		return loads, nil
+	}
+
+	s.Get(MembershipRole, "share.read.docs", load)
+	time.Sleep(5 * time.Millisecond)
+	value, _ := s.Get(MembershipRole, "share.read.docs", load)
+	if value != 2 {
+		t.Errorf("the expired entry should be loaded again, got %v", value)
+	}
+	time.Sleep(5 * time.Millisecond)
+	if size := s.Stats().Size; size != 0 {
+		t.Errorf("the expired entries should not be counted, got %d", size)
+	}
+}
+
+func TestMembershipCache_Disabled(t *testing.T) {
+	var caches = []*MembershipCache{nil, NewMembershipCache(0)}
+	for _, s := range caches {
+		loads := 0
+		for i := 0; i < 2; i++ {
+			s.Get(MembershipAdmin, "zhangsan", func() (interface{}, error) {
+				loads++
+				return true, nil
+			})
+		}
+		if loads != 2 {
+			t.Errorf("the disabled cache should always load, got %d loads", loads)
+		}
+		if s.Stats().Enabled {
+			t.Error("the cache should be disabled")
+		}
+	}
+}
+
+func TestMembershipCache_InvalidateDuringLoad(t *testing.T) {
+	s := NewMembershipCache(time.Minute)
+
+	// the members are changed and invalidated while the old membership is being read
+	value, err := s.Get(MembershipAdmin, "zhangsan", func() (interface{}, error) {
+		s.Invalidate("zhangsan")
+		return true, nil
+	})
+	if err != nil || value != true {
+		t.Fatalf("unexpected value: %v, %v", value, err)
+	}
+	value, _ = s.Get(MembershipAdmin, "zhangsan", func() (interface{}, error) {
+		return false, nil
+	})
+	if value != false {
+		t.Error("the value loaded before the invalidation should not be cached")
+	}
+
+	s.Get(MembershipRole, "srv01.read.", func() (interface{}, error) {
+		s.Clear()
+		return 69, nil
+	})
+	value, _ = s.Get(MembershipRole, "srv01.read.", func() (interface{}, error) {
+		return 68, nil
+	})
+	if value != 68 {
+		t.Error("the value loaded before the clear should not be cached")
+	}
+	value, _ = s.Get(MembershipRole, "srv01.read.", func() (interface{}, error) {
+		return 0, nil
+	})
+	if value != 68 {
+		t.Error("the value loaded after the clear should be cached")
+	}
+}
@@ -0,0 +1,133 @@
+package controller
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"github.com/csby/goa/assist"
+	"github.com/csby/goa/data/model"
+	"github.com/csby/gwsf/gtype"
+	"strings"
+	"time"
+)
+
+const (
+	NtHashBucket = "nt.hash"
+)
+
+// NtHashEnabled returns true if MS-CHAPv2 of RADIUS is enabled, only then the NT hashes are saved
+func (s *Controller) NtHashEnabled() bool {
+	return s.Cfg != nil && s.Cfg.Radius.Enabled && s.Cfg.Radius.MsChap2.Enabled && s.Dbs != nil
+}
+
+// SaveNtHash keeps the NT hash of the password which MS-CHAPv2 requires, AD does not expose it through LDAP;
+// it is called when goa knows the password (login, PAP and password change) and does nothing if MS-CHAPv2 is disabled
+func (s *Controller) SaveNtHash(account, password string) error {
+	if !s.NtHashEnabled() {
+		return nil
+	}
+
+	// read again to get pwdLastSet after the password is changed
+	user, err := s.Ad().GetUser(account)
+	if err != nil {
+		return err
+	}
+
+	return s.PutNtHash(user, password)
+}
+
+// PutNtHash saves the NT hash encrypted with radius.msChap2.key, it is bound to pwdLastSet of the user
+// so that it is ignored once the password is changed outside goa
+func (s *Controller) PutNtHash(user *assist.AdEntryUser, password string) error {
+	if user == nil || len(user.Account) < 1 {
+		return fmt.Errorf("帐号为空")
+	}
+	aead, err := s.ntHashAead()
+	if err != nil {
+		return err
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	_, err = rand.Read(nonce)
+	if err != nil {
+		return err
+	}
+	hash := assist.MsChap2NtPasswordHash(password)
+	item := &model.NtHash{
+		Account:    user.Account,
+		Hash:       base64.StdEncoding.EncodeToString(aead.Seal(nonce, nonce, hash, []byte(strings.ToLower(user.Account)))),
+		PwdLastSet: user.PwdLastSet,
+		UpdateTime: gtype.DateTime(time.Now()),
+	}
+
+	return s.Dbs.Put(NtHashBucket, strings.ToLower(user.Account), item)
+}
+
+// GetNtHash returns the NT hash of the current password of the user, it fails if no hash is saved
+// or the password has been changed since the hash was saved
+func (s *Controller) GetNtHash(user *assist.AdEntryUser) ([]byte, error) {
+	if user == nil || len(user.Account) < 1 {
+		return nil, fmt.Errorf("帐号为空")
+	}
+	if s.Dbs == nil {
+		return nil, fmt.Errorf("本地存储不可用")
+	}
+	aead, err := s.ntHashAead()
+	if err != nil {
+		return nil, err
+	}
+
+	item := &model.NtHash{}
+	ok, err := s.Dbs.Get(NtHashBucket, strings.ToLower(user.Account), item)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, fmt.Errorf("帐号(%s)未保存NT哈希, 需先登录系统一次", user.Account)
+	}
+	if item.PwdLastSet != user.PwdLastSet {
+		return nil, fmt.Errorf("帐号(%s)的密码已在其他系统修改, 需重新登录系统一次", user.Account)
+	}
+
+	data, err := base64.StdEncoding.DecodeString(item.Hash)
+	if err != nil {
+		return nil, err
+	}
+	size := aead.NonceSize()
+	if len(data) < size {
+		return nil, fmt.Errorf("NT哈希无效")
+	}
+	hash, err := aead.Open(nil, data[:size], data[size:], []byte(strings.ToLower(user.Account)))
+	if err != nil {
+		return nil, fmt.Errorf("NT哈希解密失败: %v", err)
+	}
+
+	return hash, nil
+}
+
+func (s *Controller) DeleteNtHash(account string) error {
+	if s.Dbs == nil {
+		return nil
+	}
+
+	return s.Dbs.Delete(NtHashBucket, strings.ToLower(account))
+}
+
+func (s *Controller) ntHashAead() (cipher.AEAD, error) {
+	if s.Cfg == nil || s.Dbs == nil {
+		return nil, fmt.Errorf("MS-CHAPv2不可用")
+	}
+	k, err := hex.DecodeString(s.Cfg.Radius.MsChap2.Key)
+	if err != nil {
+		return nil, fmt.Errorf("MS-CHAPv2配置错误: 密钥(radius.msChap2.key)无效")
+	}
+	block, err := aes.NewCipher(k)
+	if err != nil {
+		return nil, fmt.Errorf("MS-CHAPv2配置错误: 密钥(radius.msChap2.key)无效")
+	}
+
+	return cipher.NewGCM(block)
+}
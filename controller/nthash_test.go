@@ -0,0 +1,54 @@
+package controller
+
+import (
+	"bytes"
+	"github.com/csby/goa/assist"
+	"github.com/csby/goa/config"
+	"github.com/csby/goa/data/storage/storagetest"
+	"strings"
+	"testing"
+)
+
+func TestController_NtHash(t *testing.T) {
+	dbs := storagetest.Open(t)
+	cfg := &config.Config{}
+	cfg.Radius.MsChap2.Key = strings.Repeat("01", 32)
+	s := &Controller{Cfg: cfg, Dbs: dbs}
+
+	user := &assist.AdEntryUser{Account: "ZhangSan", PwdLastSet: "133700000000000000"}
+	err := s.PutNtHash(user, "clientPass")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lower := &assist.AdEntryUser{Account: "zhangsan", PwdLastSet: user.PwdLastSet}
+	hash, err := s.GetNtHash(lower)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(hash, assist.MsChap2NtPasswordHash("clientPass")) {
+		t.Errorf("unexpected nt hash: %x", hash)
+	}
+
+	changed := &assist.AdEntryUser{Account: "zhangsan", PwdLastSet: "133700000000000001"}
+	if _, err = s.GetNtHash(changed); err == nil {
+		t.Error("the hash should be ignored after the password is changed outside goa")
+	}
+	if _, err = s.GetNtHash(&assist.AdEntryUser{Account: "lisi"}); err == nil {
+		t.Error("the hash of lisi is not saved")
+	}
+
+	cfg.Radius.MsChap2.Key = strings.Repeat("02", 32)
+	if _, err = s.GetNtHash(lower); err == nil {
+		t.Error("the hash should not be decrypted with another key")
+	}
+
+	err = s.DeleteNtHash("ZHANGSAN")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.Radius.MsChap2.Key = strings.Repeat("01", 32)
+	if _, err = s.GetNtHash(lower); err == nil {
+		t.Error("the hash should be deleted")
+	}
+}
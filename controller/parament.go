@@ -2,11 +2,16 @@ package controller
 
 import (
 	"github.com/csby/goa/config"
+	"github.com/csby/goa/data/storage"
 	"github.com/csby/gwsf/gtype"
 )
 
 type Parameter struct {
 	Cfg  *config.Config
-	Tdb  gtype.TokenDatabase
+	Tdb  *TokenDatabase
 	WChs gtype.SocketChannelCollection
+	Dbs  *storage.Storage
+
+	Signer *TokenSigner
+	Cache  *MembershipCache
 }
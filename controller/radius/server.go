@@ -0,0 +1,325 @@
+package radius
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"github.com/csby/goa/assist"
+	"github.com/csby/goa/config"
+	"github.com/csby/goa/controller"
+	"github.com/csby/gwsf/gtype"
+	"net"
+	"strings"
+)
+
+var accountingStatus = map[uint32]string{
+	1: "Start",
+	2: "Stop",
+	3: "Interim-Update",
+	7: "Accounting-On",
+	8: "Accounting-Off",
+}
+
+func NewServer(log gtype.Log, param *controller.Parameter) *Server {
+	instance := &Server{}
+	instance.SetLog(log)
+	instance.SetParameter(param)
+	instance.vpnEnable = func(account string) (bool, error) {
+		return instance.Ad().GetUserVpnEnable(account)
+	}
+
+	return instance
+}
+
+// PasswordVerifier checks the password of the account and limits the failures, it is implemented by auth.Ad
+// so that the failures of RADIUS and the other logins are counted together
+type PasswordVerifier interface {
+	VerifyPassword(ip, account, password string) (*assist.AdEntryUser, error)
+
+	// VerifyNtHash calls verify with the saved NT hash of the account (MS-CHAPv2)
+	VerifyNtHash(ip, account string, verify func(ntHash []byte) bool) (*assist.AdEntryUser, error)
+}
+
+// Server is a RADIUS (RFC 2865, RFC 2866) server which authenticates the VPN users against AD,
+// the user must have the dial-in permission (msNPAllowDialin):
+// PAP is verified by binding with the password; MS-CHAPv2 (RFC 2759) is verified with the NT hash saved by goa
+// when it knew the password, because the hash can not be read from AD through LDAP, it is rejected
+// (MS-CHAP-Error E=691) if disabled in the configuration
+type Server struct {
+	controller.Controller
+
+	Authenticator PasswordVerifier
+
+	vpnEnable func(account string) (bool, error)
+}
+
+// Start listens for authentication and accounting in background if enabled in the configuration
+func (s *Server) Start() {
+	if s.Cfg == nil || !s.Cfg.Radius.Enabled {
+		return
+	}
+
+	address := s.Cfg.Radius.Address
+	if len(address) < 1 {
+		address = ":1812"
+	}
+	go s.listen(address, s.handleAccess)
+
+	if len(s.Cfg.Radius.Accounting) > 0 {
+		go s.listen(s.Cfg.Radius.Accounting, s.handleAccounting)
+	}
+}
+
+func (s *Server) listen(address string, handle func(conn net.PacketConn, addr net.Addr, client *config.RadiusClient, data []byte)) {
+	conn, err := net.ListenPacket("udp", address)
+	if err != nil {
+		s.LogError(fmt.Sprintf("radius listen on %s fail:", address), err)
+		return
+	}
+	defer conn.Close()
+	s.LogInfo("radius listening on ", address)
+
+	s.serve(conn, handle)
+}
+
+// serve reads the requests until the connection is closed
+func (s *Server) serve(conn net.PacketConn, handle func(conn net.PacketConn, addr net.Addr, client *config.RadiusClient, data []byte)) {
+	for {
+		buf := make([]byte, 4096)
+		n, addr, err := conn.ReadFrom(buf)
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			s.LogError("radius read fail:", err)
+			continue
+		}
+
+		client := s.getClient(addr)
+		if client == nil {
+			s.LogWarning("radius request from unknown client ignored: ", addr.String())
+			continue
+		}
+
+		go func(data []byte, addr net.Addr, client *config.RadiusClient) {
+			defer func() {
+				if err := recover(); err != nil {
+					s.LogError("radius handle request error:", err)
+				}
+			}()
+			handle(conn, addr, client, data)
+		}(buf[:n], addr, client)
+	}
+}
+
+func (s *Server) handleAccess(conn net.PacketConn, addr net.Addr, client *config.RadiusClient, data []byte) {
+	request, err := assist.ParseRadiusPacket(data)
+	if err != nil {
+		s.LogWarning(fmt.Sprintf("radius invalid packet from %s: ", addr.String()), err)
+		return
+	}
+	if request.Code != assist.RadiusCodeAccessRequest {
+		return
+	}
+	if request.GetAttribute(assist.RadiusAttrMessageAuthenticator) != nil {
+		if !request.VerifyMessageAuthenticator(client.Secret) {
+			s.LogWarning(fmt.Sprintf("radius invalid message authenticator from %s (%s)", client.Name, addr.String()))
+			return
+		}
+	} else if client.RequireMessageAuthenticator {
+		// the Access-Request is not signed otherwise, the response can be forged by a man in the middle (BlastRADIUS)
+		s.LogWarning(fmt.Sprintf("radius request without message authenticator from %s (%s) ignored", client.Name, addr.String()))
+		return
+	}
+
+	account := request.GetString(assist.RadiusAttrUserName)
+	response := request.NewResponse(assist.RadiusCodeAccessReject)
+	if request.GetAttribute(assist.RadiusAttrUserPassword) != nil {
+		err = s.authenticatePap(request, client, account)
+		if err == nil {
+			response.Code = assist.RadiusCodeAccessAccept
+		} else {
+			response.AddString(assist.RadiusAttrReplyMessage, "认证失败")
+		}
+	} else if challenge := request.GetVendorAttribute(assist.RadiusVendorMicrosoft, assist.RadiusMsChap2Response); len(challenge) > 0 {
+		err = s.authenticateMsChap2(request, response, client, account)
+		if err == nil {
+			response.Code = assist.RadiusCodeAccessAccept
+		} else {
+			response.AddString(assist.RadiusAttrReplyMessage, "认证失败")
+			// MS-CHAP-Error: ident + "E=691 R=0 V=3", 691 is authentication failure and no retry
+			response.AddVendorAttribute(assist.RadiusVendorMicrosoft, assist.RadiusMsChapError,
+				append([]byte{challenge[0]}, []byte("E=691 R=0 V=3")...))
+		}
+	} else {
+		err = fmt.Errorf("不支持的认证方式")
+	}
+
+	if err != nil {
+		s.LogWarning(fmt.Sprintf("radius reject %s from %s (%s): %v", account, client.Name, addr.String(), err))
+	} else {
+		s.LogInfo(fmt.Sprintf("radius accept %s from %s (%s)", account, client.Name, addr.String()))
+	}
+
+	response.AddMessageAuthenticator()
+	reply, err := response.EncodeResponse(request, client.Secret)
+	if err != nil {
+		s.LogError("radius encode response fail:", err)
+		return
+	}
+	conn.WriteTo(reply, addr)
+}
+
+func (s *Server) authenticatePap(request *assist.RadiusPacket, client *config.RadiusClient, account string) error {
+	if len(account) < 1 {
+		return fmt.Errorf("帐号为空")
+	}
+	password, err := request.DecodeUserPassword(client.Secret)
+	if err != nil {
+		return err
+	}
+	if len(password) < 1 {
+		return fmt.Errorf("密码为空")
+	}
+
+	if s.Authenticator == nil {
+		return fmt.Errorf("认证服务不可用")
+	}
+	// the NAS is shared by all users, so the failures are counted by the calling station (the address of the end user)
+	user, err := s.Authenticator.VerifyPassword(request.GetString(assist.RadiusAttrCallingStationId), account, password)
+	if err != nil {
+		return err
+	}
+	enable, err := s.vpnEnable(user.Account)
+	if err != nil {
+		return err
+	}
+	if !enable {
+		return fmt.Errorf("帐号(%s)未启用VPN", user.Account)
+	}
+
+	return nil
+}
+
+// authenticateMsChap2 verifies the MS-CHAP2-Response and adds MS-CHAP2-Success and the MPPE keys to the response
+func (s *Server) authenticateMsChap2(request, response *assist.RadiusPacket, client *config.RadiusClient, account string) error {
+	if s.Cfg == nil || !s.Cfg.Radius.MsChap2.Enabled {
+		return fmt.Errorf("未启用MS-CHAPv2, 请在客户端改用PAP")
+	}
+	if len(account) < 1 {
+		return fmt.Errorf("帐号为空")
+	}
+	authChallenge, chap, err := request.GetMsChap2()
+	if err != nil {
+		return err
+	}
+	if s.Authenticator == nil {
+		return fmt.Errorf("认证服务不可用")
+	}
+
+	var ntHash []byte
+	name := assist.MsChap2UserName(account)
+	user, err := s.Authenticator.VerifyNtHash(request.GetString(assist.RadiusAttrCallingStationId), name, func(hash []byte) bool {
+		expected := assist.MsChap2NtResponse(authChallenge, chap.PeerChallenge, account, hash)
+		if subtle.ConstantTimeCompare(expected, chap.NtResponse) != 1 {
+			return false
+		}
+		ntHash = hash
+		return true
+	})
+	if err != nil {
+		return err
+	}
+	enable, err := s.vpnEnable(user.Account)
+	if err != nil {
+		return err
+	}
+	if !enable {
+		return fmt.Errorf("帐号(%s)未启用VPN", user.Account)
+	}
+
+	success := assist.MsChap2AuthenticatorResponse(authChallenge, chap.PeerChallenge, chap.NtResponse, account, ntHash)
+	response.AddVendorAttribute(assist.RadiusVendorMicrosoft, assist.RadiusMsChap2Success, append([]byte{chap.Ident}, []byte(success)...))
+	sendKey, recvKey := assist.MsChap2MppeKeys(ntHash, chap.NtResponse)
+	err = response.AddMppeKey(assist.RadiusMsMppeSendKey, sendKey, client.Secret, request)
+	if err != nil {
+		return err
+	}
+	err = response.AddMppeKey(assist.RadiusMsMppeRecvKey, recvKey, client.Secret, request)
+	if err != nil {
+		return err
+	}
+	// encryption allowed (1), 40-bit and 128-bit RC4 (0x06)
+	response.AddVendorAttribute(assist.RadiusVendorMicrosoft, assist.RadiusMsMppeEncryptionPolicy, []byte{0, 0, 0, 1})
+	response.AddVendorAttribute(assist.RadiusVendorMicrosoft, assist.RadiusMsMppeEncryptionTypes, []byte{0, 0, 0, 6})
+
+	return nil
+}
+
+func (s *Server) handleAccounting(conn net.PacketConn, addr net.Addr, client *config.RadiusClient, data []byte) {
+	request, err := assist.ParseRadiusPacket(data)
+	if err != nil {
+		s.LogWarning(fmt.Sprintf("radius invalid packet from %s: ", addr.String()), err)
+		return
+	}
+	if request.Code != assist.RadiusCodeAccountingRequest {
+		return
+	}
+	if !request.VerifyAccounting(client.Secret) {
+		s.LogWarning(fmt.Sprintf("radius invalid accounting authenticator from %s (%s)", client.Name, addr.String()))
+		return
+	}
+
+	status := request.GetInteger(assist.RadiusAttrAcctStatusType)
+	statusName, ok := accountingStatus[status]
+	if !ok {
+		statusName = fmt.Sprint(status)
+	}
+	framedIp := ""
+	if v := request.GetAttribute(assist.RadiusAttrFramedIpAddress); len(v) == 4 {
+		framedIp = net.IP(v).String()
+	}
+	s.LogInfo(fmt.Sprintf("radius accounting: client=%s, status=%s, user=%s, session=%s, nas=%s, calling=%s, framed=%s, time=%ds, input=%d, output=%d",
+		client.Name,
+		statusName,
+		request.GetString(assist.RadiusAttrUserName),
+		request.GetString(assist.RadiusAttrAcctSessionId),
+		request.GetString(assist.RadiusAttrNasIdentifier),
+		request.GetString(assist.RadiusAttrCallingStationId),
+		framedIp,
+		request.GetInteger(assist.RadiusAttrAcctSessionTime),
+		request.GetInteger(assist.RadiusAttrAcctInputOctets),
+		request.GetInteger(assist.RadiusAttrAcctOutputOctets)))
+
+	response := request.NewResponse(assist.RadiusCodeAccountingResponse)
+	reply, err := response.EncodeResponse(request, client.Secret)
+	if err != nil {
+		s.LogError("radius encode response fail:", err)
+		return
+	}
+	conn.WriteTo(reply, addr)
+}
+
+// getClient returns the configured client which matches the ip or network of the address
+func (s *Server) getClient(addr net.Addr) *config.RadiusClient {
+	udpAddr, ok := addr.(*net.UDPAddr)
+	if !ok {
+		return nil
+	}
+
+	for _, item := range s.Cfg.Radius.Clients {
+		if item == nil || len(item.Secret) < 1 {
+			continue
+		}
+		if strings.Contains(item.Address, "/") {
+			_, network, err := net.ParseCIDR(item.Address)
+			if err == nil && network.Contains(udpAddr.IP) {
+				return item
+			}
+		} else if ip := net.ParseIP(item.Address); ip != nil && ip.Equal(udpAddr.IP) {
+			return item
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,326 @@
+package radius
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"github.com/csby/goa/assist"
+	"github.com/csby/goa/config"
+	"github.com/csby/goa/controller"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+const testSecret = "s3cret"
+
+type testVerifier struct {
+	mutex    sync.Mutex
+	ip       string
+	account  string
+	password string
+}
+
+func (s *testVerifier) VerifyPassword(ip, account, password string) (*assist.AdEntryUser, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.ip, s.account, s.password = ip, account, password
+	return nil, fmt.Errorf("密码错误")
+}
+
+// VerifyNtHash verifies with the hash of password
+func (s *testVerifier) VerifyNtHash(ip, account string, verify func(ntHash []byte) bool) (*assist.AdEntryUser, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.ip, s.account = ip, account
+	if !verify(assist.MsChap2NtPasswordHash(s.password)) {
+		return nil, fmt.Errorf("密码错误")
+	}
+	return &assist.AdEntryUser{Account: account}, nil
+}
+
+func newTestServer(t *testing.T, verifier PasswordVerifier, configure ...func(cfg *config.Config)) net.Conn {
+	cfg := config.NewConfig()
+	cfg.Radius.Clients = []*config.RadiusClient{
+		{Name: "nas", Address: "127.0.0.0/8", Secret: testSecret},
+	}
+	for _, item := range configure {
+		item(cfg)
+	}
+	s := NewServer(nil, &controller.Parameter{Cfg: cfg})
+	s.Authenticator = verifier
+	s.vpnEnable = func(account string) (bool, error) {
+		return account == "zhangsan", nil
+	}
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go s.serve(conn, s.handleAccess)
+	t.Cleanup(func() { conn.Close() })
+
+	client, err := net.Dial("udp", conn.LocalAddr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { client.Close() })
+
+	return client
+}
+
+func newTestRequest(t *testing.T, account string) *assist.RadiusPacket {
+	request := &assist.RadiusPacket{
+		Code:       assist.RadiusCodeAccessRequest,
+		Identifier: 7,
+		Attributes: make([]*assist.RadiusAttribute, 0),
+	}
+	_, err := rand.Read(request.Authenticator[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	request.AddString(assist.RadiusAttrUserName, account)
+	request.AddString(assist.RadiusAttrCallingStationId, "10.8.0.100")
+
+	return request
+}
+
+// exchange sends the signed request and returns the response, or nil if no response is received in time
+func exchange(t *testing.T, client net.Conn, request *assist.RadiusPacket, tamper bool) *assist.RadiusPacket {
+	request.AddMessageAuthenticator()
+	data, err := request.EncodeRequest(testSecret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tamper {
+		data[len(data)-1] ^= 0xff
+	}
+
+	return roundTrip(t, client, request, data)
+}
+
+// roundTrip sends the encoded request and returns the verified response, or nil if no response is received in time
+func roundTrip(t *testing.T, client net.Conn, request *assist.RadiusPacket, data []byte) *assist.RadiusPacket {
+	_, err := client.Write(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	buf := make([]byte, 4096)
+	client.SetReadDeadline(time.Now().Add(time.Second))
+	n, err := client.Read(buf)
+	if err != nil {
+		if ne, ok := err.(net.Error); ok && ne.Timeout() {
+			return nil
+		}
+		t.Fatal(err)
+	}
+
+	// Response Authenticator = MD5(Code+ID+Length+RequestAuth+Attributes+Secret), RFC 2865, 3
+	reply := buf[:n]
+	if int(binary.BigEndian.Uint16(reply[2:4])) != n {
+		t.Fatalf("invalid response length: %d", n)
+	}
+	hash := md5.New()
+	hash.Write(reply[:4])
+	hash.Write(request.Authenticator[:])
+	hash.Write(reply[20:])
+	hash.Write([]byte(testSecret))
+	if !bytes.Equal(hash.Sum(nil), reply[4:20]) {
+		t.Fatal("invalid response authenticator")
+	}
+
+	response, err := assist.ParseRadiusPacket(reply)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response.Identifier != request.Identifier {
+		t.Fatalf("identifier: expect %d, actual %d", request.Identifier, response.Identifier)
+	}
+	response.Authenticator = request.Authenticator
+	if !response.VerifyMessageAuthenticator(testSecret) {
+		t.Fatal("invalid message authenticator of the response")
+	}
+
+	return response
+}
+
+func TestServer_Pap(t *testing.T) {
+	verifier := &testVerifier{}
+	client := newTestServer(t, verifier)
+
+	request := newTestRequest(t, "zhangsan")
+	err := request.EncodeUserPassword("wrong-password", testSecret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	response := exchange(t, client, request, false)
+	if response == nil {
+		t.Fatal("no response")
+	}
+	if response.Code != assist.RadiusCodeAccessReject {
+		t.Errorf("code: expect %d, actual %d", assist.RadiusCodeAccessReject, response.Code)
+	}
+
+	verifier.mutex.Lock()
+	defer verifier.mutex.Unlock()
+	if verifier.account != "zhangsan" || verifier.password != "wrong-password" {
+		t.Errorf("unexpected credential verified: %s/%s", verifier.account, verifier.password)
+	}
+	if verifier.ip != "10.8.0.100" {
+		t.Errorf("failures should be counted by the calling station, got %s", verifier.ip)
+	}
+}
+
+func TestServer_MsChap2Disabled(t *testing.T) {
+	client := newTestServer(t, &testVerifier{})
+
+	request := newTestRequest(t, "zhangsan")
+	request.AddVendorAttribute(assist.RadiusVendorMicrosoft, assist.RadiusMsChapChallenge, make([]byte, 16))
+	request.AddVendorAttribute(assist.RadiusVendorMicrosoft, assist.RadiusMsChap2Response, append([]byte{9}, make([]byte, 49)...))
+	response := exchange(t, client, request, false)
+	if response == nil {
+		t.Fatal("no response")
+	}
+	if response.Code != assist.RadiusCodeAccessReject {
+		t.Errorf("code: expect %d, actual %d", assist.RadiusCodeAccessReject, response.Code)
+	}
+	chapError := response.GetVendorAttribute(assist.RadiusVendorMicrosoft, assist.RadiusMsChapError)
+	if !bytes.Equal(chapError, append([]byte{9}, []byte("E=691 R=0 V=3")...)) {
+		t.Errorf("unexpected MS-CHAP-Error: %q", chapError)
+	}
+}
+
+// newTestMsChap2Request adds the MS-CHAPv2 attributes computed with the password
+func newTestMsChap2Request(t *testing.T, account, password string) (*assist.RadiusPacket, []byte, []byte) {
+	request := newTestRequest(t, account)
+	authChallenge := make([]byte, 16)
+	peerChallenge := make([]byte, 16)
+	rand.Read(authChallenge)
+	rand.Read(peerChallenge)
+	ntResponse := assist.MsChap2NtResponse(authChallenge, peerChallenge, account, assist.MsChap2NtPasswordHash(password))
+
+	value := []byte{5, 0}
+	value = append(value, peerChallenge...)
+	value = append(value, make([]byte, 8)...)
+	value = append(value, ntResponse...)
+	request.AddVendorAttribute(assist.RadiusVendorMicrosoft, assist.RadiusMsChapChallenge, authChallenge)
+	request.AddVendorAttribute(assist.RadiusVendorMicrosoft, assist.RadiusMsChap2Response, value)
+
+	return request, authChallenge, peerChallenge
+}
+
+func TestServer_MsChap2(t *testing.T) {
+	verifier := &testVerifier{password: "clientPass"}
+	client := newTestServer(t, verifier, func(cfg *config.Config) {
+		cfg.Radius.MsChap2.Enabled = true
+	})
+
+	request, authChallenge, peerChallenge := newTestMsChap2Request(t, "CORP\\zhangsan", "clientPass")
+	response := exchange(t, client, request, false)
+	if response == nil {
+		t.Fatal("no response")
+	}
+	if response.Code != assist.RadiusCodeAccessAccept {
+		t.Fatalf("code: expect %d, actual %d", assist.RadiusCodeAccessAccept, response.Code)
+	}
+	verifier.mutex.Lock()
+	if verifier.account != "zhangsan" {
+		t.Errorf("the domain should be removed from the account, got %s", verifier.account)
+	}
+	verifier.mutex.Unlock()
+
+	ntHash := assist.MsChap2NtPasswordHash("clientPass")
+	_, chap, _ := request.GetMsChap2()
+	success := assist.MsChap2AuthenticatorResponse(authChallenge, peerChallenge, chap.NtResponse, "zhangsan", ntHash)
+	if v := response.GetVendorAttribute(assist.RadiusVendorMicrosoft, assist.RadiusMsChap2Success); string(v) != "\x05"+success {
+		t.Errorf("unexpected MS-CHAP2-Success: %q", v)
+	}
+	for _, key := range []byte{assist.RadiusMsMppeSendKey, assist.RadiusMsMppeRecvKey} {
+		if v := response.GetVendorAttribute(assist.RadiusVendorMicrosoft, key); len(v) != 34 {
+			t.Errorf("MPPE key %d should be returned, got %x", key, v)
+		}
+	}
+
+	request, _, _ = newTestMsChap2Request(t, "zhangsan", "wrong-password")
+	response = exchange(t, client, request, false)
+	if response == nil || response.Code != assist.RadiusCodeAccessReject {
+		t.Fatal("wrong password should be rejected")
+	}
+	if v := response.GetVendorAttribute(assist.RadiusVendorMicrosoft, assist.RadiusMsChapError); string(v) != "\x05E=691 R=0 V=3" {
+		t.Errorf("unexpected MS-CHAP-Error: %q", v)
+	}
+	if response.GetVendorAttribute(assist.RadiusVendorMicrosoft, assist.RadiusMsMppeSendKey) != nil {
+		t.Error("MPPE keys should not be returned on reject")
+	}
+
+	request, _, _ = newTestMsChap2Request(t, "lisi", "clientPass")
+	response = exchange(t, client, request, false)
+	if response == nil || response.Code != assist.RadiusCodeAccessReject {
+		t.Fatal("user without vpn permission should be rejected")
+	}
+}
+
+func TestServer_RequireMessageAuthenticator(t *testing.T) {
+	verifier := &testVerifier{}
+	client := newTestServer(t, verifier, func(cfg *config.Config) {
+		cfg.Radius.Clients[0].RequireMessageAuthenticator = true
+	})
+
+	request := newTestRequest(t, "zhangsan")
+	err := request.EncodeUserPassword("password", testSecret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := request.Encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response := roundTrip(t, client, request, data); response != nil {
+		t.Errorf("request without message authenticator should be ignored, got code %d", response.Code)
+	}
+
+	if response := exchange(t, client, request, false); response == nil {
+		t.Error("request with message authenticator should be answered")
+	}
+}
+
+func TestServer_InvalidMessageAuthenticator(t *testing.T) {
+	verifier := &testVerifier{}
+	client := newTestServer(t, verifier)
+
+	request := newTestRequest(t, "zhangsan")
+	err := request.EncodeUserPassword("password", testSecret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response := exchange(t, client, request, true); response != nil {
+		t.Errorf("request with invalid message authenticator should be ignored, got code %d", response.Code)
+	}
+}
+
+func TestServer_Close(t *testing.T) {
+	cfg := config.NewConfig()
+	s := NewServer(nil, &controller.Parameter{Cfg: cfg})
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan struct{})
+	go func() {
+		s.serve(conn, s.handleAccess)
+		close(done)
+	}()
+
+	conn.Close()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("serve should stop when the connection is closed")
+	}
+}
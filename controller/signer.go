@@ -0,0 +1,161 @@
+package controller
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"github.com/csby/goa/data/model"
+	"github.com/golang-jwt/jwt/v5"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// AccessClaims are the claims of the signed access token, the subject is the account of the login user
+// and the session id is the key of the token in Tdb
+type AccessClaims struct {
+	jwt.RegisteredClaims
+
+	Name      string `json:"name,omitempty"`
+	SessionID string `json:"sid"`
+}
+
+// LoadTokenSigner reads the RSA private key from the PEM file, a 2048-bit key is created and saved if the file not exists;
+// kid is generated from the public key if empty
+func LoadTokenSigner(filePath, kid, issuer string) (*TokenSigner, error) {
+	key, err := LoadRsaKey(filePath)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewTokenSigner(key, kid, issuer), nil
+}
+
+// LoadRsaKey reads the RSA private key (PKCS#1 or PKCS#8) from the PEM file, a 2048-bit key is created and saved if the file not exists
+func LoadRsaKey(filePath string) (*rsa.PrivateKey, error) {
+	if len(filePath) < 1 {
+		return nil, fmt.Errorf("file path is empty")
+	}
+
+	var key *rsa.PrivateKey
+	data, err := os.ReadFile(filePath)
+	if os.IsNotExist(err) {
+		key, err = rsa.GenerateKey(rand.Reader, 2048)
+		if err != nil {
+			return nil, err
+		}
+		err = os.MkdirAll(filepath.Dir(filePath), 0700)
+		if err != nil {
+			return nil, err
+		}
+		data = pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+		err = os.WriteFile(filePath, data, 0600)
+		if err != nil {
+			return nil, err
+		}
+	} else if err != nil {
+		return nil, err
+	} else {
+		block, _ := pem.Decode(data)
+		if block == nil {
+			return nil, fmt.Errorf("invalid pem file: %s", filePath)
+		}
+		key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+		if err != nil {
+			pk, pe := x509.ParsePKCS8PrivateKey(block.Bytes)
+			if pe != nil {
+				return nil, err
+			}
+			rk, ok := pk.(*rsa.PrivateKey)
+			if !ok {
+				return nil, fmt.Errorf("not a rsa private key: %s", filePath)
+			}
+			key = rk
+		}
+	}
+
+	return key, nil
+}
+
+func NewTokenSigner(key *rsa.PrivateKey, kid, issuer string) *TokenSigner {
+	if len(kid) < 1 {
+		der := x509.MarshalPKCS1PublicKey(&key.PublicKey)
+		sum := sha256.Sum256(der)
+		kid = hex.EncodeToString(sum[:8])
+	}
+
+	return &TokenSigner{
+		key:    key,
+		kid:    kid,
+		issuer: issuer,
+	}
+}
+
+// TokenSigner signs and verifies the JWT with RS256, so that other services can verify the tokens with the public key
+type TokenSigner struct {
+	key    *rsa.PrivateKey
+	kid    string
+	issuer string
+}
+
+func (s *TokenSigner) KeyID() string {
+	return s.kid
+}
+
+func (s *TokenSigner) Issuer() string {
+	return s.issuer
+}
+
+func (s *TokenSigner) PrivateKey() *rsa.PrivateKey {
+	return s.key
+}
+
+func (s *TokenSigner) Sign(claims jwt.Claims) (string, error) {
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = s.kid
+
+	return token.SignedString(s.key)
+}
+
+// Parse verifies the signature, issuer and expiration of the token and decodes the claims
+func (s *TokenSigner) Parse(value string, claims jwt.Claims) error {
+	options := []jwt.ParserOption{
+		jwt.WithValidMethods([]string{jwt.SigningMethodRS256.Alg()}),
+		jwt.WithExpirationRequired(),
+	}
+	if len(s.issuer) > 0 {
+		options = append(options, jwt.WithIssuer(s.issuer))
+	}
+
+	_, err := jwt.ParseWithClaims(value, claims, func(token *jwt.Token) (interface{}, error) {
+		return &s.key.PublicKey, nil
+	}, options...)
+
+	return err
+}
+
+func (s *TokenSigner) Jwks() *model.Jwks {
+	return &model.Jwks{
+		Keys: []*model.Jwk{
+			{
+				Kty: "RSA",
+				Use: "sig",
+				Alg: jwt.SigningMethodRS256.Alg(),
+				Kid: s.kid,
+				N:   base64.RawURLEncoding.EncodeToString(s.key.PublicKey.N.Bytes()),
+				E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(s.key.PublicKey.E)).Bytes()),
+			},
+		},
+	}
+}
+
+// IsJwt returns true if the value looks like a JWT, the opaque token is a guid without dot
+func IsJwt(value string) bool {
+	return strings.Count(value, ".") == 2
+}
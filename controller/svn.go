@@ -0,0 +1,43 @@
+package controller
+
+import (
+	"fmt"
+	"strings"
+)
+
+// SvnManagerGroup returns the account of the group whose members manage the permissions of the repository,
+// the group is created with the repository
+func SvnManagerGroup(repository string) string {
+	return fmt.Sprintf("SVN.Authorization.Managers.%s", repository)
+}
+
+// IsSvnManager checks whether the account is a member (nested) of the manager group of the repository
+func (s *Controller) IsSvnManager(account, repository string) (bool, error) {
+	if len(account) < 1 || len(repository) < 1 {
+		return false, nil
+	}
+
+	ad := s.Ad()
+	user, err := ad.GetUser(account)
+	if err != nil {
+		if ad.IsNotExit(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	groups, err := ad.GetMemberGroups(user.DN, true)
+	if err != nil {
+		return false, err
+	}
+	groupAccount := strings.ToLower(SvnManagerGroup(repository))
+	for _, group := range groups {
+		if group == nil {
+			continue
+		}
+		if strings.ToLower(group.Account) == groupAccount {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
@@ -100,6 +100,7 @@ func (s *Permission) AddItem(ctx gtype.Context, ps gtype.Params) {
 func (s *Permission) AddItemDoc(doc gtype.Doc, method string, uri gtype.Uri) {
 	catalog := s.createCatalog(doc, "权限")
 	function := catalog.AddFunction(method, uri, "添加项目访问权限")
+	function.SetRemark("需要管理员或该存储库的授权管理员(SVN.Authorization.Managers.存储库名称)权限")
 	function.SetInputJsonExample(&model.SvnPermissionArgumentEdit{
 		SvnPermissionArgument: model.SvnPermissionArgument{
 			Repository: "test",
@@ -110,6 +111,7 @@ func (s *Permission) AddItemDoc(doc gtype.Doc, method string, uri gtype.Uri) {
 	})
 	function.AddOutputError(gtype.ErrInternal)
 	function.AddOutputError(gtype.ErrInput)
+	function.AddOutputError(gtype.ErrNoPermission)
 }
 
 func (s *Permission) ModItem(ctx gtype.Context, ps gtype.Params) {
@@ -149,6 +151,7 @@ func (s *Permission) ModItem(ctx gtype.Context, ps gtype.Params) {
 func (s *Permission) ModItemDoc(doc gtype.Doc, method string, uri gtype.Uri) {
 	catalog := s.createCatalog(doc, "权限")
 	function := catalog.AddFunction(method, uri, "修改项目访问权限")
+	function.SetRemark("需要管理员或该存储库的授权管理员(SVN.Authorization.Managers.存储库名称)权限")
 	function.SetInputJsonExample(&model.SvnPermissionArgumentEdit{
 		SvnPermissionArgument: model.SvnPermissionArgument{
 			Repository: "test",
@@ -159,6 +162,7 @@ func (s *Permission) ModItemDoc(doc gtype.Doc, method string, uri gtype.Uri) {
 	})
 	function.AddOutputError(gtype.ErrInternal)
 	function.AddOutputError(gtype.ErrInput)
+	function.AddOutputError(gtype.ErrNoPermission)
 }
 
 func (s *Permission) DelItem(ctx gtype.Context, ps gtype.Params) {
@@ -198,6 +202,7 @@ func (s *Permission) DelItem(ctx gtype.Context, ps gtype.Params) {
 func (s *Permission) DelItemDoc(doc gtype.Doc, method string, uri gtype.Uri) {
 	catalog := s.createCatalog(doc, "权限")
 	function := catalog.AddFunction(method, uri, "删除项目访问权限")
+	function.SetRemark("需要管理员或该存储库的授权管理员(SVN.Authorization.Managers.存储库名称)权限")
 	function.SetInputJsonExample(&model.SvnPermissionArgument{
 		Repository: "test",
 		Path:       "/trunk",
@@ -205,4 +210,5 @@ func (s *Permission) DelItemDoc(doc gtype.Doc, method string, uri gtype.Uri) {
 	})
 	function.AddOutputError(gtype.ErrInternal)
 	function.AddOutputError(gtype.ErrInput)
+	function.AddOutputError(gtype.ErrNoPermission)
 }
@@ -52,6 +52,7 @@ func (s *Repository) AddRepository(ctx gtype.Context, ps gtype.Params) {
 func (s *Repository) AddRepositoryDoc(doc gtype.Doc, method string, uri gtype.Uri) {
 	catalog := s.createCatalog(doc, "存储库")
 	function := catalog.AddFunction(method, uri, "新建存储库")
+	function.SetRemark("需要管理员权限")
 	function.SetNote("成功时返回存储库名称, 并创建3个文件夹: branches,tags,trunk")
 	function.SetInputJsonExample(&model.SvnRepositoryCreate{
 		Name: "test",
@@ -59,6 +60,7 @@ func (s *Repository) AddRepositoryDoc(doc gtype.Doc, method string, uri gtype.Ur
 	function.SetOutputDataExample("test")
 	function.AddOutputError(gtype.ErrInternal)
 	function.AddOutputError(gtype.ErrInput)
+	function.AddOutputError(gtype.ErrNoPermission)
 }
 
 func (s *Repository) GetRepositories(ctx gtype.Context, ps gtype.Params) {
@@ -192,7 +194,7 @@ func (s *Repository) addManager(repository string) {
 		}
 	}
 
-	groupName := fmt.Sprintf("SVN.Authorization.Managers.%s", repository)
+	groupName := controller.SvnManagerGroup(repository)
 	ad.NewGroup(entry.DN, groupName, "授权管理员", "具备添加、删除成员及编辑成员访问权限的权限")
 
 	groupName = fmt.Sprintf("SVN.Email.Subscribers.%s", repository)
@@ -30,8 +30,8 @@ func (s *User) GetPermissions(ctx gtype.Context, ps gtype.Params) {
 		ctx.Error(gtype.ErrInternal, "登录用户信息为空")
 		return
 	}
-	user, ok := token.Ext.(*assist.AdEntryUser)
-	if !ok || user == nil {
+	user := s.TokenUser(token)
+	if user == nil {
 		ctx.Error(gtype.ErrInternal, "登录用户信息无效")
 		return
 	}
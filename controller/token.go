@@ -0,0 +1,272 @@
+package controller
+
+import (
+	"github.com/csby/gwsf/gtype"
+	"strings"
+	"sync"
+	"time"
+)
+
+func NewTokenDatabase(tdb gtype.TokenDatabase) *TokenDatabase {
+	instance := &TokenDatabase{
+		TokenDatabase: tdb,
+		accounts:      make(map[string]map[string]bool),
+		states:        make(map[string]*tokenState),
+	}
+
+	// index the tokens restored from the persistent store
+	store, ok := tdb.(interface {
+		Range(fn func(key string, value interface{}))
+	})
+	if ok {
+		store.Range(instance.index)
+	}
+
+	// remove the index of the tokens expired by the store, or check the index periodically
+	// if the store does not report the expired tokens
+	notifier, ok := tdb.(interface {
+		OnExpired(fn func(key string))
+	})
+	if ok {
+		notifier.OnExpired(instance.forget)
+	} else {
+		go instance.runPrune()
+	}
+
+	return instance
+}
+
+// TokenDatabase indexes the tokens by the account of the login user,
+// so that all tokens of an account can be listed or revoked;
+// it also keeps the last active time and the count of the websocket channels of each token
+type TokenDatabase struct {
+	gtype.TokenDatabase
+
+	mutex    sync.Mutex
+	accounts map[string]map[string]bool
+	states   map[string]*tokenState // key: token id
+}
+
+type tokenState struct {
+	activeTime time.Time
+	channels   int
+}
+
+func (s *TokenDatabase) Set(key string, value interface{}) {
+	s.TokenDatabase.Set(key, value)
+	s.index(key, value)
+}
+
+func (s *TokenDatabase) index(key string, value interface{}) {
+	token, ok := value.(*gtype.Token)
+	if !ok || token == nil {
+		return
+	}
+	account := strings.ToLower(token.UserAccount)
+	if len(account) < 1 {
+		return
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	keys, ok := s.accounts[account]
+	if !ok {
+		keys = make(map[string]bool)
+		s.accounts[account] = keys
+	}
+	keys[key] = true
+}
+
+// Get records the active time of the token if delay is true
+func (s *TokenDatabase) Get(key string, delay bool) (interface{}, bool) {
+	value, ok := s.TokenDatabase.Get(key, delay)
+	if ok && delay {
+		s.mutex.Lock()
+		s.state(key).activeTime = time.Now()
+		s.mutex.Unlock()
+	}
+
+	return value, ok
+}
+
+func (s *TokenDatabase) Del(key string) bool {
+	ok := s.TokenDatabase.Del(key)
+	s.forget(key)
+
+	return ok
+}
+
+// forget removes the token from the index and the states, the token itself is removed by the caller or the store
+func (s *TokenDatabase) forget(key string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	delete(s.states, key)
+
+	for account, keys := range s.accounts {
+		if keys[key] {
+			delete(keys, key)
+			if len(keys) < 1 {
+				delete(s.accounts, account)
+			}
+			break
+		}
+	}
+}
+
+// Prune removes the tokens which are not in the store anymore from the index and the states,
+// and returns the count of the removed tokens
+func (s *TokenDatabase) Prune() int {
+	s.mutex.Lock()
+	keys := make([]string, 0, len(s.states))
+	for _, items := range s.accounts {
+		for key := range items {
+			keys = append(keys, key)
+		}
+	}
+	for key := range s.states {
+		keys = append(keys, key)
+	}
+	s.mutex.Unlock()
+
+	count := 0
+	checked := make(map[string]bool)
+	for _, key := range keys {
+		if checked[key] {
+			continue
+		}
+		checked[key] = true
+		_, ok := s.TokenDatabase.Get(key, false)
+		if !ok {
+			s.forget(key)
+			count++
+		}
+	}
+
+	return count
+}
+
+func (s *TokenDatabase) runPrune() {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		s.Prune()
+	}
+}
+
+// GetTokens returns the valid tokens of the account, the expired ones are removed from the index
+func (s *TokenDatabase) GetTokens(account string) []*gtype.Token {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	tokens := make([]*gtype.Token, 0)
+	key := strings.ToLower(account)
+	keys, ok := s.accounts[key]
+	if !ok {
+		return tokens
+	}
+
+	for k := range keys {
+		value, ok := s.TokenDatabase.Get(k, false)
+		if !ok {
+			delete(keys, k)
+			delete(s.states, k)
+			continue
+		}
+		token, ok := value.(*gtype.Token)
+		if !ok || token == nil {
+			delete(keys, k)
+			continue
+		}
+		tokens = append(tokens, token)
+	}
+	if len(keys) < 1 {
+		delete(s.accounts, key)
+	}
+
+	return tokens
+}
+
+// GetAccounts returns the accounts which have tokens, some tokens may be expired
+func (s *TokenDatabase) GetAccounts() []string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	accounts := make([]string, 0, len(s.accounts))
+	for account := range s.accounts {
+		accounts = append(accounts, account)
+	}
+
+	return accounts
+}
+
+// GetActiveTime returns the last active time of the token, or the login time if it is not active after login
+func (s *TokenDatabase) GetActiveTime(token *gtype.Token) time.Time {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	state, ok := s.states[token.ID]
+	if ok && !state.activeTime.IsZero() {
+		return state.activeTime
+	}
+	if token.ActiveTime.After(token.LoginTime) {
+		return token.ActiveTime
+	}
+
+	return token.LoginTime
+}
+
+// Connect increases the count of the websocket channels of the token
+func (s *TokenDatabase) Connect(key string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.state(key).channels++
+}
+
+// Disconnect decreases the count of the websocket channels of the token
+func (s *TokenDatabase) Disconnect(key string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	state, ok := s.states[key]
+	if ok && state.channels > 0 {
+		state.channels--
+	}
+}
+
+// IsConnected returns true if the token has websocket channels
+func (s *TokenDatabase) IsConnected(key string) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	state, ok := s.states[key]
+
+	return ok && state.channels > 0
+}
+
+// state returns the state of the token, the mutex must be locked by the caller
+func (s *TokenDatabase) state(key string) *tokenState {
+	state, ok := s.states[key]
+	if !ok {
+		state = &tokenState{}
+		s.states[key] = state
+	}
+
+	return state
+}
+
+// DelTokens revokes all tokens of the account and returns the count of the revoked tokens
+func (s *TokenDatabase) DelTokens(account string) int {
+	tokens := s.GetTokens(account)
+	count := 0
+	for _, token := range tokens {
+		if s.Del(token.ID) {
+			count++
+		}
+	}
+
+	return count
+}
@@ -0,0 +1,334 @@
+package controller
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"github.com/csby/goa/data/storage"
+	"github.com/csby/gwsf/gtype"
+	"sync"
+	"time"
+)
+
+const (
+	TokenBucket = "token"
+
+	// the active time is saved at most once in this interval to avoid writing the database on every request
+	tokenActiveSaveInterval = time.Minute
+)
+
+// NewTokenStore creates a token database which is persisted in dbs so that the login users keep online after restart,
+// key is the AES key (16, 24 or 32 bytes) used to encrypt the Ext of the token, newExt returns the value
+// to decode the Ext into; the tokens are expired after expiredMinutes inactive, 0 means never expired
+func NewTokenStore(dbs *storage.Storage, expiredMinutes int64, key []byte, newExt func() interface{}) (*TokenStore, error) {
+	if dbs == nil {
+		return nil, fmt.Errorf("dbs is nil")
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	instance := &TokenStore{
+		dbs:        dbs,
+		expiration: time.Duration(expiredMinutes) * time.Minute,
+		aead:       aead,
+		newExt:     newExt,
+		items:      make(map[string]*tokenItem),
+	}
+	err = instance.load()
+	if err != nil {
+		return nil, err
+	}
+
+	if instance.expiration > 0 {
+		go instance.sweep()
+	}
+
+	return instance, nil
+}
+
+// TokenStore implements gtype.TokenDatabase, the tokens are cached in memory and written through to the database,
+// only *gtype.Token values are persisted, except those with a transient Ext (e.g. impersonation)
+type TokenStore struct {
+	dbs        *storage.Storage
+	expiration time.Duration
+	aead       cipher.AEAD
+	newExt     func() interface{}
+
+	mutex   sync.RWMutex
+	items   map[string]*tokenItem
+	expired func(key string)
+}
+
+type tokenItem struct {
+	value      interface{}
+	activeTime time.Time
+	savedTime  time.Time
+	permanent  bool
+}
+
+type tokenRecord struct {
+	Token      *gtype.Token `json:"token"`
+	Ext        []byte       `json:"ext"`
+	ActiveTime time.Time    `json:"activeTime"`
+}
+
+func (s *TokenStore) Set(key string, value interface{}) {
+	now := time.Now()
+	item := &tokenItem{
+		value:      value,
+		activeTime: now,
+	}
+
+	s.mutex.Lock()
+	s.items[key] = item
+	s.mutex.Unlock()
+
+	s.save(key, item)
+}
+
+func (s *TokenStore) Get(key string, delay bool) (interface{}, bool) {
+	s.mutex.Lock()
+	item, ok := s.items[key]
+	if !ok {
+		s.mutex.Unlock()
+		return nil, false
+	}
+	now := time.Now()
+	if s.isExpired(item, now) {
+		delete(s.items, key)
+		expired := s.expired
+		s.mutex.Unlock()
+		s.dbs.Delete(TokenBucket, key)
+		if expired != nil {
+			expired(key)
+		}
+		return nil, false
+	}
+	save := false
+	if delay {
+		item.activeTime = now
+		save = now.Sub(item.savedTime) >= tokenActiveSaveInterval
+	}
+	value := item.value
+	s.mutex.Unlock()
+
+	if save {
+		s.save(key, item)
+	}
+
+	return value, true
+}
+
+func (s *TokenStore) Del(key string) bool {
+	s.mutex.Lock()
+	_, ok := s.items[key]
+	delete(s.items, key)
+	s.mutex.Unlock()
+
+	s.dbs.Delete(TokenBucket, key)
+
+	return ok
+}
+
+// Permanent keeps the token from expiring while the websocket of it is connected,
+// it is not persisted since the connections are closed when the service stops
+func (s *TokenStore) Permanent(key string, value bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	item, ok := s.items[key]
+	if !ok {
+		return
+	}
+	item.permanent = value
+	if !value {
+		item.activeTime = time.Now()
+	}
+}
+
+// OnExpired sets the handler which is called after a token is removed for being expired
+func (s *TokenStore) OnExpired(fn func(key string)) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.expired = fn
+}
+
+// Range calls fn for each token which is not expired
+func (s *TokenStore) Range(fn func(key string, value interface{})) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	now := time.Now()
+	for key, item := range s.items {
+		if s.isExpired(item, now) {
+			continue
+		}
+		fn(key, item.value)
+	}
+}
+
+func (s *TokenStore) isExpired(item *tokenItem, now time.Time) bool {
+	if s.expiration <= 0 || item.permanent {
+		return false
+	}
+
+	return now.Sub(item.activeTime) > s.expiration
+}
+
+// save writes the token to the database, the record is put under the lock only if the item is still the current one,
+// so that a token deleted (or replaced) while being encrypted is never written back
+func (s *TokenStore) save(key string, item *tokenItem) {
+	token, ok := item.value.(*gtype.Token)
+	if !ok || token == nil {
+		return
+	}
+	transient, ok := token.Ext.(interface{ Transient() bool })
+	if ok && transient.Transient() {
+		return
+	}
+
+	copied := *token
+	copied.Ext = nil
+	record := &tokenRecord{
+		Token: &copied,
+	}
+	if token.Ext != nil {
+		ext, err := s.encrypt(token.Ext)
+		if err != nil {
+			return
+		}
+		record.Ext = ext
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.items[key] != item {
+		return
+	}
+	record.ActiveTime = item.activeTime
+	item.savedTime = time.Now()
+
+	s.dbs.Put(TokenBucket, key, record)
+}
+
+func (s *TokenStore) load() error {
+	now := time.Now()
+	expired := make([]string, 0)
+	err := s.dbs.ForEach(TokenBucket, func(key string, value []byte) error {
+		record := &tokenRecord{}
+		if json.Unmarshal(value, record) != nil || record.Token == nil {
+			expired = append(expired, key)
+			return nil
+		}
+		item := &tokenItem{
+			value:      record.Token,
+			activeTime: record.ActiveTime,
+			savedTime:  record.ActiveTime,
+		}
+		if s.isExpired(item, now) {
+			expired = append(expired, key)
+			return nil
+		}
+		if len(record.Ext) > 0 {
+			ext, err := s.decrypt(record.Ext)
+			if err != nil {
+				// the key has been changed
+				expired = append(expired, key)
+				return nil
+			}
+			record.Token.Ext = ext
+		}
+
+		s.items[key] = item
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, key := range expired {
+		s.dbs.Delete(TokenBucket, key)
+	}
+
+	return nil
+}
+
+func (s *TokenStore) sweep() {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		s.purge(time.Now())
+	}
+}
+
+// purge removes the tokens expired at now and returns their keys
+func (s *TokenStore) purge(now time.Time) []string {
+	expired := make([]string, 0)
+	s.mutex.Lock()
+	for key, item := range s.items {
+		if s.isExpired(item, now) {
+			expired = append(expired, key)
+			delete(s.items, key)
+		}
+	}
+	handler := s.expired
+	s.mutex.Unlock()
+
+	for _, key := range expired {
+		s.dbs.Delete(TokenBucket, key)
+		if handler != nil {
+			handler(key)
+		}
+	}
+
+	return expired
+}
+
+func (s *TokenStore) encrypt(v interface{}) ([]byte, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, s.aead.NonceSize())
+	_, err = rand.Read(nonce)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.aead.Seal(nonce, nonce, data, nil), nil
+}
+
+func (s *TokenStore) decrypt(v []byte) (interface{}, error) {
+	size := s.aead.NonceSize()
+	if len(v) < size {
+		return nil, fmt.Errorf("invalid data")
+	}
+	data, err := s.aead.Open(nil, v[:size], v[size:], nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var ext interface{}
+	if s.newExt != nil {
+		ext = s.newExt()
+		err = json.Unmarshal(data, ext)
+	} else {
+		err = json.Unmarshal(data, &ext)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return ext, nil
+}
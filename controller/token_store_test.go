@@ -0,0 +1,183 @@
+package controller
+
+import (
+	"bytes"
+	"github.com/csby/goa/assist"
+	"github.com/csby/goa/data/storage"
+	"github.com/csby/goa/data/storage/storagetest"
+	"github.com/csby/gwsf/gtype"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func newTestExt() interface{} {
+	return &assist.AdEntryUser{}
+}
+
+func TestTokenStore_Persist(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.db")
+	key := bytes.Repeat([]byte{1}, 32)
+
+	dbs, err := storage.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	store, err := NewTokenStore(dbs, 30, key, newTestExt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ext := &assist.AdEntryUser{Account: "zhangsan", SID: "S-1-5-21-secret"}
+	store.Set("t1", &gtype.Token{ID: "t1", UserAccount: "zhangsan", Ext: ext})
+
+	raw := make([]byte, 0)
+	dbs.ForEach(TokenBucket, func(k string, v []byte) error {
+		raw = append(raw, v...)
+		return nil
+	})
+	if len(raw) < 1 {
+		t.Fatal("token should be saved")
+	}
+	if bytes.Contains(raw, []byte("S-1-5-21-secret")) {
+		t.Fatal("ext should be encrypted")
+	}
+	dbs.Close()
+
+	dbs, err = storage.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dbs.Close()
+	store, err = NewTokenStore(dbs, 30, key, newTestExt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	value, ok := store.Get("t1", true)
+	if !ok {
+		t.Fatal("token should be restored")
+	}
+	token, ok := value.(*gtype.Token)
+	if !ok || token.UserAccount != "zhangsan" {
+		t.Fatalf("unexpected token: %#v", value)
+	}
+	user, ok := token.Ext.(*assist.AdEntryUser)
+	if !ok || user.SID != ext.SID {
+		t.Fatalf("unexpected ext: %#v", token.Ext)
+	}
+
+	tdb := NewTokenDatabase(store)
+	if len(tdb.GetTokens("ZhangSan")) != 1 {
+		t.Fatal("restored token should be indexed by account")
+	}
+	if tdb.DelTokens("zhangsan") != 1 {
+		t.Fatal("restored token should be revoked")
+	}
+	if _, ok = store.Get("t1", false); ok {
+		t.Fatal("token should be deleted")
+	}
+}
+
+func TestTokenStore_WrongKey(t *testing.T) {
+	dbs := storagetest.Open(t)
+
+	store, err := NewTokenStore(dbs, 30, bytes.Repeat([]byte{1}, 32), newTestExt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	store.Set("t1", &gtype.Token{ID: "t1", Ext: &assist.AdEntryUser{}})
+
+	store, err = NewTokenStore(dbs, 30, bytes.Repeat([]byte{2}, 32), newTestExt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := store.Get("t1", false); ok {
+		t.Fatal("token should be dropped when the key is changed")
+	}
+}
+
+func TestTokenStore_Expire(t *testing.T) {
+	dbs := storagetest.Open(t)
+
+	store, err := NewTokenStore(dbs, 1, bytes.Repeat([]byte{1}, 32), newTestExt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	store.Set("t1", &gtype.Token{ID: "t1"})
+	store.Set("t2", &gtype.Token{ID: "t2"})
+	store.Permanent("t2", true)
+	store.items["t1"].activeTime = time.Now().Add(-2 * time.Minute)
+	store.items["t2"].activeTime = time.Now().Add(-2 * time.Minute)
+
+	if _, ok := store.Get("t1", true); ok {
+		t.Fatal("token should be expired")
+	}
+	if _, ok := store.Get("t2", true); !ok {
+		t.Fatal("permanent token should not be expired")
+	}
+
+	store.Permanent("t2", false)
+	if _, ok := store.Get("t2", false); !ok {
+		t.Fatal("token should be active after the websocket is closed")
+	}
+}
+
+func TestTokenStore_Transient(t *testing.T) {
+	dbs := storagetest.Open(t)
+	store, err := NewTokenStore(dbs, 30, bytes.Repeat([]byte{1}, 32), newTestExt)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ext := &Impersonation{Admin: "admin", ExpireTime: time.Now().Add(time.Minute)}
+	ext.Account = "zhangsan"
+	store.Set("t1", &gtype.Token{ID: "t1", UserAccount: "zhangsan", Ext: ext})
+	store.Get("t1", true)
+
+	count := 0
+	dbs.ForEach(TokenBucket, func(k string, v []byte) error {
+		count++
+		return nil
+	})
+	if count != 0 {
+		t.Fatal("impersonation token should not be saved")
+	}
+	if _, ok := store.Get("t1", false); !ok {
+		t.Fatal("impersonation token should be kept in memory")
+	}
+}
+
+func TestTokenStore_SaveAfterDelete(t *testing.T) {
+	dbs := storagetest.Open(t)
+	store, err := NewTokenStore(dbs, 30, bytes.Repeat([]byte{1}, 32), newTestExt)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	store.Set("t1", &gtype.Token{ID: "t1", UserAccount: "zhangsan"})
+	store.mutex.RLock()
+	item := store.items["t1"]
+	store.mutex.RUnlock()
+
+	// a save which started before the token is revoked finishes after it
+	store.Del("t1")
+	store.save("t1", item)
+
+	ok, err := dbs.Get(TokenBucket, "t1", &tokenRecord{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ok {
+		t.Fatal("revoked token should not be written back")
+	}
+
+	store.Set("t2", &gtype.Token{ID: "t2", UserAccount: "lisi"})
+	store.mutex.RLock()
+	replaced := store.items["t2"]
+	store.mutex.RUnlock()
+	store.Set("t2", &gtype.Token{ID: "t2", UserAccount: "wangwu"})
+	store.save("t2", replaced)
+	record := &tokenRecord{}
+	if ok, _ = dbs.Get(TokenBucket, "t2", record); !ok || record.Token.UserAccount != "wangwu" {
+		t.Fatalf("replaced token should not be written back: %+v", record.Token)
+	}
+}
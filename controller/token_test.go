@@ -0,0 +1,125 @@
+package controller
+
+import (
+	"bytes"
+	"github.com/csby/goa/data/storage/storagetest"
+	"github.com/csby/gwsf/gtype"
+	"testing"
+	"time"
+)
+
+func newTestTokenDatabase(t *testing.T) *TokenDatabase {
+	dbs := storagetest.Open(t)
+
+	store, err := NewTokenStore(dbs, 30, bytes.Repeat([]byte{1}, 32), newTestExt)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return NewTokenDatabase(store)
+}
+
+func TestTokenDatabase_State(t *testing.T) {
+	tdb := newTestTokenDatabase(t)
+	loginTime := time.Now().Add(-time.Hour)
+	token := &gtype.Token{ID: "t1", UserAccount: "ZhangSan", LoginTime: loginTime, ActiveTime: loginTime}
+	tdb.Set(token.ID, token)
+	tdb.Set("t2", &gtype.Token{ID: "t2", UserAccount: "lisi"})
+
+	if accounts := tdb.GetAccounts(); len(accounts) != 2 {
+		t.Errorf("expected 2 accounts, got %v", accounts)
+	}
+
+	if !tdb.GetActiveTime(token).Equal(loginTime) {
+		t.Error("active time should be the login time before any request")
+	}
+	tdb.Get(token.ID, false)
+	if !tdb.GetActiveTime(token).Equal(loginTime) {
+		t.Error("active time should not be changed without delay")
+	}
+	tdb.Get(token.ID, true)
+	if !tdb.GetActiveTime(token).After(loginTime) {
+		t.Error("active time should be updated with delay")
+	}
+
+	tdb.Connect(token.ID)
+	tdb.Connect(token.ID)
+	tdb.Disconnect(token.ID)
+	if !tdb.IsConnected(token.ID) {
+		t.Error("token should be connected with one channel left")
+	}
+	tdb.Disconnect(token.ID)
+	if tdb.IsConnected(token.ID) {
+		t.Error("token should not be connected without channels")
+	}
+
+	tdb.Connect(token.ID)
+	tdb.Del(token.ID)
+	if tdb.IsConnected(token.ID) {
+		t.Error("state should be removed with the token")
+	}
+	if len(tdb.GetTokens("zhangsan")) != 0 {
+		t.Error("token should be deleted")
+	}
+}
+
+func TestTokenDatabase_Expired(t *testing.T) {
+	dbs := storagetest.Open(t)
+	store, err := NewTokenStore(dbs, 30, bytes.Repeat([]byte{1}, 32), newTestExt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tdb := NewTokenDatabase(store)
+	tdb.Set("t1", &gtype.Token{ID: "t1", UserAccount: "zhangsan"})
+	tdb.Set("t2", &gtype.Token{ID: "t2", UserAccount: "lisi"})
+	tdb.Connect("t1")
+
+	expired := store.purge(time.Now().Add(time.Hour))
+	if len(expired) != 2 {
+		t.Fatalf("expected 2 expired tokens, got %v", expired)
+	}
+	if accounts := tdb.GetAccounts(); len(accounts) != 0 {
+		t.Errorf("index should be pruned when the token expired, got %v", accounts)
+	}
+	if len(tdb.states) != 0 {
+		t.Errorf("states should be pruned when the token expired, got %d", len(tdb.states))
+	}
+}
+
+type testMemoryTokenDatabase struct {
+	items map[string]interface{}
+}
+
+func (s *testMemoryTokenDatabase) Set(key string, value interface{}) { s.items[key] = value }
+func (s *testMemoryTokenDatabase) Del(key string) bool {
+	_, ok := s.items[key]
+	delete(s.items, key)
+	return ok
+}
+func (s *testMemoryTokenDatabase) Get(key string, delay bool) (interface{}, bool) {
+	value, ok := s.items[key]
+	return value, ok
+}
+func (s *testMemoryTokenDatabase) Permanent(key string, value bool) {}
+
+func TestTokenDatabase_Prune(t *testing.T) {
+	inner := &testMemoryTokenDatabase{items: make(map[string]interface{})}
+	tdb := NewTokenDatabase(inner)
+	tdb.Set("t1", &gtype.Token{ID: "t1", UserAccount: "zhangsan"})
+	tdb.Set("t2", &gtype.Token{ID: "t2", UserAccount: "lisi"})
+	tdb.Connect("t2")
+
+	// expired inside the store without notification
+	delete(inner.items, "t2")
+
+	if count := tdb.Prune(); count != 1 {
+		t.Errorf("expected 1 pruned token, got %d", count)
+	}
+	accounts := tdb.GetAccounts()
+	if len(accounts) != 1 {
+		t.Errorf("expected 1 account left, got %v", accounts)
+	}
+	if tdb.IsConnected("t2") {
+		t.Error("state of the expired token should be removed")
+	}
+}
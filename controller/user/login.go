@@ -2,6 +2,7 @@ package user
 
 import (
 	"github.com/csby/goa/controller"
+	"github.com/csby/goa/data/model"
 	"github.com/csby/gwsf/gtype"
 	"time"
 )
@@ -25,27 +26,35 @@ func (s *Login) GetAccount(ctx gtype.Context, ps gtype.Params) {
 		return
 	}
 
-	account := &gtype.LoginAccount{
-		Account:   token.UserAccount,
-		Name:      token.UserName,
-		LoginTime: gtype.DateTime(token.LoginTime),
-		LoginIp:   token.LoginIP,
-	}
+	account := &model.AuthLoginAccount{}
+	account.Account = token.UserAccount
+	account.Name = token.UserName
+	account.LoginTime = gtype.DateTime(token.LoginTime)
+	account.LoginIp = token.LoginIP
 	if s.IsAdmin(account.Account) {
 		account.Role = 1
 	}
+	impersonation := controller.ImpersonationOf(token)
+	if impersonation != nil {
+		account.Impersonator = &model.AuthImpersonator{
+			Account:    impersonation.Admin,
+			Name:       impersonation.AdminName,
+			Reason:     impersonation.Reason,
+			ExpireTime: gtype.DateTime(impersonation.ExpireTime),
+		}
+	}
 	ctx.Success(account)
 }
 
 func (s *Login) GetAccountDoc(doc gtype.Doc, method string, uri gtype.Uri) {
 	catalog := s.createCatalog(doc, userCatalogLogin)
 	function := catalog.AddFunction(method, uri, "获取账号信息")
-	function.SetNote("获取当前登录账号基本信息")
-	function.SetOutputDataExample(&gtype.LoginAccount{
-		Account:   "admin",
-		Name:      "管理员",
-		LoginTime: gtype.DateTime(time.Now()),
-	})
+	function.SetNote("获取当前登录账号基本信息; 代理登录时包含代理登录的管理员(impersonator), 界面应显示代理登录提示")
+	example := &model.AuthLoginAccount{}
+	example.Account = "admin"
+	example.Name = "管理员"
+	example.LoginTime = gtype.DateTime(time.Now())
+	function.SetOutputDataExample(example)
 	function.AddOutputError(gtype.ErrTokenEmpty)
 	function.AddOutputError(gtype.ErrTokenInvalid)
 }
@@ -57,6 +57,10 @@ func (s *Notify) Socket(ctx gtype.Context, ps gtype.Params) {
 	}
 	channel := s.WChs.NewChannel(token)
 	defer s.WChs.Remove(channel)
+	if token != nil {
+		s.Tdb.Connect(token.ID)
+		defer s.Tdb.Disconnect(token.ID)
+	}
 
 	waitGroup := &sync.WaitGroup{}
 	stopWrite := make(chan bool, 2)
@@ -82,6 +86,24 @@ func (s *Notify) Socket(ctx gtype.Context, ps gtype.Params) {
 					return
 				}
 
+				if msg != nil {
+					notice, isNotice := msg.Data.(*socket.Notice)
+					if isNotice {
+						if notice == nil || !notice.Match(ch.Token()) {
+							continue
+						}
+						msg = &gtype.SocketMessage{
+							ID:   msg.ID,
+							Data: notice.Data,
+						}
+						if notice.Close {
+							conn.WriteJSON(msg)
+							conn.Close()
+							return
+						}
+					}
+				}
+
 				conn.WriteJSON(msg)
 			}
 		}
@@ -0,0 +1,89 @@
+package controller
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/csby/goa/data/model"
+	"github.com/csby/gwsf/gtype"
+	"strings"
+	"time"
+)
+
+const (
+	VpnGrantBucket = "vpn.grant"
+	VpnEventBucket = "vpn.event"
+)
+
+// SetUserVpnEnable sets the dial-in permission of the account and records the change,
+// ip is the address of the operator and is empty when the change is made by a background task
+func (s *Controller) SetUserVpnEnable(account string, enable bool, source int, operator, ip, reason string) error {
+	ad := s.Ad()
+	err := ad.SetUserVpnEnable(account, enable)
+	if err != nil {
+		return err
+	}
+
+	if s.Dbs == nil {
+		return nil
+	}
+
+	now := time.Now()
+	event := &model.VpnEvent{
+		ID:       fmt.Sprintf("%019d.%s", now.UnixNano(), gtype.NewGuid()),
+		Account:  account,
+		Enable:   enable,
+		Source:   source,
+		Operator: operator,
+		IP:       ip,
+		Reason:   reason,
+		Time:     gtype.DateTime(now),
+	}
+	err = s.Dbs.Put(VpnEventBucket, event.ID, event)
+	if err != nil {
+		s.LogError("save vpn event fail:", err)
+	}
+
+	return nil
+}
+
+// CancelVpnGrants cancels the scheduled and active grants of the account so that the scheduler
+// will not change the permission anymore, it returns the count of the canceled grants
+func (s *Controller) CancelVpnGrants(account string) (int, error) {
+	if s.Dbs == nil {
+		return 0, nil
+	}
+
+	ids := make([]string, 0)
+	err := s.Dbs.ForEach(VpnGrantBucket, func(key string, value []byte) error {
+		item := &model.VpnGrant{}
+		if json.Unmarshal(value, item) != nil {
+			return nil
+		}
+		if strings.ToLower(item.Account) != strings.ToLower(account) {
+			return nil
+		}
+		if item.Status == model.VpnGrantScheduled || item.Status == model.VpnGrantActive {
+			ids = append(ids, key)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	for _, id := range ids {
+		item := &model.VpnGrant{}
+		err = s.Dbs.Modify(VpnGrantBucket, id, item, func(existed bool) error {
+			if !existed {
+				return fmt.Errorf("not existed")
+			}
+			item.Status = model.VpnGrantCanceled
+			return nil
+		})
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	return len(ids), nil
+}
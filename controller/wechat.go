@@ -0,0 +1,5 @@
+package controller
+
+const (
+	WechatBindingBucket = "wechat.binding"
+)
@@ -0,0 +1,73 @@
+package model
+
+import (
+	"github.com/csby/gwsf/gtype"
+	"time"
+)
+
+const (
+	AdResourceServer = 1 // 服务器
+	AdResourceShare  = 2 // 共享目录
+	AdResourceSvn    = 3 // SVN存储库
+
+	AdResourceOther = 0
+)
+
+const (
+	AccessRequestPending  = 0 // 待审批
+	AccessRequestApproved = 1 // 已批准
+	AccessRequestRejected = 2 // 已拒绝
+	AccessRequestFailed   = 3 // 已批准, 但添加组成员失败
+)
+
+type AdResource struct {
+	AdDn
+
+	Type int    `json:"type" note:"资源类型: 1-服务器; 2-共享目录; 3-SVN存储库; 0-其他"`
+	Name string `json:"name" note:"资源名称"`
+}
+
+type AdResourceGroup struct {
+	Resource AdResource  `json:"resource" note:"资源"`
+	Group    AdRoleGroup `json:"group" note:"角色组"`
+}
+
+type AccessRequestCreate struct {
+	GroupDn string `json:"groupDn" required:"true" note:"申请的角色组唯一名称, base64"`
+	Reason  string `json:"reason" required:"true" note:"申请理由"`
+}
+
+type AccessRequestFilter struct {
+	Status int  `json:"status" note:"状态: -1-全部; 0-待审批; 1-已批准; 2-已拒绝; 3-执行失败"`
+	Mine   bool `json:"mine" note:"true-我提交的申请; false-需要我审批的申请"`
+}
+
+type AccessRequestApprove struct {
+	ID      string `json:"id" required:"true" note:"申请标识ID"`
+	Comment string `json:"comment" note:"审批意见"`
+}
+
+type AccessRequest struct {
+	ID          string          `json:"id" note:"标识ID"`
+	Account     string          `json:"account" note:"申请人帐号"`
+	Name        string          `json:"name" note:"申请人姓名"`
+	MemberDn    string          `json:"memberDn" note:"申请人唯一名称, base64"`
+	Group       AdRoleGroup     `json:"group" note:"申请的角色组"`
+	Resource    AdResource      `json:"resource" note:"角色组所属资源"`
+	Reason      string          `json:"reason" note:"申请理由"`
+	Approvers   []string        `json:"approvers" note:"审批人帐号"`
+	Status      int             `json:"status" note:"状态: 0-待审批; 1-已批准; 2-已拒绝; 3-执行失败"`
+	ApproveBy   string          `json:"approveBy" note:"审批人帐号"`
+	Comment     string          `json:"comment" note:"审批意见"`
+	Error       string          `json:"error" note:"添加组成员失败时的错误信息"`
+	CreateTime  gtype.DateTime  `json:"createTime" note:"申请时间"`
+	ApproveTime *gtype.DateTime `json:"approveTime,omitempty" note:"审批时间"`
+}
+
+type AccessRequestCollection []*AccessRequest
+
+func (s AccessRequestCollection) Len() int      { return len(s) }
+func (s AccessRequestCollection) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+func (s AccessRequestCollection) Less(i, j int) bool {
+	return time.Time(s[i].CreateTime).After(time.Time(s[j].CreateTime))
+}
@@ -1,6 +1,10 @@
 package model
 
-import "strings"
+import (
+	"github.com/csby/gwsf/gtype"
+	"strings"
+	"time"
+)
 
 const (
 	GroupRoleAuthorization   = 99 // 授权管理员
@@ -147,6 +151,7 @@ type AdOrganizationUnitAdd struct {
 	Description string `json:"description" note:"描述"`
 	Street      string `json:"street" note:"街道"`
 	GroupSuffix string `json:"groupSuffix" note:"用户组后缀"`
+	SkipGroups  bool   `json:"skipGroups" note:"是否不创建角色组, 默认按配置的模板创建"`
 }
 
 type AdServer struct {
@@ -179,4 +184,24 @@ func (s AdServerCollection) Less(i, j int) bool {
 type AdGroupMemberArgument struct {
 	GroupDn  string `json:"groupDn" required:"true" note:"组唯一名称"`
 	MemberDn string `json:"memberDn" required:"true" note:"成员唯一名称"`
+
+	ExpireTime *gtype.DateTime `json:"expireTime,omitempty" note:"过期时间, 仅添加成员时有效, 为空表示永久有效, 到期后自动移除该成员"`
+}
+
+type AdGroupMemberExpiration struct {
+	ID         string         `json:"id" note:"标识ID"`
+	Group      AdRoleGroup    `json:"group" note:"组"`
+	Member     AdUser         `json:"member" note:"成员"`
+	ExpireTime gtype.DateTime `json:"expireTime" note:"过期时间"`
+	Reminded   bool           `json:"reminded" note:"是否已发送到期提醒"`
+	CreateBy   string         `json:"createBy" note:"添加人帐号"`
+	CreateTime gtype.DateTime `json:"createTime" note:"添加时间"`
+}
+
+type AdGroupMemberExpirationCollection []*AdGroupMemberExpiration
+
+func (s AdGroupMemberExpirationCollection) Len() int      { return len(s) }
+func (s AdGroupMemberExpirationCollection) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+func (s AdGroupMemberExpirationCollection) Less(i, j int) bool {
+	return time.Time(s[i].ExpireTime).Before(time.Time(s[j].ExpireTime))
 }
@@ -0,0 +1,37 @@
+package model
+
+import "github.com/csby/gwsf/gtype"
+
+type ApiKey struct {
+	ID         string          `json:"id" note:"标识ID"`
+	Name       string          `json:"name" note:"名称, 如: dhcp-kiosk"`
+	Account    string          `json:"account" note:"调用时使用的用户帐号, 权限与该帐号相同"`
+	Routes     []string        `json:"routes" note:"允许调用的接口路径, 如: /staff.api/dhcp/filter/add, 以*结尾表示前缀匹配"`
+	Cidrs      []string        `json:"cidrs" note:"允许的来源地址(CIDR), 如: 192.168.1.0/24"`
+	ExpireTime gtype.DateTime  `json:"expireTime" note:"过期时间"`
+	Creator    string          `json:"creator" note:"创建人帐号"`
+	CreateTime gtype.DateTime  `json:"createTime" note:"创建时间"`
+	UseTime    *gtype.DateTime `json:"useTime,omitempty" note:"最后使用时间"`
+	UseIP      string          `json:"useIp,omitempty" note:"最后使用的来源IP"`
+	UseCount   int64           `json:"useCount" note:"使用次数(近似值)"`
+
+	Hash string `json:"hash,omitempty" note:"密钥的哈希值, 不返回"`
+}
+
+type ApiKeyCreate struct {
+	Name       string         `json:"name" required:"true" note:"名称"`
+	Account    string         `json:"account" required:"true" note:"调用时使用的用户帐号"`
+	Routes     []string       `json:"routes" required:"true" note:"允许调用的接口路径, 以*结尾表示前缀匹配"`
+	Cidrs      []string       `json:"cidrs" required:"true" note:"允许的来源地址(CIDR或IP)"`
+	ExpireTime gtype.DateTime `json:"expireTime" required:"true" note:"过期时间"`
+}
+
+type ApiKeyCreated struct {
+	ApiKey
+
+	Key string `json:"key" note:"密钥, 仅在创建时返回一次, 调用接口时作为凭证(token)使用"`
+}
+
+type ApiKeyDelete struct {
+	ID string `json:"id" required:"true" note:"标识ID"`
+}
@@ -0,0 +1,40 @@
+package model
+
+import (
+	"github.com/csby/gwsf/gtype"
+	"time"
+)
+
+const (
+	AuditActionImpersonateStart = 1 // 开始代理登录
+	AuditActionImpersonateCall  = 2 // 代理登录期间调用接口
+	AuditActionImpersonateStop  = 3 // 结束代理登录
+)
+
+type AuditEvent struct {
+	ID        string         `json:"id" note:"标识ID"`
+	Action    int            `json:"action" note:"操作: 1-开始代理登录; 2-代理登录期间调用接口; 3-结束代理登录"`
+	Account   string         `json:"account" note:"生效的用户帐号, 代理登录时为被代理的用户"`
+	Operator  string         `json:"operator" note:"实际操作人帐号, 代理登录时为管理员"`
+	SessionID string         `json:"sessionId" note:"会话ID"`
+	IP        string         `json:"ip" note:"操作人IP地址"`
+	Path      string         `json:"path" note:"接口地址"`
+	Reason    string         `json:"reason" note:"原因"`
+	Time      gtype.DateTime `json:"time" note:"操作时间"`
+}
+
+type AuditEventCollection []*AuditEvent
+
+func (s AuditEventCollection) Len() int      { return len(s) }
+func (s AuditEventCollection) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+func (s AuditEventCollection) Less(i, j int) bool {
+	return time.Time(s[i].Time).After(time.Time(s[j].Time))
+}
+
+type AuditEventFilter struct {
+	Account   string          `json:"account" note:"生效的用户帐号, 为空时表示全部"`
+	Operator  string          `json:"operator" note:"实际操作人帐号, 为空时表示全部"`
+	SessionID string          `json:"sessionId" note:"会话ID, 为空时表示全部"`
+	StartTime *gtype.DateTime `json:"startTime" note:"开始时间"`
+	EndTime   *gtype.DateTime `json:"endTime" note:"结束时间"`
+}
@@ -0,0 +1,49 @@
+package model
+
+import "github.com/csby/gwsf/gtype"
+
+const (
+	AuthRoleAdmin         = "admin"         // 管理员组成员
+	AuthRoleAuthorization = "authorization" // 资源授权组成员, 或可管理请求参数中指定的组
+	AuthRoleSelf          = "self"          // 请求参数中的用户帐号为本人
+	AuthRoleRepository    = "repository"    // 请求参数中SVN存储库的授权管理员组成员
+)
+
+const (
+	AuthConditionNone       = ""           // 无条件
+	AuthConditionAccount    = "account"    // 仅限本人帐号
+	AuthConditionGroup      = "group"      // 仅限可管理的组
+	AuthConditionRepository = "repository" // 仅限可管理的SVN存储库
+)
+
+type AuthCapability struct {
+	Account string                 `json:"account" note:"用户帐号"`
+	Roles   []string               `json:"roles" note:"用户具有的角色: admin-管理员; authorization-资源授权管理员"`
+	Routes  []*AuthRouteCapability `json:"routes" note:"受限接口"`
+}
+
+type AuthRouteCapability struct {
+	Uri       string   `json:"uri" note:"接口地址"`
+	Roles     []string `json:"roles" note:"允许调用的角色: admin-管理员; authorization-资源授权管理员; self-本人; repository-SVN存储库授权管理员"`
+	Allowed   bool     `json:"allowed" note:"是否可以调用"`
+	Condition string   `json:"condition" note:"调用条件, 空-无条件; account-仅限本人帐号; group-仅限可管理的组; repository-仅限可管理的SVN存储库"`
+}
+
+type MembershipCacheStats struct {
+	Enabled bool                   `json:"enabled" note:"是否启用缓存"`
+	Ttl     int64                  `json:"ttl" note:"缓存有效期(秒)"`
+	Size    int                    `json:"size" note:"有效的缓存项数量"`
+	Hits    uint64                 `json:"hits" note:"命中次数"`
+	Misses  uint64                 `json:"misses" note:"未命中次数"`
+	HitRate float64                `json:"hitRate" note:"命中率"`
+	Kinds   []*MembershipCacheStat `json:"kinds" note:"各类缓存的统计"`
+	Time    gtype.DateTime         `json:"time" note:"统计时间"`
+}
+
+type MembershipCacheStat struct {
+	Kind    string  `json:"kind" note:"类别: admin-管理员组成员; authorization-资源授权组成员; role-组的角色"`
+	Size    int     `json:"size" note:"有效的缓存项数量"`
+	Hits    uint64  `json:"hits" note:"命中次数"`
+	Misses  uint64  `json:"misses" note:"未命中次数"`
+	HitRate float64 `json:"hitRate" note:"命中率"`
+}
@@ -0,0 +1,80 @@
+package model
+
+import (
+	"github.com/csby/gwsf/gtype"
+	"strings"
+	"time"
+)
+
+const (
+	GroupMemberAdded   = 1 // 添加成员
+	GroupMemberRemoved = 2 // 移除成员
+)
+
+const (
+	GroupMemberSourceSnapshot = 0 // 对比快照时发现的变更, 如在域控制台中直接修改
+	GroupMemberSourceApi      = 1 // 通过接口添加或移除
+	GroupMemberSourceAccess   = 2 // 权限申请批准
+	GroupMemberSourceExpired  = 3 // 限时成员到期
+	GroupMemberSourceReview   = 4 // 权限审核撤销
+	GroupMemberSourceJob      = 5 // 入职或离职作业
+)
+
+type GroupMemberSnapshot struct {
+	Date       string                      `json:"date" note:"日期, 如: 2024-01-31"`
+	CreateTime gtype.DateTime              `json:"createTime" note:"快照时间"`
+	Groups     []*GroupMemberSnapshotGroup `json:"groups" note:"角色组"`
+}
+
+type GroupMemberSnapshotGroup struct {
+	Group   AdGroup   `json:"group" note:"角色组"`
+	Members []*AdUser `json:"members" note:"成员"`
+}
+
+type GroupMemberEvent struct {
+	ID       string         `json:"id" note:"标识ID"`
+	Group    AdGroup        `json:"group" note:"角色组"`
+	Member   AdUser         `json:"member" note:"成员"`
+	Action   int            `json:"action" note:"变更: 1-添加成员; 2-移除成员"`
+	Source   int            `json:"source" note:"来源: 0-快照对比(操作人未知); 1-接口; 2-权限申请; 3-限时成员到期; 4-权限审核; 5-入职或离职作业"`
+	Operator string         `json:"operator" note:"操作人帐号"`
+	Time     gtype.DateTime `json:"time" note:"变更时间, 快照对比时为发现变更的快照时间"`
+}
+
+type GroupMemberEventCollection []*GroupMemberEvent
+
+func (s GroupMemberEventCollection) Len() int      { return len(s) }
+func (s GroupMemberEventCollection) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+func (s GroupMemberEventCollection) Less(i, j int) bool {
+	return time.Time(s[i].Time).Before(time.Time(s[j].Time))
+}
+
+type GroupMemberTimelineFilter struct {
+	GroupDn string `json:"groupDn" required:"true" note:"组唯一名称, base64"`
+}
+
+type GroupMemberDiffFilter struct {
+	From    string `json:"from" required:"true" note:"开始日期, 如: 2024-01-01"`
+	To      string `json:"to" note:"结束日期, 如: 2024-01-31, 为空时表示当前"`
+	GroupDn string `json:"groupDn" note:"组唯一名称, base64, 为空时表示全部角色组"`
+}
+
+type GroupMemberDiff struct {
+	From   string                 `json:"from" note:"实际对比的开始快照日期"`
+	To     string                 `json:"to" note:"实际对比的结束快照日期, 为空时表示当前"`
+	Groups []*GroupMemberDiffItem `json:"groups" note:"有变更的角色组"`
+}
+
+type GroupMemberDiffItem struct {
+	Group   AdGroup   `json:"group" note:"角色组"`
+	Added   []*AdUser `json:"added" note:"新增成员"`
+	Removed []*AdUser `json:"removed" note:"移除成员"`
+}
+
+type GroupMemberDiffItemCollection []*GroupMemberDiffItem
+
+func (s GroupMemberDiffItemCollection) Len() int      { return len(s) }
+func (s GroupMemberDiffItemCollection) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+func (s GroupMemberDiffItemCollection) Less(i, j int) bool {
+	return strings.Compare(s[i].Group.Account, s[j].Group.Account) < 0
+}
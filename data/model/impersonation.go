@@ -0,0 +1,28 @@
+package model
+
+import "github.com/csby/gwsf/gtype"
+
+type AuthImpersonate struct {
+	Account string `json:"account" required:"true" note:"被代理的用户帐号"`
+	Reason  string `json:"reason" required:"true" note:"原因, 如: 工单号"`
+}
+
+type AuthImpersonator struct {
+	Account    string         `json:"account" note:"管理员帐号"`
+	Name       string         `json:"name" note:"管理员姓名"`
+	Reason     string         `json:"reason" note:"原因"`
+	ExpireTime gtype.DateTime `json:"expireTime" note:"代理登录到期时间"`
+}
+
+type AuthImpersonation struct {
+	AuthLogin
+
+	SessionID    string            `json:"sessionId" note:"会话ID, 用于查询审计记录"`
+	Impersonator *AuthImpersonator `json:"impersonator" note:"代理登录的管理员"`
+}
+
+type AuthLoginAccount struct {
+	gtype.LoginAccount
+
+	Impersonator *AuthImpersonator `json:"impersonator,omitempty" note:"代理登录的管理员, 不为空时表示当前为代理登录, 界面应显示代理登录提示"`
+}
@@ -0,0 +1,89 @@
+package model
+
+import (
+	"github.com/csby/gwsf/gtype"
+	"time"
+)
+
+const (
+	JobOffboarding = 1 // 离职
+	JobOnboarding  = 2 // 入职
+)
+
+const (
+	JobRunning   = 0 // 执行中
+	JobSucceeded = 1 // 成功
+	JobFailed    = 2 // 失败
+)
+
+const (
+	JobStepPending    = 0 // 待执行
+	JobStepSucceeded  = 1 // 成功
+	JobStepFailed     = 2 // 失败
+	JobStepSkipped    = 3 // 跳过
+	JobStepPlanned    = 4 // 预演, 未执行
+	JobStepRolledBack = 5 // 已回滚
+)
+
+type Job struct {
+	ID         string          `json:"id" note:"标识ID"`
+	Type       int             `json:"type" note:"类型: 1-离职; 2-入职"`
+	Target     string          `json:"target" note:"用户帐号"`
+	DryRun     bool            `json:"dryRun" note:"是否为预演, 预演时仅列出将要执行的操作"`
+	Status     int             `json:"status" note:"状态: 0-执行中; 1-成功; 2-失败"`
+	Steps      []*JobStep      `json:"steps" note:"步骤"`
+	CreateBy   string          `json:"createBy" note:"执行人帐号"`
+	CreateTime gtype.DateTime  `json:"createTime" note:"开始时间"`
+	FinishTime *gtype.DateTime `json:"finishTime,omitempty" note:"结束时间"`
+}
+
+type JobStep struct {
+	Name   string          `json:"name" note:"名称"`
+	Status int             `json:"status" note:"状态: 0-待执行; 1-成功; 2-失败; 3-跳过; 4-预演; 5-已回滚"`
+	Items  []string        `json:"items" note:"操作对象, 如组、MAC地址等"`
+	Error  string          `json:"error" note:"错误信息"`
+	Time   *gtype.DateTime `json:"time,omitempty" note:"执行时间"`
+}
+
+type JobCollection []*Job
+
+func (s JobCollection) Len() int      { return len(s) }
+func (s JobCollection) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+func (s JobCollection) Less(i, j int) bool {
+	return time.Time(s[i].CreateTime).After(time.Time(s[j].CreateTime))
+}
+
+type JobFilter struct {
+	Type   int    `json:"type" note:"类型: 0-全部; 1-离职; 2-入职"`
+	Target string `json:"target" note:"用户帐号, 为空时表示全部"`
+}
+
+type JobID struct {
+	ID string `json:"id" required:"true" note:"作业标识ID"`
+}
+
+type JobOffboardingArgument struct {
+	Account string `json:"account" required:"true" note:"离职用户帐号"`
+	DryRun  bool   `json:"dryRun" note:"是否为预演, 预演时仅列出将要执行的操作"`
+}
+
+type JobOnboardingArgument struct {
+	Department string   `json:"department" required:"true" note:"部门名称, 对应入职模板(config: ad.onboarding)"`
+	Name       string   `json:"name" required:"true" note:"用户姓名"`
+	Account    string   `json:"account" required:"true" note:"登录帐号"`
+	Manager    string   `json:"manager" note:"直接主管DN, base64, 初始密码发送给直接主管"`
+	Macs       []string `json:"macs" note:"设备MAC地址, 用于添加DHCP筛选器"`
+}
+
+type JobOnboardingResult struct {
+	Job
+
+	Password string `json:"password,omitempty" note:"初始密码, 仅作业成功时在本次结果中返回, 不保存"`
+}
+
+type JobOnboardingPassword struct {
+	JobID    string `json:"jobId" note:"作业标识ID"`
+	Account  string `json:"account" note:"新用户登录帐号"`
+	Name     string `json:"name" note:"新用户姓名"`
+	Password string `json:"password" note:"初始密码"`
+}
@@ -0,0 +1,58 @@
+package model
+
+import "strings"
+
+const (
+	AccessPrincipalUser  = 1 // 用户
+	AccessPrincipalGroup = 2 // 组
+)
+
+type AccessMatrixPrincipalFilter struct {
+	Account string `json:"account" required:"true" note:"用户或组的帐号名称"`
+}
+
+type AccessMatrixResourceFilter struct {
+	Dn string `json:"dn" required:"true" note:"资源(服务器、共享目录或SVN存储库)的唯一名称, base64"`
+}
+
+type AccessMatrixExportFilter struct {
+	Account string `json:"account" note:"用户或组的帐号名称, 不为空时导出该用户或组可访问的资源"`
+	Dn      string `json:"dn" note:"资源的唯一名称, base64, 帐号名称为空时导出可访问该资源的用户"`
+}
+
+type AccessPrincipal struct {
+	AdDn
+
+	Type    int    `json:"type" note:"类型: 1-用户; 2-组"`
+	SID     string `json:"sid" note:"ID"`
+	Account string `json:"account" note:"帐号名称"`
+	Name    string `json:"name" note:"名称"`
+}
+
+type AccessMatrixEntry struct {
+	Principal AccessPrincipal `json:"principal" note:"用户或组"`
+	Resource  AdResource      `json:"resource" note:"资源"`
+	Group     AdRoleGroup     `json:"group" note:"角色组"`
+	Direct    bool            `json:"direct" note:"true-直接成员; false-通过嵌套组获得的权限"`
+}
+
+type AccessMatrixEntryCollection []*AccessMatrixEntry
+
+func (s AccessMatrixEntryCollection) Len() int      { return len(s) }
+func (s AccessMatrixEntryCollection) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+func (s AccessMatrixEntryCollection) Less(i, j int) bool {
+	if s[i].Resource.Type != s[j].Resource.Type {
+		return s[i].Resource.Type < s[j].Resource.Type
+	}
+	if s[i].Resource.Name != s[j].Resource.Name {
+		return strings.Compare(s[i].Resource.Name, s[j].Resource.Name) < 0
+	}
+	if s[i].Group.Role != s[j].Group.Role {
+		return s[i].Group.Role > s[j].Group.Role
+	}
+	if s[i].Group.Account != s[j].Group.Account {
+		return strings.Compare(s[i].Group.Account, s[j].Group.Account) < 0
+	}
+
+	return strings.Compare(s[i].Principal.Account, s[j].Principal.Account) < 0
+}
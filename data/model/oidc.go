@@ -0,0 +1,59 @@
+package model
+
+import (
+	"github.com/csby/gwsf/gtype"
+)
+
+type OidcLogin struct {
+	gtype.LoginFilter
+
+	RequestID string `json:"requestId" required:"true" note:"授权请求ID, 由登录页面提供"`
+}
+
+type OidcTotpLogin struct {
+	TotpLogin
+
+	RequestID string `json:"requestId" required:"true" note:"授权请求ID, 由登录页面提供"`
+}
+
+type OidcLoginResult struct {
+	TotpTicket  string `json:"totpTicket,omitempty" note:"两步验证票据, 不为空时须使用该票据提交验证码完成登录"`
+	RedirectUri string `json:"redirectUri,omitempty" note:"回调地址, 已包含授权码(code)及状态(state)"`
+}
+
+type OidcToken struct {
+	AccessToken string `json:"access_token" note:"访问凭证, 用于获取用户信息"`
+	TokenType   string `json:"token_type" note:"凭证类型, 固定为Bearer"`
+	ExpiresIn   int64  `json:"expires_in" note:"访问凭证有效期(秒)"`
+	IdToken     string `json:"id_token" note:"身份凭证"`
+	Scope       string `json:"scope,omitempty" note:"授权范围"`
+}
+
+type OidcError struct {
+	Error            string `json:"error" note:"错误代码, 如: invalid_request, invalid_client, invalid_grant"`
+	ErrorDescription string `json:"error_description,omitempty" note:"错误描述"`
+}
+
+type OidcUserInfo struct {
+	Subject           string   `json:"sub" note:"用户帐号"`
+	Name              string   `json:"name,omitempty" note:"用户姓名"`
+	PreferredUsername string   `json:"preferred_username" note:"用户帐号"`
+	Email             string   `json:"email,omitempty" note:"电子邮箱"`
+	Groups            []string `json:"groups" note:"所属组(包括嵌套)帐号"`
+}
+
+type OidcDiscovery struct {
+	Issuer                            string   `json:"issuer"`
+	AuthorizationEndpoint             string   `json:"authorization_endpoint"`
+	TokenEndpoint                     string   `json:"token_endpoint"`
+	UserInfoEndpoint                  string   `json:"userinfo_endpoint"`
+	JwksUri                           string   `json:"jwks_uri"`
+	ResponseTypesSupported            []string `json:"response_types_supported"`
+	GrantTypesSupported               []string `json:"grant_types_supported"`
+	SubjectTypesSupported             []string `json:"subject_types_supported"`
+	IdTokenSigningAlgValuesSupported  []string `json:"id_token_signing_alg_values_supported"`
+	ScopesSupported                   []string `json:"scopes_supported"`
+	TokenEndpointAuthMethodsSupported []string `json:"token_endpoint_auth_methods_supported"`
+	CodeChallengeMethodsSupported     []string `json:"code_challenge_methods_supported"`
+	ClaimsSupported                   []string `json:"claims_supported"`
+}
@@ -0,0 +1,10 @@
+package model
+
+import "github.com/csby/gwsf/gtype"
+
+type NtHash struct {
+	Account    string         `json:"account" note:"帐号"`
+	Hash       string         `json:"hash" note:"加密后的NT哈希"`
+	PwdLastSet string         `json:"pwdLastSet" note:"保存时AD中的密码修改时间(pwdLastSet)"`
+	UpdateTime gtype.DateTime `json:"updateTime" note:"保存时间"`
+}
@@ -0,0 +1,109 @@
+package model
+
+import (
+	"github.com/csby/gwsf/gtype"
+	"strings"
+	"time"
+)
+
+const (
+	AccessReviewByAuthorization = 1 // 由资源的授权管理员审核
+	AccessReviewByManager       = 2 // 由成员的直接主管审核
+)
+
+const (
+	AccessReviewCampaignActive    = 0 // 进行中
+	AccessReviewCampaignCompleted = 1 // 已完成
+)
+
+const (
+	AccessReviewPending      = 0 // 待审核
+	AccessReviewKeep         = 1 // 保留
+	AccessReviewRevoke       = 2 // 撤销
+	AccessReviewRevokeFailed = 3 // 撤销失败
+)
+
+type AccessReviewCampaignCreate struct {
+	Name      string `json:"name" required:"true" note:"名称"`
+	Reviewer  int    `json:"reviewer" note:"审核人: 1-资源的授权管理员(默认); 2-成员的直接主管"`
+	Resources []int  `json:"resources" note:"资源类型: 1-服务器; 2-共享目录; 3-SVN存储库, 为空时表示全部"`
+}
+
+type AccessReviewCampaignID struct {
+	ID string `json:"id" required:"true" note:"审核活动标识ID"`
+}
+
+type AccessReviewCampaign struct {
+	ID           string          `json:"id" note:"标识ID"`
+	Name         string          `json:"name" note:"名称"`
+	Reviewer     int             `json:"reviewer" note:"审核人: 1-资源的授权管理员; 2-成员的直接主管"`
+	Resources    []int           `json:"resources" note:"资源类型: 1-服务器; 2-共享目录; 3-SVN存储库, 为空时表示全部"`
+	Status       int             `json:"status" note:"状态: 0-进行中; 1-已完成"`
+	Total        int             `json:"total" note:"审核项总数"`
+	Pending      int             `json:"pending" note:"待审核数量"`
+	CreateBy     string          `json:"createBy" note:"发起人帐号"`
+	CreateTime   gtype.DateTime  `json:"createTime" note:"发起时间"`
+	CompleteBy   string          `json:"completeBy" note:"完成人帐号"`
+	CompleteTime *gtype.DateTime `json:"completeTime,omitempty" note:"完成时间"`
+}
+
+type AccessReviewCampaignCollection []*AccessReviewCampaign
+
+func (s AccessReviewCampaignCollection) Len() int      { return len(s) }
+func (s AccessReviewCampaignCollection) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+func (s AccessReviewCampaignCollection) Less(i, j int) bool {
+	return time.Time(s[i].CreateTime).After(time.Time(s[j].CreateTime))
+}
+
+type AccessReviewItemFilter struct {
+	CampaignID string `json:"campaignId" required:"true" note:"审核活动标识ID"`
+	Decision   int    `json:"decision" note:"审核结果: -1-全部; 0-待审核; 1-保留; 2-撤销; 3-撤销失败"`
+}
+
+type AccessReviewDecide struct {
+	CampaignID string   `json:"campaignId" required:"true" note:"审核活动标识ID"`
+	ItemIDs    []string `json:"itemIds" required:"true" note:"审核项标识ID"`
+	Decision   int      `json:"decision" required:"true" note:"审核结果: 1-保留; 2-撤销"`
+	Comment    string   `json:"comment" note:"审核意见"`
+}
+
+type AccessReviewItem struct {
+	ID         string          `json:"id" note:"标识ID"`
+	CampaignID string          `json:"campaignId" note:"审核活动标识ID"`
+	Resource   AdResource      `json:"resource" note:"资源"`
+	Group      AdRoleGroup     `json:"group" note:"角色组"`
+	Member     AdUser          `json:"member" note:"成员"`
+	Reviewers  []string        `json:"reviewers" note:"审核人帐号, 为空时仅管理员可审核"`
+	Decision   int             `json:"decision" note:"审核结果: 0-待审核; 1-保留; 2-撤销; 3-撤销失败"`
+	ReviewBy   string          `json:"reviewBy" note:"审核人帐号"`
+	ReviewTime *gtype.DateTime `json:"reviewTime,omitempty" note:"审核时间"`
+	Comment    string          `json:"comment" note:"审核意见"`
+	Error      string          `json:"error" note:"撤销失败时的错误信息"`
+}
+
+type AccessReviewItemCollection []*AccessReviewItem
+
+func (s AccessReviewItemCollection) Len() int      { return len(s) }
+func (s AccessReviewItemCollection) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+func (s AccessReviewItemCollection) Less(i, j int) bool {
+	if s[i].Resource.Type != s[j].Resource.Type {
+		return s[i].Resource.Type < s[j].Resource.Type
+	}
+	if s[i].Resource.Name != s[j].Resource.Name {
+		return strings.Compare(s[i].Resource.Name, s[j].Resource.Name) < 0
+	}
+	if s[i].Group.Account != s[j].Group.Account {
+		return strings.Compare(s[i].Group.Account, s[j].Group.Account) < 0
+	}
+
+	return strings.Compare(s[i].Member.Account, s[j].Member.Account) < 0
+}
+
+type AccessReviewReport struct {
+	Campaign AccessReviewCampaign `json:"campaign" note:"审核活动"`
+	Kept     int                  `json:"kept" note:"保留数量"`
+	Revoked  int                  `json:"revoked" note:"撤销数量"`
+	Failed   int                  `json:"failed" note:"撤销失败数量"`
+	Pending  int                  `json:"pending" note:"未审核数量"`
+	Items    []*AccessReviewItem  `json:"items" note:"审核项"`
+}
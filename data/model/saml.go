@@ -0,0 +1,27 @@
+package model
+
+import (
+	"github.com/csby/gwsf/gtype"
+)
+
+type SamlLogin struct {
+	gtype.LoginFilter
+
+	RequestID string `json:"requestId" required:"true" note:"认证请求ID, 由登录页面提供"`
+}
+
+type SamlTotpLogin struct {
+	TotpLogin
+
+	RequestID string `json:"requestId" required:"true" note:"认证请求ID, 由登录页面提供"`
+}
+
+type SamlLoginResult struct {
+	TotpTicket string    `json:"totpTicket,omitempty" note:"两步验证票据, 不为空时须使用该票据提交验证码完成登录"`
+	Form       *SamlForm `json:"form,omitempty" note:"提交至服务提供者的表单(HTTP-POST绑定), 由页面完成提交"`
+}
+
+type SamlForm struct {
+	Action string            `json:"action" note:"断言消费地址"`
+	Fields map[string]string `json:"fields" note:"表单字段: SAMLResponse-响应(base64); RelayState-状态, 原样返回"`
+}
@@ -0,0 +1,29 @@
+package model
+
+import "github.com/csby/gwsf/gtype"
+
+type AuthSession struct {
+	ID         string         `json:"id" note:"会话ID"`
+	Account    string         `json:"account" note:"用户帐号"`
+	Name       string         `json:"name" note:"用户姓名"`
+	LoginIP    string         `json:"loginIp" note:"登录IP"`
+	LoginTime  gtype.DateTime `json:"loginTime" note:"登录时间"`
+	ActiveTime gtype.DateTime `json:"activeTime" note:"最后活动时间"`
+	Connected  bool           `json:"connected" note:"是否已连接消息推送(websocket)"`
+	Current    bool           `json:"current" note:"是否为当前会话"`
+
+	Impersonator string `json:"impersonator,omitempty" note:"代理登录的管理员帐号, 为空表示本人登录"`
+}
+
+type AuthSessionFilter struct {
+	Account string `json:"account" note:"用户帐号, 为空表示全部用户"`
+}
+
+type AuthSessionRevoke struct {
+	ID string `json:"id" required:"true" note:"会话ID"`
+}
+
+type AuthSessionKill struct {
+	Account string `json:"account" required:"true" note:"用户帐号"`
+	ID      string `json:"id" note:"会话ID, 为空表示该用户的全部会话"`
+}
@@ -0,0 +1,67 @@
+package model
+
+import (
+	"github.com/csby/gwsf/gtype"
+)
+
+type AuthLogin struct {
+	gtype.Login
+
+	RefreshToken string `json:"refreshToken,omitempty" note:"刷新凭证, 仅启用JWT时签发, 每次刷新后旧凭证失效"`
+	ExpiresIn    int64  `json:"expiresIn,omitempty" note:"访问凭证有效期(秒), 仅启用JWT时有效"`
+
+	TotpTicket string `json:"totpTicket,omitempty" note:"两步验证票据, 不为空时未签发凭证, 须使用该票据提交验证码(/auth/ad/totp/login)完成登录"`
+	TotpEnroll bool   `json:"totpEnroll,omitempty" note:"是否须先绑定验证器(/auth/ad/totp/enroll), 强制两步验证但尚未启用时为true"`
+}
+
+type AuthCaptcha struct {
+	gtype.Captcha
+
+	RsaKeyID string `json:"rsaKeyId" note:"RSA公钥ID, 密钥轮换后旧公钥仍可在宽限期内使用"`
+}
+
+type AuthRefresh struct {
+	RefreshToken string `json:"refreshToken" required:"true" note:"刷新凭证"`
+}
+
+// AuthRefreshToken is saved with the hash of the refresh token as the key, the value is never saved
+type AuthRefreshToken struct {
+	SessionID  string          `json:"sessionId" note:"会话ID, 即登录凭证ID"`
+	Account    string          `json:"account" note:"用户帐号"`
+	Used       bool            `json:"used" note:"是否已使用"`
+	UseIP      string          `json:"useIp" note:"使用时的IP地址"`
+	UseTime    *gtype.DateTime `json:"useTime,omitempty" note:"使用时间"`
+	CreateTime gtype.DateTime  `json:"createTime" note:"签发时间"`
+	ExpireTime gtype.DateTime  `json:"expireTime" note:"过期时间"`
+}
+
+type Jwk struct {
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+}
+
+type Jwks struct {
+	Keys []*Jwk `json:"keys"`
+}
+
+const (
+	AuthLimitKindIP      = "ip"
+	AuthLimitKindAccount = "account"
+)
+
+type AuthLimitKey struct {
+	Kind      string          `json:"kind" note:"类型: ip-IP地址; account-用户帐号"`
+	Value     string          `json:"value" note:"IP地址或用户帐号"`
+	Failures  int             `json:"failures" note:"窗口内失败次数"`
+	LastTime  gtype.DateTime  `json:"lastTime" note:"最后失败时间"`
+	LockUntil *gtype.DateTime `json:"lockUntil,omitempty" note:"锁定截止时间, 未锁定时为空"`
+}
+
+type AuthLimitKeyFilter struct {
+	Kind  string `json:"kind" note:"类型: ip-IP地址; account-用户帐号; 为空表示全部"`
+	Value string `json:"value" note:"IP地址或用户帐号, 为空表示该类型的全部"`
+}
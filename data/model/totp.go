@@ -0,0 +1,52 @@
+package model
+
+import (
+	"github.com/csby/gwsf/gtype"
+)
+
+// TotpSecret is the two-factor authentication setting of an account, saved with the lower case account as the key
+type TotpSecret struct {
+	Account       string          `json:"account" note:"用户帐号"`
+	Secret        string          `json:"secret" note:"验证密钥(已加密)"`
+	Enabled       bool            `json:"enabled" note:"是否已启用, 绑定验证器并验证后启用"`
+	RecoveryCodes []string        `json:"recoveryCodes" note:"恢复码的哈希值, 使用后删除"`
+	LastStep      int64           `json:"lastStep" note:"最后使用的验证码时间步, 防止重放"`
+	CreateTime    gtype.DateTime  `json:"createTime" note:"创建时间"`
+	EnableTime    *gtype.DateTime `json:"enableTime,omitempty" note:"启用时间"`
+}
+
+type TotpStatus struct {
+	Enabled       bool `json:"enabled" note:"是否已启用"`
+	Required      bool `json:"required" note:"是否强制启用, 强制启用的用户不能停用"`
+	RecoveryCodes int  `json:"recoveryCodes" note:"剩余恢复码数量"`
+}
+
+type TotpTicket struct {
+	Ticket string `json:"ticket" note:"两步验证票据, 登录时返回, 5分钟内有效; 已登录时为空"`
+}
+
+type TotpLogin struct {
+	TotpTicket
+
+	Code string `json:"code" required:"true" note:"验证器应用中的6位验证码, 或恢复码"`
+}
+
+type TotpEnrollment struct {
+	Secret string `json:"secret" note:"验证密钥(base32), 用于手动输入"`
+	Uri    string `json:"uri" note:"配置地址(otpauth://), 用于生成二维码供验证器应用扫描"`
+}
+
+type TotpEnable struct {
+	TotpTicket
+
+	Code string `json:"code" required:"true" note:"验证器应用中的6位验证码"`
+}
+
+type TotpEnabled struct {
+	RecoveryCodes []string   `json:"recoveryCodes" note:"恢复码, 仅显示一次, 每个只能使用一次, 请妥善保存"`
+	Login         *AuthLogin `json:"login,omitempty" note:"登录凭证, 登录过程中启用时返回"`
+}
+
+type TotpCode struct {
+	Code string `json:"code" required:"true" note:"验证器应用中的6位验证码, 或恢复码"`
+}
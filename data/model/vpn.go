@@ -0,0 +1,81 @@
+package model
+
+import (
+	"github.com/csby/gwsf/gtype"
+	"time"
+)
+
+const (
+	VpnSourceApi   = 1 // 通过接口设置
+	VpnSourceGrant = 2 // 限时授权开始或结束
+	VpnSourceJob   = 3 // 入职或离职作业
+)
+
+const (
+	VpnGrantScheduled = 0 // 未开始
+	VpnGrantActive    = 1 // 生效中
+	VpnGrantEnded     = 2 // 已结束
+	VpnGrantCanceled  = 3 // 已取消
+)
+
+type VpnEvent struct {
+	ID       string         `json:"id" note:"标识ID"`
+	Account  string         `json:"account" note:"用户帐号"`
+	Enable   bool           `json:"enable" note:"true-启用; false-禁用"`
+	Source   int            `json:"source" note:"来源: 1-接口; 2-限时授权; 3-入职或离职作业"`
+	Operator string         `json:"operator" note:"操作人帐号"`
+	IP       string         `json:"ip" note:"操作人IP地址, 后台任务时为空"`
+	Reason   string         `json:"reason" note:"原因"`
+	Time     gtype.DateTime `json:"time" note:"变更时间"`
+}
+
+type VpnEventCollection []*VpnEvent
+
+func (s VpnEventCollection) Len() int      { return len(s) }
+func (s VpnEventCollection) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+func (s VpnEventCollection) Less(i, j int) bool {
+	return time.Time(s[i].Time).After(time.Time(s[j].Time))
+}
+
+type VpnEventFilter struct {
+	Account   string          `json:"account" note:"用户帐号, 为空时表示全部"`
+	StartTime *gtype.DateTime `json:"startTime" note:"开始时间"`
+	EndTime   *gtype.DateTime `json:"endTime" note:"结束时间"`
+}
+
+type VpnGrant struct {
+	ID         string         `json:"id" note:"标识ID"`
+	Account    string         `json:"account" note:"用户帐号"`
+	Name       string         `json:"name" note:"用户姓名"`
+	StartTime  gtype.DateTime `json:"startTime" note:"开始时间"`
+	EndTime    gtype.DateTime `json:"endTime" note:"结束时间"`
+	Reason     string         `json:"reason" note:"原因, 如: 出差"`
+	Status     int            `json:"status" note:"状态: 0-未开始; 1-生效中; 2-已结束; 3-已取消"`
+	Enabled    bool           `json:"enabled" note:"开始时VPN是否已启用, 已启用时结束后不禁用"`
+	CreateBy   string         `json:"createBy" note:"授权人帐号"`
+	CreateIP   string         `json:"createIp" note:"授权人IP地址"`
+	CreateTime gtype.DateTime `json:"createTime" note:"授权时间"`
+}
+
+type VpnGrantCollection []*VpnGrant
+
+func (s VpnGrantCollection) Len() int      { return len(s) }
+func (s VpnGrantCollection) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+func (s VpnGrantCollection) Less(i, j int) bool {
+	return time.Time(s[i].StartTime).Before(time.Time(s[j].StartTime))
+}
+
+type VpnGrantCreate struct {
+	Account   string         `json:"account" required:"true" note:"用户帐号"`
+	StartTime gtype.DateTime `json:"startTime" note:"开始时间, 为空或早于当前时间时立即开始"`
+	EndTime   gtype.DateTime `json:"endTime" required:"true" note:"结束时间"`
+	Reason    string         `json:"reason" required:"true" note:"原因, 如: 出差"`
+}
+
+type VpnGrantID struct {
+	ID string `json:"id" required:"true" note:"授权标识ID"`
+}
+
+type VpnGrantFilter struct {
+	Account string `json:"account" note:"用户帐号, 为空时表示全部"`
+}
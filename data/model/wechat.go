@@ -0,0 +1,61 @@
+package model
+
+import (
+	"encoding/xml"
+	"github.com/csby/gwsf/gtype"
+)
+
+const (
+	WechatMsgText  = "text"
+	WechatMsgEvent = "event"
+
+	WechatEventSubscribe   = "subscribe"
+	WechatEventUnsubscribe = "unsubscribe"
+	WechatEventScan        = "SCAN"
+
+	// WechatScenePrefix is the prefix of the event key of subscribe event by scanning a QR code with scene
+	WechatScenePrefix = "qrscene_"
+)
+
+type WechatQRCode struct {
+	State string      `json:"state" note:"状态, 用于连接等待扫码结果的websocket(/auth/wechat/socket?state=)"`
+	Page  interface{} `json:"page" note:"微信登录页面信息"`
+}
+
+type WechatBinding struct {
+	UnionID  string         `json:"unionId" note:"微信UnionID, 未关联开放平台时为空"`
+	OpenID   string         `json:"openId" note:"微信OpenID"`
+	Account  string         `json:"account" note:"绑定的域帐号"`
+	NickName string         `json:"nickName" note:"微信昵称"`
+	BindTime gtype.DateTime `json:"bindTime" note:"绑定时间"`
+}
+
+// Key returns the key of the binding in the database, the union id is preferred as it is the same for all apps
+func (s *WechatBinding) Key() string {
+	if len(s.UnionID) > 0 {
+		return s.UnionID
+	}
+
+	return s.OpenID
+}
+
+type WechatScan struct {
+	NickName string `json:"nickName" note:"微信昵称"`
+	Account  string `json:"account" note:"绑定的域帐号"`
+	Error    string `json:"error" note:"错误信息, 为空表示成功"`
+}
+
+// WechatMessage is the message (or event) pushed to the callback url by WeChat official account
+type WechatMessage struct {
+	XMLName      xml.Name `xml:"xml" json:"-"`
+	ToUserName   string   `xml:"ToUserName" json:"toUserName" note:"公众号原始ID"`
+	FromUserName string   `xml:"FromUserName" json:"fromUserName" note:"发送者OpenID"`
+	CreateTime   int64    `xml:"CreateTime" json:"createTime" note:"消息创建时间"`
+	MsgType      string   `xml:"MsgType" json:"msgType" note:"消息类型: text-文本; event-事件"`
+	MsgId        int64    `xml:"MsgId" json:"msgId" note:"消息ID, 事件无此字段"`
+	Content      string   `xml:"Content" json:"content" note:"文本消息内容"`
+	Event        string   `xml:"Event" json:"event" note:"事件类型: subscribe-关注; unsubscribe-取消关注; SCAN-已关注用户扫描带参数二维码"`
+	EventKey     string   `xml:"EventKey" json:"eventKey" note:"事件KEY值, 扫描带参数二维码时为场景值, 关注事件的场景值以qrscene_为前缀"`
+	Ticket       string   `xml:"Ticket" json:"ticket" note:"二维码的ticket"`
+	Encrypt      string   `xml:"Encrypt" json:"-"`
+}
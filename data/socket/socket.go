@@ -1,6 +1,61 @@
 package socket
 
+import (
+	"github.com/csby/gwsf/gtype"
+	"strings"
+)
+
 const (
 	WSUserLogin  = 1001 // 用户登陆
 	WSUserLogout = 1002 // 用户注销
+	WSUserKicked = 1003 // 用户被强制下线
+
+	WSAccessRequest       = 2001 // 权限申请待审批
+	WSAccessRequestResult = 2002 // 权限申请审批结果
+
+	WSGroupMemberExpiring = 2011 // 限时组成员即将到期
+	WSGroupMemberExpired  = 2012 // 限时组成员已到期移除
+
+	WSAccessReview         = 2021 // 访问权限审核待处理
+	WSAccessReviewComplete = 2022 // 访问权限审核活动已完成
+
+	WSOnboardingPassword = 2031 // 入职新用户的初始密码
+
+	WSWechatLogin   = 2041 // 微信扫码登录成功, 数据为登录凭证, 须两步验证时为票据(totpTicket)
+	WSWechatUnbound = 2042 // 微信扫码登录失败, 该微信未绑定帐号
+	WSWechatBind    = 2043 // 微信绑定结果
 )
+
+// Notice is the data of a message which should be sent to the specified accounts only
+type Notice struct {
+	Accounts []string
+	Data     interface{}
+
+	// Session limits the message to the channels of the session (the token id) if not empty
+	Session string
+
+	// Close closes the channels of the accounts after the message is sent
+	Close bool
+}
+
+func (s *Notice) Contains(account string) bool {
+	for _, item := range s.Accounts {
+		if strings.ToLower(item) == strings.ToLower(account) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Match returns true if the channel of the token should receive the message
+func (s *Notice) Match(token *gtype.Token) bool {
+	if token == nil {
+		return false
+	}
+	if len(s.Session) > 0 && s.Session != token.ID {
+		return false
+	}
+
+	return s.Contains(token.UserAccount)
+}
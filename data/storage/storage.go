@@ -0,0 +1,154 @@
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+	"go.etcd.io/bbolt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+func Open(filePath string) (*Storage, error) {
+	if len(filePath) < 1 {
+		return nil, fmt.Errorf("file path is empty")
+	}
+
+	fileFolder := filepath.Dir(filePath)
+	_, err := os.Stat(fileFolder)
+	if os.IsNotExist(err) {
+		os.MkdirAll(fileFolder, 0777)
+	}
+
+	db, err := bbolt.Open(filePath, 0600, &bbolt.Options{Timeout: 3 * time.Second})
+	if err != nil {
+		return nil, err
+	}
+
+	return &Storage{db: db}, nil
+}
+
+type Storage struct {
+	db *bbolt.DB
+}
+
+func (s *Storage) Close() error {
+	if s.db == nil {
+		return nil
+	}
+
+	return s.db.Close()
+}
+
+func (s *Storage) Put(bucket, key string, value interface{}) error {
+	if len(key) < 1 {
+		return fmt.Errorf("key is empty")
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+
+	return s.db.Update(func(tx *bbolt.Tx) error {
+		b, e := tx.CreateBucketIfNotExists([]byte(bucket))
+		if e != nil {
+			return e
+		}
+
+		return b.Put([]byte(key), data)
+	})
+}
+
+// Get reads the value of key into value, returns false if the key does not exist
+func (s *Storage) Get(bucket, key string, value interface{}) (bool, error) {
+	var data []byte
+	err := s.db.View(func(tx *bbolt.Tx) error {
+		b := tx.Bucket([]byte(bucket))
+		if b == nil {
+			return nil
+		}
+
+		v := b.Get([]byte(key))
+		if v != nil {
+			data = make([]byte, len(v))
+			copy(data, v)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return false, err
+	}
+	if data == nil {
+		return false, nil
+	}
+
+	err = json.Unmarshal(data, value)
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// Modify reads the value of key into value, calls modify and saves value back
+// in one transaction when modify returns nil
+func (s *Storage) Modify(bucket, key string, value interface{}, modify func(existed bool) error) error {
+	if len(key) < 1 {
+		return fmt.Errorf("key is empty")
+	}
+
+	return s.db.Update(func(tx *bbolt.Tx) error {
+		b, e := tx.CreateBucketIfNotExists([]byte(bucket))
+		if e != nil {
+			return e
+		}
+
+		existed := false
+		v := b.Get([]byte(key))
+		if v != nil {
+			e = json.Unmarshal(v, value)
+			if e != nil {
+				return e
+			}
+			existed = true
+		}
+
+		e = modify(existed)
+		if e != nil {
+			return e
+		}
+
+		data, e := json.Marshal(value)
+		if e != nil {
+			return e
+		}
+
+		return b.Put([]byte(key), data)
+	})
+}
+
+func (s *Storage) Delete(bucket, key string) error {
+	return s.db.Update(func(tx *bbolt.Tx) error {
+		b := tx.Bucket([]byte(bucket))
+		if b == nil {
+			return nil
+		}
+
+		return b.Delete([]byte(key))
+	})
+}
+
+// ForEach calls fn for every item of bucket in key order, stops when fn returns an error
+func (s *Storage) ForEach(bucket string, fn func(key string, value []byte) error) error {
+	return s.db.View(func(tx *bbolt.Tx) error {
+		b := tx.Bucket([]byte(bucket))
+		if b == nil {
+			return nil
+		}
+
+		return b.ForEach(func(k, v []byte) error {
+			return fn(string(k), v)
+		})
+	})
+}
@@ -0,0 +1,111 @@
+package storage
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+)
+
+type testItem struct {
+	Name  string `json:"name"`
+	Count int    `json:"count"`
+}
+
+func TestStorage_PutGet(t *testing.T) {
+	s, err := Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	item := &testItem{}
+	ok, err := s.Get("items", "a", item)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ok {
+		t.Fatal("item should not exist")
+	}
+
+	err = s.Put("items", "a", &testItem{Name: "a", Count: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ok, err = s.Get("items", "a", item)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ok || item.Name != "a" || item.Count != 1 {
+		t.Fatalf("invalid item: %#v", item)
+	}
+
+	err = s.Delete("items", "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ok, _ = s.Get("items", "a", item)
+	if ok {
+		t.Fatal("item should be deleted")
+	}
+}
+
+func TestStorage_Modify(t *testing.T) {
+	s, err := Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	for i := 0; i < 3; i++ {
+		item := &testItem{}
+		err = s.Modify("items", "a", item, func(existed bool) error {
+			if !existed {
+				item.Name = "a"
+			}
+			item.Count++
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	item := &testItem{}
+	err = s.Modify("items", "a", item, func(existed bool) error {
+		item.Count = 100
+		return fmt.Errorf("cancel")
+	})
+	if err == nil {
+		t.Fatal("error expected")
+	}
+
+	s.Get("items", "a", item)
+	if item.Count != 3 {
+		t.Fatalf("count: expect 3, actual %d", item.Count)
+	}
+}
+
+func TestStorage_ForEach(t *testing.T) {
+	s, err := Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	keys := []string{"c", "a", "b"}
+	for _, k := range keys {
+		s.Put("items", k, &testItem{Name: k})
+	}
+
+	result := ""
+	err = s.ForEach("items", func(key string, value []byte) error {
+		result += key
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result != "abc" {
+		t.Fatalf("order: expect abc, actual %s", result)
+	}
+}
@@ -0,0 +1,21 @@
+// Package storagetest provides the local storage for tests.
+package storagetest
+
+import (
+	"github.com/csby/goa/data/storage"
+	"path/filepath"
+	"testing"
+)
+
+// Open opens a storage in the temporary directory of the test, which is closed when the test finishes
+func Open(t testing.TB) *storage.Storage {
+	t.Helper()
+
+	dbs, err := storage.Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { dbs.Close() })
+
+	return dbs
+}
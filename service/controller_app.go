@@ -5,14 +5,20 @@ import (
 	"github.com/csby/goa/controller/ad"
 	"github.com/csby/goa/controller/auth"
 	"github.com/csby/goa/controller/dhcp"
+	"github.com/csby/goa/controller/job"
 	"github.com/csby/goa/controller/mail"
+	"github.com/csby/goa/controller/radius"
 	"github.com/csby/goa/controller/svn"
 	"github.com/csby/goa/controller/user"
+	"github.com/csby/goa/data/model"
 	"github.com/csby/gwsf/gtype"
+	"time"
 )
 
 type controllerApp struct {
 	authAd      *auth.Ad
+	authAuthz   *auth.Authz
+	authWechat  *auth.Wechat
 	userLogin   *user.Login
 	userNotify  *user.Notify
 	userAccount *user.Account
@@ -26,10 +32,22 @@ type controllerApp struct {
 
 	mailBlock *mail.Block
 
-	adUser   *ad.User
-	adGroup  *ad.Group
-	adServer *ad.Server
-	adShear  *ad.Share
+	adUser    *ad.User
+	adGroup   *ad.Group
+	adServer  *ad.Server
+	adShear   *ad.Share
+	adAccess  *ad.Access
+	adExpire  *ad.Expiration
+	adReview  *ad.Review
+	adMatrix  *ad.Matrix
+	adHistory *ad.History
+	adVpn     *ad.Vpn
+
+	jobJob         *job.Job
+	jobOffboarding *job.Offboarding
+	jobOnboarding  *job.Onboarding
+
+	radiusServer *radius.Server
 }
 
 func (s *controllerApp) initController(h *Handler) {
@@ -37,8 +55,15 @@ func (s *controllerApp) initController(h *Handler) {
 	param.Cfg = cfg
 	param.Tdb = h.tdb
 	param.WChs = h.wsc
+	param.Dbs = h.dbs
+	param.Signer = h.signer
+	param.Cache = controller.NewMembershipCache(s.membershipCacheTtl())
 
 	s.authAd = auth.NewAd(log, param)
+	s.authAd.Start()
+	s.authAuthz = auth.NewAuthz(log, param)
+	s.authWechat = auth.NewWechat(log, param)
+	s.authWechat.Authenticator = s.authAd
 	s.userLogin = user.NewLogin(log, param)
 	s.userNotify = user.NewNotify(log, param)
 	s.userAccount = user.NewAccount(log, param)
@@ -52,9 +77,26 @@ func (s *controllerApp) initController(h *Handler) {
 	s.adGroup = ad.NewGroup(log, param)
 	s.adServer = ad.NewServer(log, param)
 	s.adShear = ad.NewShare(log, param)
+	s.adAccess = ad.NewAccess(log, param)
+	s.adExpire = ad.NewExpiration(log, param)
+	s.adExpire.Start()
+	s.adReview = ad.NewReview(log, param)
+	s.adMatrix = ad.NewMatrix(log, param)
+	s.adHistory = ad.NewHistory(log, param)
+	s.adHistory.Start()
+	s.adVpn = ad.NewVpn(log, param)
+	s.adVpn.Start()
+	s.jobJob = job.NewJob(log, param)
+	s.jobOffboarding = job.NewOffboarding(log, param)
+	s.jobOnboarding = job.NewOnboarding(log, param)
+	s.radiusServer = radius.NewServer(log, param)
+	s.radiusServer.Authenticator = s.authAd
+	s.radiusServer.Start()
 }
 
 func (s *controllerApp) initRouter(router gtype.Router, path *gtype.Path, preHandle gtype.HttpHandle) {
+	preHandle = s.authAuthz.Authorize(path, preHandle, s.authzRules())
+
 	// 权限管理-AD
 	router.POST(path.Uri("/auth/ad/captcha").SetTokenUI(nil).SetTokenCreate(nil), nil,
 		s.authAd.GetCaptcha, s.authAd.GetCaptchaDoc)
@@ -62,6 +104,72 @@ func (s *controllerApp) initRouter(router gtype.Router, path *gtype.Path, preHan
 		s.authAd.Login, s.authAd.LoginDoc)
 	router.POST(path.Uri("/auth/ad/logout"), preHandle,
 		s.authAd.Logout, s.authAd.LogoutDoc)
+	router.POST(path.Uri("/auth/ad/refresh").SetTokenUI(nil).SetTokenCreate(nil), nil,
+		s.authAd.Refresh, s.authAd.RefreshDoc)
+	router.GET(path.Uri("/auth/ad/jwks").SetTokenUI(nil).SetTokenCreate(nil), nil,
+		s.authAd.GetJwks, s.authAd.GetJwksDoc)
+	router.POST(path.Uri("/auth/ad/totp/login").SetTokenUI(nil).SetTokenCreate(nil), nil,
+		s.authAd.TotpLogin, s.authAd.TotpLoginDoc)
+	router.POST(path.Uri("/auth/ad/totp/enroll").SetTokenUI(nil).SetTokenCreate(nil), nil,
+		s.authAd.TotpEnroll, s.authAd.TotpEnrollDoc)
+	router.POST(path.Uri("/auth/ad/totp/enable").SetTokenUI(nil).SetTokenCreate(nil), nil,
+		s.authAd.TotpEnable, s.authAd.TotpEnableDoc)
+	router.POST(path.Uri("/auth/ad/totp/disable"), preHandle,
+		s.authAd.TotpDisable, s.authAd.TotpDisableDoc)
+	router.POST(path.Uri("/auth/ad/totp/recovery/reset"), preHandle,
+		s.authAd.ResetTotpRecoveryCodes, s.authAd.ResetTotpRecoveryCodesDoc)
+	router.POST(path.Uri("/auth/ad/totp/status"), preHandle,
+		s.authAd.GetTotpStatus, s.authAd.GetTotpStatusDoc)
+	router.POST(path.Uri("/auth/ad/limit/list"), preHandle,
+		s.authAd.GetLimitKeys, s.authAd.GetLimitKeysDoc)
+	router.POST(path.Uri("/auth/ad/limit/clear"), preHandle,
+		s.authAd.ClearLimitKeys, s.authAd.ClearLimitKeysDoc)
+	router.POST(path.Uri("/auth/ad/session/list"), preHandle,
+		s.authAd.GetSessions, s.authAd.GetSessionsDoc)
+	router.POST(path.Uri("/auth/ad/session/revoke"), preHandle,
+		s.authAd.RevokeSession, s.authAd.RevokeSessionDoc)
+	router.POST(path.Uri("/auth/ad/session/user/list"), preHandle,
+		s.authAd.GetUserSessions, s.authAd.GetUserSessionsDoc)
+	router.POST(path.Uri("/auth/ad/session/user/kill"), preHandle,
+		s.authAd.KillUserSessions, s.authAd.KillUserSessionsDoc)
+	router.POST(path.Uri("/auth/ad/apikey/create"), preHandle,
+		s.authAd.CreateApiKey, s.authAd.CreateApiKeyDoc)
+	router.POST(path.Uri("/auth/ad/apikey/list"), preHandle,
+		s.authAd.GetApiKeys, s.authAd.GetApiKeysDoc)
+	router.POST(path.Uri("/auth/ad/apikey/delete"), preHandle,
+		s.authAd.DeleteApiKey, s.authAd.DeleteApiKeyDoc)
+	router.POST(path.Uri("/auth/ad/impersonate/start"), preHandle,
+		s.authAd.StartImpersonation, s.authAd.StartImpersonationDoc)
+	router.POST(path.Uri("/auth/ad/impersonate/stop"), preHandle,
+		s.authAd.StopImpersonation, s.authAd.StopImpersonationDoc)
+	router.POST(path.Uri("/auth/ad/audit/list"), preHandle,
+		s.authAd.GetAuditEvents, s.authAd.GetAuditEventsDoc)
+
+	// 权限管理-接口授权
+	router.POST(path.Uri("/auth/capability/list"), preHandle,
+		s.authAuthz.GetCapabilities, s.authAuthz.GetCapabilitiesDoc)
+	router.POST(path.Uri("/auth/cache/stats"), preHandle,
+		s.authAuthz.GetCacheStats, s.authAuthz.GetCacheStatsDoc)
+	router.POST(path.Uri("/auth/cache/clear"), preHandle,
+		s.authAuthz.ClearCache, s.authAuthz.ClearCacheDoc)
+
+	// 权限管理-微信
+	router.GET(path.Uri("/auth/wechat/url").SetTokenUI(nil).SetTokenCreate(nil), nil,
+		s.authWechat.VerifyUrl, s.authWechat.VerifyUrlDoc)
+	router.POST(path.Uri("/auth/wechat/url").SetTokenUI(nil).SetTokenCreate(nil), nil,
+		s.authWechat.Receive, s.authWechat.ReceiveDoc)
+	router.GET(path.Uri("/auth/wechat/code").SetTokenUI(nil).SetTokenCreate(nil), nil,
+		s.authWechat.Code, s.authWechat.CodeDoc)
+	router.POST(path.Uri("/auth/wechat/qrcode").SetTokenUI(nil).SetTokenCreate(nil), nil,
+		s.authWechat.GetQRCode, s.authWechat.GetQRCodeDoc)
+	router.GET(path.Uri("/auth/wechat/socket").SetTokenUI(nil).SetTokenCreate(nil).SetIsWebsocket(true), nil,
+		s.authWechat.Socket, s.authWechat.SocketDoc)
+	router.POST(path.Uri("/auth/wechat/bind/qrcode"), preHandle,
+		s.authWechat.GetBindQRCode, s.authWechat.GetBindQRCodeDoc)
+	router.POST(path.Uri("/auth/wechat/binding"), preHandle,
+		s.authWechat.GetBinding, s.authWechat.GetBindingDoc)
+	router.POST(path.Uri("/auth/wechat/unbind"), preHandle,
+		s.authWechat.Unbind, s.authWechat.UnbindDoc)
 
 	// 用户管理
 	router.POST(path.Uri("/user/login/account"), preHandle,
@@ -146,6 +254,14 @@ func (s *controllerApp) initRouter(router gtype.Router, path *gtype.Path, preHan
 		s.adUser.SetVpnEnable, s.adUser.SetVpnEnableDoc)
 	router.POST(path.Uri("/ad/user/vpn/enable/list"), preHandle,
 		s.adUser.GetVpnEnableList, s.adUser.GetVpnEnableListDoc)
+	router.POST(path.Uri("/ad/user/vpn/grant/create"), preHandle,
+		s.adVpn.CreateGrant, s.adVpn.CreateGrantDoc)
+	router.POST(path.Uri("/ad/user/vpn/grant/cancel"), preHandle,
+		s.adVpn.CancelGrant, s.adVpn.CancelGrantDoc)
+	router.POST(path.Uri("/ad/user/vpn/grant/list"), preHandle,
+		s.adVpn.GetGrants, s.adVpn.GetGrantsDoc)
+	router.POST(path.Uri("/ad/user/vpn/event/list"), preHandle,
+		s.adVpn.GetEvents, s.adVpn.GetEventsDoc)
 	// 域控-组
 	router.POST(path.Uri("/ad/group/user/list"), preHandle,
 		s.adGroup.GetUsers, s.adGroup.GetUsersDoc)
@@ -155,6 +271,16 @@ func (s *controllerApp) initRouter(router gtype.Router, path *gtype.Path, preHan
 		s.adGroup.AddMember, s.adGroup.AddMemberDoc)
 	router.POST(path.Uri("/ad/group/member/remove"), preHandle,
 		s.adGroup.RemoveMember, s.adGroup.RemoveMemberDoc)
+	router.POST(path.Uri("/ad/group/member/expiration/list"), preHandle,
+		s.adExpire.GetList, s.adExpire.GetListDoc)
+	router.POST(path.Uri("/ad/group/history/snapshot/create"), preHandle,
+		s.adHistory.CreateSnapshot, s.adHistory.CreateSnapshotDoc)
+	router.POST(path.Uri("/ad/group/history/snapshot/list"), preHandle,
+		s.adHistory.GetSnapshots, s.adHistory.GetSnapshotsDoc)
+	router.POST(path.Uri("/ad/group/history/diff"), preHandle,
+		s.adHistory.GetDiff, s.adHistory.GetDiffDoc)
+	router.POST(path.Uri("/ad/group/history/timeline"), preHandle,
+		s.adHistory.GetTimeline, s.adHistory.GetTimelineDoc)
 	// 域控-服务器
 	router.POST(path.Uri("/ad/server/list"), preHandle,
 		s.adServer.GetList, s.adServer.GetListDoc)
@@ -165,6 +291,128 @@ func (s *controllerApp) initRouter(router gtype.Router, path *gtype.Path, preHan
 		s.adShear.GetList, s.adShear.GetListDoc)
 	router.POST(path.Uri("/ad/share/add"), preHandle,
 		s.adShear.Add, s.adShear.AddDoc)
+	// 域控-权限申请
+	router.POST(path.Uri("/ad/access/request/add"), preHandle,
+		s.adAccess.CreateRequest, s.adAccess.CreateRequestDoc)
+	router.POST(path.Uri("/ad/access/request/list"), preHandle,
+		s.adAccess.GetRequests, s.adAccess.GetRequestsDoc)
+	router.POST(path.Uri("/ad/access/request/approve"), preHandle,
+		s.adAccess.Approve, s.adAccess.ApproveDoc)
+	router.POST(path.Uri("/ad/access/request/reject"), preHandle,
+		s.adAccess.Reject, s.adAccess.RejectDoc)
+	// 域控-权限审核
+	router.POST(path.Uri("/ad/access/review/campaign/start"), preHandle,
+		s.adReview.StartCampaign, s.adReview.StartCampaignDoc)
+	router.POST(path.Uri("/ad/access/review/campaign/list"), preHandle,
+		s.adReview.GetCampaigns, s.adReview.GetCampaignsDoc)
+	router.POST(path.Uri("/ad/access/review/campaign/complete"), preHandle,
+		s.adReview.CompleteCampaign, s.adReview.CompleteCampaignDoc)
+	router.POST(path.Uri("/ad/access/review/campaign/report"), preHandle,
+		s.adReview.GetReport, s.adReview.GetReportDoc)
+	router.POST(path.Uri("/ad/access/review/item/list"), preHandle,
+		s.adReview.GetItems, s.adReview.GetItemsDoc)
+	router.POST(path.Uri("/ad/access/review/item/decide"), preHandle,
+		s.adReview.Decide, s.adReview.DecideDoc)
+	// 域控-访问权限
+	router.POST(path.Uri("/ad/access/matrix/principal"), preHandle,
+		s.adMatrix.GetPrincipalAccess, s.adMatrix.GetPrincipalAccessDoc)
+	router.POST(path.Uri("/ad/access/matrix/resource"), preHandle,
+		s.adMatrix.GetResourceAccess, s.adMatrix.GetResourceAccessDoc)
+	router.POST(path.Uri("/ad/access/matrix/export"), preHandle,
+		s.adMatrix.Export, s.adMatrix.ExportDoc)
+
+	// 作业
+	router.POST(path.Uri("/job/list"), preHandle,
+		s.jobJob.GetList, s.jobJob.GetListDoc)
+	router.POST(path.Uri("/job/detail"), preHandle,
+		s.jobJob.GetDetail, s.jobJob.GetDetailDoc)
+	router.POST(path.Uri("/job/offboarding/start"), preHandle,
+		s.jobOffboarding.Start, s.jobOffboarding.StartDoc)
+	router.POST(path.Uri("/job/onboarding/start"), preHandle,
+		s.jobOnboarding.Start, s.jobOnboarding.StartDoc)
+}
+
+// membershipCacheTtl returns the ttl of the membership cache (config: ad.cache.expiration), 0 means disabled
+func (s *controllerApp) membershipCacheTtl() time.Duration {
+	seconds := int64(60)
+	if cfg != nil && cfg.Ad.Cache.Expiration != 0 {
+		seconds = cfg.Ad.Cache.Expiration
+	}
+	if seconds < 0 {
+		return 0
+	}
+
+	return time.Duration(seconds) * time.Second
+}
+
+// authzRules declares the roles which may call the routes, the routes not listed are open to all login users
+func (s *controllerApp) authzRules() []*auth.AuthzRule {
+	admin := []string{model.AuthRoleAdmin}
+	svnManager := []string{model.AuthRoleAdmin, model.AuthRoleRepository}
+
+	return []*auth.AuthzRule{
+		// 权限管理-AD
+		{Uri: "/auth/ad/limit/list", Roles: admin},
+		{Uri: "/auth/ad/limit/clear", Roles: admin},
+		{Uri: "/auth/ad/session/user/list", Roles: admin},
+		{Uri: "/auth/ad/session/user/kill", Roles: admin},
+		{Uri: "/auth/ad/apikey/create", Roles: admin},
+		{Uri: "/auth/ad/apikey/list", Roles: admin},
+		{Uri: "/auth/ad/apikey/delete", Roles: admin},
+		{Uri: "/auth/ad/impersonate/start", Roles: admin},
+		{Uri: "/auth/ad/audit/list", Roles: admin},
+
+		// 权限管理-接口授权
+		{Uri: "/auth/cache/stats", Roles: admin},
+		{Uri: "/auth/cache/clear", Roles: admin},
+
+		// 用户管理
+		{Uri: "/user/account/create", Roles: admin},
+
+		// DHCP-筛选器
+		{Uri: "/dhcp/filter/add", Roles: admin},
+		{Uri: "/dhcp/filter/del", Roles: admin},
+		{Uri: "/dhcp/filter/mod", Roles: admin},
+
+		// SVN
+		{Uri: "/svn/repository/add", Roles: admin},
+		{Uri: "/svn/permission/item/add", Roles: svnManager, Repository: "repository"},
+		{Uri: "/svn/permission/item/mod", Roles: svnManager, Repository: "repository"},
+		{Uri: "/svn/permission/item/del", Roles: svnManager, Repository: "repository"},
+
+		// 邮件
+		{Uri: "/mail/receiver/block/address/add", Roles: admin},
+		{Uri: "/mail/receiver/block/address/del", Roles: admin},
+		{Uri: "/mail/sender/block/address/add", Roles: admin},
+		{Uri: "/mail/sender/block/address/del", Roles: admin},
+
+		// 域控-用户
+		{Uri: "/ad/user/account/create", Roles: admin},
+		{Uri: "/ad/user/account/password/reset", Roles: admin},
+		{Uri: "/ad/user/vpn/enable/get", Roles: []string{model.AuthRoleAdmin, model.AuthRoleSelf}, Account: "account", AccountDefaultSelf: true},
+		{Uri: "/ad/user/vpn/enable/set", Roles: admin},
+		{Uri: "/ad/user/vpn/grant/create", Roles: admin},
+		{Uri: "/ad/user/vpn/grant/cancel", Roles: admin},
+		{Uri: "/ad/user/vpn/grant/list", Roles: []string{model.AuthRoleAdmin, model.AuthRoleSelf}, Account: "account", AccountDefaultSelf: true},
+		{Uri: "/ad/user/vpn/event/list", Roles: admin},
+		// 域控-组
+		{Uri: "/ad/group/member/add", Roles: []string{model.AuthRoleAdmin, model.AuthRoleAuthorization}, Group: "groupDn"},
+		{Uri: "/ad/group/member/remove", Roles: []string{model.AuthRoleAdmin, model.AuthRoleAuthorization}, Group: "groupDn"},
+		{Uri: "/ad/group/history/snapshot/create", Roles: admin},
+		// 域控-服务器/共享目录
+		{Uri: "/ad/server/add", Roles: admin},
+		{Uri: "/ad/share/add", Roles: admin},
+		// 域控-权限审核
+		{Uri: "/ad/access/review/campaign/start", Roles: admin},
+		{Uri: "/ad/access/review/campaign/complete", Roles: admin},
+		{Uri: "/ad/access/review/campaign/report", Roles: admin},
+
+		// 作业
+		{Uri: "/job/list", Roles: admin},
+		{Uri: "/job/detail", Roles: admin},
+		{Uri: "/job/offboarding/start", Roles: admin},
+		{Uri: "/job/onboarding/start", Roles: admin},
+	}
 }
 
 func (s *controllerApp) createTokenForAccountPassword() func(items []gtype.TokenAuth, ctx gtype.Context) (string, gtype.Error) {
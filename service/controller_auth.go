@@ -1,14 +1,63 @@
 package main
 
 import (
+	"github.com/csby/goa/controller"
+	"github.com/csby/goa/controller/auth"
 	"github.com/csby/gwsf/gtype"
 )
 
 type controllerAuth struct {
+	oidc *auth.Oidc
+	saml *auth.Saml
 }
 
 func (s *controllerAuth) initController(h *Handler) {
+	param := &controller.Parameter{}
+	param.Cfg = cfg
+	param.Tdb = h.tdb
+	param.WChs = h.wsc
+	param.Dbs = h.dbs
+	param.Signer = h.signer
+
+	s.oidc = auth.NewOidc(log, param)
+	s.oidc.Authenticator = h.ctrl.app.authAd
+
+	s.saml = auth.NewSaml(log, param)
+	s.saml.Authenticator = h.ctrl.app.authAd
 }
 
 func (s *controllerAuth) initRouter(router gtype.Router, path *gtype.Path, preHandle gtype.HttpHandle) {
+	// 单点登录(OIDC)
+	router.GET(path.Uri("/.well-known/openid-configuration"), nil,
+		s.oidc.GetDiscovery, s.oidc.GetDiscoveryDoc)
+	router.GET(path.Uri("/oidc/authorize"), nil,
+		s.oidc.Authorize, s.oidc.AuthorizeDoc)
+	router.POST(path.Uri("/oidc/captcha"), nil,
+		s.oidc.GetCaptcha, s.oidc.GetCaptchaDoc)
+	router.POST(path.Uri("/oidc/login"), nil,
+		s.oidc.Login, s.oidc.LoginDoc)
+	router.POST(path.Uri("/oidc/totp"), nil,
+		s.oidc.TotpLogin, s.oidc.TotpLoginDoc)
+	router.POST(path.Uri("/oidc/token"), nil,
+		s.oidc.Token, s.oidc.TokenDoc)
+	router.GET(path.Uri("/oidc/userinfo"), nil,
+		s.oidc.GetUserInfo, s.oidc.GetUserInfoDoc)
+	router.GET(path.Uri("/oidc/jwks"), nil,
+		s.oidc.GetJwks, s.oidc.GetJwksDoc)
+
+	// 单点登录(SAML)
+	router.GET(path.Uri("/saml/metadata"), nil,
+		s.saml.GetMetadata, s.saml.GetMetadataDoc)
+	router.GET(path.Uri("/saml/sso"), nil,
+		s.saml.SingleSignOn, s.saml.SingleSignOnDoc)
+	router.POST(path.Uri("/saml/sso"), nil,
+		s.saml.SingleSignOn, s.saml.SingleSignOnDoc)
+	router.GET(path.Uri("/saml/initiate"), nil,
+		s.saml.InitiateSignOn, s.saml.InitiateSignOnDoc)
+	router.POST(path.Uri("/saml/captcha"), nil,
+		s.saml.GetCaptcha, s.saml.GetCaptchaDoc)
+	router.POST(path.Uri("/saml/login"), nil,
+		s.saml.Login, s.saml.LoginDoc)
+	router.POST(path.Uri("/saml/totp"), nil,
+		s.saml.TotpLogin, s.saml.TotpLoginDoc)
 }
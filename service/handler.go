@@ -1,8 +1,12 @@
 package main
 
 import (
+	"encoding/hex"
 	"fmt"
+	"github.com/csby/goa/assist"
 	"github.com/csby/goa/config"
+	"github.com/csby/goa/controller"
+	"github.com/csby/goa/data/storage"
 	"github.com/csby/gwsf/gopt"
 	"github.com/csby/gwsf/gtype"
 	"net/http"
@@ -17,7 +21,37 @@ func NewHandler(log gtype.Log, cfg *config.Config) gtype.Handler {
 	if cfg != nil {
 		tokenExpiredMinutes = cfg.Site.Opt.Api.Token.Expiration
 	}
-	instance.tdb = gtype.NewTokenDatabase(tokenExpiredMinutes, "staff")
+
+	if cfg != nil {
+		dbs, err := storage.Open(cfg.Db.Path)
+		if err != nil {
+			instance.LogError("open local database fail: ", err)
+		} else {
+			instance.dbs = dbs
+		}
+	}
+
+	var tdb gtype.TokenDatabase
+	if cfg != nil && cfg.Db.Token.Persistent && instance.dbs != nil {
+		tdb = instance.newTokenStore(tokenExpiredMinutes, cfg.Db.Token.Key)
+	}
+	if tdb == nil {
+		tdb = gtype.NewTokenDatabase(tokenExpiredMinutes, "staff")
+	}
+	instance.tdb = controller.NewTokenDatabase(tdb)
+
+	if cfg != nil && cfg.Auth.Token.Jwt {
+		if instance.dbs == nil {
+			instance.LogError("jwt is disabled: local database is not available")
+		} else {
+			signer, err := controller.LoadTokenSigner(cfg.Auth.Token.Key.File, cfg.Auth.Token.Key.ID, cfg.Auth.Token.Issuer)
+			if err != nil {
+				instance.LogError("load token signing key fail: ", err)
+			} else {
+				instance.signer = signer
+			}
+		}
+	}
 
 	return instance
 }
@@ -28,7 +62,29 @@ type Handler struct {
 	ctrl controllers
 
 	wsc gtype.SocketChannelCollection
-	tdb gtype.TokenDatabase
+	tdb *controller.TokenDatabase
+	dbs *storage.Storage
+
+	signer *controller.TokenSigner
+}
+
+// newTokenStore returns nil if the key is invalid, then the tokens are kept in memory only
+func (s *Handler) newTokenStore(expiredMinutes int64, key string) gtype.TokenDatabase {
+	k, err := hex.DecodeString(key)
+	if err != nil {
+		s.LogError("token key is invalid: ", err)
+		return nil
+	}
+
+	store, err := controller.NewTokenStore(s.dbs, expiredMinutes, k, func() interface{} {
+		return &assist.AdEntryUser{}
+	})
+	if err != nil {
+		s.LogError("open token store fail: ", err)
+		return nil
+	}
+
+	return store
 }
 
 func (s *Handler) InitRouting(router gtype.Router) {
@@ -1,6 +1,8 @@
 package main
 
 import (
+	"crypto/rand"
+	"encoding/hex"
 	"fmt"
 	"github.com/csby/goa/config"
 	"github.com/csby/gwsf/gcfg"
@@ -116,6 +118,53 @@ func init() {
 		})
 	}
 
+	// init path of token signing key
+	if cfg.Auth.Token.Key.File == "" {
+		cfg.Auth.Token.Key.File = filepath.Join(rootFolder, "crt", "token.pem")
+	}
+
+	// init path of SAML assertion signing key and certificate
+	if cfg.Auth.Saml.Key.File == "" {
+		cfg.Auth.Saml.Key.File = filepath.Join(rootFolder, "crt", "saml.pem")
+	}
+	if cfg.Auth.Saml.Key.Cert == "" {
+		cfg.Auth.Saml.Key.Cert = filepath.Join(rootFolder, "crt", "saml.crt")
+	}
+
+	// init path and key of login password encryption key
+	if cfg.Auth.Rsa.File == "" {
+		cfg.Auth.Rsa.File = filepath.Join(rootFolder, "crt", "login.key")
+	}
+	if cfg.Auth.Rsa.Key == "" {
+		generateKey(cfgPath, "login rsa", func(c *config.Config, key string) {
+			c.Auth.Rsa.Key = key
+		})
+	}
+
+	// init key of two-factor authentication secrets
+	if cfg.Auth.Totp.Enabled && cfg.Auth.Totp.Key == "" {
+		generateKey(cfgPath, "totp", func(c *config.Config, key string) {
+			c.Auth.Totp.Key = key
+		})
+	}
+
+	// init key of nt hashes for ms-chapv2 of radius
+	if cfg.Radius.MsChap2.Enabled && cfg.Radius.MsChap2.Key == "" {
+		generateKey(cfgPath, "ms-chapv2", func(c *config.Config, key string) {
+			c.Radius.MsChap2.Key = key
+		})
+	}
+
+	// init path of local database
+	if cfg.Db.Path == "" {
+		cfg.Db.Path = filepath.Join(rootFolder, "data", fmt.Sprintf("%s.db", moduleName))
+	}
+	if cfg.Db.Token.Persistent && cfg.Db.Token.Key == "" {
+		generateKey(cfgPath, "token", func(c *config.Config, key string) {
+			c.Db.Token.Key = key
+		})
+	}
+
 	// init uri for dhcp filter api uri
 	if cfg.Dhcp.Api.Uri.Filter.List == "" {
 		cfg.Dhcp.Api.Uri.Filter.List = "/api/dhcp/filter/list"
@@ -195,5 +244,28 @@ func init() {
 	LogInfo("log path: ", cfg.Log.Folder)
 	LogInfo("log level: ", cfg.Log.Level)
 	LogInfo("configure path: ", cfgPath)
-	LogInfo("configure info: ", cfg)
+	LogInfo("configure info: ", cfg.MaskedString())
+}
+
+// generateKey generates a random key (32 bytes in hex) and sets it to the configure in use and the configure file,
+// the file is loaded again before saving, so that only the key is added to it but not the default paths computed at start
+func generateKey(cfgPath, name string, set func(c *config.Config, key string)) {
+	key := make([]byte, 32)
+	_, err := rand.Read(key)
+	if err != nil {
+		fmt.Println(fmt.Sprintf("generate %s key fail: ", name), err)
+		return
+	}
+	value := hex.EncodeToString(key)
+	set(cfg, value)
+
+	saved := config.NewConfig()
+	err = saved.LoadFromFile(cfgPath)
+	if err == nil {
+		set(saved, value)
+		err = saved.SaveToFile(cfgPath)
+	}
+	if err != nil {
+		fmt.Println(fmt.Sprintf("save %s key fail: ", name), err)
+	}
 }